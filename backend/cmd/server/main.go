@@ -1,24 +1,33 @@
 package main
 
 import (
-//	"fmt"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/admin"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/controllers"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/database"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/logging"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/metrics"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/ratelimit"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/routes"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/scanner"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -29,65 +38,285 @@ func main() {
 	if err := godotenv.Load("../.env"); err != nil {
 		// Fallback to backend/.env if root .env doesn't exist
 		if err := godotenv.Load(".env"); err != nil {
-			log.Printf("Warning: Error loading .env file: %v (using environment variables only)", err)
+			slog.Warn("no .env file loaded, using environment variables only", "error", err)
 		}
 	}
 
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+		fatal("failed to load config", err)
+	}
+	logFile, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		fatal("failed to initialize logging", err)
+	}
+	defer logFile.Close()
+
+	// SIGINT/SIGTERM cancel ctx, which starts the graceful shutdown below
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	tasks := services.NewBackgroundTasks()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		fatal("failed to initialize tracing", err)
 	}
 
 	if err := database.Connect(&cfg.Database); err != nil {
-		log.Fatalf("failed to connect database: %v", err)
+		fatal("failed to connect database", err)
 	}
 	defer func() {
 		if err := database.Close(); err != nil {
-			log.Printf("error closing database: %v", err)
+			slog.Error("closing database failed", "error", err)
 		}
 	}()
 
 	store, err := buildStorage(cfg)
 	if err != nil {
-		log.Fatalf("failed to initialize storage: %v", err)
+		fatal("failed to initialize storage", err)
+	}
+	storageBackend := storageBackendName(store)
+	// Health probes use the bare backend so they do not show up in the storage metrics
+	healthService := services.NewHealthService(database.GetDB(), store)
+	if version, err := database.LatestMigrationVersion(); err == nil {
+		healthService.SetExpectedSchemaVersion(version)
+	} else {
+		slog.Warn("migrations not found, readiness will not check the schema version", "error", err)
+	}
+
+	var metricsServer *http.Server
+	if cfg.Metrics.Enabled {
+		store = metrics.InstrumentStorage(store, storageBackend)
+		if sqlDB, err := database.GetDB().DB(); err == nil {
+			if err := metrics.RegisterDBStats(sqlDB); err != nil {
+				slog.Error("registering database pool metrics failed", "error", err)
+			}
+		}
+		metricsServer = metrics.NewServer(":" + strconv.Itoa(cfg.Metrics.Port))
+		go func() {
+			slog.Info("metrics listener started", "addr", metricsServer.Addr, "path", "/metrics")
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("metrics listener stopped", "error", err)
+			}
+		}()
+	}
+	if cfg.Tracing.Enabled() {
+		store = tracing.InstrumentStorage(store, storageBackend)
+		if err := tracing.InstrumentGORM(database.GetDB()); err != nil {
+			fatal("failed to instrument database queries", err)
+		}
+		slog.Info("tracing enabled", "exporter", cfg.Tracing.Exporter, "endpoint", cfg.Tracing.Endpoint)
 	}
 
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(database.GetDB())
 	loginSessionRepo := repositories.NewLoginSessionRepository(database.GetDB())
+	securityEventRepo := repositories.NewSecurityEventRepository(database.GetDB())
+	webAuthnCredentialRepo := repositories.NewWebAuthnCredentialRepository(database.GetDB())
+	webAuthnSessionRepo := repositories.NewWebAuthnSessionRepository(database.GetDB())
+	userIdentityRepo := repositories.NewUserIdentityRepository(database.GetDB())
+	oidcAuthRequestRepo := repositories.NewOIDCAuthRequestRepository(database.GetDB())
+	accessTokenRepo := repositories.NewPersonalAccessTokenRepository(database.GetDB())
+	signingKeyRepo := repositories.NewJWTSigningKeyRepository(database.GetDB())
 
 	// Initialize services
 	authService := services.NewAuthServiceWithLoginSessions(userRepo, loginSessionRepo, cfg)
+	authService.SetSecurityEventRepository(securityEventRepo)
+	keyManager, err := services.NewJWTKeyManager(cfg.JWT, signingKeyRepo,
+		services.NewAdvisoryLock(database.GetDB(), services.LockKeyJWTRotation))
+	if err != nil {
+		fatal("failed to initialize jwt signing keys", err)
+	}
+	authService.SetKeyManager(keyManager)
+	if keyManager.Asymmetric() {
+		tasks.Go(func() { rotateSigningKeys(ctx, keyManager) })
+	}
+	webAuthnService, err := services.NewWebAuthnService(cfg, userRepo, webAuthnCredentialRepo, webAuthnSessionRepo, loginSessionRepo)
+	if err != nil {
+		fatal("failed to initialize webauthn", err)
+	}
+	oidcService := services.NewOIDCService(cfg.OIDC, userRepo, userIdentityRepo, oidcAuthRequestRepo)
+	accessTokenService := services.NewPersonalAccessTokenService(accessTokenRepo, userRepo)
 	fileService := services.NewFileService(database.GetDB(), store)
+	fileService.SetAllowedMimeTypes(cfg.Storage.AllowedMimeTypes)
+	fileService.SetBackgroundTasks(tasks)
+	if cfg.Scanner.Enabled {
+		fileScanner, err := buildScanner(&cfg.Scanner)
+		if err != nil {
+			fatal("failed to initialize malware scanner", err)
+		}
+		fileService.SetScanner(fileScanner)
+		tasks.Go(func() { scanPendingFiles(ctx, fileService) })
+	}
 	statsService := services.NewStatisticsService(database.GetDB())
 	historyService := services.NewDownloadHistoryService(database.GetDB())
+	fileEventService := services.NewFileEventService(database.GetDB())
+	fileEventService.SetInternalOrigins(cfg.CORS.AllowedOrigins)
+	tasks.Go(func() { fileEventService.Run(ctx) })
+	abuseReportService := services.NewAbuseReportService(repositories.NewAbuseReportRepository(database.GetDB()), fileService)
+	abuseReportService.SetNotifier(services.NewNotifier(cfg.Email))
+	filePasswordService := services.NewFilePasswordService(repositories.NewFilePasswordAttemptRepository(database.GetDB()), keyManager)
+	filePasswordService.SetNotifier(services.NewNotifier(cfg.Email))
+	cleanupService, err := services.NewCleanupService(database.GetDB(), store, repositories.NewCleanupRunRepository(database.GetDB()),
+		services.NewAdvisoryLock(database.GetDB(), services.LockKeyCleanupRun), cfg.Cleanup)
+	if err != nil {
+		fatal("failed to initialize cleanup", err)
+	}
+	var cleanupScheduler *services.CronScheduler
+	if cfg.Cleanup.Cron != "" {
+		cleanupScheduler, err = services.NewCronScheduler("cleanup", cfg.Cleanup.Cron,
+			services.NewAdvisoryLock(database.GetDB(), services.LockKeyCleanupLeader), func(ctx context.Context) {
+				if _, err := cleanupService.Run(ctx, services.CleanupRequest{Trigger: models.CleanupTriggerSchedule}); err != nil && !errors.Is(err, services.ErrCleanupRunning) {
+					slog.ErrorContext(ctx, "scheduled cleanup failed", "error", err)
+				}
+			})
+		if err != nil {
+			fatal("failed to initialize cleanup scheduler", err)
+		}
+		cleanupScheduler.Start()
+	}
+
+	policyService := services.NewPolicyService(database.GetDB())
+	// Repairs share the cleanup run lock: cleanup deletes objects before their rows.
+	reconcileService := services.NewReconcileService(database.GetDB(), store, services.NewAdvisoryLock(database.GetDB(), services.LockKeyCleanupRun))
 
 	// Initialize controllers
 	authController := controllers.NewAuthController(authService)
+	authController.SetWebAuthnService(webAuthnService)
+	webAuthnController := controllers.NewWebAuthnController(webAuthnService, authService)
+	oidcController := controllers.NewOIDCController(oidcService, authService)
+	tokenController := controllers.NewPersonalAccessTokenController(accessTokenService)
+	healthController := controllers.NewHealthController(healthService)
 	fileController := controllers.NewFileController(fileService, statsService, historyService)
+	fileController.SetAbuseReportService(abuseReportService)
+	fileController.SetFilePasswordService(filePasswordService)
+	fileController.SetFileEventService(fileEventService)
+	fileController.SetFileAnalyticsService(services.NewFileAnalyticsService(database.GetDB()))
 
 	// Middlewares
-	authMiddleware := middleware.AuthMiddleware(cfg)
+	authMiddleware := middleware.AuthMiddleware(keyManager, userRepo, accessTokenService)
+	rateLimitStore, err := buildRateLimitStore(&cfg.RateLimit)
+	if err != nil {
+		fatal("failed to initialize rate limit store", err)
+	}
+	limiter := ratelimit.New(cfg.RateLimit, rateLimitStore)
+	limiter.SetIdentify(middleware.RequesterKey(keyManager))
 
 	// Setup router
-	router := gin.Default()
+	router := gin.New()
+	// Only the nginx front (and local/Docker networks) may set X-Forwarded-For / X-Real-IP
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		fatal("invalid trusted proxies", err)
+	}
+	router.Use(tracing.Middleware(), logging.RequestIDMiddleware(), logging.AccessLog(), logging.Recovery())
+	if cfg.Metrics.Enabled {
+		router.Use(metrics.Middleware())
+	}
 	router.Use(corsMiddleware(&cfg.CORS))
+	router.Use(limiter.Global())
 
 	// Application routes
-	routes.SetupRoutes(router, fileController, authController, authMiddleware)
+	routes.SetupRoutes(router, fileController, authController, webAuthnController, oidcController, tokenController, healthController, authMiddleware, limiter)
 
 	// Admin routes
-	admin.Setup(router, database.GetDB(), store)
+	admin.Setup(router, database.GetDB(), authMiddleware, fileService, cleanupService, reconcileService, policyService, abuseReportService, limiter)
 
 	// Start server using config
-	addr := cfg.Server.Host + ":" + strconv.Itoa(cfg.Server.Port)
-	log.Printf("Server running on %s (storage=%T)", addr, store)
+	srv, err := newHTTPServer(&cfg.Server, router)
+	if err != nil {
+		fatal("invalid server timeouts", err)
+	}
+	shutdownTimeout, err := cfg.Server.GetShutdownTimeout()
+	if err != nil {
+		fatal("invalid server shutdown timeout", err)
+	}
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", srv.Addr, "storage", storageBackend)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("failed to run server", err)
+		}
+	case <-ctx.Done():
+	}
+	stop() // a second signal kills the process immediately
 
-	if err := router.Run(addr); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("failed to run server: %v", err)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdown(shutdownCtx, srv, metricsServer, cleanupScheduler, tasks)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("flushing traces failed", "error", err)
 	}
+}
 
-	waitForShutdown()
+// newHTTPServer applies the configured timeouts; zero disables a timeout. File transfers
+// lift the read/write deadlines themselves (see controllers.extendTransferDeadlines).
+func newHTTPServer(cfg *config.ServerConfig, handler http.Handler) (*http.Server, error) {
+	readTimeout, err := cfg.GetReadTimeout()
+	if err != nil {
+		return nil, err
+	}
+	writeTimeout, err := cfg.GetWriteTimeout()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{
+		Addr:              cfg.Host + ":" + strconv.Itoa(cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       2 * time.Minute,
+	}, nil
+}
+
+// shutdown stops accepting requests and waits for in-flight ones, then stops the scheduler
+// and waits for background work, all within ctx. The database is closed afterwards by
+// main's deferred call, once nothing can use it any more.
+func shutdown(ctx context.Context, srv, metricsServer *http.Server, scheduler *services.CronScheduler, tasks *services.BackgroundTasks) {
+	slog.Info("shutting down server")
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("draining http connections failed, closing them", "error", err)
+		_ = srv.Close()
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			slog.Error("stopping metrics listener failed", "error", err)
+		}
+	}
+	if scheduler != nil {
+		scheduler.Stop()
+	}
+	if err := tasks.Wait(ctx); err != nil {
+		slog.Error("background tasks did not finish before the shutdown timeout", "error", err)
+	}
+	slog.Info("server stopped")
+}
+
+// fatal logs a startup failure and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// buildRateLimitStore returns the counter store selected by cfg.Store.
+func buildRateLimitStore(cfg *config.RateLimitConfig) (ratelimit.Store, error) {
+	switch cfg.Store {
+	case "", "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "postgres":
+		return ratelimit.NewPostgresStore(database.GetDB()), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.Store)
+	}
 }
 
 func buildStorage(cfg *config.Config) (storage.Storage, error) {
@@ -100,7 +329,7 @@ func buildStorage(cfg *config.Config) (storage.Storage, error) {
 			cfg.CloudStorage.PrivateContainer,
 		)
 		if err != nil {
-			log.Printf("Azure Blob init failed, falling back to LocalStorage: %v", err)
+			slog.Warn("azure blob init failed, falling back to local storage", "error", err)
 			basePath := cfg.Storage.Path
 			if basePath == "" {
 				basePath = "./storage/uploads"
@@ -117,11 +346,74 @@ func buildStorage(cfg *config.Config) (storage.Storage, error) {
 	return storage.NewLocalStorage(basePath), nil
 }
 
-func waitForShutdown() {
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
-	log.Println("Shutting down server...")
+// storageBackendName labels the backend in logs and metrics.
+func storageBackendName(store storage.Storage) string {
+	switch store.(type) {
+	case *storage.AzureBlobStorage:
+		return "azure_blob"
+	case *storage.LocalStorage:
+		return "local"
+	default:
+		return fmt.Sprintf("%T", store)
+	}
+}
+
+func buildScanner(scannerCfg *config.ScannerConfig) (scanner.Scanner, error) {
+	timeout, err := scannerCfg.GetTimeout()
+	if err != nil {
+		return nil, err
+	}
+	switch scannerCfg.Type {
+	case "", "clamav":
+		return scanner.NewClamAV(scannerCfg.Address, timeout)
+	default:
+		return nil, fmt.Errorf("unsupported scanner type %q", scannerCfg.Type)
+	}
+}
+
+// scanPendingFiles periodically scans uploads whose background scan never finished,
+// e.g. because the server restarted or clamd was down, until ctx is cancelled. A batch in
+// progress is finished rather than cancelled so no scan is recorded as failed.
+func scanPendingFiles(ctx context.Context, fileService *services.FileService) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		scanned, err := fileService.ScanPending(context.WithoutCancel(ctx), 5*time.Minute, 50)
+		if err != nil {
+			slog.Error("pending malware scan failed", "error", err)
+			continue
+		}
+		if scanned > 0 {
+			slog.Info("scanned pending files", "count", scanned)
+		}
+	}
+}
+
+// rotateSigningKeys periodically rotates the JWT signing key when it is due and picks up
+// keys rotated by other instances, until ctx is cancelled.
+func rotateSigningKeys(ctx context.Context, keyManager *services.JWTKeyManager) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rotated, err := keyManager.RotateIfDue(time.Now().UTC())
+		if err != nil {
+			slog.Error("jwt key rotation failed", "error", err)
+			continue
+		}
+		if rotated {
+			slog.Info("rotated jwt signing key", "algorithm", keyManager.Algorithm())
+		}
+	}
 }
 
 func corsMiddleware(corsCfg *config.CORSConfig) gin.HandlerFunc {
@@ -137,7 +429,8 @@ func corsMiddleware(corsCfg *config.CORSConfig) gin.HandlerFunc {
 			}
 			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Cron-Secret")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Cron-Secret, X-Request-ID, X-File-Password, X-Download-Grant, Range, If-Range, traceparent, tracestate")
+			c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, X-Download-Grant, X-Download-Grant-Expires, Accept-Ranges, Content-Range")
 			
 			if c.Request.Method == "OPTIONS" {
 				c.AbortWithStatus(204)
@@ -158,9 +451,9 @@ func corsMiddleware(corsCfg *config.CORSConfig) gin.HandlerFunc {
 			}
 			// Debug logging: log when origin doesn't match
 			if !allowed && origin != "" {
-				log.Printf("[CORS] Origin '%s' not in allowed list: %v", origin, corsCfg.AllowedOrigins)
+				slog.Warn("cors origin not allowed", "origin", origin, "allowed", corsCfg.AllowedOrigins)
 			} else if allowed {
-				log.Printf("[CORS] Origin '%s' matched, allowing request", origin)
+				slog.Debug("cors origin allowed", "origin", origin)
 			}
 		} else {
 			allowed = true
@@ -172,7 +465,8 @@ func corsMiddleware(corsCfg *config.CORSConfig) gin.HandlerFunc {
 		}
 		
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Cron-Secret")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Cron-Secret, X-Request-ID, X-File-Password, X-Download-Grant, Range, If-Range, traceparent, tracestate")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, X-Download-Grant, X-Download-Grant-Expires, Accept-Ranges, Content-Range")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
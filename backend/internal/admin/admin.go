@@ -1,49 +1,79 @@
 package admin
 
 import (
-	"log"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
-	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/ratelimit"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
 )
 
-// Rate limiting state
-var (
-	cleanupRateMutex            sync.Mutex
-	cleanupWindowStart          time.Time
-	cleanupRequestCount         int
-	cleanupWindowDuration       = time.Minute
-	cleanupMaxRequestsPerWindow = 10
-)
+// cleanupRateLimit caps manual cleanup runs across all callers, whoever triggers them.
+var cleanupRateLimit = ratelimit.Rule{
+	Name:   "cleanup",
+	Limit:  10,
+	Window: time.Minute,
+	Key:    func(c *gin.Context) string { return "global" },
+}
 
 //########################
 //## 0. SETUP MODULE   ###
 //########################
-func Setup(router *gin.Engine, db *gorm.DB, store storage.Storage) {
+
+// Setup registers /api/admin/*. Staff users authenticate with their normal access token
+// (authMiddleware) and each endpoint requires a permission of their role (see
+// models.RolePermissions). ADMIN_API_TOKEN and X-Cron-Secret are only accepted for
+// bootstrapping the first admin and for cleanup.
+func Setup(router *gin.Engine, db *gorm.DB, authMiddleware gin.HandlerFunc, fileService *services.FileService, cleanup *services.CleanupService, reconcile *services.ReconcileService, policies *services.PolicyService, abuseReports *services.AbuseReportService, limits *ratelimit.Limiter) {
 	// 1. Ensure DB has default policy
 	ensure_policy_exists(db)
 
 	admin := router.Group("/api/admin")
-	admin.Use(admin_auth_middleware())
+	admin.Use(admin_auth_middleware(authMiddleware))
 	{
-		admin.GET("/policy", get_policy(db))
-		admin.PATCH("/policy", update_policy(db))
-		admin.POST("/cleanup", cleanup_files(db, store))
+		admin.GET("/policy", require_permission(models.PermissionPolicyRead), get_policy(db))
+		admin.PATCH("/policy", require_permission(models.PermissionPolicyWrite), update_policy(db, policies))
+		admin.GET("/policy/history", require_permission(models.PermissionPolicyRead), list_policy_history(policies))
+		admin.POST("/policy/history/:id/rollback", require_permission(models.PermissionPolicyWrite), rollback_policy(db, policies))
+		admin.GET("/policy/overrides", require_permission(models.PermissionPolicyRead), list_policy_overrides(policies))
+		admin.PUT("/policy/overrides/:audience", require_permission(models.PermissionPolicyWrite), set_policy_override(db, policies))
+		admin.DELETE("/policy/overrides/:audience", require_permission(models.PermissionPolicyWrite), delete_policy_override(db, policies))
+		admin.POST("/cleanup", require_permission(models.PermissionCleanupRun), limits.Limit(cleanupRateLimit), cleanup_files(db, cleanup))
+		admin.GET("/cleanup/runs", require_permission(models.PermissionCleanupRun), list_cleanup_runs(cleanup))
+		admin.GET("/cleanup/runs/:id", require_permission(models.PermissionCleanupRun), get_cleanup_run(cleanup))
+		admin.GET("/cleanup/runs/:id/files", require_permission(models.PermissionCleanupRun), list_cleanup_run_files(cleanup))
+		admin.POST("/storage/reconcile", require_permission(models.PermissionStorageReconcile), reconcile_storage(db, reconcile))
+		admin.POST("/bootstrap", require_permission(models.PermissionAdminBootstrap), bootstrap_admin(db))
+		admin.GET("/audit-log", require_permission(models.PermissionAuditRead), list_audit_log(db))
 	}
+	register_user_routes(admin, db)
+	register_file_routes(admin, db, fileService)
+	register_report_routes(admin, db, abuseReports)
 }
 
 //########################
 //## 1. AUTH MIDDLEWARE ##
 //########################
-func admin_auth_middleware() gin.HandlerFunc {
+
+// machinePermissions limits what the shared secrets can do; everything else needs a staff user.
+var machinePermissions = map[string][]models.Permission{
+	models.AdminActorToken: {models.PermissionAdminBootstrap, models.PermissionCleanupRun},
+	models.AdminActorCron:  {models.PermissionCleanupRun},
+}
+
+func admin_auth_middleware(authMiddleware gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Let OPTIONS through without auth (CORS preflight)
 		if c.Request.Method == "OPTIONS" {
@@ -51,60 +81,54 @@ func admin_auth_middleware() gin.HandlerFunc {
 			return
 		}
 
-		path := c.FullPath()
-		if path == "" {
-			path = c.Request.URL.Path
-		}
-
-		envToken := os.Getenv("ADMIN_API_TOKEN")
-		if envToken == "" {
-			log.Println("[Admin] ❌ ADMIN_API_TOKEN is not set in .env. Admin API is disabled.")
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin API configuration missing"})
+		cronSecretHeader := c.GetHeader("X-Cron-Secret")
+		envSecret := os.Getenv("CLEANUP_SECRET")
+		if cronSecretHeader != "" && envSecret != "" && secure_equal(cronSecretHeader, envSecret) {
+			c.Set("adminAuth", models.AdminActorCron)
+			c.Next()
 			return
 		}
 
+		envToken := os.Getenv("ADMIN_API_TOKEN")
 		authHeader := c.GetHeader("Authorization")
-		
-		if strings.HasPrefix(path, "/admin/cleanup") {
-			cronSecretHeader := c.GetHeader("X-Cron-Secret")
-			envSecret := os.Getenv("CLEANUP_SECRET")
-			if cronSecretHeader != "" && envSecret != "" && cronSecretHeader == envSecret {
-				c.Set("adminAuth", "cron")
-				c.Next()
-				return
-			}
-		}
-
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Bearer token is required",
-			})
+		if envToken != "" && strings.HasPrefix(authHeader, "Bearer ") && secure_equal(strings.TrimPrefix(authHeader, "Bearer "), envToken) {
+			c.Set("adminAuth", models.AdminActorToken)
+			c.Next()
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Invalid token format. Use 'Bearer <token>'",
-			})
-			return
-		}
+		// Staff users: normal JWT validation, then role checks per endpoint
+		c.Set("adminAuth", models.AdminActorUser)
+		authMiddleware(c)
+	}
+}
 
-		if parts[1] != envToken {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Invalid Admin Token",
-			})
+func require_permission(perm models.Permission) gin.HandlerFunc {
+	userCheck := middleware.RequirePermission(perm)
+	return func(c *gin.Context) {
+		actor := c.GetString("adminAuth")
+		if actor == models.AdminActorUser {
+			userCheck(c)
 			return
 		}
 
-		c.Set("adminAuth", "token")
-		c.Next()
+		for _, granted := range machinePermissions[actor] {
+			if granted == perm {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": "ADMIN_API_TOKEN and X-Cron-Secret can only be used for bootstrap and cleanup. Sign in with a staff account.",
+		})
 	}
 }
 
+func secure_equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
 //########################
 //## 2. GET POLICY     ###
 //########################
@@ -125,17 +149,9 @@ func get_policy(db *gorm.DB) gin.HandlerFunc {
 //########################
 //## 3. UPDATE POLICY  ###
 //########################
-func update_policy(db *gorm.DB) gin.HandlerFunc {
+func update_policy(db *gorm.DB, policies *services.PolicyService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		type policyUpdateRequest struct {
-			MaxFileSizeMB            *int `json:"maxFileSizeMB"`
-			MinValidityHours         *int `json:"minValidityHours"`
-			MaxValidityDays          *int `json:"maxValidityDays"`
-			DefaultValidityDays      *int `json:"defaultValidityDays"`
-			RequirePasswordMinLength *int `json:"requirePasswordMinLength"`
-		}
-
-		var input policyUpdateRequest
+		var input policy_settings_request
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "Validation error",
@@ -144,97 +160,260 @@ func update_policy(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Validation logic preserved...
-		if input.MaxFileSizeMB != nil && *input.MaxFileSizeMB < 1 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "maxFileSizeMB must be >= 1"})
+		settings, msg := input.settings()
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": msg})
 			return
 		}
 
-		updates := map[string]interface{}{}
-		if input.MaxFileSizeMB != nil { updates["max_file_size_mb"] = *input.MaxFileSizeMB }
-		if input.MinValidityHours != nil { updates["min_validity_hours"] = *input.MinValidityHours }
-		if input.MaxValidityDays != nil { updates["max_validity_days"] = *input.MaxValidityDays }
-		if input.DefaultValidityDays != nil { updates["default_validity_days"] = *input.DefaultValidityDays }
-		if input.RequirePasswordMinLength != nil { updates["require_password_min_length"] = *input.RequirePasswordMinLength }
+		if input.CleanupGraceHours != nil {
+			if *input.CleanupGraceHours < 0 || *input.CleanupGraceHours > 24*365 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "cleanupGraceHours must be between 0 and 8760"})
+				return
+			}
+		}
+
+		if input.ScanDownloadPolicy != nil {
+			switch *input.ScanDownloadPolicy {
+			case models.ScanPolicyRequireClean, models.ScanPolicyBlockInfected:
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "scanDownloadPolicy must be require_clean or block_infected"})
+				return
+			}
+		}
 
-		if len(updates) == 0 {
+		if settings.IsEmpty() && input.CleanupGraceHours == nil && input.ScanDownloadPolicy == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "No fields provided"})
 			return
 		}
 
-		if err := db.Model(&models.SystemPolicy{ID: 1}).Updates(updates).Error; err != nil {
+		// Every change is kept in policy_changes with before/after snapshots for rollback
+		updated, change, err := policies.UpdateSystem(c.Request.Context(), policy_actor(c), func(p *models.SystemPolicy) error {
+			settings.ApplyTo(p)
+			if input.CleanupGraceHours != nil {
+				p.CleanupGraceHours = *input.CleanupGraceHours
+			}
+			if input.ScanDownloadPolicy != nil {
+				p.ScanDownloadPolicy = *input.ScanDownloadPolicy
+			}
+			return nil
+		})
+		if errors.Is(err, services.ErrPolicyUnchanged) {
+			var current models.SystemPolicy
+			db.First(&current, 1)
+			c.JSON(http.StatusOK, gin.H{"message": "Policy unchanged", "policy": current})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
 			return
 		}
 
-		var updated models.SystemPolicy
-		db.First(&updated, 1)
-		c.JSON(http.StatusOK, gin.H{"message": "Policy updated", "policy": updated})
+		record_action(db, c, "policy.update", "policy", "1", gin.H{"changeId": change.ID, "diff": json.RawMessage(change.Diff)})
+		c.JSON(http.StatusOK, gin.H{"message": "Policy updated", "policy": updated, "changeId": change.ID})
 	}
 }
 
+// policy_settings_request is the body of PATCH /policy and PUT /policy/overrides/:audience.
+// Scan and cleanup settings are deployment-wide and ignored for overrides.
+type policy_settings_request struct {
+	MaxFileSizeMB            *int      `json:"maxFileSizeMB"`
+	MinValidityHours         *int      `json:"minValidityHours"`
+	MaxValidityDays          *int      `json:"maxValidityDays"`
+	DefaultValidityDays      *int      `json:"defaultValidityDays"`
+	RequirePasswordMinLength *int      `json:"requirePasswordMinLength"`
+	AllowedMimeTypes         *[]string `json:"allowedMimeTypes"`
+	BlockedMimeTypes         *[]string `json:"blockedMimeTypes"`
+	BlockedExtensions        *[]string `json:"blockedExtensions"`
+	ScanDownloadPolicy       *string   `json:"scanDownloadPolicy"`
+	CleanupGraceHours        *int      `json:"cleanupGraceHours"`
+}
+
+// settings validates the limits and upload type rules, returning a message on failure.
+func (in *policy_settings_request) settings() (models.PolicySettings, string) {
+	settings := models.PolicySettings{
+		MaxFileSizeMB:            in.MaxFileSizeMB,
+		MinValidityHours:         in.MinValidityHours,
+		MaxValidityDays:          in.MaxValidityDays,
+		DefaultValidityDays:      in.DefaultValidityDays,
+		RequirePasswordMinLength: in.RequirePasswordMinLength,
+	}
+
+	limits := []struct {
+		field string
+		value *int
+		min   int
+	}{
+		{"maxFileSizeMB", in.MaxFileSizeMB, 1},
+		{"minValidityHours", in.MinValidityHours, 1},
+		{"maxValidityDays", in.MaxValidityDays, 1},
+		{"defaultValidityDays", in.DefaultValidityDays, 1},
+		{"requirePasswordMinLength", in.RequirePasswordMinLength, 4},
+	}
+	for _, limit := range limits {
+		if limit.value != nil && *limit.value < limit.min {
+			return settings, limit.field + " must be >= " + strconv.Itoa(limit.min)
+		}
+	}
+
+	// Upload type rules: MIME patterns ("*", "image/*", "application/pdf") and ".ext" extensions
+	typeRules := []struct {
+		field   string
+		list    *[]string
+		target  **models.StringArray
+		valid   func(string) bool
+		example string
+	}{
+		{"allowedMimeTypes", in.AllowedMimeTypes, &settings.AllowedMimeTypes, services.ValidMimePattern, `"type/subtype", "type/*" or "*"`},
+		{"blockedMimeTypes", in.BlockedMimeTypes, &settings.BlockedMimeTypes, services.ValidMimePattern, `"type/subtype", "type/*" or "*"`},
+		{"blockedExtensions", in.BlockedExtensions, &settings.BlockedExtensions, services.ValidExtension, `".exe"`},
+	}
+	for _, rule := range typeRules {
+		if rule.list == nil {
+			continue
+		}
+		normalized, ok := normalize_list(*rule.list, rule.valid)
+		if !ok {
+			return settings, rule.field + " entries must look like " + rule.example
+		}
+		*rule.target = &normalized
+	}
+	return settings, ""
+}
+
+// normalize_list lowercases and de-duplicates entries, rejecting any that fail valid.
+func normalize_list(list []string, valid func(string) bool) (models.StringArray, bool) {
+	normalized := models.StringArray{}
+	seen := map[string]bool{}
+	for _, item := range list {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if !valid(item) {
+			return nil, false
+		}
+		if !seen[item] {
+			seen[item] = true
+			normalized = append(normalized, item)
+		}
+	}
+	return normalized, true
+}
+
 //########################
 //## 4. CLEANUP FILES  ###
 //########################
-func cleanup_files(db *gorm.DB, store storage.Storage) gin.HandlerFunc {
+func cleanup_files(db *gorm.DB, cleanup *services.CleanupService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !allowCleanupRequest() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Too many requests",
-				"message": "Cleanup endpoint is rate limited.",
-			})
+		// ?dryRun=true only lists what would be deleted
+		dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "dryRun must be true or false"})
+			return
+		}
+
+		// Same code path as the in-process scheduler; the run lock keeps them from overlapping
+		run, err := cleanup.Run(c.Request.Context(), services.CleanupRequest{
+			Trigger:     models.CleanupTriggerManual,
+			TriggeredBy: actor_id(c),
+			DryRun:      dryRun,
+		})
+		if errors.Is(err, services.ErrCleanupRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "A cleanup run is already in progress"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "cleanup failed", "component", "admin", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Cleanup failed"})
+			return
+		}
+
+		action, message := "cleanup.run", "Cleanup complete"
+		if dryRun {
+			action, message = "cleanup.dry_run", "Dry run complete, nothing was deleted"
+		}
+		record_action(db, c, action, "cleanup_run", run.ID.String(), gin.H{
+			"files_found":     run.FilesFound,
+			"files_deleted":   run.FilesDeleted,
+			"files_failed":    run.FilesFailed,
+			"bytes_reclaimed": run.BytesReclaimed,
+		})
+
+		// The first page of per-file results; the rest via GET /cleanup/runs/:id/files
+		files, total, err := cleanup.ListRunFiles(run.ID, "", 100, 0)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "listing cleanup results failed", "component", "admin", "run_id", run.ID, "error", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":         message,
+			"runId":           run.ID,
+			"dryRun":          run.DryRun,
+			"status":          run.Status,
+			"graceHours":      run.GraceHours,
+			"files_found":     run.FilesFound,
+			"files_deleted":   run.FilesDeleted,
+			"files_failed":    run.FilesFailed,
+			"files_skipped":   run.FilesSkipped,
+			"bytes_reclaimed": run.BytesReclaimed,
+			"files":           files,
+			"files_total":     total,
+			"timestamp":       run.StartedAt.Format(time.RFC3339),
+		})
+	}
+}
+
+//########################
+//## 5. BOOTSTRAP ADMIN ##
+//########################
+
+// bootstrap_admin promotes an existing account to admin with ADMIN_API_TOKEN. It only works
+// while no admin exists; afterwards roles are managed by admins themselves.
+func bootstrap_admin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" binding:"required,email"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "A valid email is required"})
 			return
 		}
 
-		startTime := time.Now().UTC()
-		var expiredFiles []models.File
-		
-		// Find expired files
-		if err := db.Where("available_to < ?", time.Now()).Find(&expiredFiles).Error; err != nil {
-			log.Printf("[Admin] error querying expired files: %v", err)
+		var admins int64
+		if err := db.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
 			return
 		}
+		if admins > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "An admin already exists. Ask an admin to change roles."})
+			return
+		}
 
-		deletedCount := 0
-		for _, file := range expiredFiles {
-			// Determine container
-			container := storage.ContainerPrivate
-			if file.IsPublic != nil && *file.IsPublic {
-				container = storage.ContainerPublic
-			}
+		var user models.User
+		if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "No account with this email"})
+			return
+		}
 
-			// Delete from Storage
-			loc := &storage.Location{Container: container, Path: file.FilePath}
-			err := store.Delete(c.Request.Context(), loc)
-
-			// Delete from DB if storage delete OK or file missing
-			if err == nil {
-				if err := db.Delete(&file).Error; err == nil {
-					deletedCount++
-				}
-			} else {
-				log.Printf("[Admin] failed to delete storage file %s: %v", file.ID, err)
-			}
+		if err := db.Model(&user).Update("role", models.RoleAdmin).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
 		}
 
+		record_action(db, c, "admin.bootstrap", "user", user.ID.String(), gin.H{"email": user.Email})
 		c.JSON(http.StatusOK, gin.H{
-			"message":      "Cleanup complete",
-			"files_found":  len(expiredFiles),
-			"files_deleted": deletedCount,
-			"timestamp":    startTime.Format(time.RFC3339),
+			"message": "User promoted to admin",
+			"user":    gin.H{"id": user.ID, "email": user.Email, "role": models.RoleAdmin},
 		})
 	}
 }
 
 //########################
-//## 5. INIT HELPERS   ###
+//## 6. INIT HELPERS   ###
 //########################
 func ensure_policy_exists(db *gorm.DB) {
 	var count int64
 	db.Model(&models.SystemPolicy{}).Where("id = ?", 1).Count(&count)
 	if count == 0 {
-		log.Println("[Admin] Initializing Default System Policy...")
+		slog.Info("initializing default system policy", "component", "admin")
 		defaultPolicy := models.SystemPolicy{
 			ID:                       1,
 			MaxFileSizeMB:            50,
@@ -242,24 +421,10 @@ func ensure_policy_exists(db *gorm.DB) {
 			MaxValidityDays:          30,
 			DefaultValidityDays:      7,
 			RequirePasswordMinLength: 8,
+			BlockedMimeTypes:         models.DefaultBlockedMimeTypes,
+			BlockedExtensions:        models.DefaultBlockedExtensions,
+			ScanDownloadPolicy:       models.ScanPolicyRequireClean,
 		}
 		db.Create(&defaultPolicy)
 	}
 }
-
-func allowCleanupRequest() bool {
-	cleanupRateMutex.Lock()
-	defer cleanupRateMutex.Unlock()
-
-	now := time.Now()
-	if cleanupWindowStart.IsZero() || now.Sub(cleanupWindowStart) > cleanupWindowDuration {
-		cleanupWindowStart = now
-		cleanupRequestCount = 0
-	}
-
-	if cleanupRequestCount >= cleanupMaxRequestsPerWindow {
-		return false
-	}
-	cleanupRequestCount++
-	return true
-}
@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+)
+
+// record_action writes an audit log entry attributed to the current actor: the staff user
+// from the access token, or the bootstrap token / cron. Failures are logged, not returned,
+// so a completed action is never reported as failed.
+func record_action(db *gorm.DB, c *gin.Context, action, targetType, targetID string, details interface{}) {
+	entry := models.AdminAuditLog{
+		ActorType: c.GetString("adminAuth"),
+		Action:    action,
+		IPAddress: optional_string(c.ClientIP()),
+	}
+	if entry.ActorType == "" {
+		entry.ActorType = models.AdminActorUser
+	}
+
+	if userID, ok := c.Get("userID"); ok {
+		if id, ok := userID.(uuid.UUID); ok {
+			entry.ActorID = &id
+		}
+		entry.ActorEmail = optional_string(c.GetString("userEmail"))
+		if role, ok := c.Get("userRole"); ok {
+			if r, ok := role.(models.UserRole); ok {
+				entry.ActorRole = optional_string(string(r))
+			}
+		}
+	}
+
+	entry.TargetType = optional_string(targetType)
+	entry.TargetID = optional_string(targetID)
+	if details != nil {
+		if raw, err := json.Marshal(details); err == nil {
+			entry.Details = optional_string(string(raw))
+		}
+	}
+
+	actor := entry.ActorType
+	if entry.ActorEmail != nil {
+		actor = *entry.ActorEmail
+	}
+	slog.InfoContext(c.Request.Context(), "admin action", "component", "admin", "action", action, "actor", actor, "target_type", targetType, "target_id", targetID)
+
+	if err := db.Create(&entry).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "recording audit log failed", "component", "admin", "action", action, "error", err)
+	}
+}
+
+// list_audit_log handles GET /api/admin/audit-log with optional actorId and action filters.
+func list_audit_log(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, limit := pagination_params(c, 50)
+
+		query := db.Model(&models.AdminAuditLog{})
+		if actorID := c.Query("actorId"); actorID != "" {
+			id, err := uuid.Parse(actorID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid actorId format"})
+				return
+			}
+			query = query.Where("actor_id = ?", id)
+		}
+		if action := c.Query("action"); action != "" {
+			query = query.Where("action = ?", action)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		entries := []models.AdminAuditLog{}
+		if err := query.Order("created_at DESC").Limit(limit).Offset((page - 1) * limit).Find(&entries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"entries": entries,
+			"pagination": gin.H{
+				"currentPage":  page,
+				"totalPages":   totalPages,
+				"totalRecords": total,
+				"limit":        limit,
+			},
+		})
+	}
+}
+
+func optional_string(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+//########################
+//## CLEANUP HISTORY   ###
+//########################
+
+// list_cleanup_runs handles GET /api/admin/cleanup/runs?page=&limit=
+func list_cleanup_runs(cleanup *services.CleanupService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, limit := pagination_params(c, 20)
+
+		runs, total, err := cleanup.ListRuns(limit, (page-1)*limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"runs": runs,
+			"pagination": gin.H{
+				"currentPage":  page,
+				"totalPages":   totalPages,
+				"totalRecords": total,
+				"limit":        limit,
+			},
+		})
+	}
+}
+
+// get_cleanup_run handles GET /api/admin/cleanup/runs/:id
+func get_cleanup_run(cleanup *services.CleanupService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, ok := load_cleanup_run(cleanup, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"run": run})
+	}
+}
+
+// list_cleanup_run_files handles GET /api/admin/cleanup/runs/:id/files?result=&page=&limit=
+func list_cleanup_run_files(cleanup *services.CleanupService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := models.CleanupFileResult(c.Query("result"))
+		switch result {
+		case "", models.CleanupFileDeleted, models.CleanupFileFailed, models.CleanupFileSkipped, models.CleanupFileWouldDelete:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "result must be deleted, failed, skipped or would_delete"})
+			return
+		}
+
+		run, ok := load_cleanup_run(cleanup, c)
+		if !ok {
+			return
+		}
+		page, limit := pagination_params(c, 50)
+
+		files, total, err := cleanup.ListRunFiles(run.ID, result, limit, (page-1)*limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"runId": run.ID,
+			"files": files,
+			"pagination": gin.H{
+				"currentPage":  page,
+				"totalPages":   totalPages,
+				"totalRecords": total,
+				"limit":        limit,
+			},
+		})
+	}
+}
+
+func load_cleanup_run(cleanup *services.CleanupService, c *gin.Context) (*models.CleanupRun, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid run id format"})
+		return nil, false
+	}
+
+	run, err := cleanup.GetRun(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "Cleanup run not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+		}
+		return nil, false
+	}
+	return run, true
+}
@@ -0,0 +1,356 @@
+package admin
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+//########################
+//## FILE MODERATION   ###
+//########################
+
+func register_file_routes(admin *gin.RouterGroup, db *gorm.DB, fileService *services.FileService) {
+	files := admin.Group("/files")
+	{
+		files.GET("", require_permission(models.PermissionFilesRead), list_files(fileService))
+		files.GET("/:id", require_permission(models.PermissionFilesRead), get_file(fileService))
+		files.POST("/:id/expire", require_permission(models.PermissionFilesModerate), expire_file(db, fileService))
+		files.POST("/:id/disable-share", require_permission(models.PermissionFilesModerate), set_share_disabled(db, fileService, true))
+		files.POST("/:id/enable-share", require_permission(models.PermissionFilesModerate), set_share_disabled(db, fileService, false))
+		files.DELETE("/:id", require_permission(models.PermissionFilesModerate), delete_file(db, fileService))
+		files.POST("/:id/legal-hold", require_permission(models.PermissionFilesLegalHold), place_legal_hold(db, fileService))
+		files.DELETE("/:id/legal-hold", require_permission(models.PermissionFilesLegalHold), release_legal_hold(db, fileService))
+		files.POST("/:id/rescan", require_permission(models.PermissionFilesModerate), rescan_file(db, fileService))
+	}
+}
+
+// list_files handles GET /api/admin/files?ownerId=&mimeType=&minSize=&maxSize=&status=
+// &visibility=public|private&legalHold=&scanStatus=&createdFrom=&createdTo=&q=&page=&limit=
+func list_files(fileService *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, msg := parse_file_filter(c)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": msg})
+			return
+		}
+		page, limit := pagination_params(c, 20)
+
+		files, total, err := fileService.ListFilesForAdmin(filter, limit, (page-1)*limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(files))
+		for i := range files {
+			result = append(result, admin_file_json(&files[i]))
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"files": result,
+			"pagination": gin.H{
+				"currentPage":  page,
+				"totalPages":   totalPages,
+				"totalRecords": total,
+				"limit":        limit,
+			},
+		})
+	}
+}
+
+func parse_file_filter(c *gin.Context) (services.AdminFileFilter, string) {
+	var filter services.AdminFileFilter
+
+	if ownerID := c.Query("ownerId"); ownerID != "" {
+		id, err := uuid.Parse(ownerID)
+		if err != nil {
+			return filter, "Invalid ownerId format"
+		}
+		filter.OwnerID = &id
+	}
+	filter.MimeType = strings.TrimSpace(c.Query("mimeType"))
+	filter.Query = strings.TrimSpace(c.Query("q"))
+
+	for param, target := range map[string]*int64{"minSize": &filter.MinSize, "maxSize": &filter.MaxSize} {
+		if raw := c.Query(param); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				return filter, param + " must be a non-negative number of bytes"
+			}
+			*target = n
+		}
+	}
+
+	switch status := c.Query("status"); status {
+	case "", "active", "pending", "expired":
+		filter.Status = status
+	default:
+		return filter, "status must be active, pending or expired"
+	}
+
+	switch c.Query("visibility") {
+	case "":
+	case "public":
+		filter.IsPublic = bool_ptr(true)
+	case "private":
+		filter.IsPublic = bool_ptr(false)
+	default:
+		return filter, "visibility must be public or private"
+	}
+
+	if raw := c.Query("legalHold"); raw != "" {
+		hold, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, "legalHold must be true or false"
+		}
+		filter.LegalHold = &hold
+	}
+
+	if scanStatus := c.Query("scanStatus"); scanStatus != "" {
+		if scanStatus != "unscanned" && !models.ScanStatus(scanStatus).IsValid() {
+			return filter, "scanStatus must be pending, clean, infected, error or unscanned"
+		}
+		filter.ScanStatus = scanStatus
+	}
+
+	for param, target := range map[string]**time.Time{"createdFrom": &filter.CreatedFrom, "createdTo": &filter.CreatedTo} {
+		if raw := c.Query(param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return filter, param + " must be an RFC 3339 timestamp"
+			}
+			*target = &t
+		}
+	}
+
+	return filter, ""
+}
+
+// get_file handles GET /api/admin/files/:id
+func get_file(fileService *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, ok := load_target_file(fileService, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"file": admin_file_json(file)})
+	}
+}
+
+// expire_file handles POST /api/admin/files/:id/expire
+func expire_file(db *gorm.DB, fileService *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, ok := load_target_file(fileService, c)
+		if !ok {
+			return
+		}
+		updated, err := fileService.ForceExpire(file.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "file.expire", "file", file.ID.String(), gin.H{"previousAvailableTo": file.AvailableTo})
+		c.JSON(http.StatusOK, gin.H{"message": "File expired", "file": admin_file_json(updated)})
+	}
+}
+
+// set_share_disabled handles POST /api/admin/files/:id/disable-share and /enable-share
+func set_share_disabled(db *gorm.DB, fileService *services.FileService, disabled bool) gin.HandlerFunc {
+	action, message := "file.share_enable", "Share link enabled"
+	if disabled {
+		action, message = "file.share_disable", "Share link disabled"
+	}
+	return func(c *gin.Context) {
+		file, ok := load_target_file(fileService, c)
+		if !ok {
+			return
+		}
+		if (file.ShareDisabledAt != nil) == disabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "Share link is already in that state"})
+			return
+		}
+		updated, err := fileService.SetShareDisabled(file.ID, disabled)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, action, "file", file.ID.String(), nil)
+		c.JSON(http.StatusOK, gin.H{"message": message, "file": admin_file_json(updated)})
+	}
+}
+
+// delete_file handles DELETE /api/admin/files/:id
+func delete_file(db *gorm.DB, fileService *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, ok := load_target_file(fileService, c)
+		if !ok {
+			return
+		}
+		if err := fileService.Delete(file.ID); err != nil {
+			if errors.Is(err, services.ErrLegalHold) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Legal hold", "message": "File is under legal hold and cannot be deleted"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Failed to delete file"})
+			return
+		}
+
+		record_action(db, c, "file.delete", "file", file.ID.String(), gin.H{"fileName": file.FileName, "ownerId": file.OwnerID})
+		c.JSON(http.StatusOK, gin.H{"message": "File deleted", "fileId": file.ID})
+	}
+}
+
+// place_legal_hold handles POST /api/admin/files/:id/legal-hold
+func place_legal_hold(db *gorm.DB, fileService *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Reason string `json:"reason" binding:"required,max=255"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Reason) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "reason is required (at most 255 characters)"})
+			return
+		}
+
+		file, ok := load_target_file(fileService, c)
+		if !ok {
+			return
+		}
+		if file.LegalHold {
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "File is already under legal hold"})
+			return
+		}
+		updated, err := fileService.SetLegalHold(file.ID, true, strings.TrimSpace(input.Reason))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "file.legal_hold", "file", file.ID.String(), gin.H{"reason": input.Reason})
+		c.JSON(http.StatusOK, gin.H{"message": "Legal hold placed", "file": admin_file_json(updated)})
+	}
+}
+
+// release_legal_hold handles DELETE /api/admin/files/:id/legal-hold
+func release_legal_hold(db *gorm.DB, fileService *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, ok := load_target_file(fileService, c)
+		if !ok {
+			return
+		}
+		if !file.LegalHold {
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "File is not under legal hold"})
+			return
+		}
+		updated, err := fileService.SetLegalHold(file.ID, false, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "file.legal_hold_release", "file", file.ID.String(), gin.H{"previousReason": file.LegalHoldReason})
+		c.JSON(http.StatusOK, gin.H{"message": "Legal hold released", "file": admin_file_json(updated)})
+	}
+}
+
+// rescan_file handles POST /api/admin/files/:id/rescan
+func rescan_file(db *gorm.DB, fileService *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !fileService.ScanningEnabled() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Scanner disabled", "message": "Malware scanning is not enabled"})
+			return
+		}
+		file, ok := load_target_file(fileService, c)
+		if !ok {
+			return
+		}
+		updated, err := fileService.ScanFile(c.Request.Context(), file.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Scan failed"})
+			return
+		}
+
+		record_action(db, c, "file.rescan", "file", file.ID.String(), gin.H{
+			"previousStatus": file.ScanStatus,
+			"scanStatus":     updated.ScanStatus,
+			"signature":      updated.ScanSignature,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "File rescanned", "file": admin_file_json(updated)})
+	}
+}
+
+func load_target_file(fileService *services.FileService, c *gin.Context) (*models.File, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid file id format"})
+		return nil, false
+	}
+
+	file, err := fileService.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "File not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+func admin_file_json(file *models.File) gin.H {
+	result := gin.H{
+		"id":              file.ID,
+		"fileName":        file.FileName,
+		"shareToken":      file.ShareToken,
+		"fileSize":        file.FileSize,
+		"mimeType":        file.MimeType,
+		"isPublic":        file.IsPublic != nil && *file.IsPublic,
+		"hasPassword":     file.HasPassword(),
+		"status":          file.GetStatus(),
+		"availableFrom":   file.AvailableFrom,
+		"availableTo":     file.AvailableTo,
+		"createdAt":       file.CreatedAt,
+		"shareDisabled":   file.ShareDisabledAt != nil,
+		"shareDisabledAt": file.ShareDisabledAt,
+		"legalHold":       file.LegalHold,
+		"legalHoldReason": file.LegalHoldReason,
+		"legalHoldAt":     file.LegalHoldAt,
+		"takenDown":       file.TakenDownAt != nil,
+		"takenDownAt":     file.TakenDownAt,
+		"takedownReason":  file.TakedownReason,
+		"scanStatus":      file.ScanStatus,
+		"scanSignature":   file.ScanSignature,
+		"scannedAt":       file.ScannedAt,
+		"quarantined":     file.QuarantinedAt != nil,
+		"quarantinedAt":   file.QuarantinedAt,
+		"owner":           nil,
+	}
+	if file.Owner != nil {
+		result["owner"] = gin.H{"id": file.Owner.ID, "username": file.Owner.Username, "email": file.Owner.Email}
+	}
+	if file.Statistics != nil {
+		result["downloadCount"] = file.Statistics.DownloadCount
+	}
+	return result
+}
+
+func bool_ptr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,173 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+//########################
+//## POLICY HISTORY    ###
+//########################
+
+// list_policy_history handles GET /api/admin/policy/history?audience=&page=&limit=
+func list_policy_history(policies *services.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		audience := c.Query("audience")
+		if audience != "" && audience != models.PolicyAudienceSystem && !models.ValidPolicyAudience(audience) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Unknown policy audience"})
+			return
+		}
+		page, limit := pagination_params(c, 20)
+
+		changes, total, err := policies.ListChanges(c.Request.Context(), audience, limit, (page-1)*limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"changes": changes,
+			"pagination": gin.H{
+				"currentPage":  page,
+				"totalPages":   totalPages,
+				"totalRecords": total,
+				"limit":        limit,
+			},
+		})
+	}
+}
+
+// rollback_policy handles POST /api/admin/policy/history/:id/rollback
+func rollback_policy(db *gorm.DB, policies *services.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid change id format"})
+			return
+		}
+
+		change, err := policies.Rollback(c.Request.Context(), id, policy_actor(c))
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "Policy change not found"})
+			return
+		case errors.Is(err, services.ErrPolicyUnchanged):
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "The policy already matches the state before this change"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Rollback failed"})
+			return
+		}
+
+		record_action(db, c, "policy.rollback", "policy", change.Audience, gin.H{
+			"changeId":   change.ID,
+			"rollbackOf": id,
+			"diff":       json.RawMessage(change.Diff),
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "Policy rolled back", "change": change})
+	}
+}
+
+//########################
+//## POLICY OVERRIDES  ###
+//########################
+
+// list_policy_overrides handles GET /api/admin/policy/overrides
+func list_policy_overrides(policies *services.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		overrides, err := policies.ListOverrides(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+	}
+}
+
+// set_policy_override handles PUT /api/admin/policy/overrides/:audience. The body replaces
+// the whole override; omitted fields inherit from the system policy.
+func set_policy_override(db *gorm.DB, policies *services.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		audience := c.Param("audience")
+		if !models.ValidPolicyAudience(audience) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "audience must be anonymous, user, admin or group:<name>"})
+			return
+		}
+
+		var input policy_settings_request
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid input data"})
+			return
+		}
+		if input.ScanDownloadPolicy != nil || input.CleanupGraceHours != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "scanDownloadPolicy and cleanupGraceHours apply to everyone and cannot be overridden"})
+			return
+		}
+		settings, msg := input.settings()
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": msg})
+			return
+		}
+		if settings.IsEmpty() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "No fields provided; delete the override instead"})
+			return
+		}
+
+		override, change, err := policies.SetOverride(c.Request.Context(), audience, settings, policy_actor(c))
+		if errors.Is(err, services.ErrPolicyUnchanged) {
+			c.JSON(http.StatusOK, gin.H{"message": "Override unchanged"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "policy.override_set", "policy", audience, gin.H{"changeId": change.ID, "diff": json.RawMessage(change.Diff)})
+		c.JSON(http.StatusOK, gin.H{"message": "Override saved", "override": override, "changeId": change.ID})
+	}
+}
+
+// delete_policy_override handles DELETE /api/admin/policy/overrides/:audience
+func delete_policy_override(db *gorm.DB, policies *services.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		audience := c.Param("audience")
+		change, err := policies.DeleteOverride(c.Request.Context(), audience, policy_actor(c))
+		switch {
+		case errors.Is(err, services.ErrInvalidPolicyAudience):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "audience must be anonymous, user, admin or group:<name>"})
+			return
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "No override for this audience"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Delete failed"})
+			return
+		}
+
+		record_action(db, c, "policy.override_delete", "policy", audience, gin.H{"changeId": change.ID})
+		c.JSON(http.StatusOK, gin.H{"message": "Override deleted", "changeId": change.ID})
+	}
+}
+
+// policy_actor identifies the caller in the policy change history.
+func policy_actor(c *gin.Context) services.PolicyActor {
+	name := c.GetString("userEmail")
+	if name == "" {
+		name = c.GetString("adminAuth")
+	}
+	return services.PolicyActor{ID: actor_id(c), Name: name}
+}
@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+//########################
+//## STORAGE RECONCILE ###
+//########################
+
+// reconcile_storage handles POST /api/admin/storage/reconcile?repair=&minAgeHours=
+func reconcile_storage(db *gorm.DB, reconcile *services.ReconcileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repair, err := strconv.ParseBool(c.DefaultQuery("repair", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "repair must be true or false"})
+			return
+		}
+		opts := services.ReconcileOptions{Repair: repair}
+		if raw := c.Query("minAgeHours"); raw != "" {
+			hours, err := strconv.Atoi(raw)
+			if err != nil || hours < 1 || hours > 720 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "minAgeHours must be between 1 and 720"})
+				return
+			}
+			opts.MinAge = time.Duration(hours) * time.Hour
+		}
+
+		report, err := reconcile.Reconcile(c.Request.Context(), opts)
+		if err != nil {
+			if errors.Is(err, services.ErrReconcileRunning) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "A cleanup or repair is already in progress"})
+				return
+			}
+			slog.ErrorContext(c.Request.Context(), "storage reconciliation failed", "component", "admin", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Reconciliation failed"})
+			return
+		}
+
+		action := "storage.reconcile"
+		if repair {
+			action = "storage.repair"
+		}
+		record_action(db, c, action, "storage", "", gin.H{
+			"orphans_found":   report.OrphansFound,
+			"objects_deleted": report.ObjectsDeleted,
+			"dangling_found":  report.DanglingFound,
+			"files_deleted":   report.FilesDeleted,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"report": report})
+	}
+}
@@ -0,0 +1,231 @@
+package admin
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+//########################
+//## ABUSE REPORTS     ###
+//########################
+
+func register_report_routes(admin *gin.RouterGroup, db *gorm.DB, abuseReports *services.AbuseReportService) {
+	reports := admin.Group("/reports")
+	{
+		reports.GET("", require_permission(models.PermissionFilesRead), list_reports(abuseReports))
+		reports.GET("/:id", require_permission(models.PermissionFilesRead), get_report(abuseReports))
+		reports.POST("/:id/dismiss", require_permission(models.PermissionFilesModerate), dismiss_report(db, abuseReports))
+		reports.POST("/:id/takedown", require_permission(models.PermissionFilesModerate), takedown_report(db, abuseReports))
+	}
+
+	admin.POST("/files/:id/takedown", require_permission(models.PermissionFilesModerate), takedown_file(db, abuseReports))
+	admin.DELETE("/files/:id/takedown", require_permission(models.PermissionFilesModerate), restore_file(db, abuseReports))
+}
+
+// list_reports handles GET /api/admin/reports?status=open|dismissed|actioned&fileId=&page=&limit=
+// Defaults to the open queue, oldest first.
+func list_reports(abuseReports *services.AbuseReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, limit := pagination_params(c, 20)
+
+		status := models.AbuseReportStatus(c.DefaultQuery("status", string(models.AbuseReportOpen)))
+		switch status {
+		case models.AbuseReportOpen, models.AbuseReportDismissed, models.AbuseReportActioned:
+		case "all":
+			status = ""
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "status must be open, dismissed, actioned or all"})
+			return
+		}
+
+		var fileID *uuid.UUID
+		if raw := c.Query("fileId"); raw != "" {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid fileId format"})
+				return
+			}
+			fileID = &id
+		}
+
+		reports, total, err := abuseReports.List(status, fileID, limit, (page-1)*limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"reports": reports,
+			"pagination": gin.H{
+				"currentPage":  page,
+				"totalPages":   totalPages,
+				"totalRecords": total,
+				"limit":        limit,
+			},
+		})
+	}
+}
+
+// get_report handles GET /api/admin/reports/:id
+func get_report(abuseReports *services.AbuseReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, ok := load_target_report(abuseReports, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"report": report})
+	}
+}
+
+// dismiss_report handles POST /api/admin/reports/:id/dismiss
+func dismiss_report(db *gorm.DB, abuseReports *services.AbuseReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		note, ok := bind_note(c)
+		if !ok {
+			return
+		}
+		report, ok := load_target_report(abuseReports, c)
+		if !ok {
+			return
+		}
+
+		updated, err := abuseReports.Dismiss(report.ID, actor_id(c), note)
+		if err != nil {
+			write_report_error(c, err)
+			return
+		}
+
+		record_action(db, c, "report.dismiss", "abuse_report", report.ID.String(), gin.H{"fileId": report.FileID, "note": note})
+		c.JSON(http.StatusOK, gin.H{"message": "Report dismissed", "report": updated})
+	}
+}
+
+// takedown_report handles POST /api/admin/reports/:id/takedown
+func takedown_report(db *gorm.DB, abuseReports *services.AbuseReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		note, ok := bind_note(c)
+		if !ok {
+			return
+		}
+		report, ok := load_target_report(abuseReports, c)
+		if !ok {
+			return
+		}
+
+		updated, err := abuseReports.TakedownReport(report.ID, actor_id(c), note)
+		if err != nil {
+			write_report_error(c, err)
+			return
+		}
+
+		record_action(db, c, "file.takedown", "file", report.FileID.String(), gin.H{"reportId": report.ID, "reason": report.Reason, "note": note})
+		c.JSON(http.StatusOK, gin.H{"message": "File taken down", "report": updated})
+	}
+}
+
+// takedown_file handles POST /api/admin/files/:id/takedown without a report
+func takedown_file(db *gorm.DB, abuseReports *services.AbuseReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Reason string `json:"reason" binding:"required,max=255"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Reason) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "reason is required (at most 255 characters)"})
+			return
+		}
+		fileID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid file id format"})
+			return
+		}
+
+		file, resolved, err := abuseReports.Takedown(fileID, actor_id(c), strings.TrimSpace(input.Reason))
+		if err != nil {
+			write_report_error(c, err)
+			return
+		}
+
+		record_action(db, c, "file.takedown", "file", file.ID.String(), gin.H{"reason": input.Reason, "reportsClosed": resolved})
+		c.JSON(http.StatusOK, gin.H{"message": "File taken down", "reportsClosed": resolved, "file": admin_file_json(file)})
+	}
+}
+
+// restore_file handles DELETE /api/admin/files/:id/takedown
+func restore_file(db *gorm.DB, abuseReports *services.AbuseReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid file id format"})
+			return
+		}
+
+		file, err := abuseReports.Restore(fileID)
+		if err != nil {
+			write_report_error(c, err)
+			return
+		}
+
+		record_action(db, c, "file.takedown_lift", "file", file.ID.String(), nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Takedown lifted", "file": admin_file_json(file)})
+	}
+}
+
+func load_target_report(abuseReports *services.AbuseReportService, c *gin.Context) (*models.AbuseReport, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid report id format"})
+		return nil, false
+	}
+	report, err := abuseReports.GetByID(id)
+	if err != nil {
+		write_report_error(c, err)
+		return nil, false
+	}
+	return report, true
+}
+
+func write_report_error(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "Report or file not found"})
+	case errors.Is(err, services.ErrReportNotOpen):
+		c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "Report has already been reviewed"})
+	case errors.Is(err, services.ErrFileNotTakenDown):
+		c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "File is not taken down"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+	}
+}
+
+func bind_note(c *gin.Context) (string, bool) {
+	var input struct {
+		Note string `json:"note" binding:"max=255"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "note must be at most 255 characters"})
+		return "", false
+	}
+	return strings.TrimSpace(input.Note), true
+}
+
+func actor_id(c *gin.Context) *uuid.UUID {
+	if userID, ok := c.Get("userID"); ok {
+		if id, ok := userID.(uuid.UUID); ok {
+			return &id
+		}
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+package admin
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+)
+
+//########################
+//## USER MANAGEMENT   ###
+//########################
+
+func register_user_routes(admin *gin.RouterGroup, db *gorm.DB) {
+	users := admin.Group("/users")
+	{
+		users.GET("", require_permission(models.PermissionUsersRead), list_users(db))
+		users.GET("/:id", require_permission(models.PermissionUsersRead), get_user(db))
+		users.GET("/:id/files", require_permission(models.PermissionUsersRead), list_user_files(db))
+		users.POST("/:id/suspend", require_permission(models.PermissionUsersManage), suspend_user(db))
+		users.POST("/:id/reactivate", require_permission(models.PermissionUsersManage), reactivate_user(db))
+		users.POST("/:id/reset-totp", require_permission(models.PermissionUsersManage), reset_user_totp(db))
+		users.POST("/:id/logout", require_permission(models.PermissionUsersManage), force_logout_user(db))
+		users.PATCH("/:id/role", require_permission(models.PermissionUsersRoles), change_user_role(db))
+		users.PUT("/:id/policy-group", require_permission(models.PermissionUsersManage), set_user_policy_group(db))
+	}
+}
+
+type user_usage struct {
+	OwnerID      uuid.UUID
+	FileCount    int64
+	StorageBytes int64
+}
+
+// list_users handles GET /api/admin/users?q=&role=&status=active|suspended&page=&limit=
+func list_users(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, limit := pagination_params(c, 20)
+
+		query := db.Model(&models.User{})
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			like := "%" + q + "%"
+			query = query.Where("username ILIKE ? OR email ILIKE ?", like, like)
+		}
+		if role := c.Query("role"); role != "" {
+			if !models.UserRole(role).IsValid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Unknown role"})
+				return
+			}
+			query = query.Where("role = ?", role)
+		}
+		switch c.Query("status") {
+		case "":
+		case "active":
+			query = query.Where("suspended_at IS NULL")
+		case "suspended":
+			query = query.Where("suspended_at IS NOT NULL")
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "status must be active or suspended"})
+			return
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		var users []models.User
+		if err := query.Order("created_at DESC").Limit(limit).Offset((page - 1) * limit).Find(&users).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		ids := make([]uuid.UUID, 0, len(users))
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		usage, err := load_usage(db, ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(users))
+		for i := range users {
+			result = append(result, admin_user_json(&users[i], usage[users[i].ID]))
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"users": result,
+			"pagination": gin.H{
+				"currentPage":  page,
+				"totalPages":   totalPages,
+				"totalRecords": total,
+				"limit":        limit,
+			},
+		})
+	}
+}
+
+// get_user handles GET /api/admin/users/:id
+func get_user(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := load_target_user(db, c)
+		if !ok {
+			return
+		}
+		usage, err := load_usage(db, []uuid.UUID{user.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		result := admin_user_json(user, usage[user.ID])
+		result["lockedUntil"] = user.LockedUntil
+		c.JSON(http.StatusOK, gin.H{"user": result})
+	}
+}
+
+// list_user_files handles GET /api/admin/users/:id/files
+func list_user_files(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := load_target_user(db, c)
+		if !ok {
+			return
+		}
+		page, limit := pagination_params(c, 20)
+
+		var total int64
+		query := db.Model(&models.File{}).Where("owner_id = ?", user.ID)
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		var files []models.File
+		if err := query.Order("created_at DESC").Limit(limit).Offset((page - 1) * limit).Find(&files).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(files))
+		for _, f := range files {
+			result = append(result, gin.H{
+				"id":            f.ID,
+				"fileName":      f.FileName,
+				"fileSize":      f.FileSize,
+				"mimeType":      f.MimeType,
+				"shareToken":    f.ShareToken,
+				"status":        f.GetStatus(),
+				"isPublic":      f.IsPublic,
+				"hasPassword":   f.HasPassword(),
+				"availableFrom": f.AvailableFrom,
+				"availableTo":   f.AvailableTo,
+				"createdAt":     f.CreatedAt,
+			})
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"userId": user.ID,
+			"files":  result,
+			"pagination": gin.H{
+				"currentPage":  page,
+				"totalPages":   totalPages,
+				"totalRecords": total,
+				"limit":        limit,
+			},
+		})
+	}
+}
+
+// suspend_user handles POST /api/admin/users/:id/suspend
+// Suspended users cannot sign in, their tokens are rejected and their share links stop working.
+func suspend_user(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Reason string `json:"reason" binding:"max=255"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "reason must be at most 255 characters"})
+			return
+		}
+
+		user, ok := load_manageable_user(db, c)
+		if !ok {
+			return
+		}
+		if user.IsSuspended() {
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "User is already suspended"})
+			return
+		}
+
+		now := time.Now().UTC()
+		updates := map[string]interface{}{
+			"suspended_at":        now,
+			"suspended_reason":    optional_string(strings.TrimSpace(input.Reason)),
+			"sessions_revoked_at": now, // reactivation requires a fresh login
+		}
+		if err := db.Model(user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "user.suspend", "user", user.ID.String(), gin.H{"reason": input.Reason})
+		c.JSON(http.StatusOK, gin.H{"message": "User suspended", "userId": user.ID, "suspendedAt": now})
+	}
+}
+
+// reactivate_user handles POST /api/admin/users/:id/reactivate
+func reactivate_user(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := load_manageable_user(db, c)
+		if !ok {
+			return
+		}
+		if !user.IsSuspended() {
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "User is not suspended"})
+			return
+		}
+
+		updates := map[string]interface{}{"suspended_at": nil, "suspended_reason": nil}
+		if err := db.Model(user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "user.reactivate", "user", user.ID.String(), nil)
+		c.JSON(http.StatusOK, gin.H{"message": "User reactivated", "userId": user.ID})
+	}
+}
+
+// reset_user_totp handles POST /api/admin/users/:id/reset-totp
+// Disables TOTP so a user who lost their authenticator can sign in and enroll again.
+func reset_user_totp(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := load_manageable_user(db, c)
+		if !ok {
+			return
+		}
+
+		updates := map[string]interface{}{
+			"totp_enabled":         false,
+			"totp_secret":          nil,
+			"totp_failed_attempts": 0,
+			"locked_until":         nil,
+		}
+		if err := db.Model(user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "user.reset_totp", "user", user.ID.String(), nil)
+		c.JSON(http.StatusOK, gin.H{"message": "TOTP reset", "userId": user.ID})
+	}
+}
+
+// force_logout_user handles POST /api/admin/users/:id/logout
+// Rejects every access token issued so far, revokes personal access tokens and drops
+// pending second-factor logins.
+func force_logout_user(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := load_manageable_user(db, c)
+		if !ok {
+			return
+		}
+
+		now := time.Now().UTC()
+		var revokedTokens int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(user).Update("sessions_revoked_at", now).Error; err != nil {
+				return err
+			}
+			result := tx.Model(&models.PersonalAccessToken{}).
+				Where("user_id = ? AND revoked_at IS NULL", user.ID).
+				Update("revoked_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			revokedTokens = result.RowsAffected
+			return tx.Where("user_id = ?", user.ID).Delete(&models.LoginSession{}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "user.force_logout", "user", user.ID.String(), gin.H{"revoked_access_tokens": revokedTokens})
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "User signed out everywhere",
+			"userId":              user.ID,
+			"revokedAccessTokens": revokedTokens,
+		})
+	}
+}
+
+var errLastAdmin = errors.New("cannot demote the last admin")
+
+// change_user_role handles PATCH /api/admin/users/:id/role
+func change_user_role(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Role models.UserRole `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil || !input.Role.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "role must be one of user, moderator, auditor, admin"})
+			return
+		}
+
+		user, ok := load_manageable_user(db, c)
+		if !ok {
+			return
+		}
+		if user.Role == input.Role {
+			c.JSON(http.StatusOK, gin.H{"message": "Role unchanged", "userId": user.ID, "role": user.Role})
+			return
+		}
+
+		previous := user.Role
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Locking every admin row makes concurrent demotions wait for each other, so the
+			// check below cannot be stale when the update commits.
+			var admins []uuid.UUID
+			if err := tx.Model(&models.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("role = ?", models.RoleAdmin).Pluck("id", &admins).Error; err != nil {
+				return err
+			}
+			if len(admins) == 1 && admins[0] == user.ID {
+				return errLastAdmin
+			}
+			return tx.Model(user).Update("role", input.Role).Error
+		})
+		if errors.Is(err, errLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Conflict", "message": "Cannot demote the last admin"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "user.change_role", "user", user.ID.String(), gin.H{"from": previous, "to": input.Role})
+		c.JSON(http.StatusOK, gin.H{"message": "Role updated", "userId": user.ID, "role": input.Role})
+	}
+}
+
+// set_user_policy_group handles PUT /api/admin/users/:id/policy-group; a null group removes it.
+func set_user_policy_group(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Group *string `json:"group"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid input data"})
+			return
+		}
+		var group *string
+		if input.Group != nil && *input.Group != "" {
+			name := strings.ToLower(strings.TrimSpace(*input.Group))
+			if !models.ValidPolicyGroup(name) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "group must be 1-64 characters of a-z, 0-9, _ or -"})
+				return
+			}
+			group = &name
+		}
+
+		user, ok := load_manageable_user(db, c)
+		if !ok {
+			return
+		}
+		if err := db.Model(user).Update("policy_group", group).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Update failed"})
+			return
+		}
+
+		record_action(db, c, "user.policy_group", "user", user.ID.String(), gin.H{"from": user.PolicyGroup, "to": group})
+		c.JSON(http.StatusOK, gin.H{"message": "Policy group updated", "userId": user.ID, "policyGroup": group})
+	}
+}
+
+//########################
+//## HELPERS           ###
+//########################
+
+func load_target_user(db *gorm.DB, c *gin.Context) (*models.User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "Invalid user id format"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error", "message": "Database query failed"})
+		}
+		return nil, false
+	}
+	return &user, true
+}
+
+// load_manageable_user loads the target of a write action. Staff cannot act on themselves,
+// and only admins may act on staff accounts of equal or higher rank.
+func load_manageable_user(db *gorm.DB, c *gin.Context) (*models.User, bool) {
+	user, ok := load_target_user(db, c)
+	if !ok {
+		return nil, false
+	}
+
+	if actorID, ok := c.Get("userID"); ok && actorID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation error", "message": "You cannot perform this action on your own account"})
+		return nil, false
+	}
+
+	actorRole, _ := c.Get("userRole")
+	role, _ := actorRole.(models.UserRole)
+	if role != models.RoleAdmin && !role.Outranks(user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "You cannot manage users with this role"})
+		return nil, false
+	}
+	return user, true
+}
+
+func load_usage(db *gorm.DB, ids []uuid.UUID) (map[uuid.UUID]user_usage, error) {
+	usage := make(map[uuid.UUID]user_usage, len(ids))
+	if len(ids) == 0 {
+		return usage, nil
+	}
+
+	var rows []user_usage
+	err := db.Model(&models.File{}).
+		Select("owner_id, COUNT(*) AS file_count, COALESCE(SUM(file_size), 0) AS storage_bytes").
+		Where("owner_id IN ?", ids).
+		Group("owner_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		usage[row.OwnerID] = row
+	}
+	return usage, nil
+}
+
+func admin_user_json(user *models.User, usage user_usage) gin.H {
+	return gin.H{
+		"id":              user.ID,
+		"username":        user.Username,
+		"email":           user.Email,
+		"role":            user.Role,
+		"policyGroup":     user.PolicyGroup,
+		"totpEnabled":     user.TOTPEnabled != nil && *user.TOTPEnabled,
+		"createdAt":       user.CreatedAt,
+		"suspended":       user.IsSuspended(),
+		"suspendedAt":     user.SuspendedAt,
+		"suspendedReason": user.SuspendedReason,
+		"fileCount":       usage.FileCount,
+		"storageBytes":    usage.StorageBytes,
+	}
+}
+
+func pagination_params(c *gin.Context, defaultLimit int) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = defaultLimit
+	}
+	return page, limit
+}
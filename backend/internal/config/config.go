@@ -16,6 +16,8 @@ type Config struct {
 	Database     DatabaseConfig     `mapstructure:"database"`
 	JWT          JWTConfig          `mapstructure:"jwt"`
 	TOTP         TOTPConfig         `mapstructure:"totp"`
+	WebAuthn     WebAuthnConfig     `mapstructure:"webauthn"`
+	OIDC         OIDCConfig         `mapstructure:"oidc"`
 	Storage      StorageConfig      `mapstructure:"storage"`
 	SystemPolicy SystemPolicyConfig `mapstructure:"system_policy"`
 	CORS         CORSConfig         `mapstructure:"cors"`
@@ -23,8 +25,10 @@ type Config struct {
 	Logging      LoggingConfig      `mapstructure:"logging"`
 	Cleanup      CleanupConfig      `mapstructure:"cleanup"`
 	Email        EmailConfig        `mapstructure:"email"`
+	Scanner      ScannerConfig      `mapstructure:"scanner"`
 	CloudStorage CloudStorageConfig `mapstructure:"cloud_storage"`
 	Metrics      MetricsConfig      `mapstructure:"metrics"`
+	Tracing      TracingConfig      `mapstructure:"tracing"`
 	Swagger      SwaggerConfig      `mapstructure:"swagger"`
 }
 
@@ -35,6 +39,9 @@ type ServerConfig struct {
 	ReadTimeout     string `mapstructure:"read_timeout"`
 	WriteTimeout    string `mapstructure:"write_timeout"`
 	ShutdownTimeout string `mapstructure:"shutdown_timeout"`
+	// TrustedProxies lists the IPs/CIDRs (e.g. the nginx front) whose X-Forwarded-For and
+	// X-Real-IP headers are believed when resolving the client IP; empty trusts none.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -54,6 +61,8 @@ type JWTConfig struct {
 	Secret             string `mapstructure:"secret"`
 	AccessTokenExpiry  string `mapstructure:"access_token_expiry"`
 	RefreshTokenExpiry string `mapstructure:"refresh_token_expiry"`
+	Algorithm          string `mapstructure:"algorithm"`         // HS256 (default, uses Secret), RS256 or EdDSA
+	RotationInterval   string `mapstructure:"rotation_interval"` // how often a new signing key is generated, e.g. "30d"
 }
 
 type TOTPConfig struct {
@@ -62,6 +71,26 @@ type TOTPConfig struct {
 	Digits uint   `mapstructure:"digits"`
 }
 
+type WebAuthnConfig struct {
+	RPID          string   `mapstructure:"rp_id"`           // e.g. "example.com" (no scheme/port)
+	RPDisplayName string   `mapstructure:"rp_display_name"` // shown by the authenticator
+	RPOrigins     []string `mapstructure:"rp_origins"`      // e.g. ["https://example.com"]
+}
+
+type OIDCConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	IssuerURL    string   `mapstructure:"issuer_url"` // discovery at <issuer>/.well-known/openid-configuration
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	RedirectURL  string   `mapstructure:"redirect_url"`
+	Scopes       []string `mapstructure:"scopes"` // "openid" is always requested
+	// RoleClaim names an ID token claim (string or list of strings); RoleMapping maps its
+	// values to a models.UserRole, which is granted on login but never taken away (demote
+	// through the admin API). Leave RoleClaim empty to keep roles managed locally.
+	RoleClaim   string            `mapstructure:"role_claim"`
+	RoleMapping map[string]string `mapstructure:"role_mapping"`
+}
+
 type StorageConfig struct {
 	Type             string   `mapstructure:"type"`
 	Path             string   `mapstructure:"path"`
@@ -96,9 +125,15 @@ type CORSConfig struct {
 	MaxAge           string   `mapstructure:"max_age"`
 }
 
+// RateLimitConfig sets the rate limit buckets. A zero limit uses the default, a negative
+// one disables the bucket.
 type RateLimitConfig struct {
-	RequestsPerMinute int `mapstructure:"requests_per_minute"`
-	UploadPerHour     int `mapstructure:"upload_per_hour"`
+	RequestsPerMinute     int    `mapstructure:"requests_per_minute"`      // whole API, per user or client IP
+	UploadPerHour         int    `mapstructure:"upload_per_hour"`          // per user or client IP
+	LoginPerMinute        int    `mapstructure:"login_per_minute"`         // password, passkey and register attempts per client IP
+	TOTPPerMinute         int    `mapstructure:"totp_per_minute"`          // second-factor attempts per client IP
+	FilePasswordPerMinute int    `mapstructure:"file_password_per_minute"` // downloads sending a file password, per client IP and file
+	Store                 string `mapstructure:"store"`                    // "memory" (per replica, default) or "postgres" (shared)
 }
 
 type LoggingConfig struct {
@@ -108,8 +143,11 @@ type LoggingConfig struct {
 }
 
 type CleanupConfig struct {
-	Cron   string `mapstructure:"cron"`
-	Secret string `mapstructure:"secret"`
+	Cron        string `mapstructure:"cron"` // standard 5-field cron expression; empty disables the scheduler
+	Secret      string `mapstructure:"secret"`
+	BatchSize   int    `mapstructure:"batch_size"`   // files deleted per batch
+	MaxAttempts int    `mapstructure:"max_attempts"` // storage delete attempts per file before giving up for this run
+	RetryDelay  string `mapstructure:"retry_delay"`  // base delay between attempts, doubled each time, e.g. "2s"
 }
 
 type EmailConfig struct {
@@ -121,11 +159,30 @@ type EmailConfig struct {
 	From     string `mapstructure:"from"`
 }
 
+type ScannerConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Type    string `mapstructure:"type"`    // "clamav" (the only engine for now)
+	Address string `mapstructure:"address"` // clamd socket: "tcp://host:3310" or "unix:///path/clamd.sock"
+	Timeout string `mapstructure:"timeout"` // per-scan timeout, e.g. "60s"
+}
+
 type MetricsConfig struct {
 	Enabled bool `mapstructure:"enabled"`
 	Port    int  `mapstructure:"port"`
 }
 
+type TracingConfig struct {
+	Exporter    string  `mapstructure:"exporter"`     // "none" (default) or "otlp"
+	Endpoint    string  `mapstructure:"endpoint"`     // OTLP/HTTP collector URL, e.g. "http://otel-collector:4318"
+	ServiceName string  `mapstructure:"service_name"` // default "file-sharing-backend"
+	SampleRatio float64 `mapstructure:"sample_ratio"` // share of new traces recorded, 0 < r <= 1; 0 means 1
+}
+
+// Enabled reports whether spans are exported.
+func (c *TracingConfig) Enabled() bool {
+	return c.Exporter != "" && !strings.EqualFold(c.Exporter, "none")
+}
+
 type SwaggerConfig struct {
 	Enabled  bool   `mapstructure:"enabled"`
 	Host     string `mapstructure:"host"`
@@ -185,6 +242,38 @@ func Load() (*Config, error) {
 	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
 		cfg.JWT.Secret = jwtSecret
 	}
+	if jwtAlgorithm := os.Getenv("JWT_ALGORITHM"); jwtAlgorithm != "" {
+		cfg.JWT.Algorithm = jwtAlgorithm
+	}
+	if rotation := os.Getenv("JWT_ROTATION_INTERVAL"); rotation != "" {
+		cfg.JWT.RotationInterval = rotation
+	}
+
+	if rpID := os.Getenv("WEBAUTHN_RP_ID"); rpID != "" {
+		cfg.WebAuthn.RPID = rpID
+	}
+	if rpOrigins := os.Getenv("WEBAUTHN_RP_ORIGINS"); rpOrigins != "" {
+		cfg.WebAuthn.RPOrigins = strings.Split(rpOrigins, ",")
+		for i, origin := range cfg.WebAuthn.RPOrigins {
+			cfg.WebAuthn.RPOrigins[i] = strings.TrimSpace(origin)
+		}
+	}
+
+	if enabled := os.Getenv("OIDC_ENABLED"); enabled != "" {
+		cfg.OIDC.Enabled = enabled == "true"
+	}
+	if issuer := os.Getenv("OIDC_ISSUER_URL"); issuer != "" {
+		cfg.OIDC.IssuerURL = issuer
+	}
+	if clientID := os.Getenv("OIDC_CLIENT_ID"); clientID != "" {
+		cfg.OIDC.ClientID = clientID
+	}
+	if clientSecret := os.Getenv("OIDC_CLIENT_SECRET"); clientSecret != "" {
+		cfg.OIDC.ClientSecret = clientSecret
+	}
+	if redirectURL := os.Getenv("OIDC_REDIRECT_URL"); redirectURL != "" {
+		cfg.OIDC.RedirectURL = redirectURL
+	}
 
 	// Add CORS environment variable overrides
 	if corsOrigins := os.Getenv("CORS_ALLOWED_ORIGINS"); corsOrigins != "" {
@@ -242,6 +331,85 @@ func Load() (*Config, error) {
 		cfg.CloudStorage.PrivateContainer = privateContainer
 	}
 
+	if enabled := os.Getenv("EMAIL_ENABLED"); enabled != "" {
+		cfg.Email.Enabled = enabled == "true"
+	}
+	if smtpHost := os.Getenv("EMAIL_SMTP_HOST"); smtpHost != "" {
+		cfg.Email.SMTPHost = smtpHost
+	}
+	if smtpPort := os.Getenv("EMAIL_SMTP_PORT"); smtpPort != "" {
+		if port, err := strconv.Atoi(smtpPort); err == nil {
+			cfg.Email.SMTPPort = port
+		}
+	}
+	if username := os.Getenv("EMAIL_USERNAME"); username != "" {
+		cfg.Email.Username = username
+	}
+	if password := os.Getenv("EMAIL_PASSWORD"); password != "" {
+		cfg.Email.Password = password
+	}
+	if from := os.Getenv("EMAIL_FROM"); from != "" {
+		cfg.Email.From = from
+	}
+
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		cfg.Server.TrustedProxies = strings.Split(proxies, ",")
+	}
+	if store := os.Getenv("RATE_LIMIT_STORE"); store != "" {
+		cfg.RateLimit.Store = store
+	}
+
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		cfg.Logging.Level = level
+	}
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		cfg.Logging.Format = format
+	}
+	if output := os.Getenv("LOG_OUTPUT"); output != "" {
+		cfg.Logging.Output = output
+	}
+
+	if cron, ok := os.LookupEnv("CLEANUP_CRON"); ok {
+		cfg.Cleanup.Cron = cron
+	}
+
+	if enabled := os.Getenv("SCANNER_ENABLED"); enabled != "" {
+		cfg.Scanner.Enabled = enabled == "true"
+	}
+	if scannerType := os.Getenv("SCANNER_TYPE"); scannerType != "" {
+		cfg.Scanner.Type = scannerType
+	}
+	if address := os.Getenv("SCANNER_ADDRESS"); address != "" {
+		cfg.Scanner.Address = address
+	}
+	if timeout := os.Getenv("SCANNER_TIMEOUT"); timeout != "" {
+		cfg.Scanner.Timeout = timeout
+	}
+
+	if enabled := os.Getenv("METRICS_ENABLED"); enabled != "" {
+		cfg.Metrics.Enabled = enabled == "true"
+	}
+	if metricsPort := os.Getenv("METRICS_PORT"); metricsPort != "" {
+		if port, err := strconv.Atoi(metricsPort); err == nil {
+			cfg.Metrics.Port = port
+		}
+	}
+
+	if exporter := os.Getenv("TRACING_EXPORTER"); exporter != "" {
+		cfg.Tracing.Exporter = exporter
+	}
+	if endpoint := os.Getenv("TRACING_ENDPOINT"); endpoint != "" {
+		cfg.Tracing.Endpoint = endpoint
+	}
+	if serviceName := os.Getenv("TRACING_SERVICE_NAME"); serviceName != "" {
+		cfg.Tracing.ServiceName = serviceName
+	}
+	if ratio := os.Getenv("TRACING_SAMPLE_RATIO"); ratio != "" {
+		if r, err := strconv.ParseFloat(ratio, 64); err == nil {
+			cfg.Tracing.SampleRatio = r
+		}
+	}
+
 	return &cfg, nil
 }
 
@@ -280,6 +448,10 @@ func (c *JWTConfig) GetRefreshTokenExpiry() (time.Duration, error) {
 	return parseDuration(c.RefreshTokenExpiry)
 }
 
+func (c *JWTConfig) GetRotationInterval() (time.Duration, error) {
+	return parseDuration(c.RotationInterval)
+}
+
 func (c *ServerConfig) GetReadTimeout() (time.Duration, error) {
 	return parseDuration(c.ReadTimeout)
 }
@@ -296,6 +468,14 @@ func (c *DatabaseConfig) GetConnMaxLifetime() (time.Duration, error) {
 	return parseDuration(c.ConnMaxLifetime)
 }
 
+func (c *CleanupConfig) GetRetryDelay() (time.Duration, error) {
+	return parseDuration(c.RetryDelay)
+}
+
+func (c *ScannerConfig) GetTimeout() (time.Duration, error) {
+	return parseDuration(c.Timeout)
+}
+
 func (c *CORSConfig) GetMaxAge() (time.Duration, error) {
 	return parseDuration(c.MaxAge)
 }
@@ -1,7 +1,11 @@
 package controllers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
@@ -10,7 +14,8 @@ import (
 )
 
 type AuthController struct {
-	authService *services.AuthService
+	authService     *services.AuthService
+	webAuthnService *services.WebAuthnService
 }
 
 func NewAuthController(authService *services.AuthService) *AuthController {
@@ -49,6 +54,11 @@ type changePasswordRequest struct {
 	NewPassword string `json:"newPassword" binding:"required,min=8"`
 }
 
+// SetWebAuthnService lets the password step offer registered security keys as a second factor.
+func (a *AuthController) SetWebAuthnService(webAuthnService *services.WebAuthnService) {
+	a.webAuthnService = webAuthnService
+}
+
 // Register handles POST /auth/register
 func (a *AuthController) Register(c *gin.Context) {
 	var req registerRequest
@@ -81,35 +91,63 @@ func (a *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	user, totpEnabled, err := a.authService.Login(req.Email, req.Password)
+	user, totpEnabled, err := a.authService.Login(req.Email, req.Password, clientInfoFromContext(c))
 	if err != nil {
+		var lockedErr *services.AccountLockedError
+		if errors.As(err, &lockedErr) {
+			writeAccountLocked(c, lockedErr.Until)
+			return
+		}
 		if err == services.ErrInvalidCredentials {
 			writeError(c, http.StatusUnauthorized, "Unauthorized", "Invalid email or password")
 			return
 		}
+		if err == services.ErrAccountSuspended {
+			writeAccountSuspended(c)
+			return
+		}
 		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
 		return
 	}
 
-	if totpEnabled {
-		// TOTP is enabled: create a short-lived login session identified by cid.
+	webAuthnEnabled := false
+	if a.webAuthnService != nil {
+		webAuthnEnabled, err = a.webAuthnService.HasCredentials(user.ID)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+			return
+		}
+	}
+
+	if totpEnabled || webAuthnEnabled {
+		// A second factor is enabled: create a short-lived login session identified by cid.
 		cid, err := a.authService.CreateLoginSession(user.ID)
 		if err != nil {
 			writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
 			return
 		}
 
+		methods := []string{}
+		if totpEnabled {
+			methods = append(methods, "totp")
+		}
+		if webAuthnEnabled {
+			methods = append(methods, "webauthn")
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"requireTOTP": true,
-			"message":     "TOTP verification required",
-			"cid":         cid,
+			"requireTOTP":         totpEnabled,
+			"requireSecondFactor": true,
+			"secondFactorMethods": methods,
+			"message":             "Second factor verification required",
+			"cid":                 cid,
 		})
 		return
 	}
 
 	token, err := a.authService.GenerateAccessToken(user)
 	if err != nil {
-		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		writeTokenError(c, err)
 		return
 	}
 
@@ -133,8 +171,13 @@ func (a *AuthController) LoginTOTP(c *gin.Context) {
 		return
 	}
 
-	user, err := a.authService.LoginWithTOTPSession(cid, req.Code)
+	user, err := a.authService.LoginWithTOTPSession(cid, req.Code, clientInfoFromContext(c))
 	if err != nil {
+		var lockedErr *services.AccountLockedError
+		if errors.As(err, &lockedErr) {
+			writeAccountLocked(c, lockedErr.Until)
+			return
+		}
 		switch err {
 		case services.ErrInvalidCredentials, services.ErrInvalidTOTPCode, services.ErrTOTPNotEnabled, services.ErrTOTPSecretNotCreated:
 			writeError(c, http.StatusUnauthorized, "Unauthorized", "Invalid or expired TOTP code")
@@ -142,6 +185,9 @@ func (a *AuthController) LoginTOTP(c *gin.Context) {
 		case services.ErrLoginSessionExpired:
 			writeError(c, http.StatusUnauthorized, "Unauthorized", "Login session expired. Please restart the login flow.")
 			return
+		case services.ErrTOTPAttemptsExceeded:
+			writeError(c, http.StatusUnauthorized, "Unauthorized", "Too many failed TOTP attempts. Please restart the login flow.")
+			return
 		default:
 			writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
 			return
@@ -150,7 +196,7 @@ func (a *AuthController) LoginTOTP(c *gin.Context) {
 
 	token, err := a.authService.GenerateAccessToken(user)
 	if err != nil {
-		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		writeTokenError(c, err)
 		return
 	}
 
@@ -212,6 +258,13 @@ func (a *AuthController) TOTPVerify(c *gin.Context) {
 	})
 }
 
+// JWKS handles GET /.well-known/jwks.json
+// Publishes the public keys that verify access tokens (empty when signing with HS256).
+func (a *AuthController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, a.authService.KeyManager().JWKS())
+}
+
 // Profile handles GET /user
 func (a *AuthController) Profile(c *gin.Context) {
 	userID, ok := userIDFromContext(c)
@@ -235,6 +288,52 @@ func (a *AuthController) Profile(c *gin.Context) {
 	})
 }
 
+// SecurityEvents handles GET /user/security-events
+func (a *AuthController) SecurityEvents(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Invalid user context")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	events, total, err := a.authService.GetSecurityEvents(userID, limit, (page-1)*limit)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		return
+	}
+
+	eventsResponse := make([]gin.H, 0, len(events))
+	for _, e := range events {
+		eventsResponse = append(eventsResponse, gin.H{
+			"id":        e.ID,
+			"eventType": e.EventType,
+			"ipAddress": e.IPAddress,
+			"userAgent": e.UserAgent,
+			"details":   e.Details,
+			"createdAt": e.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": eventsResponse,
+		"pagination": gin.H{
+			"currentPage":  page,
+			"totalPages":   int(math.Ceil(float64(total) / float64(limit))),
+			"totalRecords": total,
+			"limit":        limit,
+		},
+	})
+}
+
 // Logout handles POST /auth/logout
 func (a *AuthController) Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -340,6 +439,40 @@ func writeError(c *gin.Context, status int, errStr, msg string) {
 	})
 }
 
+// writeAccountLocked responds 429 with Retry-After while an account lockout is active.
+func writeAccountLocked(c *gin.Context, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Account locked",
+		"message":     "Too many failed verification attempts. Please try again later.",
+		"lockedUntil": until,
+	})
+}
+
+func writeAccountSuspended(c *gin.Context) {
+	writeError(c, http.StatusForbidden, "Account suspended", "This account has been suspended. Contact an administrator.")
+}
+
+// writeTokenError reports a GenerateAccessToken failure.
+func writeTokenError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrAccountSuspended) {
+		writeAccountSuspended(c)
+		return
+	}
+	writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+}
+
+func clientInfoFromContext(c *gin.Context) services.ClientInfo {
+	return services.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
 func writeValidationError(c *gin.Context, err error) {
 	writeError(c, http.StatusBadRequest, "Validation error", err.Error())
 }
@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"mime"
 	"net/http"
@@ -15,6 +17,7 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/metrics"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
@@ -27,6 +30,10 @@ type FileController struct {
 	fileService    *services.FileService
 	statsService   *services.StatisticsService
 	historyService *services.DownloadHistoryService
+	abuseReports   *services.AbuseReportService
+	filePasswords  *services.FilePasswordService
+	fileEvents     *services.FileEventService
+	analytics      *services.FileAnalyticsService
 }
 
 func NewFileController(
@@ -40,10 +47,33 @@ func NewFileController(
 	}
 }
 
+// SetAbuseReportService enables POST /files/:shareToken/report.
+func (fc *FileController) SetAbuseReportService(abuseReports *services.AbuseReportService) {
+	fc.abuseReports = abuseReports
+}
+
+// SetFilePasswordService enables brute-force protection and download grants for
+// password-protected files. Without it passwords are only compared.
+func (fc *FileController) SetFilePasswordService(filePasswords *services.FilePasswordService) {
+	fc.filePasswords = filePasswords
+}
+
+// SetFileEventService records downloads and previews in the history and statistics.
+// Without it transfers are not counted.
+func (fc *FileController) SetFileEventService(fileEvents *services.FileEventService) {
+	fc.fileEvents = fileEvents
+}
+
+// SetFileAnalyticsService enables GET /files/analytics/:id and GET /user/analytics.
+func (fc *FileController) SetFileAnalyticsService(analytics *services.FileAnalyticsService) {
+	fc.analytics = analytics
+}
+
 // GetPolicyLimits exposes limited system policy info for client-side validation.
+// Signed-in callers get the limits of their audience (user, staff, group).
 // GET /policy/limits
 func (fc *FileController) GetPolicyLimits(c *gin.Context) {
-	policy, err := fc.fileService.GetSystemPolicy(c.Request.Context())
+	policy, err := fc.fileService.GetSystemPolicy(c.Request.Context(), getUserIDFromContext(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Internal error",
@@ -55,12 +85,16 @@ func (fc *FileController) GetPolicyLimits(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"maxFileSizeMB":            policy.MaxFileSizeMB,
 		"requirePasswordMinLength": policy.RequirePasswordMinLength,
+		"allowedMimeTypes":         policy.AllowedMimeTypes,
+		"blockedExtensions":        policy.BlockedExtensions,
 	})
 }
 
 // UploadFile handles file upload
 // POST /files/upload
 func (fc *FileController) UploadFile(c *gin.Context) {
+	start := time.Now()
+	extendTransferDeadlines(c)
 	// Get current user (optional - for authenticated uploads)
 	currentUserID := getUserIDFromContext(c)
 
@@ -123,7 +157,7 @@ func (fc *FileController) UploadFile(c *gin.Context) {
 
 	if password != "" {
 		// Validate password length against system policy
-		policy, err := fc.fileService.GetSystemPolicy(c.Request.Context())
+		policy, err := fc.fileService.GetSystemPolicy(c.Request.Context(), currentUserID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Internal server error",
@@ -192,7 +226,7 @@ func (fc *FileController) UploadFile(c *gin.Context) {
 
 	// Additional validation against system policy when custom availability is provided
 	if availableFrom != nil || availableTo != nil {
-		policy, err := fc.fileService.GetSystemPolicy(c.Request.Context())
+		policy, err := fc.fileService.GetSystemPolicy(c.Request.Context(), currentUserID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Internal server error",
@@ -237,7 +271,7 @@ func (fc *FileController) UploadFile(c *gin.Context) {
 	}
 
 	// Check file size against system policy
-	policy, err := fc.fileService.GetSystemPolicy(c.Request.Context())
+	policy, err := fc.fileService.GetSystemPolicy(c.Request.Context(), currentUserID)
 	if err == nil {
 		maxSizeBytes := int64(policy.MaxFileSizeMB) * 1024 * 1024
 		if fileHeader.Size > maxSizeBytes {
@@ -268,6 +302,13 @@ func (fc *FileController) UploadFile(c *gin.Context) {
 
 	storedFile, err := fc.fileService.UploadFile(c.Request.Context(), uploadInput)
 	if err != nil {
+		if errors.Is(err, services.ErrFileTypeNotAllowed) || errors.Is(err, services.ErrFileTypeMismatch) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error":   "Unsupported file type",
+				"message": err.Error(),
+			})
+			return
+		}
 		// Check for specific error types
 		if strings.Contains(err.Error(), "anonymous private uploads") {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -283,12 +324,14 @@ func (fc *FileController) UploadFile(c *gin.Context) {
 			})
 			return
 		}
+		metrics.ObserveTransfer(metrics.DirectionUpload, 0, start, false)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Internal server error",
 			"message": err.Error(),
 		})
 		return
 	}
+	metrics.ObserveTransfer(metrics.DirectionUpload, storedFile.FileSize, start, true)
 
 	// Build response with file information
 	response := gin.H{
@@ -309,6 +352,9 @@ func (fc *FileController) UploadFile(c *gin.Context) {
 	if len(sharedWithEmailsResponse) > 0 {
 		response["file"].(gin.H)["sharedWith"] = sharedWithEmailsResponse
 	}
+	if storedFile.ScanStatus != nil {
+		response["file"].(gin.H)["scanStatus"] = *storedFile.ScanStatus
+	}
 
 	c.JSON(http.StatusCreated, response)
 }
@@ -319,7 +365,7 @@ func (fc *FileController) GetFileInfo(c *gin.Context) {
 	shareToken := c.Param("shareToken")
 
 	// Get file metadata from database
-	file, err := fc.fileService.GetByShareToken(shareToken)
+	file, err := fc.fileService.WithContext(c.Request.Context()).GetByShareToken(shareToken)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -328,6 +374,14 @@ func (fc *FileController) GetFileInfo(c *gin.Context) {
 			})
 			return
 		}
+		if errors.Is(err, services.ErrFileTakenDown) {
+			writeTakenDown(c)
+			return
+		}
+		if errors.Is(err, services.ErrShareDisabled) {
+			writeShareDisabled(c)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Internal server error",
 			"message": "Failed to retrieve file",
@@ -364,6 +418,9 @@ func (fc *FileController) GetFileInfo(c *gin.Context) {
 	if file.MimeType != nil && *file.MimeType != "" {
 		response["file"].(gin.H)["mimeType"] = *file.MimeType
 	}
+	if file.ScanStatus != nil {
+		response["file"].(gin.H)["scanStatus"] = *file.ScanStatus
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -547,6 +604,13 @@ func (fc *FileController) DeleteFile(c *gin.Context) {
 
 	// Delete file
 	err = fc.fileService.Delete(fileID)
+	if errors.Is(err, services.ErrLegalHold) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Legal hold",
+			"message": "File is under legal hold and cannot be deleted",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Internal server error",
@@ -570,7 +634,7 @@ func (fc *FileController) DownloadFile(c *gin.Context) {
 	currentUserEmail := getUserEmailFromContext(c)
 
 	// Get file metadata from database with relationships
-	file, err := fc.fileService.GetByShareToken(shareToken)
+	file, err := fc.fileService.WithContext(c.Request.Context()).GetByShareToken(shareToken)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -579,6 +643,14 @@ func (fc *FileController) DownloadFile(c *gin.Context) {
 			})
 			return
 		}
+		if errors.Is(err, services.ErrFileTakenDown) {
+			writeTakenDown(c)
+			return
+		}
+		if errors.Is(err, services.ErrShareDisabled) {
+			writeShareDisabled(c)
+			return
+		}
 		return
 	}
 
@@ -635,30 +707,21 @@ func (fc *FileController) DownloadFile(c *gin.Context) {
 	}
 
 	// Security check 3: Password protection (owner can bypass)
-	if file.HasPassword() && !isOwner {
-		password := strings.TrimSpace(c.GetHeader("X-File-Password"))
-
-		if password == "" {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":   "Password required",
-				"message": "This file is password-protected",
-			})
-			return
-		}
+	if file.HasPassword() && !isOwner && !fc.checkFilePassword(c, file, currentUserID) {
+		return
+	}
 
-		if err := bcrypt.CompareHashAndPassword([]byte(*file.PasswordHash), []byte(password)); err != nil {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":   "Incorrect password",
-				"message": "The file password is incorrect",
-			})
-			return
-		}
+	// Security check 4: Malware scan verdict (applies to the owner too)
+	if !fc.checkScanStatus(c, file) {
+		return
 	}
 
 	container := containerFromFile(file)
 
+	start := time.Now()
 	downloadResult, err := fc.fileService.Download(c.Request.Context(), &file.FilePath, container)
 	if err != nil {
+		metrics.ObserveTransfer(metrics.DirectionDownload, 0, start, false)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Download failed",
 			"message": err.Error(),
@@ -667,48 +730,15 @@ func (fc *FileController) DownloadFile(c *gin.Context) {
 	}
 	defer downloadResult.Reader.Close()
 
+	extendTransferDeadlines(c)
 	c.Header("Content-Disposition", "attachment; filename=\""+file.FileName+"\"")
 	c.Header("Content-Type", downloadResult.ContentType)
-	c.Header("Content-Length", fmt.Sprintf("%d", downloadResult.Size))
 
-	c.Status(http.StatusOK)
-	bytesCopied, copyError := io.Copy(c.Writer, downloadResult.Reader)
-
-	isCompleted := copyError == nil && bytesCopied == downloadResult.Size
-
-	fileID := file.ID
-	userID := currentUserID
-
-	go func() {
-		err := fc.historyService.Create(&models.DownloadHistory{
-			FileID:            fileID,
-			DownloaderID:      userID,
-			DownloadCompleted: &isCompleted,
-			DownloadedAt:      time.Now(),
-		})
-		if err != nil {
-			fmt.Printf("Failed to record history: %v\n", err)
-		}
-
-		if isCompleted {
-			_ = fc.statsService.IncrementDownloadCount(fileID)
-			_ = fc.statsService.UpdateLastDownloadedAt(fileID)
-
-			if userID != nil {
-				history, _ := fc.historyService.GetByFileIDAndDownloaderID(fileID, *userID)
-
-				successCount := 0
-				for _, h := range history {
-					if h.DownloadCompleted != nil && *h.DownloadCompleted {
-						successCount++
-					}
-				}
-				if successCount == 1 {
-					_ = fc.statsService.IncrementUniqueDownloaders(fileID)
-				}
-			}
-		}
-	}()
+	bytesSent, isCompleted, finished := serveFileObject(c, file, downloadResult)
+	metrics.ObserveTransfer(metrics.DirectionDownload, bytesSent, start, isCompleted)
+	if finished {
+		fc.recordFileEvent(c, file, models.FileEventDownload, currentUserID, bytesSent, isCompleted)
+	}
 }
 
 // PreviewFile handles file preview/streaming by share token (inline display)
@@ -720,7 +750,7 @@ func (fc *FileController) PreviewFile(c *gin.Context) {
 	currentUserEmail := getUserEmailFromContext(c)
 
 	// Get file metadata from database with relationships
-	file, err := fc.fileService.GetByShareToken(shareToken)
+	file, err := fc.fileService.WithContext(c.Request.Context()).GetByShareToken(shareToken)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -729,6 +759,14 @@ func (fc *FileController) PreviewFile(c *gin.Context) {
 			})
 			return
 		}
+		if errors.Is(err, services.ErrFileTakenDown) {
+			writeTakenDown(c)
+			return
+		}
+		if errors.Is(err, services.ErrShareDisabled) {
+			writeShareDisabled(c)
+			return
+		}
 		return
 	}
 
@@ -785,30 +823,21 @@ func (fc *FileController) PreviewFile(c *gin.Context) {
 	}
 
 	// Security check 3: Password protection (owner can bypass)
-	if file.HasPassword() && !isOwner {
-		password := strings.TrimSpace(c.GetHeader("X-File-Password"))
-
-		if password == "" {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":   "Password required",
-				"message": "This file is password-protected",
-			})
-			return
-		}
+	if file.HasPassword() && !isOwner && !fc.checkFilePassword(c, file, currentUserID) {
+		return
+	}
 
-		if err := bcrypt.CompareHashAndPassword([]byte(*file.PasswordHash), []byte(password)); err != nil {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":   "Incorrect password",
-				"message": "The file password is incorrect",
-			})
-			return
-		}
+	// Security check 4: Malware scan verdict (applies to the owner too)
+	if !fc.checkScanStatus(c, file) {
+		return
 	}
 
 	container := containerFromFile(file)
 
+	start := time.Now()
 	downloadResult, err := fc.fileService.Download(c.Request.Context(), &file.FilePath, container)
 	if err != nil {
+		metrics.ObserveTransfer(metrics.DirectionPreview, 0, start, false)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Preview failed",
 			"message": err.Error(),
@@ -817,21 +846,250 @@ func (fc *FileController) PreviewFile(c *gin.Context) {
 	}
 	defer downloadResult.Reader.Close()
 
+	extendTransferDeadlines(c)
 	// KEY DIFFERENCE: Use "inline" instead of "attachment" for preview
 	c.Header("Content-Disposition", "inline; filename=\""+file.FileName+"\"")
 	c.Header("Content-Type", downloadResult.ContentType)
-	c.Header("Content-Length", fmt.Sprintf("%d", downloadResult.Size))
 
-	c.Status(http.StatusOK)
-	_, copyError := io.Copy(c.Writer, downloadResult.Reader)
+	bytesSent, isCompleted, finished := serveFileObject(c, file, downloadResult)
+	metrics.ObserveTransfer(metrics.DirectionPreview, bytesSent, start, isCompleted)
+	if finished && !isCompleted {
+		slog.WarnContext(c.Request.Context(), "preview stream interrupted", "file_id", file.ID, "bytes_sent", bytesSent)
+	}
+	if finished {
+		fc.recordFileEvent(c, file, models.FileEventPreview, currentUserID, bytesSent, isCompleted)
+	}
+}
 
-	// Note: Preview doesn't record download history
-	if copyError != nil {
-		fmt.Printf("Preview stream error: %v\n", copyError)
+// serveFileObject writes obj to the response. When the storage backend returned a seekable
+// stream (local storage), Range and If-Range requests are honoured, so a client holding a
+// download grant can resume a download or seek in a preview without resending the password;
+// other backends always send the whole object. It returns the bytes sent, whether the
+// response was sent in full, and whether it finished a transfer of the file: a 200 response
+// or a 206 response whose range ends at the last byte. Other partial responses are not
+// recorded, so a resumed download or a seeking player counts once.
+func serveFileObject(c *gin.Context, file *models.File, obj *storage.DownloadResult) (int64, bool, bool) {
+	seeker, ok := obj.Reader.(io.ReadSeeker)
+	if !ok {
+		c.Header("Accept-Ranges", "none")
+		c.Header("Content-Length", strconv.FormatInt(obj.Size, 10))
+		c.Status(http.StatusOK)
+		sent, err := io.Copy(c.Writer, obj.Reader)
+		return sent, err == nil && sent == obj.Size, true
+	}
+
+	http.ServeContent(c.Writer, c.Request, file.FileName, file.CreatedAt, seeker)
+	sent := int64(c.Writer.Size())
+	if sent < 0 {
+		sent = 0
+	}
+	expected, err := strconv.ParseInt(c.Writer.Header().Get("Content-Length"), 10, 64)
+	completed := err == nil && sent == expected
+	switch c.Writer.Status() {
+	case http.StatusOK:
+		return sent, completed, true
+	case http.StatusPartialContent:
+		return sent, completed, rangeReachesEnd(c.Writer.Header().Get("Content-Range"))
+	default: // 304, 412, 416: no file content was sent
+		return 0, false, false
 	}
 }
 
+// rangeReachesEnd reports whether a single-range Content-Range header ends at the last byte.
+func rangeReachesEnd(contentRange string) bool {
+	var first, last, size int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &first, &last, &size); err != nil {
+		return false
+	}
+	return last == size-1
+}
+
+// recordFileEvent queues a finished transfer for the history and statistics. The insert
+// is not cancelled with the request, so a download the client aborted is still recorded.
+func (fc *FileController) recordFileEvent(c *gin.Context, file *models.File, eventType models.FileEventType, userID *uuid.UUID, bytesSent int64, completed bool) {
+	if fc.fileEvents == nil {
+		return
+	}
+	ctx := context.WithoutCancel(c.Request.Context())
+	err := fc.fileEvents.Record(ctx, &models.FileEvent{
+		FileID:           file.ID,
+		EventType:        eventType,
+		UserID:           userID,
+		Completed:        completed,
+		BytesSent:        bytesSent,
+		ClientCategory:   services.ClassifyClient(c.Request.UserAgent()),
+		ReferrerCategory: fc.fileEvents.ClassifyReferrer(c.Request.Referer(), c.Request.Host),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "recording file event failed", "file_id", file.ID, "type", eventType, "error", err)
+	}
+}
+
+// ReportFile accepts an anonymous abuse report for a shared file
+// POST /files/:shareToken/report
+func (fc *FileController) ReportFile(c *gin.Context) {
+	if fc.abuseReports == nil {
+		writeError(c, http.StatusNotFound, "Not found", "Abuse reporting is not enabled")
+		return
+	}
+
+	var input struct {
+		Reason       string `json:"reason" binding:"required"`
+		Details      string `json:"details" binding:"max=2000"`
+		ContactEmail string `json:"contactEmail" binding:"omitempty,email,max=255"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "reason is required; details at most 2000 characters; contactEmail must be a valid email")
+		return
+	}
+
+	report, created, err := fc.abuseReports.Report(c.Param("shareToken"), services.AbuseReportInput{
+		Reason:       input.Reason,
+		Details:      input.Details,
+		ContactEmail: input.ContactEmail,
+		ReporterIP:   c.ClientIP(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidAbuseReason):
+			writeError(c, http.StatusBadRequest, "Validation error", "reason must be one of malware, copyright, illegal, harassment, spam, other")
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			writeError(c, http.StatusNotFound, "Not found", "File not found")
+		case errors.Is(err, services.ErrFileTakenDown):
+			writeTakenDown(c)
+		case errors.Is(err, services.ErrShareDisabled):
+			writeShareDisabled(c)
+		default:
+			writeError(c, http.StatusInternalServerError, "Internal server error", "Failed to submit report")
+		}
+		return
+	}
+
+	message := "Report received and will be reviewed"
+	if !created {
+		message = "You have already reported this file; it is awaiting review"
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  message,
+		"reportId": report.ID,
+	})
+}
+
+func writeTakenDown(c *gin.Context) {
+	c.JSON(http.StatusUnavailableForLegalReasons, gin.H{
+		"error":   "Unavailable for legal reasons",
+		"message": "This file has been taken down following an abuse report",
+	})
+}
+
+func writeShareDisabled(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Share disabled",
+		"message": "This share link has been disabled",
+	})
+}
+
+// extendTransferDeadlines lifts the server read/write timeouts for a file transfer, which
+// may legitimately outlast them on a slow link; nginx still closes idle connections.
+func extendTransferDeadlines(c *gin.Context) {
+	rc := http.NewResponseController(c.Writer)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+}
+
+// checkFilePassword accepts a download grant (X-Download-Grant header or ?grant=) or the
+// X-File-Password header. After a correct password a new grant is returned in the
+// X-Download-Grant header so later (e.g. range) requests need not resend the password.
+// It writes the refusal and returns false otherwise.
+func (fc *FileController) checkFilePassword(c *gin.Context, file *models.File, currentUserID *uuid.UUID) bool {
+	if fc.filePasswords != nil {
+		grant := c.GetHeader("X-Download-Grant")
+		if grant == "" {
+			grant = c.Query("grant")
+		}
+		if grant != "" && fc.filePasswords.VerifyGrant(file, grant) == nil {
+			return true
+		}
+	}
+
+	password := strings.TrimSpace(c.GetHeader("X-File-Password"))
+	if password == "" {
+		writeError(c, http.StatusForbidden, "Password required", "This file is password-protected")
+		return false
+	}
+
+	if fc.filePasswords == nil {
+		if err := bcrypt.CompareHashAndPassword([]byte(*file.PasswordHash), []byte(password)); err != nil {
+			writeError(c, http.StatusForbidden, "Incorrect password", "The file password is incorrect")
+			return false
+		}
+		return true
+	}
+
+	clientKey := services.FilePasswordClientKey(c.ClientIP())
+	if currentUserID != nil {
+		clientKey = "user:" + currentUserID.String()
+	}
+	now := time.Now().UTC()
+	err := fc.filePasswords.Verify(c.Request.Context(), file, clientKey, password, now)
+	var locked *services.FilePasswordLockedError
+	switch {
+	case err == nil:
+	case errors.As(err, &locked):
+		retryAfter := int(math.Ceil(locked.Until.Sub(now).Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many attempts",
+			"message":     "Too many incorrect password attempts. Please try again later.",
+			"lockedUntil": locked.Until,
+		})
+		return false
+	case errors.Is(err, services.ErrIncorrectFilePassword):
+		writeError(c, http.StatusForbidden, "Incorrect password", "The file password is incorrect")
+		return false
+	default:
+		writeError(c, http.StatusInternalServerError, "Internal server error", "Failed to verify the file password")
+		return false
+	}
+
+	if grant, expiresAt, err := fc.filePasswords.IssueGrant(file, now); err == nil {
+		c.Header("X-Download-Grant", grant)
+		c.Header("X-Download-Grant-Expires", expiresAt.Format(time.RFC3339))
+	} else {
+		slog.WarnContext(c.Request.Context(), "failed to issue download grant", "file_id", file.ID, "error", err)
+	}
+	return true
+}
+
+// checkScanStatus writes the refusal and returns false when the scan download policy
+// does not allow serving the file.
+func (fc *FileController) checkScanStatus(c *gin.Context, file *models.File) bool {
+	err := fc.fileService.CheckDownloadAllowed(c.Request.Context(), file)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrFileInfected):
+		writeError(c, http.StatusForbidden, "Malware detected", "This file failed the malware scan and has been quarantined")
+	case errors.Is(err, services.ErrFileNotScanned):
+		if file.ScanStatus != nil && *file.ScanStatus == models.ScanStatusPending {
+			c.Header("Retry-After", "30")
+			writeError(c, http.StatusConflict, "Scan pending", "This file is still being scanned for malware. Please try again shortly")
+		} else {
+			writeError(c, http.StatusConflict, "Scan failed", "This file could not be scanned for malware and cannot be downloaded yet")
+		}
+	default:
+		writeError(c, http.StatusInternalServerError, "Internal server error", "Failed to load system policy")
+	}
+	return false
+}
+
 func containerFromFile(file *models.File) storage.ContainerType {
+	if file != nil && file.QuarantinedAt != nil {
+		return storage.ContainerPrivate
+	}
 	if file != nil && file.IsPublic != nil && *file.IsPublic {
 		return storage.ContainerPublic
 	}
@@ -995,11 +1253,127 @@ func (fc *FileController) GetFileStats(c *gin.Context) {
 			"downloadCount":     stats.DownloadCount,
 			"uniqueDownloaders": stats.UniqueDownloaders,
 			"lastDownloadedAt":  stats.LastDownloadedAt,
+			"previewCount":      stats.PreviewCount,
+			"lastPreviewedAt":   stats.LastPreviewedAt,
 			"createdAt":         stats.CreatedAt,
 		},
 	})
 }
 
+// GetFileAnalytics returns the bucketed downloads (or previews) of a file over a range
+// GET /files/analytics/:id?from=&to=&interval=day|hour&type=download|preview
+func (fc *FileController) GetFileAnalytics(c *gin.Context) {
+	if fc.analytics == nil {
+		writeError(c, http.StatusNotFound, "Not found", "Analytics are not enabled")
+		return
+	}
+	currentUserID := getUserIDFromContext(c)
+	if currentUserID == nil {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Invalid or missing authentication token")
+		return
+	}
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid file ID format (Must be UUID)")
+		return
+	}
+	query, msg := parseAnalyticsQuery(c)
+	if msg != "" {
+		writeError(c, http.StatusBadRequest, "Validation error", msg)
+		return
+	}
+
+	file, err := fc.fileService.GetByID(fileID)
+	if err != nil || file.OwnerID == nil {
+		writeError(c, http.StatusNotFound, "Not found", "File not found or statistics not available (anonymous upload)")
+		return
+	}
+	if *currentUserID != *file.OwnerID && getUserRoleFromContext(c) != models.RoleAdmin {
+		writeError(c, http.StatusForbidden, "Forbidden", "You don't have permission to view analytics for this file")
+		return
+	}
+
+	analytics, err := fc.analytics.GetFileAnalytics(c.Request.Context(), file.ID, query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+			writeError(c, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "loading file analytics failed", "file_id", file.ID, "error", err)
+		writeError(c, http.StatusInternalServerError, "Internal server error", "Failed to load analytics")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"fileId":    file.ID,
+		"fileName":  file.FileName,
+		"analytics": analytics,
+	})
+}
+
+// GetUserAnalytics aggregates the downloads (or previews) of all files of the current user
+// GET /user/analytics?from=&to=&interval=day|hour&type=download|preview
+func (fc *FileController) GetUserAnalytics(c *gin.Context) {
+	if fc.analytics == nil {
+		writeError(c, http.StatusNotFound, "Not found", "Analytics are not enabled")
+		return
+	}
+	currentUserID := getUserIDFromContext(c)
+	if currentUserID == nil {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Invalid or missing authentication token")
+		return
+	}
+	query, msg := parseAnalyticsQuery(c)
+	if msg != "" {
+		writeError(c, http.StatusBadRequest, "Validation error", msg)
+		return
+	}
+
+	analytics, err := fc.analytics.GetOwnerAnalytics(c.Request.Context(), *currentUserID, query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+			writeError(c, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "loading user analytics failed", "user_id", *currentUserID, "error", err)
+		writeError(c, http.StatusInternalServerError, "Internal server error", "Failed to load analytics")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"userId":    *currentUserID,
+		"analytics": analytics,
+	})
+}
+
+// parseAnalyticsQuery reads from, to (RFC 3339 or YYYY-MM-DD in UTC), interval and type.
+// It returns a validation message for malformed values; the service checks the range.
+func parseAnalyticsQuery(c *gin.Context) (services.AnalyticsQuery, string) {
+	query := services.AnalyticsQuery{
+		Interval:  services.AnalyticsInterval(c.Query("interval")),
+		EventType: models.FileEventType(c.Query("type")),
+	}
+	for param, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, raw); err != nil {
+				return query, param + " must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+			}
+			// A date as the end of the range includes that whole day
+			if param == "to" {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		*target = t
+	}
+	return query, ""
+}
+
 func getUserRoleFromContext(c *gin.Context) models.UserRole {
 	roleVal, exists := c.Get("userRole")
 	if !exists {
@@ -1254,8 +1628,20 @@ func (fc *FileController) GetDownloadHistory(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
+	// Loại sự kiện: download (mặc định), preview hoặc all
+	eventType := models.FileEventType(c.DefaultQuery("type", string(models.FileEventDownload)))
+	if eventType == "all" {
+		eventType = ""
+	} else if !eventType.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation error",
+			"message": "type must be download, preview or all",
+		})
+		return
+	}
+
 	// GỌI SERVICE
-	histories, totalRecords, err := fc.historyService.GetByFileID(fileID, limit, offset)
+	histories, totalRecords, err := fc.historyService.GetByFileID(fileID, eventType, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Internal server error",
@@ -1279,6 +1665,7 @@ func (fc *FileController) GetDownloadHistory(c *gin.Context) {
 		historyResponse = append(historyResponse, gin.H{
 			"id":                h.ID,
 			"downloader":        downloaderInfo,
+			"eventType":         h.EventType,
 			"downloadedAt":      h.DownloadedAt,
 			"downloadCompleted": h.DownloadCompleted,
 		})
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	healthService *services.HealthService
+}
+
+func NewHealthController(healthService *services.HealthService) *HealthController {
+	return &HealthController{
+		healthService: healthService,
+	}
+}
+
+// Live handles GET /health and GET /health/live
+func (h *HealthController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, h.healthService.Liveness())
+}
+
+// Ready handles GET /health/ready; it answers 503 while a required dependency is down.
+func (h *HealthController) Ready(c *gin.Context) {
+	report := h.healthService.Readiness(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCController struct {
+	oidcService *services.OIDCService
+	authService *services.AuthService
+}
+
+func NewOIDCController(oidcService *services.OIDCService, authService *services.AuthService) *OIDCController {
+	return &OIDCController{
+		oidcService: oidcService,
+		authService: authService,
+	}
+}
+
+// Login handles GET /auth/oidc/login
+// Redirects the browser to the identity provider.
+func (o *OIDCController) Login(c *gin.Context) {
+	authURL, err := o.oidcService.AuthorizationURL(c.Request.Context())
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback handles GET /auth/oidc/callback
+// Exchanges the authorization code and returns an access token like /auth/login.
+func (o *OIDCController) Callback(c *gin.Context) {
+	if idpErr := c.Query("error"); idpErr != "" {
+		msg := c.Query("error_description")
+		if msg == "" {
+			msg = idpErr
+		}
+		writeError(c, http.StatusUnauthorized, "Unauthorized", msg)
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" {
+		writeError(c, http.StatusBadRequest, "Validation error", "Missing code or state")
+		return
+	}
+
+	user, err := o.oidcService.Callback(c.Request.Context(), state, code)
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+
+	token, err := o.authService.GenerateAccessToken(user)
+	if err != nil {
+		writeTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accessToken": token,
+		"user":        sanitizeUser(user),
+	})
+}
+
+func writeOIDCError(c *gin.Context, err error) {
+	var lockedErr *services.AccountLockedError
+	if errors.As(err, &lockedErr) {
+		writeAccountLocked(c, lockedErr.Until)
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrOIDCDisabled):
+		writeError(c, http.StatusNotFound, "Not found", err.Error())
+	case errors.Is(err, services.ErrOIDCInvalidState):
+		writeError(c, http.StatusBadRequest, "Bad request", "SSO session expired. Please try again.")
+	case errors.Is(err, services.ErrOIDCTokenInvalid):
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "SSO login failed")
+	case errors.Is(err, services.ErrOIDCMissingEmail), errors.Is(err, services.ErrOIDCEmailNotVerified):
+		writeError(c, http.StatusForbidden, "Forbidden", err.Error())
+	case errors.Is(err, services.ErrOIDCProviderDown):
+		writeError(c, http.StatusBadGateway, "Bad gateway", err.Error())
+	default:
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+	}
+}
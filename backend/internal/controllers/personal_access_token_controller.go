@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PersonalAccessTokenController struct {
+	tokenService *services.PersonalAccessTokenService
+}
+
+func NewPersonalAccessTokenController(tokenService *services.PersonalAccessTokenService) *PersonalAccessTokenController {
+	return &PersonalAccessTokenController{
+		tokenService: tokenService,
+	}
+}
+
+type createAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+// Create handles POST /user/tokens
+func (p *PersonalAccessTokenController) Create(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Missing user in context")
+		return
+	}
+
+	var req createAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeValidationError(c, err)
+		return
+	}
+
+	raw, token, err := p.tokenService.Create(userID, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAccessTokenName) ||
+			errors.Is(err, services.ErrInvalidTokenScopes) ||
+			errors.Is(err, services.ErrInvalidTokenExpiry) {
+			writeError(c, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Personal access token created. Copy it now, it will not be shown again.",
+		"token":     raw,
+		"tokenInfo": token,
+	})
+}
+
+// List handles GET /user/tokens
+func (p *PersonalAccessTokenController) List(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Missing user in context")
+		return
+	}
+
+	tokens, err := p.tokenService.List(userID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+	})
+}
+
+// Revoke handles DELETE /user/tokens/:id
+func (p *PersonalAccessTokenController) Revoke(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Missing user in context")
+		return
+	}
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid token id format")
+		return
+	}
+
+	if err := p.tokenService.Revoke(userID, tokenID); err != nil {
+		if errors.Is(err, services.ErrAccessTokenNotFound) {
+			writeError(c, http.StatusNotFound, "Not found", "Token not found or already revoked")
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Personal access token revoked",
+	})
+}
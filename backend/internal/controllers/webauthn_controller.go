@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type WebAuthnController struct {
+	webAuthnService *services.WebAuthnService
+	authService     *services.AuthService
+}
+
+func NewWebAuthnController(webAuthnService *services.WebAuthnService, authService *services.AuthService) *WebAuthnController {
+	return &WebAuthnController{
+		webAuthnService: webAuthnService,
+		authService:     authService,
+	}
+}
+
+type webAuthnRegisterFinishRequest struct {
+	SessionID  string          `json:"sessionId" binding:"required"`
+	Name       string          `json:"name" binding:"required,max=100"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type webAuthnLoginBeginRequest struct {
+	CID string `json:"cid" binding:"required"`
+}
+
+type webAuthnLoginFinishRequest struct {
+	CID        string          `json:"cid" binding:"required"`
+	SessionID  string          `json:"sessionId" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type passkeyLoginFinishRequest struct {
+	SessionID  string          `json:"sessionId" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type webAuthnRenameRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// RegisterBegin handles POST /auth/webauthn/register/begin
+func (w *WebAuthnController) RegisterBegin(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Missing user in context")
+		return
+	}
+
+	options, sessionID, err := w.webAuthnService.BeginRegistration(userID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessionId": sessionID,
+		"options":   options,
+	})
+}
+
+// RegisterFinish handles POST /auth/webauthn/register/finish
+func (w *WebAuthnController) RegisterFinish(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Missing user in context")
+		return
+	}
+
+	var req webAuthnRegisterFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeValidationError(c, err)
+		return
+	}
+	sessionID, err := uuid.Parse(req.SessionID)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid sessionId format")
+		return
+	}
+
+	credential, err := w.webAuthnService.FinishRegistration(userID, sessionID, req.Name, req.Credential)
+	if err != nil {
+		writeWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Security key registered successfully",
+		"credential": credential,
+	})
+}
+
+// ListCredentials handles GET /auth/webauthn/credentials
+func (w *WebAuthnController) ListCredentials(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Missing user in context")
+		return
+	}
+
+	credentials, err := w.webAuthnService.ListCredentials(userID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credentials": credentials,
+	})
+}
+
+// RenameCredential handles PATCH /auth/webauthn/credentials/:id
+func (w *WebAuthnController) RenameCredential(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Missing user in context")
+		return
+	}
+
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid credential id format")
+		return
+	}
+
+	var req webAuthnRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeValidationError(c, err)
+		return
+	}
+
+	if err := w.webAuthnService.RenameCredential(userID, credentialID, req.Name); err != nil {
+		writeWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Security key renamed successfully",
+	})
+}
+
+// DeleteCredential handles DELETE /auth/webauthn/credentials/:id
+func (w *WebAuthnController) DeleteCredential(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Missing user in context")
+		return
+	}
+
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid credential id format")
+		return
+	}
+
+	if err := w.webAuthnService.DeleteCredential(userID, credentialID); err != nil {
+		writeWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Security key removed successfully",
+	})
+}
+
+// LoginBegin handles POST /auth/login/webauthn/begin
+func (w *WebAuthnController) LoginBegin(c *gin.Context) {
+	var req webAuthnLoginBeginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeValidationError(c, err)
+		return
+	}
+	cid, err := uuid.Parse(req.CID)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid cid format")
+		return
+	}
+
+	options, sessionID, err := w.webAuthnService.BeginSecondFactor(cid)
+	if err != nil {
+		writeWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessionId": sessionID,
+		"options":   options,
+	})
+}
+
+// LoginFinish handles POST /auth/login/webauthn/finish
+func (w *WebAuthnController) LoginFinish(c *gin.Context) {
+	var req webAuthnLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeValidationError(c, err)
+		return
+	}
+	cid, err := uuid.Parse(req.CID)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid cid format")
+		return
+	}
+	sessionID, err := uuid.Parse(req.SessionID)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid sessionId format")
+		return
+	}
+
+	user, err := w.webAuthnService.FinishSecondFactor(cid, sessionID, req.Credential)
+	if err != nil {
+		writeWebAuthnError(c, err)
+		return
+	}
+
+	token, err := w.authService.GenerateAccessToken(user)
+	if err != nil {
+		writeTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accessToken": token,
+		"user":        sanitizeUser(user),
+	})
+}
+
+// PasskeyBegin handles POST /auth/login/passkey/begin
+func (w *WebAuthnController) PasskeyBegin(c *gin.Context) {
+	options, sessionID, err := w.webAuthnService.BeginPasswordless()
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessionId": sessionID,
+		"options":   options,
+	})
+}
+
+// PasskeyFinish handles POST /auth/login/passkey/finish
+func (w *WebAuthnController) PasskeyFinish(c *gin.Context) {
+	var req passkeyLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeValidationError(c, err)
+		return
+	}
+	sessionID, err := uuid.Parse(req.SessionID)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Validation error", "Invalid sessionId format")
+		return
+	}
+
+	user, err := w.webAuthnService.FinishPasswordless(sessionID, req.Credential)
+	if err != nil {
+		writeWebAuthnError(c, err)
+		return
+	}
+
+	token, err := w.authService.GenerateAccessToken(user)
+	if err != nil {
+		writeTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accessToken": token,
+		"user":        sanitizeUser(user),
+	})
+}
+
+func writeWebAuthnError(c *gin.Context, err error) {
+	var lockedErr *services.AccountLockedError
+	if errors.As(err, &lockedErr) {
+		writeAccountLocked(c, lockedErr.Until)
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrLoginSessionExpired):
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Login session expired. Please restart the login flow.")
+	case errors.Is(err, services.ErrWebAuthnSessionExpired):
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "WebAuthn challenge expired. Please try again.")
+	case errors.Is(err, services.ErrWebAuthnVerificationFailed),
+		errors.Is(err, services.ErrWebAuthnCloneDetected),
+		errors.Is(err, services.ErrInvalidCredentials):
+		writeError(c, http.StatusUnauthorized, "Unauthorized", "Security key verification failed")
+	case errors.Is(err, services.ErrWebAuthnNoCredentials):
+		writeError(c, http.StatusBadRequest, "Bad request", "No security keys registered for this account")
+	case errors.Is(err, services.ErrWebAuthnInvalidCredentialName):
+		writeError(c, http.StatusBadRequest, "Validation error", err.Error())
+	case errors.Is(err, services.ErrWebAuthnCredentialNotFound):
+		writeError(c, http.StatusNotFound, "Not found", "Security key not found")
+	default:
+		writeError(c, http.StatusInternalServerError, "Internal error", err.Error())
+	}
+}
@@ -1,8 +1,9 @@
 package database
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
@@ -16,7 +17,18 @@ var DB *gorm.DB
 func Connect(cfg *config.DatabaseConfig) error {
 	dsn := cfg.GetDSN()
 
-	gormLogger := logger.Default.LogMode(logger.Info)
+	// SQL is logged with placeholders only, so parameter values (hashes, emails) stay out
+	// of the logs. Every statement is logged at debug level; otherwise only errors and slow queries.
+	logLevel := logger.Warn
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		logLevel = logger.Info
+	}
+	gormLogger := logger.NewSlogLogger(slog.Default(), logger.Config{
+		LogLevel:                  logLevel,
+		SlowThreshold:             200 * time.Millisecond,
+		ParameterizedQueries:      true,
+		IgnoreRecordNotFoundError: true,
+	})
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger: gormLogger,
@@ -47,7 +59,7 @@ func Connect(cfg *config.DatabaseConfig) error {
 	}
 
 	DB = db
-	log.Println("Database connected successfully")
+	slog.Info("database connected", "host", cfg.Host, "name", cfg.Name)
 	return nil
 }
 
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
 	migrate "github.com/golang-migrate/migrate/v4"
@@ -11,8 +13,11 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
-// RunMigrations executes SQL migrations using golang-migrate
-func RunMigrations(cfg *config.DatabaseConfig) error {
+// upMigrationFile matches golang-migrate file names such as 000018_name.up.sql.
+var upMigrationFile = regexp.MustCompile(`^([0-9]+)_.*\.up\.sql$`)
+
+// migrationsPath is MIGRATIONS_PATH or ./migrations, made absolute.
+func migrationsPath() (string, error) {
 	path := os.Getenv("MIGRATIONS_PATH")
 	if path == "" {
 		path = "migrations"
@@ -20,7 +25,16 @@ func RunMigrations(cfg *config.DatabaseConfig) error {
 
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return fmt.Errorf("resolve migrations path: %w", err)
+		return "", fmt.Errorf("resolve migrations path: %w", err)
+	}
+	return absPath, nil
+}
+
+// RunMigrations executes SQL migrations using golang-migrate
+func RunMigrations(cfg *config.DatabaseConfig) error {
+	absPath, err := migrationsPath()
+	if err != nil {
+		return err
 	}
 
 	sourceURL := fmt.Sprintf("file://%s", filepath.ToSlash(absPath))
@@ -37,3 +51,32 @@ func RunMigrations(cfg *config.DatabaseConfig) error {
 
 	return nil
 }
+
+// LatestMigrationVersion returns the highest migration version shipped in the migrations
+// directory, i.e. the schema version this build expects. It returns os.ErrNotExist when the
+// directory is not deployed alongside the binary.
+func LatestMigrationVersion() (uint, error) {
+	absPath, err := migrationsPath()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(absPath)
+	if err != nil {
+		return 0, err
+	}
+	var latest uint
+	for _, entry := range entries {
+		match := upMigrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if uint(version) > latest {
+			latest = uint(version)
+		}
+	}
+	return latest, nil
+}
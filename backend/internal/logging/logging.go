@@ -0,0 +1,196 @@
+// Package logging configures the process-wide log/slog logger from LoggingConfig, attaches
+// the request ID to records logged with a request context and keeps secrets out of logs.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces the value of sensitive attributes, headers and query parameters.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched case-insensitively against attribute keys, header names and
+// query parameters, after "-" is normalized to "_".
+var sensitiveKeys = map[string]bool{
+	"authorization":    true,
+	"cookie":           true,
+	"set_cookie":       true,
+	"x_file_password":  true,
+	"x_cron_secret":    true,
+	"x_download_grant": true,
+	"grant":            true, // download grant in ?grant=
+	"password":         true,
+	"secret":           true,
+	"token":            true,
+	"code":             true, // OIDC authorization code
+	"api_key":          true,
+}
+
+// IsSensitive reports whether a value stored under key must not be logged. Besides the
+// exact names above, anything ending in password, secret or _token is sensitive.
+func IsSensitive(key string) bool {
+	k := strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	if sensitiveKeys[k] {
+		return true
+	}
+	return strings.HasSuffix(k, "password") || strings.HasSuffix(k, "secret") || strings.HasSuffix(k, "_token")
+}
+
+// Headers returns h as a log attribute with sensitive headers redacted.
+func Headers(h http.Header) slog.Attr {
+	attrs := make([]any, 0, len(h))
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		if IsSensitive(name) {
+			value = Redacted
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.Group("headers", attrs...)
+}
+
+// RedactQuery returns the raw query with the values of sensitive parameters redacted.
+func RedactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Redacted
+	}
+	for key := range values {
+		if IsSensitive(key) {
+			values[key] = []string{Redacted}
+		}
+	}
+	return values.Encode()
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindGroup && IsSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// ParseLevel maps LoggingConfig.Level to a slog level; empty means info.
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", level)
+	}
+}
+
+// NewHandler builds the handler described by cfg writing to w: JSON (default) or text
+// records at cfg.Level and above, with sensitive attributes redacted and the request ID of
+// the context added to every record.
+func NewHandler(cfg config.LoggingConfig, w io.Writer) (slog.Handler, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	return contextHandler{handler}, nil
+}
+
+// Setup installs the logger described by cfg as the slog default, which also routes the
+// standard log package through it. Output is stdout (default), stderr or a file path that
+// is appended to; the returned closer closes that file.
+func Setup(cfg config.LoggingConfig) (io.Closer, error) {
+	var (
+		w    io.Writer = os.Stdout
+		file *os.File
+	)
+	switch cfg.Output {
+	case "", "stdout":
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, fmt.Errorf("open log file: %w", err)
+		}
+		w, file = f, f
+	}
+
+	handler, err := NewHandler(cfg, w)
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+	slog.SetDefault(slog.New(handler))
+	if file == nil {
+		return io.NopCloser(nil), nil
+	}
+	return file, nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID and trace of the context to each record, so any
+// slog.*Context call made while serving a request can be correlated with it.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
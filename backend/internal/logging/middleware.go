@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits IDs accepted from clients or proxies to something safe to log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware assigns every request an ID, reusing a well-formed X-Request-ID from the
+// client or a proxy. The ID is echoed in the X-Request-ID response header, stored in the
+// request context for logging (see RequestID) and added as "requestId" to JSON error bodies.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set("requestID", id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+
+		w := &errorBodyWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		w.flush(id)
+		c.Writer = w.ResponseWriter
+	}
+}
+
+// errorBodyWriter holds back JSON error bodies (status >= 400) until the handler chain is
+// done so the request ID can be added to them. Other responses are streamed unchanged.
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	buffered bool
+}
+
+func (w *errorBodyWriter) holdBack() bool {
+	return w.Status() >= http.StatusBadRequest &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if w.buffered || (!w.ResponseWriter.Written() && w.holdBack()) {
+		w.buffered = true
+		return w.buf.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *errorBodyWriter) Written() bool {
+	return w.buffered || w.ResponseWriter.Written()
+}
+
+func (w *errorBodyWriter) Size() int {
+	if w.buffered {
+		return w.buf.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to extend deadlines.
+func (w *errorBodyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *errorBodyWriter) flush(id string) {
+	if !w.buffered {
+		return
+	}
+	body := w.buf.Bytes()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err == nil {
+		if _, exists := fields["requestId"]; !exists {
+			fields["requestId"], _ = json.Marshal(id)
+			if patched, err := json.Marshal(fields); err == nil {
+				body = patched
+			}
+		}
+	}
+	w.Header().Del("Content-Length")
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// AccessLog logs one record per request, replacing gin's default logger. Server errors are
+// logged at error level and client errors at warn; request headers (redacted) are added at
+// debug level.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		ctx := c.Request.Context()
+		logger := slog.Default()
+		if !logger.Enabled(ctx, level) {
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if query := RedactQuery(c.Request.URL.RawQuery); query != "" {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if userID, ok := c.Get("userID"); ok {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, Headers(c.Request.Header))
+		}
+		logger.LogAttrs(ctx, level, "http request", attrs...)
+	}
+}
+
+// Recovery turns a panic into a 500 response and logs it with the request ID,
+// replacing gin's default recovery that writes to stderr.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, recovered any) {
+		slog.ErrorContext(c.Request.Context(), "panic while handling request",
+			"method", c.Request.Method, "path", c.Request.URL.Path, "panic", recovered)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal server error",
+			"message": "An unexpected error occurred",
+		})
+	})
+}
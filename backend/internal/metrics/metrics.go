@@ -0,0 +1,207 @@
+// Package metrics collects Prometheus metrics for the API and serves them on a
+// separate listener so /metrics is never reachable through the public router.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+)
+
+const namespace = "filesharing"
+
+// Transfer directions used by ObserveTransfer.
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+	DirectionPreview  = "preview"
+)
+
+// Registry holds every metric of the process. A dedicated registry keeps the output free of
+// metrics registered by third-party packages on the global default registry.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	transferBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_bytes_total",
+		Help:      "Bytes of file content received (upload) or sent (download, preview).",
+	}, []string{"direction"})
+
+	transferDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transfer_duration_seconds",
+		Help:      "Duration of file uploads and downloads, by whether the transfer completed.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"direction", "result"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Latency of storage backend operations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "operation"})
+
+	storageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Storage backend operations that returned an error. Stat of a missing object is not an error.",
+	}, []string{"backend", "operation"})
+
+	cleanupRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_runs_total",
+		Help:      "Finished expired-file cleanup runs by trigger and status.",
+	}, []string{"trigger", "status", "dry_run"})
+
+	cleanupFiles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_files_total",
+		Help:      "Files handled by cleanup runs (dry runs excluded) by result.",
+	}, []string{"result"})
+
+	cleanupBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_reclaimed_bytes_total",
+		Help:      "Bytes reclaimed by cleanup runs (dry runs excluded).",
+	})
+
+	cleanupLastRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cleanup_last_run_timestamp_seconds",
+		Help:      "Unix time at which the last cleanup run finished, by status.",
+	}, []string{"status"})
+
+	authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Failed authentication attempts by method and reason.",
+	}, []string{"method", "reason"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected with 429 by rate limit rule.",
+	}, []string{"rule"})
+
+	fileEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "file_events_total",
+		Help:      "Download and preview events taken from the outbox, by type and result.",
+	}, []string{"type", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		transferBytes,
+		transferDuration,
+		storageDuration,
+		storageErrors,
+		cleanupRuns,
+		cleanupFiles,
+		cleanupBytes,
+		cleanupLastRun,
+		authFailures,
+		rateLimited,
+		fileEvents,
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// NewServer returns the server of the metrics listener on addr, serving only /metrics.
+func NewServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// RegisterDBStats exports the connection pool statistics of db.
+func RegisterDBStats(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// Middleware records the duration of every request, labelled by the route template
+// (e.g. /api/files/:id) so that IDs in URLs do not create a series each.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveTransfer records a file transfer of n bytes that started at start.
+func ObserveTransfer(direction string, n int64, start time.Time, completed bool) {
+	result := "completed"
+	if !completed {
+		result = "failed"
+	}
+	if n > 0 {
+		transferBytes.WithLabelValues(direction).Add(float64(n))
+	}
+	transferDuration.WithLabelValues(direction, result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCleanupRun records the outcome of a finished cleanup run.
+func ObserveCleanupRun(run *models.CleanupRun) {
+	cleanupRuns.WithLabelValues(string(run.Trigger), string(run.Status), strconv.FormatBool(run.DryRun)).Inc()
+	if run.FinishedAt != nil {
+		cleanupLastRun.WithLabelValues(string(run.Status)).Set(float64(run.FinishedAt.Unix()))
+	}
+	if run.DryRun {
+		return
+	}
+	cleanupFiles.WithLabelValues("deleted").Add(float64(run.FilesDeleted))
+	cleanupFiles.WithLabelValues("failed").Add(float64(run.FilesFailed))
+	cleanupFiles.WithLabelValues("skipped").Add(float64(run.FilesSkipped))
+	cleanupBytes.Add(float64(run.BytesReclaimed))
+}
+
+// AuthFailure counts a rejected authentication attempt. method is how the caller tried to
+// authenticate (password, totp, webauthn, jwt, access_token) and reason a short snake_case cause.
+func AuthFailure(method, reason string) {
+	authFailures.WithLabelValues(method, reason).Inc()
+}
+
+// RateLimited counts a request rejected by the named rate limit rule.
+func RateLimited(rule string) {
+	rateLimited.WithLabelValues(rule).Inc()
+}
+
+// FileEventProcessed counts an outbox event that was applied, scheduled for a retry or
+// given up on (result "applied", "retried" or "failed").
+func FileEventProcessed(eventType, result string) {
+	fileEvents.WithLabelValues(eventType, result).Inc()
+}
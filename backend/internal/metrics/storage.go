@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+)
+
+// instrumentedStorage records the latency and errors of every call to the wrapped backend.
+type instrumentedStorage struct {
+	next    storage.Storage
+	backend string
+}
+
+// InstrumentStorage wraps st so each storage.Storage method is measured under the given
+// backend label (e.g. "local", "azure_blob"). Download measures the time to open the stream,
+// not to read it; reads are covered by the transfer metrics.
+func InstrumentStorage(st storage.Storage, backend string) storage.Storage {
+	return &instrumentedStorage{next: st, backend: backend}
+}
+
+func (s *instrumentedStorage) observe(operation string, start time.Time, err error) {
+	storageDuration.WithLabelValues(s.backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		storageErrors.WithLabelValues(s.backend, operation).Inc()
+	}
+}
+
+func (s *instrumentedStorage) Upload(ctx context.Context, obj *storage.Object) (*storage.Location, error) {
+	start := time.Now()
+	loc, err := s.next.Upload(ctx, obj)
+	s.observe("upload", start, err)
+	return loc, err
+}
+
+func (s *instrumentedStorage) Download(ctx context.Context, loc *storage.Location) (*storage.DownloadResult, error) {
+	start := time.Now()
+	res, err := s.next.Download(ctx, loc)
+	s.observe("download", start, err)
+	return res, err
+}
+
+func (s *instrumentedStorage) Delete(ctx context.Context, loc *storage.Location) error {
+	start := time.Now()
+	err := s.next.Delete(ctx, loc)
+	s.observe("delete", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) Stat(ctx context.Context, loc *storage.Location) (*storage.ObjectInfo, error) {
+	start := time.Now()
+	info, err := s.next.Stat(ctx, loc)
+	s.observe("stat", start, err)
+	return info, err
+}
+
+func (s *instrumentedStorage) List(ctx context.Context, container storage.ContainerType, fn func(storage.ObjectInfo) error) error {
+	start := time.Now()
+	err := s.next.List(ctx, container, fn)
+	s.observe("list", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) Probe(ctx context.Context) error {
+	start := time.Now()
+	err := s.next.Probe(ctx)
+	s.observe("probe", start, err)
+	return err
+}
@@ -1,21 +1,29 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
 
-	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/metrics"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware accepts JWT access tokens verified by keys and, when tokenService is set,
+// personal access tokens. The user is loaded on every request, so suspensions, forced
+// logouts and role changes apply immediately rather than when the token expires.
+// Requests authenticated with a personal access token carry its scopes in the context
+// (see RequireScope); JWT requests are not scope-restricted.
+func AuthMiddleware(keys *services.JWTKeyManager, userRepo repositories.UserRepository, tokenService *services.PersonalAccessTokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			metrics.AuthFailure("jwt", "missing_token")
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error":   "Unauthorized",
 				"message": "Bearer token is required",
@@ -24,11 +32,15 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		}
 
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+		if tokenService != nil && strings.HasPrefix(tokenStr, models.PersonalAccessTokenPrefix) {
+			authenticatePersonalAccessToken(c, tokenService, tokenStr)
+			return
+		}
+
 		claims := &services.TokenClaims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(cfg.JWT.Secret), nil
-		})
-		if err != nil || !token.Valid {
+		token, err := keys.Parse(tokenStr, claims)
+		if err != nil || !token.Valid || isDownloadGrant(claims) {
+			metrics.AuthFailure("jwt", "invalid_token")
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error":   "Unauthorized",
 				"message": "Invalid or expired access token",
@@ -39,6 +51,7 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		// Ensure userID is a valid UUID (v4) in context
 		userUUID, err := uuid.Parse(claims.UserID)
 		if err != nil {
+			metrics.AuthFailure("jwt", "invalid_token")
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error":   "Unauthorized",
 				"message": "Invalid user identifier in token",
@@ -46,10 +59,166 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		c.Set("userID", userUUID)
-		c.Set("userEmail", claims.Email)
-		c.Set("userRole", claims.Role)
-		c.Set("totpEnabled", claims.TOTPEnabled)
+		user, err := userRepo.GetByID(userUUID)
+		if err != nil || user == nil {
+			metrics.AuthFailure("jwt", "unknown_user")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "User no longer exists",
+			})
+			return
+		}
+		if rejectSuspended(c, user, "jwt") {
+			return
+		}
+		if claims.IssuedAt == nil || user.SessionRevoked(claims.IssuedAt.Time) {
+			metrics.AuthFailure("jwt", "session_revoked")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "Session has been revoked. Please sign in again.",
+			})
+			return
+		}
+
+		c.Set("userID", user.ID)
+		c.Set("userEmail", user.Email)
+		c.Set("userRole", user.Role)
+		c.Set("totpEnabled", user.TOTPEnabled != nil && *user.TOTPEnabled)
+		c.Next()
+	}
+}
+
+// isDownloadGrant reports whether claims belong to a file download grant, which is signed
+// with the same keys as access tokens but must never authenticate a user.
+func isDownloadGrant(claims *services.TokenClaims) bool {
+	return slices.Contains(claims.Audience, services.DownloadGrantAudience)
+}
+
+// RequesterKey identifies the user of a request by a validly signed access token, without
+// loading the user, so rate limits applied before authentication count per user. It returns
+// "" for anonymous requests and personal access tokens, which are then limited per IP.
+func RequesterKey(keys *services.JWTKeyManager) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		tokenStr := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenStr == "" || strings.HasPrefix(tokenStr, models.PersonalAccessTokenPrefix) {
+			return ""
+		}
+		claims := &services.TokenClaims{}
+		if token, err := keys.Parse(tokenStr, claims); err != nil || !token.Valid || isDownloadGrant(claims) {
+			return ""
+		}
+		userUUID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			return ""
+		}
+		return "user:" + userUUID.String()
+	}
+}
+
+func authenticatePersonalAccessToken(c *gin.Context, tokenService *services.PersonalAccessTokenService, tokenStr string) {
+	user, token, err := tokenService.Authenticate(tokenStr)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAccessToken) {
+			metrics.AuthFailure("access_token", "invalid_token")
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "Invalid, expired or revoked personal access token",
+		})
+		return
+	}
+
+	if rejectSuspended(c, user, "access_token") {
+		return
+	}
+
+	c.Set("userID", user.ID)
+	c.Set("userEmail", user.Email)
+	c.Set("userRole", user.Role)
+	c.Set("totpEnabled", user.TOTPEnabled != nil && *user.TOTPEnabled)
+	c.Set("tokenID", token.ID)
+	c.Set("tokenScopes", []string(token.Scopes))
+	c.Next()
+}
+
+// rejectSuspended aborts with 403 when an admin has suspended the user.
+func rejectSuspended(c *gin.Context, user *models.User, method string) bool {
+	if !user.IsSuspended() {
+		return false
+	}
+	metrics.AuthFailure(method, "account_suspended")
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":   "Account suspended",
+		"message": "This account has been suspended. Contact an administrator.",
+	})
+	return true
+}
+
+// RequireScope rejects requests made with a personal access token lacking the scope.
+// Anonymous and JWT-authenticated requests pass through unchanged.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopesVal, exists := c.Get("tokenScopes")
+		if !exists {
+			c.Next()
+			return
+		}
+		scopes, _ := scopesVal.([]string)
+		for _, s := range scopes {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": "Access token is missing required scope: " + scope,
+		})
+	}
+}
+
+// SessionOnly rejects personal access tokens, for account-management endpoints
+// that must only be reachable from an interactive login.
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("tokenScopes"); exists {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "This endpoint cannot be used with a personal access token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission ensures the requester's role grants perm (see models.RolePermissions).
+// Personal access tokens are rejected: staff actions need an interactive login.
+func RequirePermission(perm models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleVal, exists := c.Get("userRole")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "Authentication required",
+			})
+			return
+		}
+		if _, isToken := c.Get("tokenID"); isToken {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "Personal access tokens cannot be used for this endpoint",
+			})
+			return
+		}
+		role, ok := roleVal.(models.UserRole)
+		if !ok || !role.HasPermission(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "You don't have permission to access this resource",
+			})
+			return
+		}
 		c.Next()
 	}
 }
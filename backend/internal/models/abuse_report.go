@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AbuseReason string
+
+const (
+	AbuseReasonMalware    AbuseReason = "malware"
+	AbuseReasonCopyright  AbuseReason = "copyright"
+	AbuseReasonIllegal    AbuseReason = "illegal"
+	AbuseReasonHarassment AbuseReason = "harassment"
+	AbuseReasonSpam       AbuseReason = "spam"
+	AbuseReasonOther      AbuseReason = "other"
+)
+
+func (r AbuseReason) IsValid() bool {
+	switch r {
+	case AbuseReasonMalware, AbuseReasonCopyright, AbuseReasonIllegal,
+		AbuseReasonHarassment, AbuseReasonSpam, AbuseReasonOther:
+		return true
+	}
+	return false
+}
+
+type AbuseReportStatus string
+
+const (
+	AbuseReportOpen      AbuseReportStatus = "open"
+	AbuseReportDismissed AbuseReportStatus = "dismissed"
+	AbuseReportActioned  AbuseReportStatus = "actioned" // the file was taken down
+)
+
+// AbuseReport is an anonymous complaint about a shared file, reviewed by moderators.
+type AbuseReport struct {
+	ID             uuid.UUID         `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	FileID         uuid.UUID         `gorm:"type:uuid;not null;index" json:"file_id"`
+	Reason         AbuseReason       `gorm:"type:varchar(30);not null" json:"reason"`
+	Details        *string           `gorm:"type:text" json:"details,omitempty"`
+	ContactEmail   *string           `gorm:"type:varchar(255)" json:"contact_email,omitempty"`
+	ReporterIP     *string           `gorm:"type:varchar(64)" json:"reporter_ip,omitempty"`
+	Status         AbuseReportStatus `gorm:"type:varchar(20);not null;default:open" json:"status"`
+	ReviewedBy     *uuid.UUID        `gorm:"type:uuid" json:"reviewed_by,omitempty"`
+	ReviewedAt     *time.Time        `gorm:"type:timestamp with time zone" json:"reviewed_at,omitempty"`
+	ResolutionNote *string           `gorm:"type:varchar(255)" json:"resolution_note,omitempty"`
+	CreatedAt      time.Time         `gorm:"default:CURRENT_TIMESTAMP;index" json:"created_at"`
+
+	File *File `gorm:"foreignKey:FileID;constraint:OnDelete:CASCADE" json:"file,omitempty"`
+}
+
+func (AbuseReport) TableName() string {
+	return "abuse_reports"
+}
+
+func (r *AbuseReport) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Who performed an admin action.
+const (
+	AdminActorUser  = "user"
+	AdminActorToken = "admin_token" // ADMIN_API_TOKEN, bootstrap only
+	AdminActorCron  = "cron"        // X-Cron-Secret
+)
+
+// AdminAuditLog records an admin API action and the staff member who performed it.
+type AdminAuditLog struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ActorType  string     `gorm:"type:varchar(20);not null" json:"actor_type"`
+	ActorID    *uuid.UUID `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	ActorEmail *string    `gorm:"type:varchar(255)" json:"actor_email,omitempty"`
+	ActorRole  *string    `gorm:"type:varchar(20)" json:"actor_role,omitempty"`
+	Action     string     `gorm:"type:varchar(50);not null" json:"action"`
+	TargetType *string    `gorm:"type:varchar(50)" json:"target_type,omitempty"`
+	TargetID   *string    `gorm:"type:varchar(100)" json:"target_id,omitempty"`
+	Details    *string    `gorm:"type:text" json:"details,omitempty"`
+	IPAddress  *string    `gorm:"type:varchar(64)" json:"ip_address,omitempty"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP;index" json:"created_at"`
+}
+
+func (AdminAuditLog) TableName() string {
+	return "admin_audit_logs"
+}
+
+func (l *AdminAuditLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CleanupTrigger string
+
+const (
+	CleanupTriggerSchedule CleanupTrigger = "schedule" // in-process scheduler (cleanup.cron)
+	CleanupTriggerManual   CleanupTrigger = "manual"   // POST /api/admin/cleanup
+)
+
+type CleanupRunStatus string
+
+const (
+	CleanupRunRunning   CleanupRunStatus = "running"
+	CleanupRunSucceeded CleanupRunStatus = "succeeded"
+	CleanupRunPartial   CleanupRunStatus = "partial" // some files could not be deleted and are retried next run
+	CleanupRunFailed    CleanupRunStatus = "failed"
+)
+
+// CleanupRun records one pass of the expired-file cleanup.
+type CleanupRun struct {
+	ID          uuid.UUID        `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Trigger     CleanupTrigger   `gorm:"type:varchar(20);not null" json:"trigger"`
+	Status      CleanupRunStatus `gorm:"type:varchar(20);not null;default:running" json:"status"`
+	TriggeredBy *uuid.UUID       `gorm:"type:uuid" json:"triggeredBy,omitempty"`
+	Instance    *string          `gorm:"type:varchar(255)" json:"instance,omitempty"`
+	// DryRun runs only list what would be deleted (result "would_delete").
+	DryRun     bool `gorm:"not null;default:false" json:"dryRun"`
+	GraceHours int  `gorm:"not null;default:0" json:"graceHours"`
+
+	Batches      int `gorm:"not null;default:0" json:"batches"`
+	FilesFound   int `gorm:"not null;default:0" json:"filesFound"`
+	FilesDeleted int `gorm:"not null;default:0" json:"filesDeleted"`
+	FilesFailed  int `gorm:"not null;default:0" json:"filesFailed"`
+	FilesSkipped int `gorm:"not null;default:0" json:"filesSkipped"`
+	// BytesReclaimed is the size of deleted files, or of files a dry run would delete.
+	BytesReclaimed int64      `gorm:"not null;default:0" json:"bytesReclaimed"`
+	ErrorMessage   *string    `gorm:"type:text" json:"error,omitempty"`
+	StartedAt      time.Time  `gorm:"type:timestamp with time zone;not null" json:"startedAt"`
+	FinishedAt     *time.Time `gorm:"type:timestamp with time zone" json:"finishedAt,omitempty"`
+}
+
+func (CleanupRun) TableName() string {
+	return "cleanup_runs"
+}
+
+func (r *CleanupRun) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+type CleanupFileResult string
+
+const (
+	CleanupFileDeleted     CleanupFileResult = "deleted"
+	CleanupFileFailed      CleanupFileResult = "failed"  // storage delete kept failing; retried next run
+	CleanupFileSkipped     CleanupFileResult = "skipped" // e.g. a legal hold was placed during the run
+	CleanupFileWouldDelete CleanupFileResult = "would_delete"
+)
+
+// CleanupRunFile is the outcome for one file in a cleanup run. File and owner fields are
+// snapshots because the file row is usually gone afterwards.
+type CleanupRunFile struct {
+	ID           uuid.UUID         `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"-"`
+	RunID        uuid.UUID         `gorm:"type:uuid;not null;index" json:"-"`
+	FileID       uuid.UUID         `gorm:"type:uuid;not null" json:"fileId"`
+	FileName     string            `gorm:"type:varchar(255);not null" json:"fileName"`
+	OwnerID      *uuid.UUID        `gorm:"type:uuid" json:"ownerId,omitempty"`
+	OwnerEmail   *string           `gorm:"type:varchar(255)" json:"ownerEmail,omitempty"`
+	FileSize     int64             `gorm:"not null;default:0" json:"fileSize"`
+	AvailableTo  *time.Time        `gorm:"type:timestamp with time zone" json:"availableTo,omitempty"`
+	Result       CleanupFileResult `gorm:"type:varchar(20);not null" json:"result"`
+	ErrorMessage *string           `gorm:"type:text" json:"error,omitempty"`
+	Attempts     int               `gorm:"not null;default:0" json:"attempts"`
+	CreatedAt    time.Time         `gorm:"default:CURRENT_TIMESTAMP" json:"-"`
+}
+
+func (CleanupRunFile) TableName() string {
+	return "cleanup_run_files"
+}
+
+func (f *CleanupRunFile) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
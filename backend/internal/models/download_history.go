@@ -13,6 +13,11 @@ type DownloadHistory struct {
 	DownloaderID      *uuid.UUID `gorm:"type:uuid;index" json:"downloader_id,omitempty"`
 	DownloadedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP;index" json:"downloaded_at"`
 	DownloadCompleted *bool      `gorm:"default:true" json:"download_completed"`
+	// EventType tells downloads from previews
+	EventType        FileEventType    `gorm:"type:varchar(20);not null;default:download" json:"event_type"`
+	BytesSent        int64            `gorm:"not null;default:0" json:"bytes_sent"`
+	ClientCategory   ClientCategory   `gorm:"type:varchar(20);not null;default:unknown" json:"client_category"`
+	ReferrerCategory ReferrerCategory `gorm:"type:varchar(20);not null;default:unknown" json:"referrer_category"`
 
 	File       File  `gorm:"foreignKey:FileID;constraint:OnDelete:CASCADE" json:"file,omitempty"`
 	Downloader *User `gorm:"foreignKey:DownloaderID;constraint:OnDelete:SET NULL" json:"downloader,omitempty"`
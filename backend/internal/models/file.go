@@ -61,10 +61,46 @@ type File struct {
 	SharedWithEmails StringArray `gorm:"type:jsonb;default:'[]'" json:"shared_with,omitempty"`  // Multi-valued attribute (whitelist)
 	CreatedAt        time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 
+	// Moderation: a disabled share link stops working; a legal hold blocks deletion.
+	ShareDisabledAt *time.Time `gorm:"type:timestamp with time zone" json:"share_disabled_at,omitempty"`
+	LegalHold       bool       `gorm:"not null;default:false" json:"legal_hold"`
+	LegalHoldReason *string    `gorm:"type:varchar(255)" json:"legal_hold_reason,omitempty"`
+	LegalHoldAt     *time.Time `gorm:"type:timestamp with time zone" json:"legal_hold_at,omitempty"`
+
+	// Takedown after an abuse report: the share link answers 451 until restored.
+	TakenDownAt    *time.Time `gorm:"type:timestamp with time zone" json:"taken_down_at,omitempty"`
+	TakedownReason *string    `gorm:"type:varchar(255)" json:"takedown_reason,omitempty"`
+
+	// Malware scanning: nil status means the file predates scanning (or it is disabled).
+	ScanStatus    *ScanStatus `gorm:"type:varchar(20)" json:"scan_status,omitempty"`
+	ScanSignature *string     `gorm:"type:varchar(255)" json:"scan_signature,omitempty"`
+	ScannedAt     *time.Time  `gorm:"type:timestamp with time zone" json:"scanned_at,omitempty"`
+	QuarantinedAt *time.Time  `gorm:"type:timestamp with time zone" json:"quarantined_at,omitempty"`
+	// Failed scans are retried at NextScanAt until ScanAttempts reaches the limit.
+	ScanAttempts int        `gorm:"not null;default:0" json:"scan_attempts,omitempty"`
+	NextScanAt   *time.Time `gorm:"type:timestamp with time zone" json:"next_scan_at,omitempty"`
+
 	Owner      *User           `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
 	Statistics *FileStatistics `gorm:"foreignKey:FileID" json:"statistics,omitempty"`
 }
 
+type ScanStatus string
+
+const (
+	ScanStatusPending  ScanStatus = "pending"
+	ScanStatusClean    ScanStatus = "clean"
+	ScanStatusInfected ScanStatus = "infected"
+	ScanStatusError    ScanStatus = "error"
+)
+
+func (s ScanStatus) IsValid() bool {
+	switch s {
+	case ScanStatusPending, ScanStatusClean, ScanStatusInfected, ScanStatusError:
+		return true
+	}
+	return false
+}
+
 func (File) TableName() string {
 	return "files"
 }
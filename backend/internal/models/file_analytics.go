@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClientCategory is the coarse kind of client that requested a file, derived from its
+// User-Agent header.
+type ClientCategory string
+
+const (
+	ClientBrowser ClientCategory = "browser"
+	ClientMobile  ClientCategory = "mobile"
+	ClientCLI     ClientCategory = "cli"
+	ClientBot     ClientCategory = "bot"
+	ClientOther   ClientCategory = "other"
+	ClientUnknown ClientCategory = "unknown"
+)
+
+// ReferrerCategory tells where the link to a file was followed from, derived from the
+// Referer header.
+type ReferrerCategory string
+
+const (
+	ReferrerDirect   ReferrerCategory = "direct"
+	ReferrerInternal ReferrerCategory = "internal"
+	ReferrerSearch   ReferrerCategory = "search"
+	ReferrerSocial   ReferrerCategory = "social"
+	ReferrerExternal ReferrerCategory = "external"
+	ReferrerUnknown  ReferrerCategory = "unknown"
+)
+
+// FileAnalyticsHourly holds the downloads or previews of a file within one UTC hour for
+// one client and referrer category.
+type FileAnalyticsHourly struct {
+	FileID           uuid.UUID        `gorm:"type:uuid;primaryKey" json:"file_id"`
+	EventType        FileEventType    `gorm:"type:varchar(20);primaryKey" json:"event_type"`
+	BucketStart      time.Time        `gorm:"type:timestamp with time zone;primaryKey" json:"bucket_start"`
+	ClientCategory   ClientCategory   `gorm:"type:varchar(20);primaryKey" json:"client_category"`
+	ReferrerCategory ReferrerCategory `gorm:"type:varchar(20);primaryKey" json:"referrer_category"`
+	CompletedCount   int              `gorm:"not null;default:0" json:"completed_count"`
+	AbortedCount     int              `gorm:"not null;default:0" json:"aborted_count"`
+	BytesSent        int64            `gorm:"not null;default:0" json:"bytes_sent"`
+}
+
+func (FileAnalyticsHourly) TableName() string {
+	return "file_analytics_hourly"
+}
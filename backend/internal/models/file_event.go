@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FileEventType string
+
+const (
+	FileEventDownload FileEventType = "download"
+	FileEventPreview  FileEventType = "preview"
+)
+
+func (t FileEventType) IsValid() bool {
+	return t == FileEventDownload || t == FileEventPreview
+}
+
+// FileEvent is a download or preview waiting in the outbox to be applied to the file's
+// history and statistics. It is deleted once applied. Only the category of the request's
+// User-Agent and Referer headers is kept.
+type FileEvent struct {
+	ID               int64            `gorm:"primaryKey;autoIncrement"`
+	FileID           uuid.UUID        `gorm:"type:uuid;not null"`
+	EventType        FileEventType    `gorm:"type:varchar(20);not null"`
+	UserID           *uuid.UUID       `gorm:"type:uuid"`
+	Completed        bool             `gorm:"not null"`
+	BytesSent        int64            `gorm:"not null;default:0"`
+	ClientCategory   ClientCategory   `gorm:"type:varchar(20);not null;default:unknown"`
+	ReferrerCategory ReferrerCategory `gorm:"type:varchar(20);not null;default:unknown"`
+	OccurredAt       time.Time        `gorm:"type:timestamp with time zone;not null"`
+	Attempts         int              `gorm:"not null;default:0"`
+	NextAttemptAt    time.Time        `gorm:"type:timestamp with time zone;not null"`
+	LastError        *string          `gorm:"type:text"`
+}
+
+func (FileEvent) TableName() string {
+	return "file_events"
+}
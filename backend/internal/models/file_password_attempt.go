@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FilePasswordAnyClient is the client key of the row counting the wrong passwords of all
+// clients on a file; its lock applies to everyone.
+const FilePasswordAnyClient = "*"
+
+// FilePasswordAttempt counts consecutive wrong passwords for a file from one client
+// ("user:<id>" or "ip:<addr>"), or from all clients (FilePasswordAnyClient). A client's row
+// is removed when it enters the right password.
+type FilePasswordAttempt struct {
+	FileID         uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	ClientKey      string     `gorm:"type:varchar(255);primaryKey"`
+	FailedAttempts int        `gorm:"not null;default:0"`
+	LockedUntil    *time.Time `gorm:"type:timestamp with time zone"`
+	LastFailedAt   time.Time  `gorm:"type:timestamp with time zone;not null"`
+}
+
+func (FilePasswordAttempt) TableName() string {
+	return "file_password_attempts"
+}
+
+// IsLocked reports whether the client must wait before trying another password.
+func (a *FilePasswordAttempt) IsLocked(now time.Time) bool {
+	return a != nil && a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
@@ -13,6 +13,8 @@ type FileStatistics struct {
 	DownloadCount     int        `gorm:"default:0" json:"download_count"`
 	UniqueDownloaders int        `gorm:"default:0" json:"unique_downloaders"`
 	LastDownloadedAt  *time.Time `gorm:"type:timestamp with time zone" json:"last_downloaded_at"`
+	PreviewCount      int        `gorm:"not null;default:0" json:"preview_count"`
+	LastPreviewedAt   *time.Time `gorm:"type:timestamp with time zone" json:"last_previewed_at"`
 	CreatedAt         time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt         time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// JWTSigningKey is an asymmetric key used to sign access tokens, identified by the "kid" header.
+// The newest non-retired key signs new tokens; retired keys keep verifying until ExpiresAt so
+// tokens issued before a rotation stay valid for their full lifetime.
+type JWTSigningKey struct {
+	KID        string     `gorm:"type:varchar(64);primary_key" json:"kid"`
+	Algorithm  string     `gorm:"type:varchar(16);not null" json:"algorithm"`
+	PrivateKey string     `gorm:"type:text;not null" json:"-"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	RetiredAt  *time.Time `gorm:"type:timestamp with time zone" json:"retired_at"`
+	ExpiresAt  *time.Time `gorm:"type:timestamp with time zone;index" json:"expires_at"`
+}
+
+func (JWTSigningKey) TableName() string {
+	return "jwt_signing_keys"
+}
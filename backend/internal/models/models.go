@@ -13,6 +13,14 @@ func AllModels() []interface{} {
 		&SystemPolicy{},
 		&FileStatistics{},
 		&DownloadHistory{},
+		&SecurityEvent{},
+		&WebAuthnCredential{},
+		&WebAuthnSession{},
+		&UserIdentity{},
+		&OIDCAuthRequest{},
+		&PersonalAccessToken{},
+		&JWTSigningKey{},
+		&AdminAuditLog{},
 	}
 }
 
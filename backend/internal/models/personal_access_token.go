@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Scopes that can be granted to a personal access token.
+const (
+	ScopeFilesRead  = "files:read"
+	ScopeFilesWrite = "files:write"
+	ScopeUserRead   = "user:read"
+)
+
+// AllTokenScopes lists every valid personal access token scope.
+var AllTokenScopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeUserRead}
+
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access tokens rather than JWTs.
+const PersonalAccessTokenPrefix = "fsp_"
+
+// PersonalAccessToken is a long-lived, scoped credential for scripts and CI.
+// Only the SHA-256 hash of the token is stored; the plaintext is shown once on creation.
+type PersonalAccessToken struct {
+	ID          uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	UserID      uuid.UUID   `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name        string      `gorm:"type:varchar(100);not null" json:"name"`
+	TokenHash   string      `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	TokenPrefix string      `gorm:"type:varchar(16);not null" json:"token_prefix"`
+	Scopes      StringArray `gorm:"type:jsonb;not null;default:'[]'" json:"scopes"`
+	ExpiresAt   time.Time   `gorm:"type:timestamp with time zone;not null" json:"expires_at"`
+	LastUsedAt  *time.Time  `gorm:"type:timestamp with time zone" json:"last_used_at"`
+	RevokedAt   *time.Time  `gorm:"type:timestamp with time zone" json:"revoked_at"`
+	CreatedAt   time.Time   `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+func (t *PersonalAccessToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive reports whether the token is neither revoked nor expired at the given time.
+func (t *PersonalAccessToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// HasScope reports whether the token was granted the given scope.
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
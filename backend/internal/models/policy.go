@@ -0,0 +1,175 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Policy audiences. Overrides are layered on top of SystemPolicy: anonymous uploaders get
+// "anonymous"; signed-in users get "user", then "admin" for staff roles, then their group.
+const (
+	PolicyAudienceSystem    = "system" // the base policy itself, in change history only
+	PolicyAudienceAnonymous = "anonymous"
+	PolicyAudienceUser      = "user"
+	PolicyAudienceAdmin     = "admin"
+	PolicyAudienceGroupPref = "group:"
+)
+
+var policyGroupPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// ValidPolicyGroup reports whether name can be used as a policy group.
+func ValidPolicyGroup(name string) bool {
+	return policyGroupPattern.MatchString(name)
+}
+
+// ValidPolicyAudience reports whether audience may carry an override.
+func ValidPolicyAudience(audience string) bool {
+	switch audience {
+	case PolicyAudienceAnonymous, PolicyAudienceUser, PolicyAudienceAdmin:
+		return true
+	}
+	return strings.HasPrefix(audience, PolicyAudienceGroupPref) && ValidPolicyGroup(strings.TrimPrefix(audience, PolicyAudienceGroupPref))
+}
+
+// PolicySettings holds the per-audience limits; nil fields inherit from the base policy.
+type PolicySettings struct {
+	MaxFileSizeMB            *int         `json:"maxFileSizeMB,omitempty"`
+	MinValidityHours         *int         `json:"minValidityHours,omitempty"`
+	MaxValidityDays          *int         `json:"maxValidityDays,omitempty"`
+	DefaultValidityDays      *int         `json:"defaultValidityDays,omitempty"`
+	RequirePasswordMinLength *int         `json:"requirePasswordMinLength,omitempty"`
+	AllowedMimeTypes         *StringArray `json:"allowedMimeTypes,omitempty"`
+	BlockedMimeTypes         *StringArray `json:"blockedMimeTypes,omitempty"`
+	BlockedExtensions        *StringArray `json:"blockedExtensions,omitempty"`
+}
+
+// IsEmpty reports whether no field is overridden.
+func (s PolicySettings) IsEmpty() bool {
+	return s == PolicySettings{}
+}
+
+// ApplyTo overwrites the fields of p that s sets.
+func (s PolicySettings) ApplyTo(p *SystemPolicy) {
+	if s.MaxFileSizeMB != nil {
+		p.MaxFileSizeMB = *s.MaxFileSizeMB
+	}
+	if s.MinValidityHours != nil {
+		p.MinValidityHours = *s.MinValidityHours
+	}
+	if s.MaxValidityDays != nil {
+		p.MaxValidityDays = *s.MaxValidityDays
+	}
+	if s.DefaultValidityDays != nil {
+		p.DefaultValidityDays = *s.DefaultValidityDays
+	}
+	if s.RequirePasswordMinLength != nil {
+		p.RequirePasswordMinLength = *s.RequirePasswordMinLength
+	}
+	if s.AllowedMimeTypes != nil {
+		p.AllowedMimeTypes = *s.AllowedMimeTypes
+	}
+	if s.BlockedMimeTypes != nil {
+		p.BlockedMimeTypes = *s.BlockedMimeTypes
+	}
+	if s.BlockedExtensions != nil {
+		p.BlockedExtensions = *s.BlockedExtensions
+	}
+}
+
+// Value implements driver.Valuer interface for saving to database
+func (s PolicySettings) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan implements sql.Scanner interface for reading from database
+func (s *PolicySettings) Scan(value interface{}) error {
+	*s = PolicySettings{}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("failed to unmarshal JSONB value")
+	}
+}
+
+// PolicyOverride replaces parts of the system policy for one audience.
+type PolicyOverride struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Audience  string         `gorm:"type:varchar(80);not null;uniqueIndex" json:"audience"`
+	Settings  PolicySettings `gorm:"type:jsonb;not null" json:"settings"`
+	CreatedAt time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"createdAt"`
+	UpdatedAt time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"updatedAt"`
+}
+
+func (PolicyOverride) TableName() string {
+	return "policy_overrides"
+}
+
+func (o *PolicyOverride) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// Policy change actions.
+const (
+	PolicyChangeUpdate   = "update"
+	PolicyChangeDelete   = "delete"
+	PolicyChangeRollback = "rollback"
+)
+
+// PolicyChange records one change to the system policy or an override. Before and After are
+// JSON snapshots (nil when the override did not exist); Diff maps field -> {from, to}.
+type PolicyChange struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Audience      string     `gorm:"type:varchar(80);not null" json:"audience"`
+	Action        string     `gorm:"type:varchar(20);not null" json:"action"`
+	Before        *string    `gorm:"type:jsonb" json:"-"`
+	After         *string    `gorm:"type:jsonb" json:"-"`
+	Diff          string     `gorm:"type:jsonb;not null" json:"-"`
+	ChangedBy     *uuid.UUID `gorm:"type:uuid" json:"changedBy,omitempty"`
+	ChangedByName *string    `gorm:"type:varchar(255)" json:"changedByName,omitempty"`
+	RollbackOf    *uuid.UUID `gorm:"type:uuid" json:"rollbackOf,omitempty"`
+	CreatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"createdAt"`
+}
+
+func (PolicyChange) TableName() string {
+	return "policy_changes"
+}
+
+func (c *PolicyChange) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// MarshalJSON embeds the snapshots and diff as JSON instead of strings.
+func (c PolicyChange) MarshalJSON() ([]byte, error) {
+	type change PolicyChange
+	raw := func(s *string) json.RawMessage {
+		if s == nil {
+			return json.RawMessage("null")
+		}
+		return json.RawMessage(*s)
+	}
+	diff := c.Diff
+	return json.Marshal(struct {
+		change
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+		Diff   json.RawMessage `json:"diff"`
+	}{change(c), raw(c.Before), raw(c.After), raw(&diff)})
+}
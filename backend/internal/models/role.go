@@ -0,0 +1,88 @@
+package models
+
+// Permission is a single admin API capability granted to staff roles.
+type Permission string
+
+const (
+	PermissionPolicyRead  Permission = "policy:read"
+	PermissionPolicyWrite Permission = "policy:write"
+	PermissionCleanupRun  Permission = "cleanup:run"
+	PermissionAuditRead   Permission = "audit:read"
+	// PermissionStorageReconcile finds and repairs storage objects and file rows that lost each other.
+	PermissionStorageReconcile Permission = "storage:reconcile"
+	// Users: view accounts and usage; suspend, reset TOTP and force logout; change roles.
+	PermissionUsersRead   Permission = "users:read"
+	PermissionUsersManage Permission = "users:manage"
+	PermissionUsersRoles  Permission = "users:roles"
+	// Files: browse all uploads; expire, disable share links and delete; place legal holds.
+	PermissionFilesRead      Permission = "files:read"
+	PermissionFilesModerate  Permission = "files:moderate"
+	PermissionFilesLegalHold Permission = "files:legal_hold"
+	// PermissionAdminBootstrap promotes the first admin. No role holds it; only the
+	// ADMIN_API_TOKEN can use it.
+	PermissionAdminBootstrap Permission = "admin:bootstrap"
+)
+
+// RolePermissions lists the admin API permissions of each role. Regular users have none.
+var RolePermissions = map[UserRole][]Permission{
+	RoleAdmin: {
+		PermissionPolicyRead,
+		PermissionPolicyWrite,
+		PermissionCleanupRun,
+		PermissionStorageReconcile,
+		PermissionAuditRead,
+		PermissionUsersRead,
+		PermissionUsersManage,
+		PermissionUsersRoles,
+		PermissionFilesRead,
+		PermissionFilesModerate,
+		PermissionFilesLegalHold,
+	},
+	RoleModerator: {
+		PermissionPolicyRead,
+		PermissionUsersRead,
+		PermissionUsersManage,
+		PermissionFilesRead,
+		PermissionFilesModerate,
+	},
+	RoleAuditor: {
+		PermissionPolicyRead,
+		PermissionAuditRead,
+		PermissionUsersRead,
+		PermissionFilesRead,
+	},
+}
+
+// roleRank orders roles by privilege, e.g. to pick the highest of several mapped SSO roles.
+var roleRank = map[UserRole]int{
+	RoleUser:      0,
+	RoleAuditor:   1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// IsValid reports whether r is a known role.
+func (r UserRole) IsValid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Outranks reports whether r is more privileged than other.
+func (r UserRole) Outranks(other UserRole) bool {
+	return roleRank[r] > roleRank[other]
+}
+
+// IsStaff reports whether r has access to any part of the admin API.
+func (r UserRole) IsStaff() bool {
+	return len(RolePermissions[r]) > 0
+}
+
+// HasPermission reports whether r is granted p.
+func (r UserRole) HasPermission(p Permission) bool {
+	for _, granted := range RolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SecurityEventType string
+
+const (
+	SecurityEventTOTPFailed         SecurityEventType = "totp_failed"
+	SecurityEventLoginSessionLocked SecurityEventType = "login_session_locked"
+	SecurityEventAccountLocked      SecurityEventType = "account_locked"
+	SecurityEventLoginBlocked       SecurityEventType = "login_blocked"
+)
+
+// SecurityEvent records security-relevant activity on an account so the user can review it.
+type SecurityEvent struct {
+	ID        uuid.UUID         `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	UserID    uuid.UUID         `gorm:"type:uuid;not null;index" json:"user_id"`
+	EventType SecurityEventType `gorm:"type:varchar(50);not null" json:"event_type"`
+	IPAddress *string           `gorm:"type:varchar(64)" json:"ip_address,omitempty"`
+	UserAgent *string           `gorm:"type:varchar(255)" json:"user_agent,omitempty"`
+	Details   *string           `gorm:"type:varchar(255)" json:"details,omitempty"`
+	CreatedAt time.Time         `gorm:"default:CURRENT_TIMESTAMP;index" json:"created_at"`
+
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (SecurityEvent) TableName() string {
+	return "security_events"
+}
+
+func (e *SecurityEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -1,5 +1,22 @@
 package models
 
+// Executables are blocked unless an admin edits the policy.
+var (
+	DefaultBlockedMimeTypes = StringArray{
+		"application/vnd.microsoft.portable-executable",
+		"application/x-elf",
+		"application/x-mach-binary",
+		"application/x-ms-installer",
+	}
+	DefaultBlockedExtensions = StringArray{".exe", ".dll", ".msi", ".scr", ".com", ".bat", ".cmd", ".ps1", ".vbs"}
+)
+
+// Scan download policies: which scan verdicts may be downloaded.
+const (
+	ScanPolicyRequireClean  = "require_clean"  // only clean files (and files uploaded before scanning was enabled)
+	ScanPolicyBlockInfected = "block_infected" // everything except infected files
+)
+
 type SystemPolicy struct {
 	ID                       uint `gorm:"primary_key" json:"id"`
 	MaxFileSizeMB            int  `gorm:"default:50" json:"maxFileSizeMB"`
@@ -7,6 +24,17 @@ type SystemPolicy struct {
 	MaxValidityDays          int  `gorm:"default:30" json:"maxValidityDays"`
 	DefaultValidityDays      int  `gorm:"default:7" json:"defaultValidityDays"`
 	RequirePasswordMinLength int  `gorm:"default:6" json:"requirePasswordMinLength"`
+
+	// Upload type rules, matched against the sniffed type: "*", "image/*" or "application/pdf".
+	// An empty allowlist allows every type that is not blocked.
+	AllowedMimeTypes  StringArray `gorm:"type:jsonb" json:"allowedMimeTypes"`
+	BlockedMimeTypes  StringArray `gorm:"type:jsonb" json:"blockedMimeTypes"`
+	BlockedExtensions StringArray `gorm:"type:jsonb" json:"blockedExtensions"`
+
+	ScanDownloadPolicy string `gorm:"type:varchar(20);default:require_clean" json:"scanDownloadPolicy"`
+
+	// Expired files are kept this many hours after available_to before cleanup deletes them.
+	CleanupGraceHours int `gorm:"default:0" json:"cleanupGraceHours"`
 }
 
 func (SystemPolicy) TableName() string {
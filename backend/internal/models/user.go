@@ -10,8 +10,10 @@ import (
 type UserRole string
 
 const (
-	RoleUser  UserRole = "user"
-	RoleAdmin UserRole = "admin"
+	RoleUser      UserRole = "user"
+	RoleAdmin     UserRole = "admin"
+	RoleModerator UserRole = "moderator"
+	RoleAuditor   UserRole = "auditor"
 )
 
 type User struct {
@@ -24,6 +26,18 @@ type User struct {
 	TOTPEnabled  *bool     `gorm:"default:false" json:"totp_enabled"`
 	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 
+	// Consecutive failed TOTP attempts across login sessions (reset on success)
+	TOTPFailedAttempts int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil        *time.Time `gorm:"type:timestamp with time zone" json:"-"`
+
+	// Set by admins: suspended users cannot sign in and their share links stop working.
+	SuspendedAt     *time.Time `gorm:"type:timestamp with time zone" json:"suspended_at,omitempty"`
+	SuspendedReason *string    `gorm:"type:varchar(255)" json:"suspended_reason,omitempty"`
+	// Access tokens issued at or before this time are rejected (force logout).
+	SessionsRevokedAt *time.Time `gorm:"type:timestamp with time zone" json:"-"`
+	// Named group whose policy override (audience "group:<name>") applies to the user.
+	PolicyGroup *string `gorm:"type:varchar(64)" json:"policy_group,omitempty"`
+
 	OwnedFiles []File `gorm:"foreignKey:OwnerID" json:"-"`
 }
 
@@ -31,6 +45,21 @@ func (User) TableName() string {
 	return "users"
 }
 
+// IsLocked reports whether the account is temporarily locked at the given time.
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// IsSuspended reports whether an admin has suspended the account.
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// SessionRevoked reports whether an access token issued at issuedAt was revoked by a force logout.
+func (u *User) SessionRevoked(issuedAt time.Time) bool {
+	return u.SessionsRevokedAt != nil && !issuedAt.After(u.SessionsRevokedAt.Truncate(time.Second))
+}
+
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredential is a registered WebAuthn authenticator (security key or passkey) of a user.
+type WebAuthnCredential struct {
+	ID              uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	UserID          uuid.UUID   `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name            string      `gorm:"type:varchar(100);not null" json:"name"`
+	CredentialID    []byte      `gorm:"type:bytea;uniqueIndex;not null" json:"-"`
+	PublicKey       []byte      `gorm:"type:bytea;not null" json:"-"`
+	AttestationType string      `gorm:"type:varchar(32)" json:"-"`
+	AAGUID          []byte      `gorm:"type:bytea" json:"-"`
+	SignCount       int64       `gorm:"not null;default:0" json:"sign_count"`
+	CloneWarning    bool        `gorm:"not null;default:false" json:"clone_warning"`
+	Transports      StringArray `gorm:"type:jsonb;default:'[]'" json:"transports"`
+	BackupEligible  bool        `gorm:"not null;default:false" json:"backup_eligible"`
+	BackupState     bool        `gorm:"not null;default:false" json:"backup_state"`
+	CreatedAt       time.Time   `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	LastUsedAt      *time.Time  `gorm:"type:timestamp with time zone" json:"last_used_at"`
+
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+func (c *WebAuthnCredential) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+	WebAuthnCeremonyPasskey      = "passkey"
+)
+
+// WebAuthnSession holds the challenge state between the begin and finish steps of a ceremony.
+type WebAuthnSession struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    *uuid.UUID `gorm:"type:uuid;index"`
+	Ceremony  string     `gorm:"type:varchar(20);not null"`
+	Data      string     `gorm:"type:jsonb;not null"`
+	CreatedAt time.Time  `gorm:"type:timestamptz;not null;default:now()"`
+	ExpiresAt time.Time  `gorm:"type:timestamptz;not null;index"`
+}
+
+func (WebAuthnSession) TableName() string {
+	return "webauthn_sessions"
+}
+
+func (s *WebAuthnSession) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired buckets are dropped from a MemoryStore.
+const sweepInterval = time.Minute
+
+type memoryBucket struct {
+	windowStart time.Time
+	hits        int
+	expiresAt   time.Time
+}
+
+// MemoryStore keeps counters in process memory. Each replica counts separately.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+// Hit implements Store.
+func (s *MemoryStore) Hit(_ context.Context, key string, window time.Duration, now time.Time) (int, error) {
+	start := now.Truncate(window)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.expiresAt) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || !b.windowStart.Equal(start) {
+		b = &memoryBucket{windowStart: start}
+		s.buckets[key] = b
+	}
+	b.hits++
+	b.expiresAt = start.Add(window)
+	return b.hits, nil
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostgresStore keeps counters in the rate_limit_counters table so every replica shares
+// them. The table is UNLOGGED: counters are cheap to lose on a crash.
+type PostgresStore struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresStore returns a store backed by db.
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Hit implements Store with a single upsert, which restarts the counter when the stored
+// window is older than the current one.
+func (s *PostgresStore) Hit(ctx context.Context, key string, window time.Duration, now time.Time) (int, error) {
+	start := now.Truncate(window)
+	var hits int
+	err := s.db.WithContext(ctx).Raw(`
+		INSERT INTO rate_limit_counters (bucket_key, window_start, hits, expires_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT (bucket_key) DO UPDATE SET
+			hits = CASE WHEN rate_limit_counters.window_start = EXCLUDED.window_start
+				THEN rate_limit_counters.hits + 1 ELSE 1 END,
+			window_start = EXCLUDED.window_start,
+			expires_at = EXCLUDED.expires_at
+		RETURNING hits`, key, start, start.Add(window)).Scan(&hits).Error
+	if err != nil {
+		return 0, fmt.Errorf("rate limit hit: %w", err)
+	}
+	s.sweep(ctx, now)
+	return hits, nil
+}
+
+// sweep deletes expired counters at most once per sweepInterval per replica.
+func (s *PostgresStore) sweep(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	if err := s.db.WithContext(ctx).Exec("DELETE FROM rate_limit_counters WHERE expires_at < ?", now).Error; err != nil {
+		slog.WarnContext(ctx, "failed to delete expired rate limit counters", "component", "ratelimit", "error", err)
+	}
+}
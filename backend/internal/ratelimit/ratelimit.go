@@ -0,0 +1,244 @@
+// Package ratelimit throttles API requests with fixed-window counters kept in a Store: in
+// memory for a single replica, or in Postgres so that limits hold across replicas.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/metrics"
+)
+
+// Default limits used when the corresponding RateLimitConfig field is zero.
+const (
+	DefaultRequestsPerMinute     = 60
+	DefaultUploadPerHour         = 10
+	DefaultLoginPerMinute        = 10
+	DefaultTOTPPerMinute         = 10
+	DefaultFilePasswordPerMinute = 10
+)
+
+// Response headers describing the most restrictive rule applied to a request.
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+	HeaderPolicy    = "RateLimit-Policy"
+)
+
+// Store counts hits per bucket key in fixed windows aligned to now.Truncate(window).
+type Store interface {
+	// Hit records one hit for key and returns the number of hits in the current window,
+	// including this one.
+	Hit(ctx context.Context, key string, window time.Duration, now time.Time) (int, error)
+}
+
+// Rule limits requests sharing the same key to Limit per Window. A Key returning ""
+// exempts the request from the rule.
+type Rule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    func(c *gin.Context) string
+}
+
+// Limiter builds rate limiting middleware for the buckets configured in RateLimitConfig.
+// A nil *Limiter is valid and never limits, which keeps handlers testable without one.
+type Limiter struct {
+	cfg      config.RateLimitConfig
+	store    Store
+	identify func(c *gin.Context) string
+	now      func() time.Time
+}
+
+// New returns a limiter counting in store.
+func New(cfg config.RateLimitConfig, store Store) *Limiter {
+	return &Limiter{cfg: cfg, store: store, now: time.Now}
+}
+
+// SetIdentify sets how requests are attributed to a user before authentication has run,
+// e.g. by the subject of a signed access token. It returns "" for anonymous requests.
+func (l *Limiter) SetIdentify(fn func(c *gin.Context) string) {
+	l.identify = fn
+}
+
+// SetClock replaces time.Now, for tests.
+func (l *Limiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// Global limits all /api requests per user or client IP to RequestsPerMinute.
+func (l *Limiter) Global() gin.HandlerFunc {
+	if l == nil {
+		return passthrough
+	}
+	return l.Limit(Rule{
+		Name:   "api",
+		Limit:  limitOrDefault(l.cfg.RequestsPerMinute, DefaultRequestsPerMinute),
+		Window: time.Minute,
+		Key: func(c *gin.Context) string {
+			if c.Request.Method == http.MethodOptions || !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				return ""
+			}
+			return l.requester(c)
+		},
+	})
+}
+
+// Login limits password, passkey and registration attempts per client IP.
+func (l *Limiter) Login() gin.HandlerFunc {
+	if l == nil {
+		return passthrough
+	}
+	return l.Limit(Rule{
+		Name:   "login",
+		Limit:  limitOrDefault(l.cfg.LoginPerMinute, DefaultLoginPerMinute),
+		Window: time.Minute,
+		Key:    clientIP,
+	})
+}
+
+// TOTP limits second-factor attempts per client IP.
+func (l *Limiter) TOTP() gin.HandlerFunc {
+	if l == nil {
+		return passthrough
+	}
+	return l.Limit(Rule{
+		Name:   "totp",
+		Limit:  limitOrDefault(l.cfg.TOTPPerMinute, DefaultTOTPPerMinute),
+		Window: time.Minute,
+		Key:    clientIP,
+	})
+}
+
+// Upload limits uploads per user or client IP to UploadPerHour. It must run after the
+// (optional) authentication middleware so signed-in uploads count against the user.
+func (l *Limiter) Upload() gin.HandlerFunc {
+	if l == nil {
+		return passthrough
+	}
+	return l.Limit(Rule{
+		Name:   "upload",
+		Limit:  limitOrDefault(l.cfg.UploadPerHour, DefaultUploadPerHour),
+		Window: time.Hour,
+		Key:    l.requester,
+	})
+}
+
+// FilePassword limits downloads and previews that send X-File-Password, per client IP and
+// share token, so a password-protected file cannot be brute-forced.
+func (l *Limiter) FilePassword() gin.HandlerFunc {
+	if l == nil {
+		return passthrough
+	}
+	return l.Limit(Rule{
+		Name:   "file_password",
+		Limit:  limitOrDefault(l.cfg.FilePasswordPerMinute, DefaultFilePasswordPerMinute),
+		Window: time.Minute,
+		Key: func(c *gin.Context) string {
+			if c.GetHeader("X-File-Password") == "" {
+				return ""
+			}
+			return clientIP(c) + ":" + c.Param("shareToken")
+		},
+	})
+}
+
+// Limit enforces rule. Requests over the limit are rejected with 429 and Retry-After;
+// the RateLimit-* headers of every request describe the rule closest to its limit. If the
+// store fails the request is let through, so an outage of the store does not take the
+// API down with it.
+func (l *Limiter) Limit(rule Rule) gin.HandlerFunc {
+	if l == nil || rule.Limit <= 0 || rule.Window <= 0 {
+		return passthrough
+	}
+	policy := fmt.Sprintf("%d;w=%d", rule.Limit, int(rule.Window.Seconds()))
+	return func(c *gin.Context) {
+		key := rule.Key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		now := l.now()
+		hits, err := l.store.Hit(c.Request.Context(), rule.Name+":"+key, rule.Window, now)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "rate limit store failed, allowing request",
+				"component", "ratelimit", "rule", rule.Name, "error", err)
+			c.Next()
+			return
+		}
+
+		remaining := rule.Limit - hits
+		if remaining < 0 {
+			remaining = 0
+		}
+		reset := int(math.Ceil(now.Truncate(rule.Window).Add(rule.Window).Sub(now).Seconds()))
+		setHeaders(c, rule.Limit, remaining, reset, policy)
+
+		if hits > rule.Limit {
+			metrics.RateLimited(rule.Name)
+			c.Header("Retry-After", strconv.Itoa(reset))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":   "Too many requests",
+				"message": fmt.Sprintf("Rate limit exceeded. Try again in %d seconds.", reset),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// setHeaders reports the rule unless an earlier rule on the same request has fewer
+// requests remaining.
+func setHeaders(c *gin.Context, limit, remaining, reset int, policy string) {
+	if current := c.Writer.Header().Get(HeaderRemaining); current != "" {
+		if n, err := strconv.Atoi(current); err == nil && n < remaining {
+			return
+		}
+	}
+	c.Header(HeaderLimit, strconv.Itoa(limit))
+	c.Header(HeaderRemaining, strconv.Itoa(remaining))
+	c.Header(HeaderReset, strconv.Itoa(reset))
+	c.Header(HeaderPolicy, policy)
+}
+
+// requester keys a request by the authenticated user, the user identified by SetIdentify,
+// or the client IP, in that order.
+func (l *Limiter) requester(c *gin.Context) string {
+	if userID, ok := c.Get("userID"); ok {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	if l.identify != nil {
+		if id := l.identify(c); id != "" {
+			return id
+		}
+	}
+	return clientIP(c)
+}
+
+// clientIP relies on gin's trusted proxy handling (Server.TrustedProxies) so that
+// X-Forwarded-For is only honoured when set by the nginx front.
+func clientIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+func limitOrDefault(limit, def int) int {
+	if limit == 0 {
+		return def
+	}
+	return limit
+}
+
+func passthrough(c *gin.Context) {
+	c.Next()
+}
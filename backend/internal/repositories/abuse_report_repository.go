@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AbuseReportRepository interface {
+	Create(report *models.AbuseReport) error
+	GetByID(id uuid.UUID) (*models.AbuseReport, error)
+	// FindOpen returns the open report for a file from the same reporter IP, if any.
+	FindOpen(fileID uuid.UUID, reporterIP string) (*models.AbuseReport, error)
+	List(status models.AbuseReportStatus, fileID *uuid.UUID, limit, offset int) ([]models.AbuseReport, int64, error)
+	Resolve(id uuid.UUID, status models.AbuseReportStatus, reviewerID *uuid.UUID, note *string, at time.Time) error
+	// ResolveOpenForFile closes every open report for a file and returns how many were closed.
+	ResolveOpenForFile(fileID uuid.UUID, status models.AbuseReportStatus, reviewerID *uuid.UUID, note *string, at time.Time) (int64, error)
+}
+
+type abuseReportRepository struct {
+	db *gorm.DB
+}
+
+func NewAbuseReportRepository(db *gorm.DB) AbuseReportRepository {
+	return &abuseReportRepository{db: db}
+}
+
+func (r *abuseReportRepository) Create(report *models.AbuseReport) error {
+	return r.db.Create(report).Error
+}
+
+func (r *abuseReportRepository) GetByID(id uuid.UUID) (*models.AbuseReport, error) {
+	var report models.AbuseReport
+	if err := r.db.Preload("File").Preload("File.Owner").First(&report, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *abuseReportRepository) FindOpen(fileID uuid.UUID, reporterIP string) (*models.AbuseReport, error) {
+	var report models.AbuseReport
+	err := r.db.Where("file_id = ? AND reporter_ip = ? AND status = ?", fileID, reporterIP, models.AbuseReportOpen).
+		First(&report).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *abuseReportRepository) List(status models.AbuseReportStatus, fileID *uuid.UUID, limit, offset int) ([]models.AbuseReport, int64, error) {
+	var reports []models.AbuseReport
+	var total int64
+
+	query := r.db.Model(&models.AbuseReport{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if fileID != nil {
+		query = query.Where("file_id = ?", *fileID)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Oldest open reports first so the queue is worked in order.
+	err := query.Preload("File").
+		Order("created_at ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&reports).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return reports, total, nil
+}
+
+func (r *abuseReportRepository) Resolve(id uuid.UUID, status models.AbuseReportStatus, reviewerID *uuid.UUID, note *string, at time.Time) error {
+	return r.db.Model(&models.AbuseReport{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          status,
+		"reviewed_by":     reviewerID,
+		"reviewed_at":     at,
+		"resolution_note": note,
+	}).Error
+}
+
+func (r *abuseReportRepository) ResolveOpenForFile(fileID uuid.UUID, status models.AbuseReportStatus, reviewerID *uuid.UUID, note *string, at time.Time) (int64, error) {
+	result := r.db.Model(&models.AbuseReport{}).
+		Where("file_id = ? AND status = ?", fileID, models.AbuseReportOpen).
+		Updates(map[string]interface{}{
+			"status":          status,
+			"reviewed_by":     reviewerID,
+			"reviewed_at":     at,
+			"resolution_note": note,
+		})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CleanupRunRepository interface {
+	Create(run *models.CleanupRun) error
+	Update(run *models.CleanupRun) error
+	GetByID(id uuid.UUID) (*models.CleanupRun, error)
+	// List returns runs newest first.
+	List(limit, offset int) ([]models.CleanupRun, int64, error)
+	// FailRunning marks non-dry runs still "running" (left behind by a crashed instance) as failed.
+	FailRunning(message string, at time.Time) (int64, error)
+	AddFiles(files []models.CleanupRunFile) error
+	// ListFiles returns a run's per-file results in processing order, optionally by result.
+	ListFiles(runID uuid.UUID, result models.CleanupFileResult, limit, offset int) ([]models.CleanupRunFile, int64, error)
+}
+
+type cleanupRunRepository struct {
+	db *gorm.DB
+}
+
+func NewCleanupRunRepository(db *gorm.DB) CleanupRunRepository {
+	return &cleanupRunRepository{db: db}
+}
+
+func (r *cleanupRunRepository) Create(run *models.CleanupRun) error {
+	return r.db.Create(run).Error
+}
+
+func (r *cleanupRunRepository) Update(run *models.CleanupRun) error {
+	return r.db.Save(run).Error
+}
+
+func (r *cleanupRunRepository) GetByID(id uuid.UUID) (*models.CleanupRun, error) {
+	var run models.CleanupRun
+	if err := r.db.First(&run, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *cleanupRunRepository) List(limit, offset int) ([]models.CleanupRun, int64, error) {
+	var runs []models.CleanupRun
+	var total int64
+
+	if err := r.db.Model(&models.CleanupRun{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := r.db.Order("started_at DESC").Limit(limit).Offset(offset).Find(&runs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+func (r *cleanupRunRepository) FailRunning(message string, at time.Time) (int64, error) {
+	result := r.db.Model(&models.CleanupRun{}).
+		Where("status = ? AND dry_run = ?", models.CleanupRunRunning, false).
+		Updates(map[string]interface{}{
+			"status":        models.CleanupRunFailed,
+			"error_message": message,
+			"finished_at":   at,
+		})
+	return result.RowsAffected, result.Error
+}
+
+func (r *cleanupRunRepository) AddFiles(files []models.CleanupRunFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(files, 100).Error
+}
+
+func (r *cleanupRunRepository) ListFiles(runID uuid.UUID, result models.CleanupFileResult, limit, offset int) ([]models.CleanupRunFile, int64, error) {
+	var files []models.CleanupRunFile
+	var total int64
+
+	query := r.db.Model(&models.CleanupRunFile{}).Where("run_id = ?", runID)
+	if result != "" {
+		query = query.Where("result = ?", result)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("available_to ASC, file_id ASC").Limit(limit).Offset(offset).Find(&files).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
@@ -10,7 +10,7 @@ import (
 type DownloadHistoryRepository interface {
 	GetByID(id uuid.UUID) (*models.DownloadHistory, error)
 	Create(history *models.DownloadHistory) error
-	GetByFileID(fileID uuid.UUID, limit, offset int) ([]models.DownloadHistory, int64, error)
+	GetByFileID(fileID uuid.UUID, eventType models.FileEventType, limit, offset int) ([]models.DownloadHistory, int64, error)
 	GetByDownloaderID(downloaderID uuid.UUID, limit, offset int) ([]models.DownloadHistory, int64, error)
 	GetByFileIDAndDownloaderID(fileID uuid.UUID, downloaderID uuid.UUID) ([]models.DownloadHistory, error)
 	GetDownloadCount(fileID uuid.UUID) (int64, error)
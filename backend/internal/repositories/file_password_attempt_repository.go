@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type FilePasswordAttemptRepository interface {
+	Get(fileID uuid.UUID, clientKey string) (*models.FilePasswordAttempt, error)
+	// RecordFailure counts a wrong password and returns the updated row. Counts whose last
+	// failure is before staleBefore start over from one.
+	RecordFailure(fileID uuid.UUID, clientKey string, now, staleBefore time.Time) (*models.FilePasswordAttempt, error)
+	SetLockedUntil(fileID uuid.UUID, clientKey string, until time.Time) error
+	Reset(fileID uuid.UUID, clientKey string) error
+}
+
+type filePasswordAttemptRepository struct {
+	db *gorm.DB
+}
+
+func NewFilePasswordAttemptRepository(db *gorm.DB) FilePasswordAttemptRepository {
+	return &filePasswordAttemptRepository{db: db}
+}
+
+func (r *filePasswordAttemptRepository) Get(fileID uuid.UUID, clientKey string) (*models.FilePasswordAttempt, error) {
+	var attempt models.FilePasswordAttempt
+	err := r.db.Where("file_id = ? AND client_key = ?", fileID, clientKey).First(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// RecordFailure is a single upsert so concurrent guesses from the same client cannot
+// read a stale count.
+func (r *filePasswordAttemptRepository) RecordFailure(fileID uuid.UUID, clientKey string, now, staleBefore time.Time) (*models.FilePasswordAttempt, error) {
+	var attempt models.FilePasswordAttempt
+	err := r.db.Raw(`
+		INSERT INTO file_password_attempts (file_id, client_key, failed_attempts, last_failed_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT (file_id, client_key) DO UPDATE SET
+			failed_attempts = CASE WHEN file_password_attempts.last_failed_at < ?
+				THEN 1 ELSE file_password_attempts.failed_attempts + 1 END,
+			last_failed_at = EXCLUDED.last_failed_at
+		RETURNING *`, fileID, clientKey, now, staleBefore).Scan(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *filePasswordAttemptRepository) SetLockedUntil(fileID uuid.UUID, clientKey string, until time.Time) error {
+	return r.db.Model(&models.FilePasswordAttempt{}).
+		Where("file_id = ? AND client_key = ?", fileID, clientKey).
+		Update("locked_until", until).Error
+}
+
+func (r *filePasswordAttemptRepository) Reset(fileID uuid.UUID, clientKey string) error {
+	return r.db.Where("file_id = ? AND client_key = ?", fileID, clientKey).
+		Delete(&models.FilePasswordAttempt{}).Error
+}
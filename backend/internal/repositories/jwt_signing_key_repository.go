@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"gorm.io/gorm"
+)
+
+type JWTSigningKeyRepository interface {
+	Create(key *models.JWTSigningKey) error
+	// ListUsable returns keys that have not expired at the given time, newest first.
+	ListUsable(now time.Time) ([]models.JWTSigningKey, error)
+	// RetireOlderThan retires every key still signing that was created before createdAt,
+	// other than kid.
+	RetireOlderThan(kid string, createdAt, retiredAt, expiresAt time.Time) error
+	DeleteExpired(now time.Time) error
+}
+
+type jwtSigningKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewJWTSigningKeyRepository(db *gorm.DB) JWTSigningKeyRepository {
+	return &jwtSigningKeyRepository{db: db}
+}
+
+func (r *jwtSigningKeyRepository) Create(key *models.JWTSigningKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *jwtSigningKeyRepository) ListUsable(now time.Time) ([]models.JWTSigningKey, error) {
+	var keys []models.JWTSigningKey
+	err := r.db.Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+func (r *jwtSigningKeyRepository) RetireOlderThan(kid string, createdAt, retiredAt, expiresAt time.Time) error {
+	return r.db.Model(&models.JWTSigningKey{}).
+		Where("kid <> ? AND retired_at IS NULL AND created_at < ?", kid, createdAt).
+		Updates(map[string]interface{}{
+			"retired_at": retiredAt,
+			"expires_at": expiresAt,
+		}).Error
+}
+
+func (r *jwtSigningKeyRepository) DeleteExpired(now time.Time) error {
+	return r.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Delete(&models.JWTSigningKey{}).Error
+}
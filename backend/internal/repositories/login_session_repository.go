@@ -11,7 +11,7 @@ import (
 type LoginSessionRepository interface {
 	Create(userID uuid.UUID, ttl time.Duration) (*models.LoginSession, error)
 	GetActiveByID(id uuid.UUID, now time.Time) (*models.LoginSession, error)
-	IncrementFailedAttempts(id uuid.UUID) error
+	ReserveAttempt(id uuid.UUID, maxAttempts int) (int, bool, error)
 	MarkConsumed(id uuid.UUID, consumedAt time.Time) error
 }
 
@@ -47,16 +47,35 @@ func (r *loginSessionRepository) GetActiveByID(id uuid.UUID, now time.Time) (*mo
 	return &session, nil
 }
 
-func (r *loginSessionRepository) IncrementFailedAttempts(id uuid.UUID) error {
-	return r.db.Model(&models.LoginSession{}).
-		Where("id = ?", id).
-		UpdateColumn("failed_attempts", gorm.Expr("failed_attempts + 1")).Error
+// ReserveAttempt atomically counts one more attempt against an open session before the
+// code is checked, and returns the new count. It reports false without counting once
+// maxAttempts are used up or the session is consumed, so concurrent guesses cannot all
+// pass a stale check.
+func (r *loginSessionRepository) ReserveAttempt(id uuid.UUID, maxAttempts int) (int, bool, error) {
+	var attempts []int
+	err := r.db.Raw(
+		"UPDATE login_sessions SET failed_attempts = failed_attempts + 1 WHERE id = ? AND failed_attempts < ? AND consumed_at IS NULL RETURNING failed_attempts",
+		id, maxAttempts,
+	).Scan(&attempts).Error
+	if err != nil || len(attempts) == 0 {
+		return 0, false, err
+	}
+	return attempts[0], true, nil
 }
 
+// MarkConsumed closes the session. Only one caller can consume it: the others get
+// gorm.ErrRecordNotFound, as if the session had already expired.
 func (r *loginSessionRepository) MarkConsumed(id uuid.UUID, consumedAt time.Time) error {
-	return r.db.Model(&models.LoginSession{}).
-		Where("id = ?", id).
-		Update("consumed_at", consumedAt).Error
+	result := r.db.Model(&models.LoginSession{}).
+		Where("id = ? AND consumed_at IS NULL", id).
+		Update("consumed_at", consumedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
 
@@ -9,9 +9,6 @@ type StatisticsRepository interface {
 	GetByFileID(fileID uuid.UUID) (*models.FileStatistics, error)
 	Create(stats *models.FileStatistics) error
 	Update(stats *models.FileStatistics) error
-	IncrementDownloadCount(fileID uuid.UUID) error
-	IncrementUniqueDownloaders(fileID uuid.UUID) error
-	UpdateLastDownloadedAt(fileID uuid.UUID) error
 	GetByFileIDs(fileIDs []uuid.UUID) ([]models.FileStatistics, error)
 	Delete(fileID uuid.UUID) error
 }
\ No newline at end of file
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type UserIdentityRepository interface {
+	Create(identity *models.UserIdentity) error
+	GetByIssuerSubject(issuer, subject string) (*models.UserIdentity, error)
+	UpdateLastLogin(id uuid.UUID, at time.Time) error
+}
+
+type OIDCAuthRequestRepository interface {
+	Create(request *models.OIDCAuthRequest) error
+	// Consume returns the unexpired request for state and deletes it, so each
+	// authorization response can be redeemed once.
+	Consume(state string, now time.Time) (*models.OIDCAuthRequest, error)
+	DeleteExpired(now time.Time) error
+}
+
+type userIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewUserIdentityRepository(db *gorm.DB) UserIdentityRepository {
+	return &userIdentityRepository{db: db}
+}
+
+func (r *userIdentityRepository) Create(identity *models.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *userIdentityRepository) GetByIssuerSubject(issuer, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := r.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *userIdentityRepository) UpdateLastLogin(id uuid.UUID, at time.Time) error {
+	return r.db.Model(&models.UserIdentity{}).
+		Where("id = ?", id).
+		Update("last_login_at", at).Error
+}
+
+type oidcAuthRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCAuthRequestRepository(db *gorm.DB) OIDCAuthRequestRepository {
+	return &oidcAuthRequestRepository{db: db}
+}
+
+func (r *oidcAuthRequestRepository) Create(request *models.OIDCAuthRequest) error {
+	return r.db.Create(request).Error
+}
+
+func (r *oidcAuthRequestRepository) Consume(state string, now time.Time) (*models.OIDCAuthRequest, error) {
+	var requests []models.OIDCAuthRequest
+	err := r.db.Raw(
+		"DELETE FROM oidc_auth_requests WHERE state = ? RETURNING *",
+		state,
+	).Scan(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 || !requests[0].ExpiresAt.After(now) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &requests[0], nil
+}
+
+func (r *oidcAuthRequestRepository) DeleteExpired(now time.Time) error {
+	return r.db.Where("expires_at <= ?", now).Delete(&models.OIDCAuthRequest{}).Error
+}
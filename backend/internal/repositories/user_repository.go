@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -16,6 +18,9 @@ type UserRepository interface {
 	GetAll(limit, offset int) ([]models.User, int64, error)
 	ExistsByUsername(username string) (bool, error)
 	ExistsByEmail(email string) (bool, error)
+	IncrementTOTPFailedAttempts(id uuid.UUID) (int, error)
+	ResetTOTPFailedAttempts(id uuid.UUID) error
+	SetLockedUntil(id uuid.UUID, until *time.Time) error
 }
 
 type userRepository struct {
@@ -83,3 +88,25 @@ func (r *userRepository) ExistsByEmail(email string) (bool, error) {
 	err := r.db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error
 	return count > 0, err
 }
+
+// IncrementTOTPFailedAttempts atomically bumps the consecutive TOTP failure counter and returns the new value.
+func (r *userRepository) IncrementTOTPFailedAttempts(id uuid.UUID) (int, error) {
+	var attempts int
+	err := r.db.Raw(
+		"UPDATE users SET totp_failed_attempts = totp_failed_attempts + 1 WHERE id = ? RETURNING totp_failed_attempts",
+		id,
+	).Scan(&attempts).Error
+	return attempts, err
+}
+
+func (r *userRepository) ResetTOTPFailedAttempts(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"totp_failed_attempts": 0, "locked_until": nil}).Error
+}
+
+func (r *userRepository) SetLockedUntil(id uuid.UUID, until *time.Time) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		Update("locked_until", until).Error
+}
@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type WebAuthnCredentialRepository interface {
+	Create(credential *models.WebAuthnCredential) error
+	GetByUserID(userID uuid.UUID) ([]models.WebAuthnCredential, error)
+	GetByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error)
+	CountByUserID(userID uuid.UUID) (int64, error)
+	UpdateName(id, userID uuid.UUID, name string) error
+	UpdateAfterLogin(credential *models.WebAuthnCredential) error
+	Delete(id, userID uuid.UUID) error
+}
+
+type WebAuthnSessionRepository interface {
+	Create(session *models.WebAuthnSession) error
+	// Consume returns the unexpired session of the given ceremony and deletes it,
+	// so every challenge can be answered at most once.
+	Consume(id uuid.UUID, ceremony string, now time.Time) (*models.WebAuthnSession, error)
+	DeleteExpired(now time.Time) error
+}
+
+type webAuthnCredentialRepository struct {
+	db *gorm.DB
+}
+
+func NewWebAuthnCredentialRepository(db *gorm.DB) WebAuthnCredentialRepository {
+	return &webAuthnCredentialRepository{db: db}
+}
+
+func (r *webAuthnCredentialRepository) Create(credential *models.WebAuthnCredential) error {
+	return r.db.Create(credential).Error
+}
+
+func (r *webAuthnCredentialRepository) GetByUserID(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *webAuthnCredentialRepository) GetByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	if err := r.db.Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *webAuthnCredentialRepository) CountByUserID(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *webAuthnCredentialRepository) UpdateName(id, userID uuid.UUID, name string) error {
+	result := r.db.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("name", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *webAuthnCredentialRepository) UpdateAfterLogin(credential *models.WebAuthnCredential) error {
+	return r.db.Model(&models.WebAuthnCredential{}).
+		Where("id = ?", credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":    credential.SignCount,
+			"clone_warning": credential.CloneWarning,
+			"backup_state":  credential.BackupState,
+			"last_used_at":  credential.LastUsedAt,
+		}).Error
+}
+
+func (r *webAuthnCredentialRepository) Delete(id, userID uuid.UUID) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+type webAuthnSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewWebAuthnSessionRepository(db *gorm.DB) WebAuthnSessionRepository {
+	return &webAuthnSessionRepository{db: db}
+}
+
+func (r *webAuthnSessionRepository) Create(session *models.WebAuthnSession) error {
+	return r.db.Create(session).Error
+}
+
+func (r *webAuthnSessionRepository) Consume(id uuid.UUID, ceremony string, now time.Time) (*models.WebAuthnSession, error) {
+	var sessions []models.WebAuthnSession
+	err := r.db.Raw(
+		"DELETE FROM webauthn_sessions WHERE id = ? AND ceremony = ? RETURNING *",
+		id, ceremony,
+	).Scan(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 || !sessions[0].ExpiresAt.After(now) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &sessions[0], nil
+}
+
+func (r *webAuthnSessionRepository) DeleteExpired(now time.Time) error {
+	return r.db.Where("expires_at <= ?", now).Delete(&models.WebAuthnSession{}).Error
+}
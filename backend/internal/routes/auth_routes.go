@@ -2,36 +2,72 @@ package routes
 
 import (
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/controllers"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterAuthRoutes(router *gin.RouterGroup, authController *controllers.AuthController, authMiddleware gin.HandlerFunc) {
+func RegisterAuthRoutes(
+	router *gin.RouterGroup,
+	authController *controllers.AuthController,
+	webAuthnController *controllers.WebAuthnController,
+	oidcController *controllers.OIDCController,
+	authMiddleware gin.HandlerFunc,
+	limits *ratelimit.Limiter,
+) {
+	// Credential attempts are limited per client IP (see config rate_limit)
+	login := limits.Login()
+	secondFactor := limits.TOTP()
+
 	// Public auth endpoints
 	// POST /auth/register - Register new user
-	router.POST("/register", authController.Register)
+	router.POST("/register", login, authController.Register)
 
 	// POST /auth/login - Login user (password step)
-	router.POST("/login", authController.Login)
+	router.POST("/login", login, authController.Login)
 
 	// POST /auth/login/totp - Login with TOTP after password step
-	router.POST("/login/totp", authController.LoginTOTP)
+	router.POST("/login/totp", secondFactor, authController.LoginTOTP)
+
+	// POST /auth/login/webauthn/begin|finish - Login with a security key after password step
+	router.POST("/login/webauthn/begin", secondFactor, webAuthnController.LoginBegin)
+	router.POST("/login/webauthn/finish", secondFactor, webAuthnController.LoginFinish)
+
+	// POST /auth/login/passkey/begin|finish - Passwordless login with a discoverable passkey
+	router.POST("/login/passkey/begin", login, webAuthnController.PasskeyBegin)
+	router.POST("/login/passkey/finish", login, webAuthnController.PasskeyFinish)
+
+	// GET /auth/oidc/login - Redirect to the corporate identity provider (SSO)
+	router.GET("/oidc/login", oidcController.Login)
 
-	// Protected auth endpoints (require valid JWT)
+	// GET /auth/oidc/callback - Finish SSO login and return an access token
+	router.GET("/oidc/callback", oidcController.Callback)
+
+	// Protected auth endpoints (require valid JWT; personal access tokens are rejected)
 	protected := router.Group("")
-	protected.Use(authMiddleware)
+	protected.Use(authMiddleware, middleware.SessionOnly())
 	{
 		// POST /auth/totp/setup - Generate TOTP secret and QR
 		protected.POST("/totp/setup", authController.TOTPSetup)
 
 		// POST /auth/totp/verify - Verify TOTP and enable it
-		protected.POST("/totp/verify", authController.TOTPVerify)
+		protected.POST("/totp/verify", secondFactor, authController.TOTPVerify)
 
 		// POST /auth/totp/disable - Disable TOTP (requires TOTP code)
-		protected.POST("/totp/disable", authController.DisableTOTP)
+		protected.POST("/totp/disable", secondFactor, authController.DisableTOTP)
 
 		// POST /auth/password/change - Change password (requires old password or TOTP code)
 		protected.POST("/password/change", authController.ChangePassword)
 
+		// POST /auth/webauthn/register/begin|finish - Register a security key or passkey
+		protected.POST("/webauthn/register/begin", webAuthnController.RegisterBegin)
+		protected.POST("/webauthn/register/finish", webAuthnController.RegisterFinish)
+
+		// GET/PATCH/DELETE /auth/webauthn/credentials - Manage registered security keys
+		protected.GET("/webauthn/credentials", webAuthnController.ListCredentials)
+		protected.PATCH("/webauthn/credentials/:id", webAuthnController.RenameCredential)
+		protected.DELETE("/webauthn/credentials/:id", webAuthnController.DeleteCredential)
+
 		// POST /auth/logout - Logout user
 		protected.POST("/logout", authController.Logout)
 	}
@@ -4,46 +4,59 @@ import (
 	"strings"
 
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/controllers"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterFileRoutes(router *gin.RouterGroup, fileController *controllers.FileController, authMiddleware gin.HandlerFunc) {
+func RegisterFileRoutes(router *gin.RouterGroup, fileController *controllers.FileController, authMiddleware gin.HandlerFunc, limits *ratelimit.Limiter) {
+	// Personal access tokens must carry the matching scope; JWT and anonymous requests are unaffected.
+	read := middleware.RequireScope(models.ScopeFilesRead)
+	write := middleware.RequireScope(models.ScopeFilesWrite)
+
 	// Public endpoints
 	// POST /files/upload - Upload a file
-	router.POST("/upload", optionalAuth(authMiddleware), fileController.UploadFile)
+	router.POST("/upload", optionalAuth(authMiddleware), write, limits.Upload(), fileController.UploadFile)
 
 	// GET /files/:shareToken - Get file metadata (public, optional auth for owner details)
-	router.GET("/:shareToken", optionalAuth(authMiddleware), fileController.GetFileInfo)
+	router.GET("/:shareToken", optionalAuth(authMiddleware), read, fileController.GetFileInfo)
 
 	// GET /files/:shareToken/download - Download a file (requires valid Bearer token)
-	router.GET("/:shareToken/download", optionalAuth(authMiddleware), fileController.DownloadFile)
+	router.GET("/:shareToken/download", optionalAuth(authMiddleware), read, limits.FilePassword(), fileController.DownloadFile)
 
 	// GET /files/:shareToken/preview - Preview/stream a file (inline display)
-	router.GET("/:shareToken/preview", optionalAuth(authMiddleware), fileController.PreviewFile)
+	router.GET("/:shareToken/preview", optionalAuth(authMiddleware), read, limits.FilePassword(), fileController.PreviewFile)
+
+	// POST /files/:shareToken/report - Report a shared file for abuse (no auth required)
+	router.POST("/:shareToken/report", fileController.ReportFile)
 
 	// Authenticated routes group
 	authenticated := router.Group("")
 	authenticated.Use(authMiddleware)
 	{
 		// GET /files/my - Get list of files owned by current user
-		authenticated.GET("/my", fileController.GetMyFiles)
+		authenticated.GET("/my", read, fileController.GetMyFiles)
 
 		// GET /files/info/:id - Get file info by UUID (owner/admin only)
-		authenticated.GET("/info/:id", fileController.GetFileByID)
+		authenticated.GET("/info/:id", read, fileController.GetFileByID)
 
 		// DELETE /files/info/:id - Delete file by UUID (owner/admin only)
-		authenticated.DELETE("/info/:id", fileController.DeleteFile)
+		authenticated.DELETE("/info/:id", write, fileController.DeleteFile)
 
 		// GET /files/stats/:id - Get file statistics
 		stats := authenticated.Group("/stats")
 		{
-			stats.GET("/:id", fileController.GetFileStats)
+			stats.GET("/:id", read, fileController.GetFileStats)
 		}
 
+		// GET /files/analytics/:id - Get bucketed download analytics
+		authenticated.GET("/analytics/:id", read, fileController.GetFileAnalytics)
+
 		// GET /files/download-history/:id - Get download history
 		downloadHistory := authenticated.Group("/download-history")
 		{
-			downloadHistory.GET("/:id", fileController.GetDownloadHistory)
+			downloadHistory.GET("/:id", read, fileController.GetDownloadHistory)
 		}
 	}
 }
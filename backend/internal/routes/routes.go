@@ -2,6 +2,9 @@ package routes
 
 import (
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/controllers"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,32 +13,51 @@ func SetupRoutes(
 	router *gin.Engine,
 	fileController *controllers.FileController,
 	authController *controllers.AuthController,
+	webAuthnController *controllers.WebAuthnController,
+	oidcController *controllers.OIDCController,
+	tokenController *controllers.PersonalAccessTokenController,
+	healthController *controllers.HealthController,
 	authMiddleware gin.HandlerFunc,
+	limits *ratelimit.Limiter,
 ) {
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	// Health checks: liveness (process only) and readiness (database, storage, disk)
+	router.GET("/health", healthController.Live)
+	router.GET("/health/live", healthController.Live)
+	router.GET("/health/ready", healthController.Ready)
+
+	// Public keys for verifying access tokens signed with RS256/EdDSA
+	router.GET("/.well-known/jwks.json", authController.JWKS)
 
 	// API routes group with /api prefix
 	api := router.Group("/api")
 
 	// Public policy limits (max file size, password length)
-	api.GET("/policy/limits", fileController.GetPolicyLimits)
+	api.GET("/policy/limits", optionalAuth(authMiddleware), fileController.GetPolicyLimits)
 
 	// Auth routes: /api/auth/*
 	authGroup := api.Group("/auth")
-	RegisterAuthRoutes(authGroup, authController, authMiddleware)
+	RegisterAuthRoutes(authGroup, authController, webAuthnController, oidcController, authMiddleware, limits)
 
 	// User profile route: /api/user
 	userGroup := api.Group("/user")
 	userGroup.Use(authMiddleware)
 	{
-		userGroup.GET("", authController.Profile)
+		userGroup.GET("", middleware.RequireScope(models.ScopeUserRead), authController.Profile)
+		userGroup.GET("/security-events", middleware.RequireScope(models.ScopeUserRead), authController.SecurityEvents)
+		userGroup.GET("/analytics", middleware.RequireScope(models.ScopeFilesRead), fileController.GetUserAnalytics)
+
+		// Personal access tokens can only be managed from an interactive login
+		tokens := userGroup.Group("/tokens")
+		tokens.Use(middleware.SessionOnly())
+		{
+			tokens.GET("", tokenController.List)
+			tokens.POST("", tokenController.Create)
+			tokens.DELETE("/:id", tokenController.Revoke)
+		}
 	}
 
 	// File routes: /api/files/*
 	filesGroup := api.Group("/files")
-	RegisterFileRoutes(filesGroup, fileController, authMiddleware)
+	RegisterFileRoutes(filesGroup, fileController, authMiddleware, limits)
 }
 
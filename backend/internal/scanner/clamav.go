@@ -0,0 +1,155 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the INSTREAM chunk size; it must stay below clamd's StreamMaxLength.
+const clamdChunkSize = 32 * 1024
+
+// ClamAV implements the Scanner interface by talking to a clamd daemon
+// using the INSTREAM command of the clamd protocol.
+type ClamAV struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamAV accepts "tcp://host:port", "unix:///path/to/clamd.sock" or a bare "host:port".
+func NewClamAV(address string, timeout time.Duration) (*ClamAV, error) {
+	network, addr := "tcp", address
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		addr = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "unix://"):
+		network, addr = "unix", strings.TrimPrefix(address, "unix://")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("clamav: missing daemon address")
+	}
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	return &ClamAV{network: network, address: addr, timeout: timeout}, nil
+}
+
+// Ping checks that the daemon is reachable and answering.
+func (s *ClamAV) Ping(ctx context.Context) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: unexpected ping reply %q", ErrScanFailed, reply)
+	}
+	return nil
+}
+
+func (s *ClamAV) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	header := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(header, uint32(n))
+			if _, err := conn.Write(header); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrScanFailed, err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				// clamd closes the connection early when StreamMaxLength is hit;
+				// its reply explains why, so prefer that over the write error.
+				if reply, replyErr := readReply(conn); replyErr == nil {
+					return parseReply(reply)
+				}
+				return nil, fmt.Errorf("%w: %v", ErrScanFailed, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	// A zero-length chunk terminates the stream.
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseReply(reply)
+}
+
+func (s *ClamAV) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// readReply reads one NUL-terminated reply (the "z" command prefix).
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && (err != io.EOF || len(reply) == 0) {
+		return "", fmt.Errorf("%w: reading reply: %v", ErrScanFailed, err)
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// parseReply interprets "stream: OK", "stream: <signature> FOUND" and "... ERROR".
+func parseReply(reply string) (*Result, error) {
+	body := strings.TrimSpace(reply)
+	if idx := strings.Index(body, ": "); idx >= 0 {
+		body = body[idx+2:]
+	}
+
+	switch {
+	case body == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(body, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(body, " FOUND")}, nil
+	case strings.HasSuffix(body, " ERROR"):
+		return nil, fmt.Errorf("%w: %s", ErrScanFailed, strings.TrimSuffix(body, " ERROR"))
+	default:
+		return nil, fmt.Errorf("%w: unexpected reply %q", ErrScanFailed, reply)
+	}
+}
@@ -0,0 +1,23 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrScanFailed is returned when the engine could not produce a verdict
+// (daemon unreachable, protocol error, size limit exceeded, ...).
+var ErrScanFailed = errors.New("scanner: scan failed")
+
+// Result is the verdict for a single scanned stream.
+type Result struct {
+	Infected  bool
+	Signature string // name of the matched signature when Infected
+}
+
+// Scanner describes a malware scanning engine. Implementations must consume
+// the reader fully or return an error.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAbuseReason = errors.New("invalid abuse report reason")
+	ErrReportNotOpen      = errors.New("abuse report has already been reviewed")
+	ErrFileNotTakenDown   = errors.New("file is not taken down")
+)
+
+// TakedownFileStore is the part of FileService the abuse workflow needs.
+type TakedownFileStore interface {
+	GetByShareToken(token string) (*models.File, error)
+	GetByID(id uuid.UUID) (*models.File, error)
+	SetTakenDown(id uuid.UUID, takenDown bool, reason string) (*models.File, error)
+}
+
+var _ TakedownFileStore = (*FileService)(nil)
+
+type AbuseReportInput struct {
+	Reason       string
+	Details      string
+	ContactEmail string
+	ReporterIP   string
+}
+
+// AbuseReportService accepts anonymous abuse reports on share links and lets moderators
+// dismiss them or take the file down. Owners are notified of takedowns and restores.
+type AbuseReportService struct {
+	repo     repositories.AbuseReportRepository
+	files    TakedownFileStore
+	notifier Notifier
+}
+
+func NewAbuseReportService(repo repositories.AbuseReportRepository, files TakedownFileStore) *AbuseReportService {
+	return &AbuseReportService{
+		repo:     repo,
+		files:    files,
+		notifier: logNotifier{},
+	}
+}
+
+// SetNotifier sets how file owners are told about takedowns (default: log only).
+func (s *AbuseReportService) SetNotifier(n Notifier) {
+	if n != nil {
+		s.notifier = n
+	}
+}
+
+// Report files an abuse report against a share link. Repeated reports for the same file
+// from the same IP while one is still open return the existing report (created=false).
+func (s *AbuseReportService) Report(shareToken string, input AbuseReportInput) (report *models.AbuseReport, created bool, err error) {
+	reason := models.AbuseReason(strings.ToLower(strings.TrimSpace(input.Reason)))
+	if !reason.IsValid() {
+		return nil, false, ErrInvalidAbuseReason
+	}
+
+	file, err := s.files.GetByShareToken(shareToken)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if input.ReporterIP != "" {
+		existing, err := s.repo.FindOpen(file.ID, input.ReporterIP)
+		if err == nil {
+			return existing, false, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, err
+		}
+	}
+
+	report = &models.AbuseReport{
+		FileID:       file.ID,
+		Reason:       reason,
+		Details:      optionalString(strings.TrimSpace(input.Details)),
+		ContactEmail: optionalString(strings.TrimSpace(input.ContactEmail)),
+		ReporterIP:   optionalString(input.ReporterIP),
+		Status:       models.AbuseReportOpen,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := s.repo.Create(report); err != nil {
+		return nil, false, err
+	}
+	return report, true, nil
+}
+
+func (s *AbuseReportService) List(status models.AbuseReportStatus, fileID *uuid.UUID, limit, offset int) ([]models.AbuseReport, int64, error) {
+	return s.repo.List(status, fileID, limit, offset)
+}
+
+func (s *AbuseReportService) GetByID(id uuid.UUID) (*models.AbuseReport, error) {
+	return s.repo.GetByID(id)
+}
+
+// Dismiss closes an open report without acting on the file.
+func (s *AbuseReportService) Dismiss(reportID uuid.UUID, reviewerID *uuid.UUID, note string) (*models.AbuseReport, error) {
+	report, err := s.repo.GetByID(reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status != models.AbuseReportOpen {
+		return nil, ErrReportNotOpen
+	}
+	if err := s.repo.Resolve(report.ID, models.AbuseReportDismissed, reviewerID, optionalString(strings.TrimSpace(note)), time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(report.ID)
+}
+
+// TakedownReport takes down the reported file and closes every open report against it.
+func (s *AbuseReportService) TakedownReport(reportID uuid.UUID, reviewerID *uuid.UUID, note string) (*models.AbuseReport, error) {
+	report, err := s.repo.GetByID(reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status != models.AbuseReportOpen {
+		return nil, ErrReportNotOpen
+	}
+
+	reason := strings.TrimSpace(note)
+	if reason == "" {
+		reason = fmt.Sprintf("Reported as %s", report.Reason)
+	}
+	if _, _, err := s.Takedown(report.FileID, reviewerID, reason); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(report.ID)
+}
+
+// Takedown blocks a file's share link with 451, marks its open reports as actioned and
+// notifies the owner. Taking down a file that is already down only closes open reports.
+func (s *AbuseReportService) Takedown(fileID uuid.UUID, reviewerID *uuid.UUID, reason string) (*models.File, int64, error) {
+	file, err := s.files.GetByID(fileID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	alreadyDown := file.TakenDownAt != nil
+	if !alreadyDown {
+		if file, err = s.files.SetTakenDown(fileID, true, reason); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	resolved, err := s.repo.ResolveOpenForFile(fileID, models.AbuseReportActioned, reviewerID, optionalString(reason), time.Now().UTC())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !alreadyDown {
+		s.notifyOwner(file,
+			fmt.Sprintf("Your file %q has been taken down", file.FileName),
+			fmt.Sprintf("Your shared file %q was taken down after review of an abuse report.\n\nReason: %s\n\n"+
+				"Its share link now answers 451 Unavailable For Legal Reasons. If you believe this is a mistake, please contact support.",
+				file.FileName, reason))
+	}
+	return file, resolved, nil
+}
+
+// Restore lifts a takedown and notifies the owner.
+func (s *AbuseReportService) Restore(fileID uuid.UUID) (*models.File, error) {
+	file, err := s.files.GetByID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.TakenDownAt == nil {
+		return nil, ErrFileNotTakenDown
+	}
+	if file, err = s.files.SetTakenDown(fileID, false, ""); err != nil {
+		return nil, err
+	}
+	s.notifyOwner(file,
+		fmt.Sprintf("Your file %q has been restored", file.FileName),
+		fmt.Sprintf("The takedown of your shared file %q has been lifted and its share link works again.", file.FileName))
+	return file, nil
+}
+
+// notifyOwner is best effort: a failed email must not undo a takedown.
+func (s *AbuseReportService) notifyOwner(file *models.File, subject, body string) {
+	if file == nil || file.Owner == nil || file.Owner.Email == "" {
+		return
+	}
+	if err := s.notifier.Notify(context.Background(), file.Owner.Email, subject, body); err != nil {
+		slog.Error("notifying file owner failed", "component", "abuse", "file_id", file.ID, "error", err)
+	}
+}
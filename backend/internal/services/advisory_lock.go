@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Advisory lock keys shared by every replica.
+const (
+	// LockKeyCleanupLeader is held for as long as a replica is the cleanup scheduler leader.
+	LockKeyCleanupLeader int64 = 0x66735f636c6e01
+	// LockKeyCleanupRun is held while a cleanup run (scheduled or manual) is in progress.
+	LockKeyCleanupRun int64 = 0x66735f636c6e02
+	// LockKeyJWTRotation is held while checking whether the JWT signing key is due and rotating it.
+	LockKeyJWTRotation int64 = 0x66735f6a777401
+)
+
+// Locker is a cluster-wide mutex. TryLock never blocks; it reports whether the caller
+// holds the lock afterwards (re-acquiring a lock already held succeeds).
+type Locker interface {
+	TryLock(ctx context.Context) (bool, error)
+	Unlock(ctx context.Context) error
+}
+
+// AdvisoryLock is a Postgres session-level advisory lock held on a dedicated connection,
+// so it is released automatically when the process dies or the connection drops.
+type AdvisoryLock struct {
+	db  *gorm.DB
+	key int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+func NewAdvisoryLock(db *gorm.DB, key int64) *AdvisoryLock {
+	return &AdvisoryLock{db: db, key: key}
+}
+
+func (l *AdvisoryLock) TryLock(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn != nil {
+		// Still ours as long as the session is alive.
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
+
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+	if err != nil {
+		// Never hand a session that may still hold the lock back to the pool: mark the
+		// connection bad so database/sql discards it, which ends the session.
+		_ = l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	l.conn.Close()
+	l.conn = nil
+	return err
+}
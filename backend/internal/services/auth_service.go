@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"image/png"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/metrics"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
 	"github.com/golang-jwt/jwt/v5"
@@ -26,8 +28,31 @@ var (
 	ErrInvalidTOTPCode      = errors.New("invalid totp code")
 	ErrTOTPSecretNotCreated = errors.New("totp secret not created")
 	ErrLoginSessionExpired  = errors.New("login session expired")
+	ErrTOTPAttemptsExceeded = errors.New("too many failed totp attempts")
+	ErrAccountLocked        = errors.New("account temporarily locked")
+	ErrAccountSuspended     = errors.New("account suspended")
 )
 
+// AccountLockedError is returned while an account is locked after repeated TOTP failures.
+// It matches ErrAccountLocked with errors.Is.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("account temporarily locked until %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *AccountLockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// ClientInfo describes the client performing an authentication attempt, for security events.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
 type TokenClaims struct {
 	UserID      string        `json:"sub"`
 	Email       string        `json:"email"`
@@ -40,9 +65,17 @@ type TokenClaims struct {
 type AuthService struct {
 	userRepo             repositories.UserRepository
 	loginSessionRepo     repositories.LoginSessionRepository
+	securityEventRepo    repositories.SecurityEventRepository
+	keys                 *JWTKeyManager
 	cfg                  *config.Config
 	loginSessionTTL      time.Duration
 	maxTOTPFailedAttempt int
+
+	// Account lockout: once consecutive TOTP failures across sessions reach the threshold,
+	// the account is locked for base * 2^(failures - threshold), capped at max.
+	accountLockThreshold int
+	accountLockBase      time.Duration
+	accountLockMax       time.Duration
 }
 
 type TOTPSetup struct {
@@ -54,9 +87,13 @@ func NewAuthService(repo repositories.UserRepository, cfg *config.Config) *AuthS
 	return &AuthService{
 		userRepo:             repo,
 		loginSessionRepo:     nil,
+		keys:                 newHMACKeyManager(cfg.JWT.Secret),
 		cfg:                  cfg,
 		loginSessionTTL:      5 * time.Minute,
 		maxTOTPFailedAttempt: 5,
+		accountLockThreshold: 10,
+		accountLockBase:      time.Minute,
+		accountLockMax:       24 * time.Hour,
 	}
 }
 
@@ -71,6 +108,21 @@ func NewAuthServiceWithLoginSessions(
 	return svc
 }
 
+// SetSecurityEventRepository enables recording of failed attempts and lockouts for the user to review.
+func (s *AuthService) SetSecurityEventRepository(repo repositories.SecurityEventRepository) {
+	s.securityEventRepo = repo
+}
+
+// SetKeyManager replaces the default HS256 signer, e.g. with rotating RS256/EdDSA keys.
+func (s *AuthService) SetKeyManager(keys *JWTKeyManager) {
+	s.keys = keys
+}
+
+// KeyManager returns the signer used for access tokens, which also verifies them.
+func (s *AuthService) KeyManager() *JWTKeyManager {
+	return s.keys
+}
+
 func (s *AuthService) Register(username, email, password string) (*models.User, error) {
 	if len(password) < 8 {
 		return nil, fmt.Errorf("password too short")
@@ -110,7 +162,11 @@ func (s *AuthService) Register(username, email, password string) (*models.User,
 	return user, nil
 }
 
-func (s *AuthService) Login(email, password string) (*models.User, bool, error) {
+// Login checks email and password. client is recorded with the security event of a login
+// blocked by an account lockout.
+func (s *AuthService) Login(email, password string, client ClientInfo) (_ *models.User, _ bool, err error) {
+	defer func() { recordAuthFailure("password", err) }()
+
 	user, err := s.userRepo.GetByEmail(email)
 	if err != nil {
 		return nil, false, err
@@ -123,6 +179,14 @@ func (s *AuthService) Login(email, password string) (*models.User, bool, error)
 		return nil, false, ErrInvalidCredentials
 	}
 
+	if now := time.Now().UTC(); user.IsLocked(now) {
+		s.recordSecurityEvent(user.ID, models.SecurityEventLoginBlocked, client, "login attempted while account locked")
+		return nil, false, &AccountLockedError{Until: *user.LockedUntil}
+	}
+	if user.IsSuspended() {
+		return nil, false, ErrAccountSuspended
+	}
+
 	totpEnabled := user.TOTPEnabled != nil && *user.TOTPEnabled
 	return user, totpEnabled, nil
 }
@@ -139,7 +203,9 @@ func (s *AuthService) CreateLoginSession(userID uuid.UUID) (uuid.UUID, error) {
 	return session.ID, nil
 }
 
-func (s *AuthService) LoginWithTOTP(userID uuid.UUID, code string) (*models.User, error) {
+func (s *AuthService) LoginWithTOTP(userID uuid.UUID, code string) (_ *models.User, err error) {
+	defer func() { recordAuthFailure("totp", err) }()
+
 	user, err := s.userRepo.GetByID(userID)
 	if err != nil {
 		return nil, err
@@ -162,7 +228,9 @@ func (s *AuthService) LoginWithTOTP(userID uuid.UUID, code string) (*models.User
 	return user, nil
 }
 
-func (s *AuthService) LoginWithTOTPSession(cid uuid.UUID, code string) (*models.User, error) {
+func (s *AuthService) LoginWithTOTPSession(cid uuid.UUID, code string, client ClientInfo) (_ *models.User, err error) {
+	defer func() { recordAuthFailure("totp", err) }()
+
 	if s.loginSessionRepo == nil {
 		return nil, fmt.Errorf("login session repository not configured")
 	}
@@ -190,19 +258,158 @@ func (s *AuthService) LoginWithTOTPSession(cid uuid.UUID, code string) (*models.
 		return nil, ErrTOTPSecretNotCreated
 	}
 
+	if user.IsLocked(now) {
+		_ = s.loginSessionRepo.MarkConsumed(session.ID, now)
+		s.recordSecurityEvent(user.ID, models.SecurityEventLoginBlocked, client, "totp attempted while account locked")
+		return nil, &AccountLockedError{Until: *user.LockedUntil}
+	}
+
+	// The attempt is counted before the code is checked, so concurrent requests cannot
+	// all slip past the limit.
+	attempts, reserved, err := s.loginSessionRepo.ReserveAttempt(session.ID, s.maxTOTPFailedAttempt)
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		_ = s.loginSessionRepo.MarkConsumed(session.ID, now)
+		return nil, ErrTOTPAttemptsExceeded
+	}
+
 	// Validate TOTP
 	if !s.validateTOTP(*user.TOTPSecret, code) {
-		_ = s.loginSessionRepo.IncrementFailedAttempts(session.ID)
-		return nil, ErrInvalidTOTPCode
+		return nil, s.handleFailedTOTP(session, user, client, attempts, now)
 	}
 
+	// A concurrent request with the same code may have consumed the session first.
 	if err := s.loginSessionRepo.MarkConsumed(session.ID, now); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLoginSessionExpired
+		}
 		return nil, err
 	}
 
+	if user.TOTPFailedAttempts > 0 || user.LockedUntil != nil {
+		if err := s.userRepo.ResetTOTPFailedAttempts(user.ID); err != nil {
+			return nil, err
+		}
+		user.TOTPFailedAttempts = 0
+		user.LockedUntil = nil
+	}
+
 	return user, nil
 }
 
+// handleFailedTOTP records a wrong code against the account; attempts is the session's
+// count already reserved for it. The session is consumed once it runs out of attempts; the
+// account is locked with exponential backoff once failures across sessions reach the
+// lockout threshold.
+func (s *AuthService) handleFailedTOTP(session *models.LoginSession, user *models.User, client ClientInfo, attempts int, now time.Time) error {
+	failures, err := s.userRepo.IncrementTOTPFailedAttempts(user.ID)
+	if err != nil {
+		return err
+	}
+	s.recordSecurityEvent(user.ID, models.SecurityEventTOTPFailed, client,
+		fmt.Sprintf("attempt %d of %d in login session", attempts, s.maxTOTPFailedAttempt))
+
+	if lockFor := s.accountLockDuration(failures); lockFor > 0 {
+		until := now.Add(lockFor)
+		if err := s.userRepo.SetLockedUntil(user.ID, &until); err != nil {
+			return err
+		}
+		_ = s.loginSessionRepo.MarkConsumed(session.ID, now)
+		s.recordSecurityEvent(user.ID, models.SecurityEventAccountLocked, client,
+			fmt.Sprintf("locked for %s after %d consecutive failed totp attempts", lockFor, failures))
+		return &AccountLockedError{Until: until}
+	}
+
+	if attempts >= s.maxTOTPFailedAttempt {
+		_ = s.loginSessionRepo.MarkConsumed(session.ID, now)
+		s.recordSecurityEvent(user.ID, models.SecurityEventLoginSessionLocked, client,
+			fmt.Sprintf("login session locked after %d failed totp attempts", attempts))
+		return ErrTOTPAttemptsExceeded
+	}
+
+	return ErrInvalidTOTPCode
+}
+
+// recordAuthFailure counts err in the auth failure metrics when it rejects the caller.
+// Database and other internal errors are not authentication failures and are ignored.
+func recordAuthFailure(method string, err error) {
+	var reason string
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, ErrInvalidCredentials):
+		reason = "invalid_credentials"
+	case errors.Is(err, ErrInvalidTOTPCode):
+		reason = "invalid_totp_code"
+	case errors.Is(err, ErrTOTPNotEnabled), errors.Is(err, ErrTOTPSecretNotCreated):
+		reason = "totp_not_enabled"
+	case errors.Is(err, ErrLoginSessionExpired), errors.Is(err, ErrWebAuthnSessionExpired):
+		reason = "session_expired"
+	case errors.Is(err, ErrTOTPAttemptsExceeded):
+		reason = "too_many_attempts"
+	case errors.Is(err, ErrAccountLocked):
+		reason = "account_locked"
+	case errors.Is(err, ErrAccountSuspended):
+		reason = "account_suspended"
+	case errors.Is(err, ErrWebAuthnVerificationFailed), errors.Is(err, ErrWebAuthnCredentialNotFound), errors.Is(err, ErrWebAuthnNoCredentials):
+		reason = "invalid_credentials"
+	case errors.Is(err, ErrWebAuthnCloneDetected):
+		reason = "clone_detected"
+	default:
+		return
+	}
+	metrics.AuthFailure(method, reason)
+}
+
+func (s *AuthService) accountLockDuration(failures int) time.Duration {
+	if s.accountLockThreshold <= 0 || failures < s.accountLockThreshold {
+		return 0
+	}
+	lockFor := s.accountLockBase
+	for i := s.accountLockThreshold; i < failures && lockFor < s.accountLockMax; i++ {
+		lockFor *= 2
+	}
+	if lockFor > s.accountLockMax {
+		lockFor = s.accountLockMax
+	}
+	return lockFor
+}
+
+func (s *AuthService) recordSecurityEvent(userID uuid.UUID, eventType models.SecurityEventType, client ClientInfo, details string) {
+	if s.securityEventRepo == nil {
+		return
+	}
+	event := &models.SecurityEvent{
+		UserID:    userID,
+		EventType: eventType,
+		IPAddress: optionalString(client.IPAddress),
+		UserAgent: optionalString(truncate(client.UserAgent, 255)),
+		Details:   optionalString(details),
+	}
+	_ = s.securityEventRepo.Create(event)
+}
+
+// GetSecurityEvents lists the user's recorded security events, newest first.
+func (s *AuthService) GetSecurityEvents(userID uuid.UUID, limit, offset int) ([]models.SecurityEvent, int64, error) {
+	if s.securityEventRepo == nil {
+		return []models.SecurityEvent{}, 0, nil
+	}
+	return s.securityEventRepo.GetByUserID(userID, limit, offset)
+}
+
+// truncate cuts s to at most max bytes without splitting a UTF-8 sequence.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
 func (s *AuthService) SetupTOTP(userID uuid.UUID) (*TOTPSetup, error) {
 	user, err := s.userRepo.GetByID(userID)
 	if err != nil {
@@ -270,7 +477,13 @@ func (s *AuthService) VerifyTOTP(userID uuid.UUID, code string) error {
 	return s.userRepo.Update(user)
 }
 
+// GenerateAccessToken issues an access token for user. Every login method ends here, so
+// suspended accounts are refused with ErrAccountSuspended.
 func (s *AuthService) GenerateAccessToken(user *models.User) (string, error) {
+	if user.IsSuspended() {
+		return "", ErrAccountSuspended
+	}
+
 	accessTTL, err := s.cfg.JWT.GetAccessTokenExpiry()
 	if err != nil {
 		return "", err
@@ -290,8 +503,7 @@ func (s *AuthService) GenerateAccessToken(user *models.User) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.cfg.JWT.Secret))
+	return s.keys.Sign(claims)
 }
 
 func (s *AuthService) GetProfile(userID uuid.UUID) (*models.User, error) {
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// BackgroundTasks tracks work started outside the request that triggered it (malware
+// scans, the file event worker, maintenance loops) so shutdown can wait for it after the
+// HTTP server has drained. A nil *BackgroundTasks runs tasks untracked.
+type BackgroundTasks struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func NewBackgroundTasks() *BackgroundTasks {
+	return &BackgroundTasks{}
+}
+
+// Go runs fn in a new goroutine. Once Wait has been called, fn runs synchronously instead,
+// so late work is neither lost nor left running after Wait returns.
+func (b *BackgroundTasks) Go(fn func()) {
+	if b == nil {
+		go fn()
+		return
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		fn()
+		return
+	}
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	go func() {
+		defer b.wg.Done()
+		fn()
+	}()
+}
+
+// Wait stops accepting new goroutines and waits for running tasks until ctx is done.
+func (b *BackgroundTasks) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
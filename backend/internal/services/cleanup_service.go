@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/metrics"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCleanupRunning is returned when another replica or request is already running cleanup.
+var ErrCleanupRunning = errors.New("a cleanup run is already in progress")
+
+const (
+	defaultCleanupBatchSize   = 100
+	defaultCleanupMaxAttempts = 3
+	defaultCleanupRetryDelay  = 2 * time.Second
+)
+
+// CleanupService deletes expired files (except those under legal hold) in batches once
+// the policy's grace period has passed, and records every run and its per-file results.
+type CleanupService struct {
+	db      *gorm.DB
+	storage storage.Storage
+	runs    repositories.CleanupRunRepository
+	runLock Locker
+	// running refuses a second run in this process: the advisory lock is
+	// re-entrant per session, so it only keeps other replicas out.
+	running sync.Mutex
+
+	batchSize   int
+	maxAttempts int
+	retryDelay  time.Duration
+	instance    string
+}
+
+func NewCleanupService(db *gorm.DB, st storage.Storage, runs repositories.CleanupRunRepository, runLock Locker, cfg config.CleanupConfig) (*CleanupService, error) {
+	retryDelay, err := cfg.GetRetryDelay()
+	if err != nil {
+		return nil, fmt.Errorf("cleanup: invalid retry_delay: %w", err)
+	}
+	if retryDelay <= 0 {
+		retryDelay = defaultCleanupRetryDelay
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCleanupBatchSize
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultCleanupMaxAttempts
+	}
+	instance, _ := os.Hostname()
+
+	return &CleanupService{
+		db:          db,
+		storage:     st,
+		runs:        runs,
+		runLock:     runLock,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		instance:    instance,
+	}, nil
+}
+
+// CleanupRequest describes one cleanup run.
+type CleanupRequest struct {
+	Trigger     models.CleanupTrigger
+	TriggeredBy *uuid.UUID
+	// DryRun lists what would be deleted without touching storage or the database.
+	DryRun bool
+}
+
+// Run performs one cleanup pass and returns its persisted record; per-file outcomes are
+// available through ListRunFiles. Files whose storage object cannot be deleted after
+// maxAttempts are kept and reported as failed, to be retried by the next run.
+func (s *CleanupService) Run(ctx context.Context, req CleanupRequest) (*models.CleanupRun, error) {
+	// Dry runs change nothing, so they may overlap with a real run.
+	if !req.DryRun {
+		if !s.running.TryLock() {
+			return nil, ErrCleanupRunning
+		}
+		defer s.running.Unlock()
+
+		locked, err := s.runLock.TryLock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !locked {
+			return nil, ErrCleanupRunning
+		}
+		defer func() {
+			if err := s.runLock.Unlock(context.Background()); err != nil {
+				slog.Error("releasing cleanup run lock failed", "component", "cleanup", "error", err)
+			}
+		}()
+
+		// Holding the run lock means no other run is in progress anywhere.
+		if n, err := s.runs.FailRunning("interrupted before finishing", time.Now().UTC()); err != nil {
+			slog.ErrorContext(ctx, "closing interrupted cleanup runs failed", "component", "cleanup", "error", err)
+		} else if n > 0 {
+			slog.WarnContext(ctx, "marked interrupted cleanup runs as failed", "component", "cleanup", "count", n)
+		}
+	}
+
+	graceHours, err := s.graceHours(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &models.CleanupRun{
+		Trigger:     req.Trigger,
+		Status:      models.CleanupRunRunning,
+		TriggeredBy: req.TriggeredBy,
+		Instance:    optionalString(s.instance),
+		DryRun:      req.DryRun,
+		GraceHours:  graceHours,
+		StartedAt:   time.Now().UTC(),
+	}
+	if err := s.runs.Create(run); err != nil {
+		return nil, err
+	}
+
+	cutoff := run.StartedAt.Add(-time.Duration(graceHours) * time.Hour)
+	runErr := s.processExpired(ctx, run, cutoff)
+
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+	switch {
+	case runErr != nil:
+		run.Status = models.CleanupRunFailed
+		run.ErrorMessage = optionalString(runErr.Error())
+	case run.FilesFailed > 0:
+		run.Status = models.CleanupRunPartial
+	default:
+		run.Status = models.CleanupRunSucceeded
+	}
+	metrics.ObserveCleanupRun(run)
+	if err := s.runs.Update(run); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "cleanup run finished", "component", "cleanup",
+		"run_id", run.ID, "trigger", run.Trigger, "status", run.Status, "dry_run", run.DryRun,
+		"found", run.FilesFound, "deleted", run.FilesDeleted, "failed", run.FilesFailed, "skipped", run.FilesSkipped,
+		"bytes_reclaimed", run.BytesReclaimed)
+	return run, nil
+}
+
+// processExpired works through files expired before cutoff batch by batch, in
+// (available_to, id) order, saving per-file results and progress after each batch.
+func (s *CleanupService) processExpired(ctx context.Context, run *models.CleanupRun, cutoff time.Time) error {
+	var cursor *models.File
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch, err := s.expiredBatch(ctx, cutoff, cursor)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		cursor = &batch[len(batch)-1]
+		run.Batches++
+		run.FilesFound += len(batch)
+
+		results := make([]models.CleanupRunFile, len(batch))
+		for i := range batch {
+			results[i] = newCleanupRunFile(run.ID, &batch[i])
+		}
+
+		if run.DryRun {
+			for i := range results {
+				results[i].Result = models.CleanupFileWouldDelete
+				run.BytesReclaimed += results[i].FileSize
+			}
+		} else if err := s.deleteBatch(ctx, run, batch, results); err != nil {
+			return err
+		}
+
+		if err := s.runs.AddFiles(results); err != nil {
+			slog.ErrorContext(ctx, "saving cleanup file results failed", "component", "cleanup", "run_id", run.ID, "error", err)
+		}
+		if err := s.runs.Update(run); err != nil {
+			slog.ErrorContext(ctx, "saving cleanup progress failed", "component", "cleanup", "run_id", run.ID, "error", err)
+		}
+	}
+}
+
+// deleteBatch deletes the storage objects, then the rows of the files whose object is gone.
+func (s *CleanupService) deleteBatch(ctx context.Context, run *models.CleanupRun, batch []models.File, results []models.CleanupRunFile) error {
+	objectDeleted := make([]uuid.UUID, 0, len(batch))
+	for i := range batch {
+		attempts, err := s.deleteObject(ctx, &batch[i])
+		results[i].Attempts = attempts
+		if err != nil {
+			results[i].Result = models.CleanupFileFailed
+			results[i].ErrorMessage = optionalString(err.Error())
+			run.FilesFailed++
+			continue
+		}
+		objectDeleted = append(objectDeleted, batch[i].ID)
+	}
+	if len(objectDeleted) == 0 {
+		return nil
+	}
+
+	// Re-check legal_hold: a hold placed while the batch was processed wins.
+	var deletedRows []models.File
+	err := s.db.WithContext(ctx).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("id IN ? AND legal_hold = ?", objectDeleted, false).
+		Delete(&deletedRows).Error
+	if err != nil {
+		return err
+	}
+	rowDeleted := make(map[uuid.UUID]bool, len(deletedRows))
+	for _, row := range deletedRows {
+		rowDeleted[row.ID] = true
+	}
+
+	for i := range results {
+		if results[i].Result == models.CleanupFileFailed {
+			continue
+		}
+		if rowDeleted[results[i].FileID] {
+			results[i].Result = models.CleanupFileDeleted
+			run.FilesDeleted++
+			run.BytesReclaimed += results[i].FileSize
+		} else {
+			results[i].Result = models.CleanupFileSkipped
+			results[i].ErrorMessage = optionalString("legal hold placed during cleanup; storage object already removed")
+			run.FilesSkipped++
+		}
+	}
+	return nil
+}
+
+func newCleanupRunFile(runID uuid.UUID, file *models.File) models.CleanupRunFile {
+	result := models.CleanupRunFile{
+		RunID:       runID,
+		FileID:      file.ID,
+		FileName:    file.FileName,
+		OwnerID:     file.OwnerID,
+		FileSize:    file.FileSize,
+		AvailableTo: file.AvailableTo,
+	}
+	if file.Owner != nil {
+		result.OwnerEmail = optionalString(file.Owner.Email)
+	}
+	return result
+}
+
+func (s *CleanupService) graceHours(ctx context.Context) (int, error) {
+	var policy models.SystemPolicy
+	if err := s.db.WithContext(ctx).First(&policy, 1).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if policy.CleanupGraceHours < 0 {
+		return 0, nil
+	}
+	return policy.CleanupGraceHours, nil
+}
+
+func (s *CleanupService) expiredBatch(ctx context.Context, cutoff time.Time, after *models.File) ([]models.File, error) {
+	var files []models.File
+	query := s.db.WithContext(ctx).Preload("Owner").
+		Where("available_to < ? AND legal_hold = ?", cutoff, false)
+	if after != nil {
+		query = query.Where("(available_to, id) > (?, ?)", after.AvailableTo, after.ID)
+	}
+	err := query.Order("available_to ASC, id ASC").Limit(s.batchSize).Find(&files).Error
+	return files, err
+}
+
+// deleteObject deletes the file's storage object, retrying with exponential backoff, and
+// returns the number of attempts made.
+func (s *CleanupService) deleteObject(ctx context.Context, file *models.File) (int, error) {
+	if s.storage == nil || file.FilePath == "" {
+		return 0, nil
+	}
+	loc := &storage.Location{Container: containerFromFile(file), Path: file.FilePath}
+
+	delay := s.retryDelay
+	var err error
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		if err = s.storage.Delete(ctx, loc); err == nil {
+			return attempt, nil
+		}
+		slog.WarnContext(ctx, "deleting expired object failed", "component", "cleanup",
+			"file_id", file.ID, "attempt", attempt, "max_attempts", s.maxAttempts, "error", err)
+		if attempt == s.maxAttempts {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return s.maxAttempts, err
+}
+
+// ListRuns returns cleanup runs, newest first.
+func (s *CleanupService) ListRuns(limit, offset int) ([]models.CleanupRun, int64, error) {
+	return s.runs.List(limit, offset)
+}
+
+func (s *CleanupService) GetRun(id uuid.UUID) (*models.CleanupRun, error) {
+	return s.runs.GetByID(id)
+}
+
+// ListRunFiles returns a run's per-file results; result may be empty to list all.
+func (s *CleanupService) ListRunFiles(runID uuid.UUID, result models.CleanupFileResult, limit, offset int) ([]models.CleanupRunFile, int64, error) {
+	return s.runs.ListFiles(runID, result, limit, offset)
+}
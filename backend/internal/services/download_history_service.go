@@ -34,18 +34,27 @@ func (s *DownloadHistoryService) Create(history *models.DownloadHistory) error {
 	return s.db.Create(history).Error
 }
 
-// Lấy danh sách ai đã tải file này (Dùng cho API History)
-func (s *DownloadHistoryService) GetByFileID(fileID uuid.UUID, limit, offset int) ([]models.DownloadHistory, int64, error) {
+// Lấy danh sách ai đã tải/xem trước file này (Dùng cho API History).
+// eventType rỗng trả về cả download và preview.
+func (s *DownloadHistoryService) GetByFileID(fileID uuid.UUID, eventType models.FileEventType, limit, offset int) ([]models.DownloadHistory, int64, error) {
 	var history []models.DownloadHistory
 	var total int64
 
+	byFile := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("file_id = ?", fileID)
+		if eventType != "" {
+			db = db.Where("event_type = ?", eventType)
+		}
+		return db
+	}
+
 	// Đếm tổng
-	if err := s.db.Model(&models.DownloadHistory{}).Where("file_id = ?", fileID).Count(&total).Error; err != nil {
+	if err := s.db.Model(&models.DownloadHistory{}).Scopes(byFile).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	// Lấy dữ liệu (Preload Downloader để biết tên người tải)
-	err := s.db.Where("file_id = ?", fileID).
+	err := s.db.Scopes(byFile).
 		Preload("Downloader").
 		Order("downloaded_at DESC").
 		Limit(limit).
@@ -64,12 +73,12 @@ func (s *DownloadHistoryService) GetByDownloaderID(downloaderID uuid.UUID, limit
 	var history []models.DownloadHistory
 	var total int64
 
-	if err := s.db.Model(&models.DownloadHistory{}).Where("downloader_id = ?", downloaderID).Count(&total).Error; err != nil {
+	if err := s.db.Model(&models.DownloadHistory{}).Where("downloader_id = ? AND event_type = ?", downloaderID, models.FileEventDownload).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	// Preload File để hiện tên file đã tải
-	err := s.db.Where("downloader_id = ?", downloaderID).
+	err := s.db.Where("downloader_id = ? AND event_type = ?", downloaderID, models.FileEventDownload).
 		Preload("File").
 		Order("downloaded_at DESC").
 		Limit(limit).
@@ -86,7 +95,7 @@ func (s *DownloadHistoryService) GetByDownloaderID(downloaderID uuid.UUID, limit
 // GetByFileIDAndDownloaderID: Kiểm tra xem User A đã từng tải File B chưa?
 func (s *DownloadHistoryService) GetByFileIDAndDownloaderID(fileID uuid.UUID, downloaderID uuid.UUID) ([]models.DownloadHistory, error) {
 	var history []models.DownloadHistory
-	err := s.db.Where("file_id = ? AND downloader_id = ?", fileID, downloaderID).
+	err := s.db.Where("file_id = ? AND downloader_id = ? AND event_type = ?", fileID, downloaderID, models.FileEventDownload).
 		Find(&history).Error
 	return history, err
 }
@@ -95,7 +104,7 @@ func (s *DownloadHistoryService) GetByFileIDAndDownloaderID(fileID uuid.UUID, do
 func (s *DownloadHistoryService) GetDownloadCount(fileID uuid.UUID) (int64, error) {
 	var count int64
 	err := s.db.Model(&models.DownloadHistory{}).
-		Where("file_id = ? AND download_completed = ?", fileID, true).
+		Where("file_id = ? AND event_type = ? AND download_completed = ?", fileID, models.FileEventDownload, true).
 		Count(&count).Error
 	return count, err
 }
@@ -105,7 +114,7 @@ func (s *DownloadHistoryService) GetUniqueDownloaderCount(fileID uuid.UUID) (int
 	var count int64
 	// Đếm số lượng downloader_id khác nhau (loại bỏ null/anonymous)
 	err := s.db.Model(&models.DownloadHistory{}).
-		Where("file_id = ? AND downloader_id IS NOT NULL", fileID).
+		Where("file_id = ? AND event_type = ? AND downloader_id IS NOT NULL", fileID, models.FileEventDownload).
 		Distinct("downloader_id").
 		Count(&count).Error
 	return count, err
@@ -114,7 +123,7 @@ func (s *DownloadHistoryService) GetUniqueDownloaderCount(fileID uuid.UUID) (int
 // GetDownloadsInRange: Thống kê tải theo ngày/tháng (Cho biểu đồ Admin)
 func (s *DownloadHistoryService) GetDownloadsInRange(fileID uuid.UUID, startTime, endTime time.Time) ([]models.DownloadHistory, error) {
 	var history []models.DownloadHistory
-	err := s.db.Where("file_id = ? AND downloaded_at BETWEEN ? AND ?", fileID, startTime, endTime).
+	err := s.db.Where("file_id = ? AND event_type = ? AND downloaded_at BETWEEN ? AND ?", fileID, models.FileEventDownload, startTime, endTime).
 		Find(&history).Error
 	return history, err
 }
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidAnalyticsQuery is returned for an unknown interval or event type, or a range
+// that is empty or has too many buckets.
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query")
+
+// AnalyticsInterval is the width of the buckets of an analytics time series.
+type AnalyticsInterval string
+
+const (
+	AnalyticsHourly AnalyticsInterval = "hour"
+	AnalyticsDaily  AnalyticsInterval = "day"
+)
+
+const (
+	maxHourlyAnalyticsBuckets = 31 * 24
+	maxDailyAnalyticsBuckets  = 366
+
+	ownerTopFilesLimit     = 10
+	ownerExpiringFileLimit = 10
+	ownerExpiringWindow    = 7 * 24 * time.Hour
+)
+
+// AnalyticsQuery selects the events of one type in [From, To), bucketed by Interval in UTC.
+// Zero values default to downloads over the last 30 days by day (last 24 hours by hour).
+type AnalyticsQuery struct {
+	From      time.Time
+	To        time.Time
+	Interval  AnalyticsInterval
+	EventType models.FileEventType
+}
+
+// AnalyticsTotals counts completed and aborted transfers and the bytes they sent.
+type AnalyticsTotals struct {
+	Completed int64 `json:"completed"`
+	Aborted   int64 `json:"aborted"`
+	BytesSent int64 `json:"bytesSent"`
+}
+
+func (t *AnalyticsTotals) add(o AnalyticsTotals) {
+	t.Completed += o.Completed
+	t.Aborted += o.Aborted
+	t.BytesSent += o.BytesSent
+}
+
+// AnalyticsBucket counts the transfers of one time bucket.
+type AnalyticsBucket struct {
+	Start time.Time `json:"start"`
+	AnalyticsTotals
+}
+
+// AnalyticsCategory counts the transfers of one client or referrer category.
+type AnalyticsCategory struct {
+	Category  string `json:"category"`
+	Completed int64  `json:"completed"`
+	Aborted   int64  `json:"aborted"`
+}
+
+// FileAnalytics is the time series and breakdowns of a file over a range.
+type FileAnalytics struct {
+	From      time.Time           `json:"from"`
+	To        time.Time           `json:"to"`
+	Interval  AnalyticsInterval   `json:"interval"`
+	EventType string              `json:"eventType"`
+	Totals    AnalyticsTotals     `json:"totals"`
+	Series    []AnalyticsBucket   `json:"series"`
+	Clients   []AnalyticsCategory `json:"clients"`
+	Referrers []AnalyticsCategory `json:"referrers"`
+}
+
+// TopFile is one of the most downloaded files of an owner over a range.
+type TopFile struct {
+	FileID   uuid.UUID `json:"fileId"`
+	FileName string    `json:"fileName"`
+	AnalyticsTotals
+	// AllTimeCount is the download (or preview) count of file_statistics
+	AllTimeCount int64 `json:"allTimeCount"`
+}
+
+// StorageUsage describes the files an owner currently has.
+type StorageUsage struct {
+	Files        int64 `json:"files"`
+	Bytes        int64 `json:"bytes"`
+	Active       int64 `json:"active"`
+	Pending      int64 `json:"pending"`
+	Expired      int64 `json:"expired"`
+	ExpiringSoon int64 `json:"expiringSoon"`
+	Downloads    int64 `json:"downloads"`
+	Previews     int64 `json:"previews"`
+}
+
+// ExpiringFile is a file whose validity ends soon.
+type ExpiringFile struct {
+	FileID      uuid.UUID `json:"fileId"`
+	FileName    string    `json:"fileName"`
+	FileSize    int64     `json:"fileSize"`
+	AvailableTo time.Time `json:"availableTo"`
+}
+
+// DownloaderBreakdown splits the completed transfers of a range by whether the client was
+// signed in. Transfers by users deleted since count as anonymous.
+type DownloaderBreakdown struct {
+	Anonymous      int64   `json:"anonymous"`
+	Authenticated  int64   `json:"authenticated"`
+	UniqueUsers    int64   `json:"uniqueUsers"`
+	AnonymousRatio float64 `json:"anonymousRatio"`
+}
+
+// OwnerAnalytics aggregates every file of an owner.
+type OwnerAnalytics struct {
+	From         time.Time           `json:"from"`
+	To           time.Time           `json:"to"`
+	Interval     AnalyticsInterval   `json:"interval"`
+	EventType    string              `json:"eventType"`
+	Totals       AnalyticsTotals     `json:"totals"`
+	Series       []AnalyticsBucket   `json:"series"`
+	TopFiles     []TopFile           `json:"topFiles"`
+	Downloaders  DownloaderBreakdown `json:"downloaders"`
+	Storage      StorageUsage        `json:"storage"`
+	ExpiringSoon []ExpiringFile      `json:"expiringSoon"`
+}
+
+// FileAnalyticsService answers time-series questions from the hourly rollup that the file
+// event worker maintains, so no query reads download_history row by row.
+type FileAnalyticsService struct {
+	db *gorm.DB
+}
+
+func NewFileAnalyticsService(db *gorm.DB) *FileAnalyticsService {
+	return &FileAnalyticsService{db: db}
+}
+
+// normalize applies the defaults relative to now, aligns the range to whole buckets and
+// checks its size.
+func (q *AnalyticsQuery) normalize(now time.Time) error {
+	if q.Interval == "" {
+		q.Interval = AnalyticsDaily
+	}
+	if q.EventType == "" {
+		q.EventType = models.FileEventDownload
+	}
+	if !q.EventType.IsValid() {
+		return fmt.Errorf("%w: unknown event type %q", ErrInvalidAnalyticsQuery, q.EventType)
+	}
+
+	var maxBuckets int
+	switch q.Interval {
+	case AnalyticsHourly:
+		maxBuckets = maxHourlyAnalyticsBuckets
+		if q.To.IsZero() {
+			q.To = now
+		}
+		if q.From.IsZero() {
+			q.From = q.To.Add(-24 * time.Hour)
+		}
+	case AnalyticsDaily:
+		maxBuckets = maxDailyAnalyticsBuckets
+		if q.To.IsZero() {
+			q.To = now
+		}
+		if q.From.IsZero() {
+			q.From = q.To.AddDate(0, 0, -30)
+		}
+	default:
+		return fmt.Errorf("%w: interval must be hour or day", ErrInvalidAnalyticsQuery)
+	}
+
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidAnalyticsQuery)
+	}
+	q.From = q.Interval.truncate(q.From)
+	if to := q.Interval.truncate(q.To); !to.Equal(q.To.UTC()) {
+		q.To = q.Interval.next(to)
+	} else {
+		q.To = to
+	}
+	if n := q.Interval.buckets(q.From, q.To); n > maxBuckets {
+		return fmt.Errorf("%w: %d buckets requested, at most %d by %s", ErrInvalidAnalyticsQuery, n, maxBuckets, q.Interval)
+	}
+	return nil
+}
+
+func (i AnalyticsInterval) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	if i == AnalyticsDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+func (i AnalyticsInterval) next(t time.Time) time.Time {
+	if i == AnalyticsDaily {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
+
+// buckets counts the buckets between aligned from and to. UTC days always last 24 hours.
+func (i AnalyticsInterval) buckets(from, to time.Time) int {
+	width := time.Hour
+	if i == AnalyticsDaily {
+		width = 24 * time.Hour
+	}
+	return int(to.Sub(from) / width)
+}
+
+// GetFileAnalytics returns the time series of the file over the range of q, one bucket per
+// interval including empty ones, with the totals and the client and referrer breakdowns.
+func (s *FileAnalyticsService) GetFileAnalytics(ctx context.Context, fileID uuid.UUID, q AnalyticsQuery) (*FileAnalytics, error) {
+	if err := q.normalize(time.Now()); err != nil {
+		return nil, err
+	}
+	db := s.db.WithContext(ctx)
+	inRange := func(db *gorm.DB) *gorm.DB {
+		return db.Table("file_analytics_hourly").
+			Where("file_id = ? AND event_type = ? AND bucket_start >= ? AND bucket_start < ?", fileID, q.EventType, q.From, q.To)
+	}
+
+	result := &FileAnalytics{
+		From:      q.From,
+		To:        q.To,
+		Interval:  q.Interval,
+		EventType: string(q.EventType),
+	}
+	var err error
+	if result.Series, result.Totals, err = s.series(db.Scopes(inRange), q); err != nil {
+		return nil, err
+	}
+	if result.Clients, err = s.categories(db.Scopes(inRange), "client_category"); err != nil {
+		return nil, err
+	}
+	if result.Referrers, err = s.categories(db.Scopes(inRange), "referrer_category"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetOwnerAnalytics aggregates the files of ownerID: the time series over the range of q
+// summed across files, the most downloaded files, signed-in versus anonymous clients, the
+// storage used and the files expiring within a week. Each part is a single query.
+func (s *FileAnalyticsService) GetOwnerAnalytics(ctx context.Context, ownerID uuid.UUID, q AnalyticsQuery) (*OwnerAnalytics, error) {
+	if err := q.normalize(time.Now()); err != nil {
+		return nil, err
+	}
+	db := s.db.WithContext(ctx)
+	inRange := func(db *gorm.DB) *gorm.DB {
+		return db.Table("file_analytics_hourly h").
+			Joins("JOIN files f ON f.id = h.file_id").
+			Where("f.owner_id = ? AND h.event_type = ? AND h.bucket_start >= ? AND h.bucket_start < ?", ownerID, q.EventType, q.From, q.To)
+	}
+
+	result := &OwnerAnalytics{
+		From:      q.From,
+		To:        q.To,
+		Interval:  q.Interval,
+		EventType: string(q.EventType),
+	}
+	var err error
+	if result.Series, result.Totals, err = s.series(db.Scopes(inRange), q); err != nil {
+		return nil, err
+	}
+
+	allTimeColumn := "s.download_count"
+	if q.EventType == models.FileEventPreview {
+		allTimeColumn = "s.preview_count"
+	}
+	result.TopFiles = []TopFile{}
+	err = db.Scopes(inRange).
+		Joins("LEFT JOIN file_statistics s ON s.file_id = f.id").
+		Select("f.id AS file_id, f.file_name, SUM(h.completed_count) AS completed, SUM(h.aborted_count) AS aborted, " +
+			"SUM(h.bytes_sent)::bigint AS bytes_sent, COALESCE(" + allTimeColumn + ", 0) AS all_time_count").
+		Group("f.id, f.file_name, " + allTimeColumn).
+		Order("completed DESC, bytes_sent DESC, f.id").
+		Limit(ownerTopFilesLimit).
+		Scan(&result.TopFiles).Error
+	if err != nil {
+		return nil, fmt.Errorf("load top files: %w", err)
+	}
+
+	err = db.Table("download_history dh").
+		Joins("JOIN files f ON f.id = dh.file_id").
+		Where("f.owner_id = ? AND dh.event_type = ? AND dh.download_completed IS NOT FALSE AND dh.downloaded_at >= ? AND dh.downloaded_at < ?",
+			ownerID, q.EventType, q.From, q.To).
+		Select("COUNT(*) FILTER (WHERE dh.downloader_id IS NULL) AS anonymous, " +
+			"COUNT(dh.downloader_id) AS authenticated, COUNT(DISTINCT dh.downloader_id) AS unique_users").
+		Scan(&result.Downloaders).Error
+	if err != nil {
+		return nil, fmt.Errorf("load downloader breakdown: %w", err)
+	}
+	if total := result.Downloaders.Anonymous + result.Downloaders.Authenticated; total > 0 {
+		result.Downloaders.AnonymousRatio = float64(result.Downloaders.Anonymous) / float64(total)
+	}
+
+	now := time.Now()
+	soon := now.Add(ownerExpiringWindow)
+	err = db.Table("files f").
+		Joins("LEFT JOIN file_statistics s ON s.file_id = f.id").
+		Where("f.owner_id = ?", ownerID).
+		Select(`COUNT(*) AS files, COALESCE(SUM(f.file_size), 0)::bigint AS bytes,
+			COUNT(*) FILTER (WHERE f.available_from > @now) AS pending,
+			COUNT(*) FILTER (WHERE f.available_to <= @now) AS expired,
+			COUNT(*) FILTER (WHERE f.available_to > @now AND f.available_to <= @soon) AS expiring_soon,
+			COALESCE(SUM(s.download_count), 0)::bigint AS downloads,
+			COALESCE(SUM(s.preview_count), 0)::bigint AS previews`,
+			map[string]interface{}{"now": now, "soon": soon}).
+		Scan(&result.Storage).Error
+	if err != nil {
+		return nil, fmt.Errorf("load storage usage: %w", err)
+	}
+	result.Storage.Active = result.Storage.Files - result.Storage.Pending - result.Storage.Expired
+
+	result.ExpiringSoon = []ExpiringFile{}
+	err = db.Table("files").
+		Select("id AS file_id, file_name, file_size, available_to").
+		Where("owner_id = ? AND available_to > ? AND available_to <= ?", ownerID, now, soon).
+		Order("available_to, id").
+		Limit(ownerExpiringFileLimit).
+		Scan(&result.ExpiringSoon).Error
+	if err != nil {
+		return nil, fmt.Errorf("load expiring files: %w", err)
+	}
+	return result, nil
+}
+
+// series sums the rollup rows of query into one bucket per interval of q, including empty
+// buckets, and returns them with their total.
+func (s *FileAnalyticsService) series(query *gorm.DB, q AnalyticsQuery) ([]AnalyticsBucket, AnalyticsTotals, error) {
+	var rows []AnalyticsBucket
+	err := query.
+		Select("date_trunc(?, bucket_start, 'UTC') AS start, SUM(completed_count) AS completed, SUM(aborted_count) AS aborted, SUM(bytes_sent)::bigint AS bytes_sent", string(q.Interval)).
+		Group("1").
+		Order("1").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, AnalyticsTotals{}, fmt.Errorf("load analytics series: %w", err)
+	}
+
+	byStart := make(map[int64]AnalyticsTotals, len(rows))
+	for _, row := range rows {
+		byStart[row.Start.Unix()] = row.AnalyticsTotals
+	}
+	series := make([]AnalyticsBucket, 0, q.Interval.buckets(q.From, q.To))
+	var totals AnalyticsTotals
+	for t := q.From; t.Before(q.To); t = q.Interval.next(t) {
+		bucket := byStart[t.Unix()]
+		series = append(series, AnalyticsBucket{Start: t, AnalyticsTotals: bucket})
+		totals.add(bucket)
+	}
+	return series, totals, nil
+}
+
+// categories sums the transfers of query by column, most frequent first.
+func (s *FileAnalyticsService) categories(query *gorm.DB, column string) ([]AnalyticsCategory, error) {
+	categories := []AnalyticsCategory{}
+	err := query.
+		Select(column + " AS category, SUM(completed_count) AS completed, SUM(aborted_count) AS aborted").
+		Group(column).
+		Order("SUM(completed_count + aborted_count) DESC, " + column).
+		Scan(&categories).Error
+	if err != nil {
+		return nil, fmt.Errorf("load %s breakdown: %w", column, err)
+	}
+	return categories, nil
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/metrics"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultFileEventBatchSize    = 100
+	defaultFileEventPollInterval = 2 * time.Second
+	defaultFileEventRetryDelay   = 5 * time.Second
+	defaultFileEventMaxRetry     = 30 * time.Minute
+	defaultFileEventMaxAttempts  = 10
+)
+
+// ErrInvalidFileEvent is returned by Record for an event without a file or a known type.
+var ErrInvalidFileEvent = errors.New("invalid file event")
+
+// FileEventService records downloads and previews in the file_events outbox and applies
+// them to download_history and file_statistics from a worker. Recording is a single insert
+// that survives a restart; applying an event and deleting it happen in one transaction,
+// so every event is counted exactly once even with several replicas running the worker.
+type FileEventService struct {
+	db *gorm.DB
+
+	batchSize    int
+	pollInterval time.Duration
+	retryDelay   time.Duration
+	maxRetry     time.Duration
+	maxAttempts  int
+	wake         chan struct{}
+
+	internalHosts []string
+}
+
+func NewFileEventService(db *gorm.DB) *FileEventService {
+	return &FileEventService{
+		db:           db,
+		batchSize:    defaultFileEventBatchSize,
+		pollInterval: defaultFileEventPollInterval,
+		retryDelay:   defaultFileEventRetryDelay,
+		maxRetry:     defaultFileEventMaxRetry,
+		maxAttempts:  defaultFileEventMaxAttempts,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// SetInternalOrigins sets the origins (e.g. the web frontend) whose links are counted
+// as internal referrers, besides the host the request was sent to.
+func (s *FileEventService) SetInternalOrigins(origins []string) {
+	s.internalHosts = s.internalHosts[:0]
+	for _, origin := range origins {
+		if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			s.internalHosts = append(s.internalHosts, u.Host)
+		}
+	}
+}
+
+// ClassifyReferrer categorises the Referer header of a request sent to requestHost.
+func (s *FileEventService) ClassifyReferrer(referrer, requestHost string) models.ReferrerCategory {
+	return ClassifyReferrer(referrer, append([]string{requestHost}, s.internalHosts...)...)
+}
+
+// Record adds event to the outbox and wakes the worker of this process.
+func (s *FileEventService) Record(ctx context.Context, event *models.FileEvent) error {
+	if event.FileID == uuid.Nil || !event.EventType.IsValid() {
+		return ErrInvalidFileEvent
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	if event.NextAttemptAt.IsZero() {
+		event.NextAttemptAt = event.OccurredAt
+	}
+	if event.ClientCategory == "" {
+		event.ClientCategory = models.ClientUnknown
+	}
+	if event.ReferrerCategory == "" {
+		event.ReferrerCategory = models.ReferrerUnknown
+	}
+	if err := s.db.WithContext(ctx).Create(event).Error; err != nil {
+		return fmt.Errorf("record %s event: %w", event.EventType, err)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run applies pending events until ctx is cancelled, polling so events recorded by other
+// replicas or left over from a restart are picked up too. A batch in progress is finished
+// rather than cancelled.
+func (s *FileEventService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			processed, err := s.ProcessPending(context.WithoutCancel(ctx), time.Now())
+			if err != nil {
+				slog.Error("processing file events failed", "component", "file_events", "error", err)
+				break
+			}
+			if processed < s.batchSize || ctx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// ProcessPending applies up to one batch of events that are due at now and returns how
+// many it took. Rows locked by another replica are skipped. An event that fails is rolled
+// back on its own and retried later with exponential backoff; after maxAttempts it is
+// kept in the outbox with its last error for inspection.
+func (s *FileEventService) ProcessPending(ctx context.Context, now time.Time) (int, error) {
+	var processed int
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []models.FileEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_attempt_at <= ? AND attempts < ?", now, s.maxAttempts).
+			Order("id").
+			Limit(s.batchSize).
+			Find(&events).Error
+		if err != nil {
+			return err
+		}
+		processed = len(events)
+
+		for i := range events {
+			event := &events[i]
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				if err := applyFileEvent(tx, event); err != nil {
+					return err
+				}
+				return tx.Delete(&models.FileEvent{}, event.ID).Error
+			})
+			if err == nil {
+				metrics.FileEventProcessed(string(event.EventType), "applied")
+				continue
+			}
+			if err := s.reschedule(tx, event, err, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return processed, err
+}
+
+// reschedule records a failed attempt at applying event.
+func (s *FileEventService) reschedule(tx *gorm.DB, event *models.FileEvent, cause error, now time.Time) error {
+	attempts := event.Attempts + 1
+	delay := s.retryDelay << (attempts - 1)
+	if delay <= 0 || delay > s.maxRetry {
+		delay = s.maxRetry
+	}
+	message := cause.Error()
+	logAttrs := []any{"component", "file_events", "event_id", event.ID, "file_id", event.FileID, "type", event.EventType, "attempts", attempts, "error", cause}
+	if attempts >= s.maxAttempts {
+		metrics.FileEventProcessed(string(event.EventType), "failed")
+		slog.Error("giving up on file event", logAttrs...)
+	} else {
+		metrics.FileEventProcessed(string(event.EventType), "retried")
+		slog.Warn("applying file event failed, will retry", append(logAttrs, "retry_in", delay)...)
+	}
+	return tx.Model(&models.FileEvent{}).Where("id = ?", event.ID).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"last_error":      message,
+		"next_attempt_at": now.Add(delay),
+	}).Error
+}
+
+// applyFileEvent adds event to the file's history and hourly analytics and, when the
+// transfer completed, to its statistics. A downloader who has since been deleted is
+// recorded as anonymous.
+func applyFileEvent(tx *gorm.DB, event *models.FileEvent) error {
+	err := tx.Exec(`INSERT INTO download_history (id, file_id, downloader_id, downloaded_at, download_completed, event_type, bytes_sent, client_category, referrer_category)
+		VALUES (?, ?, (SELECT id FROM users WHERE id = ?), ?, ?, ?, ?, ?, ?)`,
+		uuid.New(), event.FileID, event.UserID, event.OccurredAt, event.Completed, string(event.EventType),
+		event.BytesSent, string(event.ClientCategory), string(event.ReferrerCategory)).Error
+	if err != nil {
+		return fmt.Errorf("insert history: %w", err)
+	}
+
+	completed, aborted := 1, 0
+	if !event.Completed {
+		completed, aborted = 0, 1
+	}
+	err = tx.Exec(`INSERT INTO file_analytics_hourly (file_id, event_type, bucket_start, client_category, referrer_category, completed_count, aborted_count, bytes_sent)
+		VALUES (?, ?, date_trunc('hour', ?::timestamptz, 'UTC'), ?, ?, ?, ?, ?)
+		ON CONFLICT (file_id, event_type, bucket_start, client_category, referrer_category) DO UPDATE SET
+			completed_count = file_analytics_hourly.completed_count + EXCLUDED.completed_count,
+			aborted_count = file_analytics_hourly.aborted_count + EXCLUDED.aborted_count,
+			bytes_sent = file_analytics_hourly.bytes_sent + EXCLUDED.bytes_sent`,
+		event.FileID, string(event.EventType), event.OccurredAt, string(event.ClientCategory), string(event.ReferrerCategory),
+		completed, aborted, event.BytesSent).Error
+	if err != nil {
+		return fmt.Errorf("update hourly analytics: %w", err)
+	}
+	if !event.Completed {
+		return nil
+	}
+
+	if event.EventType == models.FileEventPreview {
+		return tx.Exec(`INSERT INTO file_statistics (id, file_id, preview_count, last_previewed_at, created_at, updated_at)
+			VALUES (?, ?, 1, ?, NOW(), NOW())
+			ON CONFLICT (file_id) DO UPDATE SET
+				preview_count = file_statistics.preview_count + 1,
+				last_previewed_at = GREATEST(file_statistics.last_previewed_at, EXCLUDED.last_previewed_at),
+				updated_at = NOW()`,
+			uuid.New(), event.FileID, event.OccurredAt).Error
+	}
+
+	// The primary key of file_unique_downloaders decides which download is a user's first,
+	// however many of them are applied at the same time
+	newDownloader := 0
+	if event.UserID != nil {
+		insert := tx.Exec(`INSERT INTO file_unique_downloaders (file_id, user_id, first_downloaded_at)
+			SELECT ?, id, ? FROM users WHERE id = ?
+			ON CONFLICT DO NOTHING`,
+			event.FileID, event.OccurredAt, *event.UserID)
+		if insert.Error != nil {
+			return fmt.Errorf("insert unique downloader: %w", insert.Error)
+		}
+		newDownloader = int(insert.RowsAffected)
+	}
+	return tx.Exec(`INSERT INTO file_statistics (id, file_id, download_count, unique_downloaders, last_downloaded_at, created_at, updated_at)
+		VALUES (?, ?, 1, ?, ?, NOW(), NOW())
+		ON CONFLICT (file_id) DO UPDATE SET
+			download_count = file_statistics.download_count + 1,
+			unique_downloaders = file_statistics.unique_downloaders + EXCLUDED.unique_downloaders,
+			last_downloaded_at = GREATEST(file_statistics.last_downloaded_at, EXCLUDED.last_downloaded_at),
+			updated_at = NOW()`,
+		uuid.New(), event.FileID, newDownloader, event.OccurredAt).Error
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdminFileFilter narrows ListFilesForAdmin. Zero values match everything.
+type AdminFileFilter struct {
+	OwnerID *uuid.UUID
+	// MimeType matches exactly, or by prefix when it ends in "/" (e.g. "image/").
+	MimeType    string
+	MinSize     int64
+	MaxSize     int64
+	Status      string // "active", "pending" or "expired"
+	IsPublic    *bool
+	LegalHold   *bool
+	ScanStatus  string // "pending", "clean", "infected", "error" or "unscanned"
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Query       string // file name substring
+}
+
+// ListFilesForAdmin returns every file matching the filter, newest first, regardless of owner.
+func (s *FileService) ListFilesForAdmin(filter AdminFileFilter, limit, offset int) ([]models.File, int64, error) {
+	var files []models.File
+	var total int64
+
+	query := applyAdminFileFilter(s.db.Model(&models.File{}), filter, time.Now().UTC())
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Preload("Owner").
+		Preload("Statistics").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&files).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return files, total, nil
+}
+
+func applyAdminFileFilter(query *gorm.DB, filter AdminFileFilter, now time.Time) *gorm.DB {
+	if filter.OwnerID != nil {
+		query = query.Where("owner_id = ?", *filter.OwnerID)
+	}
+	if filter.MimeType != "" {
+		if strings.HasSuffix(filter.MimeType, "/") {
+			query = query.Where("mime_type LIKE ?", filter.MimeType+"%")
+		} else {
+			query = query.Where("mime_type = ?", filter.MimeType)
+		}
+	}
+	if filter.MinSize > 0 {
+		query = query.Where("file_size >= ?", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		query = query.Where("file_size <= ?", filter.MaxSize)
+	}
+	switch filter.Status {
+	case "pending":
+		query = query.Where("available_from IS NOT NULL AND available_from > ?", now)
+	case "expired":
+		query = query.Where("available_to IS NOT NULL AND available_to < ?", now)
+	case "active":
+		query = query.Where("(available_from IS NULL OR available_from <= ?) AND (available_to IS NULL OR available_to >= ?)", now, now)
+	}
+	if filter.IsPublic != nil {
+		query = query.Where("is_public = ?", *filter.IsPublic)
+	}
+	if filter.LegalHold != nil {
+		query = query.Where("legal_hold = ?", *filter.LegalHold)
+	}
+	switch filter.ScanStatus {
+	case "":
+	case "unscanned":
+		query = query.Where("scan_status IS NULL")
+	default:
+		query = query.Where("scan_status = ?", filter.ScanStatus)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at <= ?", *filter.CreatedTo)
+	}
+	if filter.Query != "" {
+		query = query.Where("file_name ILIKE ?", "%"+filter.Query+"%")
+	}
+	return query
+}
+
+// ForceExpire ends a file's availability now. The file is kept until the cleanup job
+// removes it, unless it is under legal hold.
+func (s *FileService) ForceExpire(id uuid.UUID) (*models.File, error) {
+	now := time.Now().UTC()
+	return s.updateModeration(id, map[string]interface{}{"available_to": now})
+}
+
+// SetShareDisabled disables or re-enables a file's share link without touching the file.
+func (s *FileService) SetShareDisabled(id uuid.UUID, disabled bool) (*models.File, error) {
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now().UTC()
+		disabledAt = &now
+	}
+	return s.updateModeration(id, map[string]interface{}{"share_disabled_at": disabledAt})
+}
+
+// SetLegalHold places or releases a legal hold. Held files cannot be deleted by their
+// owner, by admins or by the cleanup job until the hold is released.
+func (s *FileService) SetLegalHold(id uuid.UUID, hold bool, reason string) (*models.File, error) {
+	updates := map[string]interface{}{
+		"legal_hold":        hold,
+		"legal_hold_reason": nil,
+		"legal_hold_at":     nil,
+	}
+	if hold {
+		updates["legal_hold_reason"] = optionalString(reason)
+		updates["legal_hold_at"] = time.Now().UTC()
+	}
+	return s.updateModeration(id, updates)
+}
+
+func (s *FileService) updateModeration(id uuid.UUID, updates map[string]interface{}) (*models.File, error) {
+	var file models.File
+	if err := s.db.First(&file, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&file).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// SetTakenDown blocks (or unblocks) a file's share link for legal reasons. Unlike a
+// disabled share link, a takedown is shown to visitors as 451 Unavailable For Legal Reasons.
+func (s *FileService) SetTakenDown(id uuid.UUID, takenDown bool, reason string) (*models.File, error) {
+	updates := map[string]interface{}{
+		"taken_down_at":   nil,
+		"takedown_reason": nil,
+	}
+	if takenDown {
+		updates["taken_down_at"] = time.Now().UTC()
+		updates["takedown_reason"] = optionalString(reason)
+	}
+	return s.updateModeration(id, updates)
+}
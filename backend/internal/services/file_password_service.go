@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/tracing"
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIncorrectFilePassword = errors.New("incorrect file password")
+	ErrFilePasswordLocked    = errors.New("too many incorrect file password attempts")
+	ErrInvalidDownloadGrant  = errors.New("invalid or expired download grant")
+)
+
+// DownloadGrantAudience marks download grants so they can never pass as access tokens.
+const DownloadGrantAudience = "file-download"
+
+// FilePasswordLockedError is returned while a client must wait before trying another
+// password for a file. It matches ErrFilePasswordLocked with errors.Is.
+type FilePasswordLockedError struct {
+	Until time.Time
+}
+
+func (e *FilePasswordLockedError) Error() string {
+	return fmt.Sprintf("file password attempts locked until %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *FilePasswordLockedError) Unwrap() error {
+	return ErrFilePasswordLocked
+}
+
+// DownloadGrantClaims let a client that entered the right password download or preview the
+// file again without resending it. The fingerprint ties the grant to the current password,
+// so changing or removing the password invalidates outstanding grants.
+type DownloadGrantClaims struct {
+	PasswordFingerprint string `json:"pwd"`
+	jwt.RegisteredClaims
+}
+
+// FilePasswordService checks file passwords with brute-force protection. Wrong passwords
+// are counted per file and client: after a few failures each attempt must wait a doubling
+// delay, after more the client is locked out for a doubling period, and the owner is told
+// when a file keeps receiving wrong passwords. Guesses spread over many clients are caught
+// by a per-file count that locks the file for everyone once it passes fileLockThreshold.
+type FilePasswordService struct {
+	repo     repositories.FilePasswordAttemptRepository
+	keys     *JWTKeyManager
+	notifier Notifier
+
+	delayAfter      int           // failures before delays start
+	delayBase       time.Duration // first delay, doubled per further failure
+	lockThreshold   int           // failures before lockouts start
+	lockBase        time.Duration // first lockout, doubled per further failure
+	lockMax         time.Duration
+	attemptWindow   time.Duration // failures older than this are forgotten
+	notifyThreshold int           // the owner is notified every this many failures on a file
+	grantTTL        time.Duration
+
+	fileLockThreshold int           // failures on a file from all clients before it is locked
+	fileLockDuration  time.Duration // lock applied on each failure past the threshold
+	fileAttemptWindow time.Duration // the file-wide count starts over after this long without failures
+}
+
+func NewFilePasswordService(repo repositories.FilePasswordAttemptRepository, keys *JWTKeyManager) *FilePasswordService {
+	return &FilePasswordService{
+		repo:            repo,
+		keys:            keys,
+		notifier:        logNotifier{},
+		delayAfter:      3,
+		delayBase:       2 * time.Second,
+		lockThreshold:   10,
+		lockBase:        15 * time.Minute,
+		lockMax:         24 * time.Hour,
+		attemptWindow:   24 * time.Hour,
+		notifyThreshold: 20,
+		grantTTL:        10 * time.Minute,
+
+		fileLockThreshold: 50,
+		fileLockDuration:  15 * time.Minute,
+		fileAttemptWindow: time.Hour,
+	}
+}
+
+// FilePasswordClientKey returns the key under which an anonymous client at ip is counted.
+// IPv6 clients are grouped by /64, the smallest prefix usually routed to one subscriber, so
+// rotating addresses within it does not reset the count.
+func FilePasswordClientKey(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "ip:" + parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+	}
+	return "ip:" + ip
+}
+
+// SetNotifier sets how owners are warned about repeated wrong passwords (default: log only).
+func (s *FilePasswordService) SetNotifier(n Notifier) {
+	if n != nil {
+		s.notifier = n
+	}
+}
+
+// GrantTTL is how long download grants stay valid.
+func (s *FilePasswordService) GrantTTL() time.Duration {
+	return s.grantTTL
+}
+
+// Verify checks password for file on behalf of clientKey ("user:<id>" or the result of
+// FilePasswordClientKey). While the client is delayed or locked out, or the file is locked
+// for everyone, the password is not even compared and a *FilePasswordLockedError is returned.
+func (s *FilePasswordService) Verify(ctx context.Context, file *models.File, clientKey, password string, now time.Time) error {
+	if !file.HasPassword() {
+		return nil
+	}
+
+	fileAttempt, err := s.repo.Get(file.ID, models.FilePasswordAnyClient)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if fileAttempt.IsLocked(now) {
+		return &FilePasswordLockedError{Until: *fileAttempt.LockedUntil}
+	}
+	attempt, err := s.repo.Get(file.ID, clientKey)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if attempt.IsLocked(now) {
+		return &FilePasswordLockedError{Until: *attempt.LockedUntil}
+	}
+
+	if s.comparePassword(ctx, file, password) {
+		if attempt != nil {
+			if err := s.repo.Reset(file.ID, clientKey); err != nil {
+				slog.WarnContext(ctx, "failed to reset file password attempts", "component", "files", "file_id", file.ID, "error", err)
+			}
+		}
+		return nil
+	}
+
+	return s.handleFailure(ctx, file, clientKey, now)
+}
+
+// comparePassword runs the bcrypt check in its own span: at the default cost it is one of
+// the slowest steps of a protected download.
+func (s *FilePasswordService) comparePassword(ctx context.Context, file *models.File, password string) bool {
+	_, span := tracing.Tracer().Start(ctx, "bcrypt.compare", trace.WithAttributes(attribute.String("file.id", file.ID.String())))
+	defer span.End()
+	return bcrypt.CompareHashAndPassword([]byte(*file.PasswordHash), []byte(password)) == nil
+}
+
+func (s *FilePasswordService) handleFailure(ctx context.Context, file *models.File, clientKey string, now time.Time) error {
+	attempt, err := s.repo.RecordFailure(file.ID, clientKey, now, now.Add(-s.attemptWindow))
+	if err != nil {
+		return err
+	}
+	if waitFor := s.waitDuration(attempt.FailedAttempts); waitFor > 0 {
+		if err := s.repo.SetLockedUntil(file.ID, clientKey, now.Add(waitFor)); err != nil {
+			return err
+		}
+		if attempt.FailedAttempts >= s.lockThreshold {
+			slog.WarnContext(ctx, "file password attempts locked", "component", "files",
+				"file_id", file.ID, "client", clientKey, "failures", attempt.FailedAttempts, "locked_for", waitFor.String())
+		}
+	}
+
+	total, err := s.recordFileFailure(ctx, file, now)
+	if err != nil {
+		return err
+	}
+	// Each failure gets its own count from the upsert, so exactly one of any number of
+	// concurrent requests reaches a multiple of the threshold.
+	if s.notifyThreshold > 0 && total%s.notifyThreshold == 0 {
+		s.notifyOwner(ctx, file, total)
+	}
+	return ErrIncorrectFilePassword
+}
+
+// recordFileFailure counts a wrong password towards the file-wide count and returns it,
+// locking the file for everyone while the count is past fileLockThreshold. A right password
+// does not reset this count, so one legitimate client cannot clear the way for a
+// distributed guesser.
+func (s *FilePasswordService) recordFileFailure(ctx context.Context, file *models.File, now time.Time) (int, error) {
+	attempt, err := s.repo.RecordFailure(file.ID, models.FilePasswordAnyClient, now, now.Add(-s.fileAttemptWindow))
+	if err != nil {
+		return 0, err
+	}
+	if s.fileLockThreshold <= 0 || attempt.FailedAttempts < s.fileLockThreshold {
+		return attempt.FailedAttempts, nil
+	}
+	if attempt.FailedAttempts == s.fileLockThreshold {
+		slog.WarnContext(ctx, "file password attempts locked for all clients", "component", "files",
+			"file_id", file.ID, "failures", attempt.FailedAttempts, "locked_for", s.fileLockDuration.String())
+	}
+	return attempt.FailedAttempts, s.repo.SetLockedUntil(file.ID, models.FilePasswordAnyClient, now.Add(s.fileLockDuration))
+}
+
+// waitDuration is how long a client must wait after its n-th consecutive failure:
+// nothing at first, then delayBase doubling, then lockBase doubling up to lockMax.
+func (s *FilePasswordService) waitDuration(failures int) time.Duration {
+	var wait time.Duration
+	switch {
+	case s.lockThreshold > 0 && failures >= s.lockThreshold:
+		wait = s.lockBase
+		for i := s.lockThreshold; i < failures && wait < s.lockMax; i++ {
+			wait *= 2
+		}
+		if wait > s.lockMax {
+			wait = s.lockMax
+		}
+	case s.delayAfter > 0 && failures >= s.delayAfter:
+		wait = s.delayBase
+		for i := s.delayAfter; i < failures; i++ {
+			wait *= 2
+		}
+	}
+	return wait
+}
+
+// notifyOwner is best effort: a failed email must not change the response to the client.
+func (s *FilePasswordService) notifyOwner(ctx context.Context, file *models.File, failures int) {
+	if file.Owner == nil || file.Owner.Email == "" {
+		return
+	}
+	subject := fmt.Sprintf("Repeated wrong passwords for your file %q", file.FileName)
+	body := fmt.Sprintf("Your shared file %q received %d wrong password attempts, with no break longer than %s. "+
+		"Clients that keep guessing are locked out temporarily. If you did not expect this, "+
+		"consider changing the password or disabling the share link.", file.FileName, failures, s.fileAttemptWindow)
+	if err := s.notifier.Notify(ctx, file.Owner.Email, subject, body); err != nil {
+		slog.ErrorContext(ctx, "notifying file owner failed", "component", "files", "file_id", file.ID, "error", err)
+	}
+}
+
+// IssueGrant signs a short-lived grant to download or preview file without its password.
+func (s *FilePasswordService) IssueGrant(file *models.File, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(s.grantTTL)
+	claims := DownloadGrantClaims{
+		PasswordFingerprint: passwordFingerprint(file),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "file:" + file.ID.String(),
+			Audience:  jwt.ClaimStrings{DownloadGrantAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// VerifyGrant checks that grant was issued for file and its current password.
+func (s *FilePasswordService) VerifyGrant(file *models.File, grant string) error {
+	claims := &DownloadGrantClaims{}
+	token, err := s.keys.Parse(grant, claims)
+	if err != nil || !token.Valid {
+		return ErrInvalidDownloadGrant
+	}
+	if claims.Subject != "file:"+file.ID.String() || claims.PasswordFingerprint != passwordFingerprint(file) {
+		return ErrInvalidDownloadGrant
+	}
+	audienceOK := false
+	for _, aud := range claims.Audience {
+		if aud == DownloadGrantAudience {
+			audienceOK = true
+		}
+	}
+	if !audienceOK {
+		return ErrInvalidDownloadGrant
+	}
+	return nil
+}
+
+func passwordFingerprint(file *models.File) string {
+	if !file.HasPassword() {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(*file.PasswordHash))
+	return hex.EncodeToString(sum[:8])
+}
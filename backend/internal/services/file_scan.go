@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/scanner"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrScannerDisabled is returned when a scan is requested but no scanner is configured.
+	ErrScannerDisabled = errors.New("malware scanning is not enabled")
+	// ErrFileInfected is returned for downloads of files in which malware was found.
+	ErrFileInfected = errors.New("file is infected")
+	// ErrFileNotScanned is returned for downloads of files without a clean verdict yet
+	// (scan pending or failed) while the policy requires one.
+	ErrFileNotScanned = errors.New("file has not passed the malware scan")
+)
+
+// quarantinePrefix is prepended to the object name of quarantined files. Quarantined
+// objects always live in the private container so no public URL can reach them.
+const quarantinePrefix = "quarantine-"
+
+// A scan that fails (scanner or storage unreachable) is retried by ScanPending after
+// scanRetryBaseDelay, doubling up to scanRetryMaxDelay, until maxScanAttempts failures.
+const (
+	scanRetryBaseDelay = time.Minute
+	scanRetryMaxDelay  = time.Hour
+	maxScanAttempts    = 10
+)
+
+// SetScanner enables malware scanning: new uploads start as pending and are scanned in
+// the background.
+func (s *FileService) SetScanner(sc scanner.Scanner) {
+	s.scanner = sc
+}
+
+// ScanningEnabled reports whether a scanner is configured.
+func (s *FileService) ScanningEnabled() bool {
+	return s.scanner != nil
+}
+
+// CheckScanStatus reports whether a file may be downloaded under the given scan download
+// policy. Files without a status were uploaded while scanning was disabled and are allowed.
+func CheckScanStatus(file *models.File, scanPolicy string) error {
+	if file == nil || file.ScanStatus == nil {
+		return nil
+	}
+	switch *file.ScanStatus {
+	case models.ScanStatusClean:
+		return nil
+	case models.ScanStatusInfected:
+		return ErrFileInfected
+	default:
+		if scanPolicy == models.ScanPolicyBlockInfected {
+			return nil
+		}
+		return ErrFileNotScanned
+	}
+}
+
+// CheckDownloadAllowed applies CheckScanStatus with the current system policy.
+func (s *FileService) CheckDownloadAllowed(ctx context.Context, file *models.File) error {
+	if file == nil || file.ScanStatus == nil || *file.ScanStatus == models.ScanStatusClean {
+		return nil
+	}
+	policy, err := s.GetSystemPolicy(ctx, nil) // the scan policy has no per-audience overrides
+	if err != nil {
+		return err
+	}
+	return CheckScanStatus(file, policy.ScanDownloadPolicy)
+}
+
+// ScanFile scans the stored object and records the verdict. Infected objects are moved to
+// quarantine; a quarantined file that now scans clean (e.g. after a signature fix) is
+// moved back. A failed scan is recorded as status "error" rather than returned, and
+// scheduled for a retry by ScanPending.
+func (s *FileService) ScanFile(ctx context.Context, id uuid.UUID) (*models.File, error) {
+	if s.scanner == nil {
+		return nil, ErrScannerDisabled
+	}
+	if s.storage == nil {
+		return nil, errors.New("file service: storage backend is not configured")
+	}
+
+	var file models.File
+	if err := s.db.WithContext(ctx).First(&file, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	result, scanErr := s.scanObject(ctx, &file)
+	now := time.Now().UTC()
+	updates := map[string]interface{}{"scanned_at": now, "scan_signature": nil, "scan_attempts": 0, "next_scan_at": nil}
+
+	switch {
+	case scanErr != nil:
+		slog.ErrorContext(ctx, "scanning file failed", "component", "scan", "file_id", file.ID, "error", scanErr)
+		scheduleScanRetry(updates, &file, now)
+	case result.Infected:
+		updates["scan_status"] = models.ScanStatusInfected
+		updates["scan_signature"] = result.Signature
+		if file.QuarantinedAt == nil {
+			newPath, err := s.moveObject(ctx, &file, storage.ContainerPrivate, quarantinePrefix+path.Base(file.FilePath))
+			if err != nil {
+				// Downloads are refused on the infected status alone, so keep the verdict.
+				slog.ErrorContext(ctx, "quarantining file failed", "component", "scan", "file_id", file.ID, "error", err)
+			} else {
+				updates["file_path"] = newPath
+				updates["quarantined_at"] = now
+			}
+		}
+	default:
+		updates["scan_status"] = models.ScanStatusClean
+		if file.QuarantinedAt != nil {
+			name := strings.TrimPrefix(path.Base(file.FilePath), quarantinePrefix)
+			newPath, err := s.moveObject(ctx, &file, visibilityContainer(&file), name)
+			if err != nil {
+				slog.ErrorContext(ctx, "releasing file from quarantine failed", "component", "scan", "file_id", file.ID, "error", err)
+				scheduleScanRetry(updates, &file, now)
+			} else {
+				updates["file_path"] = newPath
+				updates["quarantined_at"] = nil
+			}
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.File{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// scheduleScanRetry records a failed scan of file in updates, with the time of the next
+// attempt unless the file has failed maxScanAttempts times.
+func scheduleScanRetry(updates map[string]interface{}, file *models.File, now time.Time) {
+	attempts := file.ScanAttempts + 1
+	updates["scan_status"] = models.ScanStatusError
+	updates["scan_attempts"] = attempts
+	if attempts >= maxScanAttempts {
+		slog.Error("giving up on scanning file", "component", "scan", "file_id", file.ID, "attempts", attempts)
+		return
+	}
+	delay := scanRetryBaseDelay << (attempts - 1)
+	if delay <= 0 || delay > scanRetryMaxDelay {
+		delay = scanRetryMaxDelay
+	}
+	updates["next_scan_at"] = now.Add(delay)
+}
+
+// ScanPending scans files still pending after olderThan, e.g. uploads whose background
+// scan was lost to a restart, and failed scans whose retry is due, e.g. because clamd was
+// down. It returns the number of files scanned.
+func (s *FileService) ScanPending(ctx context.Context, olderThan time.Duration, limit int) (int, error) {
+	if s.scanner == nil {
+		return 0, ErrScannerDisabled
+	}
+
+	var ids []uuid.UUID
+	err := s.db.WithContext(ctx).Model(&models.File{}).
+		Where("(scan_status = ? AND created_at < ?) OR (scan_status = ? AND next_scan_at <= ?)",
+			models.ScanStatusPending, time.Now().Add(-olderThan), models.ScanStatusError, time.Now()).
+		Order("COALESCE(next_scan_at, created_at) ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	scanned := 0
+	for _, id := range ids {
+		if _, err := s.ScanFile(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "pending scan failed", "component", "scan", "file_id", id, "error", err)
+			continue
+		}
+		scanned++
+	}
+	return scanned, nil
+}
+
+// scanInBackground is started after an upload; the periodic ScanPending sweep picks the
+// file up again if this never finishes.
+func (s *FileService) scanInBackground(id uuid.UUID) {
+	if _, err := s.ScanFile(context.Background(), id); err != nil {
+		slog.Error("background scan failed", "component", "scan", "file_id", id, "error", err)
+	}
+}
+
+func (s *FileService) scanObject(ctx context.Context, file *models.File) (*scanner.Result, error) {
+	obj, err := s.storage.Download(ctx, &storage.Location{Container: containerFromFile(file), Path: file.FilePath})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Reader.Close()
+	return s.scanner.Scan(ctx, obj.Reader)
+}
+
+// moveObject copies the file's object to container/name and deletes the original,
+// returning the new storage path.
+func (s *FileService) moveObject(ctx context.Context, file *models.File, container storage.ContainerType, name string) (string, error) {
+	src := &storage.Location{Container: containerFromFile(file), Path: file.FilePath}
+	obj, err := s.storage.Download(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Reader.Close()
+
+	contentType := obj.ContentType
+	if contentType == "" && file.MimeType != nil {
+		contentType = *file.MimeType
+	}
+	loc, err := s.storage.Upload(ctx, &storage.Object{
+		Name:        name,
+		Container:   container,
+		ContentType: contentType,
+		Size:        file.FileSize,
+		Reader:      obj.Reader,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.storage.Delete(ctx, src); err != nil {
+		slog.WarnContext(ctx, "deleting original object failed", "component", "scan", "file_id", file.ID, "error", err)
+	}
+	return loc.Path, nil
+}
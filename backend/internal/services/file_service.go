@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/scanner"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -18,9 +20,25 @@ import (
 
 var _ repositories.FileRepository = (*FileService)(nil)
 
+var (
+	// ErrShareDisabled is returned for share links that exist but may not be used,
+	// e.g. because the owner's account is suspended or a moderator disabled the link.
+	ErrShareDisabled = errors.New("share link disabled")
+	// ErrLegalHold is returned when deleting a file that is under legal hold.
+	ErrLegalHold = errors.New("file is under legal hold")
+	// ErrFileTakenDown is returned for share links of files taken down after an abuse report.
+	ErrFileTakenDown = errors.New("file has been taken down")
+)
+
 type FileService struct {
 	db      *gorm.DB
 	storage storage.Storage
+	// allowedMimeTypes is the deployment-wide allowlist from storage.allowed_mime_types.
+	allowedMimeTypes []string
+	// scanner is optional; without it uploads are served without a scan verdict.
+	scanner scanner.Scanner
+	// tasks tracks background scans so shutdown can wait for them.
+	tasks *BackgroundTasks
 }
 
 func NewFileService(db *gorm.DB, st storage.Storage) *FileService {
@@ -30,19 +48,46 @@ func NewFileService(db *gorm.DB, st storage.Storage) *FileService {
 	}
 }
 
-func (s *FileService) GetSystemPolicy(ctx context.Context) (*models.SystemPolicy, error) {
+// WithContext returns a copy of the service whose database calls run with ctx, so lookups
+// made while serving a request are traced as part of it and cancelled with it.
+func (s *FileService) WithContext(ctx context.Context) *FileService {
+	copied := *s
+	copied.db = s.db.WithContext(ctx)
+	return &copied
+}
+
+// SetAllowedMimeTypes restricts uploads to these types on top of the policy allowlist.
+// An empty list or "*" allows everything.
+func (s *FileService) SetAllowedMimeTypes(types []string) {
+	s.allowedMimeTypes = types
+}
+
+// SetBackgroundTasks makes background scans part of tasks, which shutdown waits for.
+func (s *FileService) SetBackgroundTasks(tasks *BackgroundTasks) {
+	s.tasks = tasks
+}
+
+// GetSystemPolicy returns the policy that applies to userID (nil for anonymous callers):
+// the base policy with the caller's audience overrides layered on top.
+func (s *FileService) GetSystemPolicy(ctx context.Context, userID *uuid.UUID) (*models.SystemPolicy, error) {
 	var policy models.SystemPolicy
 	if err := s.db.WithContext(ctx).First(&policy, 1).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return &models.SystemPolicy{
-				ID:                       1,
-				MaxFileSizeMB:            50,
-				MinValidityHours:         1,
-				MaxValidityDays:          30,
-				DefaultValidityDays:      7,
-				RequirePasswordMinLength: 8,
-			}, nil
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		policy = models.SystemPolicy{
+			ID:                       1,
+			MaxFileSizeMB:            50,
+			MinValidityHours:         1,
+			MaxValidityDays:          30,
+			DefaultValidityDays:      7,
+			RequirePasswordMinLength: 8,
+			BlockedMimeTypes:         models.DefaultBlockedMimeTypes,
+			BlockedExtensions:        models.DefaultBlockedExtensions,
+			ScanDownloadPolicy:       models.ScanPolicyRequireClean,
 		}
+	}
+	if err := applyPolicyOverrides(ctx, s.db, &policy, userID); err != nil {
 		return nil, err
 	}
 
@@ -61,6 +106,9 @@ func (s *FileService) GetSystemPolicy(ctx context.Context) (*models.SystemPolicy
 	if policy.RequirePasswordMinLength < 4 {
 		policy.RequirePasswordMinLength = 8
 	}
+	if policy.ScanDownloadPolicy != models.ScanPolicyBlockInfected {
+		policy.ScanDownloadPolicy = models.ScanPolicyRequireClean
+	}
 
 	return &policy, nil
 }
@@ -110,13 +158,29 @@ func (s *FileService) UploadFile(ctx context.Context, input *UploadInput) (*mode
 	}
 
 	fileName := input.sanitizedFileName()
+
+	// Never trust the client's Content-Type: sniff the real type and check it against policy.
+	policy, err := s.GetSystemPolicy(ctx, input.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	contentType, reader, err := SniffUpload(input.Reader, fileName, input.ContentType, UploadTypeRules{
+		ConfigAllowed:     s.allowedMimeTypes,
+		PolicyAllowed:     policy.AllowedMimeTypes,
+		BlockedMimeTypes:  policy.BlockedMimeTypes,
+		BlockedExtensions: policy.BlockedExtensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	storageName := fmt.Sprintf("%s-%s", uuid.NewString(), fileName)
 	obj := &storage.Object{
 		Name:        storageName,
 		Container:   input.container(),
-		ContentType: input.ContentType,
+		ContentType: contentType,
 		Size:        input.Size,
-		Reader:      input.Reader,
+		Reader:      reader,
 	}
 
 	loc, err := s.storage.Upload(ctx, obj)
@@ -124,7 +188,7 @@ func (s *FileService) UploadFile(ctx context.Context, input *UploadInput) (*mode
 		return nil, err
 	}
 
-	availableFrom, availableTo, err := s.resolveAvailability(ctx, input)
+	availableFrom, availableTo, err := resolveAvailability(input, policy)
 	if err != nil {
 		_ = s.storage.Delete(ctx, loc)
 		return nil, err
@@ -134,13 +198,17 @@ func (s *FileService) UploadFile(ctx context.Context, input *UploadInput) (*mode
 		FileName:      fileName,
 		FilePath:      loc.Path,
 		FileSize:      input.Size,
-		MimeType:      optionalString(input.ContentType),
+		MimeType:      optionalString(contentType),
 		OwnerID:       input.OwnerID,
 		IsPublic:      input.IsPublic,
 		PasswordHash:  input.PasswordHash,
 		AvailableFrom: availableFrom,
 		AvailableTo:   availableTo,
 	}
+	if s.scanner != nil {
+		pending := models.ScanStatusPending
+		file.ScanStatus = &pending
+	}
 
 	var sharedWithEmails []string
 	if len(input.SharedWithEmails) > 0 && input.OwnerID != nil {
@@ -186,6 +254,10 @@ func (s *FileService) UploadFile(ctx context.Context, input *UploadInput) (*mode
 		return nil, err
 	}
 
+	if s.scanner != nil {
+		s.tasks.Go(func() { s.scanInBackground(file.ID) })
+	}
+
 	return file, nil
 }
 
@@ -197,47 +269,34 @@ func optionalString(val string) *string {
 	return &v
 }
 
+// containerFromFile is where the file's object currently lives; quarantined objects are
+// always private.
 func containerFromFile(file *models.File) storage.ContainerType {
+	if file != nil && file.QuarantinedAt != nil {
+		return storage.ContainerPrivate
+	}
+	return visibilityContainer(file)
+}
+
+// visibilityContainer is the container matching the file's public/private setting.
+func visibilityContainer(file *models.File) storage.ContainerType {
 	if file != nil && file.IsPublic != nil && *file.IsPublic {
 		return storage.ContainerPublic
 	}
 	return storage.ContainerPrivate
 }
 
-func (s *FileService) resolveAvailability(ctx context.Context, input *UploadInput) (*time.Time, *time.Time, error) {
+func resolveAvailability(input *UploadInput, policy *models.SystemPolicy) (*time.Time, *time.Time, error) {
 	if input.AvailableFrom != nil || input.AvailableTo != nil {
 		return input.AvailableFrom, input.AvailableTo, nil
 	}
 
-	days, err := s.defaultValidityDays(ctx)
-	if err != nil {
-		return nil, nil, err
-	}
-	if days <= 0 {
-		days = 7
-	}
-
 	now := time.Now()
-	expiryTime := now.AddDate(0, 0, days)
+	expiryTime := now.AddDate(0, 0, policy.DefaultValidityDays)
 
 	return &now, &expiryTime, nil
 }
 
-func (s *FileService) defaultValidityDays(ctx context.Context) (int, error) {
-	var policy models.SystemPolicy
-	if err := s.db.WithContext(ctx).First(&policy).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return 7, nil
-		}
-		return 0, err
-	}
-
-	if policy.DefaultValidityDays <= 0 {
-		return 7, nil
-	}
-	return policy.DefaultValidityDays, nil
-}
-
 func (s *FileService) GetByID(id uuid.UUID) (*models.File, error) {
 	var file models.File
 	err := s.db.Preload("Owner").Preload("Statistics").First(&file, "id = ?", id).Error
@@ -253,6 +312,12 @@ func (s *FileService) GetByShareToken(token string) (*models.File, error) {
 	if err != nil {
 		return nil, err
 	}
+	if file.TakenDownAt != nil {
+		return nil, ErrFileTakenDown
+	}
+	if file.ShareDisabledAt != nil || (file.Owner != nil && file.Owner.IsSuspended()) {
+		return nil, ErrShareDisabled
+	}
 	return &file, nil
 }
 
@@ -269,13 +334,19 @@ func (s *FileService) Delete(id uuid.UUID) error {
 	if err := s.db.First(&file, "id = ?", id).Error; err != nil {
 		return err
 	}
+	if file.LegalHold {
+		return ErrLegalHold
+	}
 
 	if s.storage != nil && file.FilePath != "" {
 		loc := &storage.Location{
 			Container: containerFromFile(&file),
 			Path:      file.FilePath,
 		}
-		_ = s.storage.Delete(context.Background(), loc)
+		// The row goes regardless; a leftover object is an orphan for storage reconciliation.
+		if err := s.storage.Delete(context.Background(), loc); err != nil {
+			slog.Warn("deleting object of deleted file failed", "component", "files", "file_id", id, "path", file.FilePath, "error", err)
+		}
 	}
 
 	return s.db.Delete(&models.File{}, "id = ?", id).Error
@@ -354,7 +425,7 @@ func (s *FileService) SearchFiles(query string, limit, offset int) ([]models.Fil
 func (s *FileService) GetExpiredFiles() ([]models.File, error) {
 	var files []models.File
 
-	err := s.db.Where("available_to IS NOT NULL AND available_to < CURRENT_TIMESTAMP").
+	err := s.db.Where("available_to IS NOT NULL AND available_to < CURRENT_TIMESTAMP AND legal_hold = ?", false).
 		Find(&files).Error
 
 	if err != nil {
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var (
+	// ErrFileTypeNotAllowed is returned for uploads whose extension or sniffed type the
+	// policy blocks or does not allow.
+	ErrFileTypeNotAllowed = errors.New("file type not allowed")
+	// ErrFileTypeMismatch is returned when the content does not match the declared type,
+	// e.g. an executable uploaded as application/pdf.
+	ErrFileTypeMismatch = errors.New("file content does not match its declared type")
+)
+
+// sniffLength is how many leading bytes are inspected; it matches mimetype's default limit.
+const sniffLength = 3072
+
+// UploadTypeRules combines the deployment allowlist (storage.allowed_mime_types) with
+// the allow/deny lists from SystemPolicy.
+type UploadTypeRules struct {
+	ConfigAllowed     []string
+	PolicyAllowed     []string
+	BlockedMimeTypes  []string
+	BlockedExtensions []string
+}
+
+// SniffUpload detects the real type from the first bytes of reader and checks it against
+// the rules and the declared content type. It returns the detected media type and a reader
+// that yields the full stream again.
+func SniffUpload(reader io.Reader, fileName, declared string, rules UploadTypeRules) (string, io.Reader, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext != "" && containsFold(rules.BlockedExtensions, ext) {
+		return "", nil, fmt.Errorf("%w: extension %s is blocked", ErrFileTypeNotAllowed, ext)
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, err
+	}
+	head = head[:n]
+	detected := mimetype.Detect(head)
+	sniffed := mediaType(detected.String())
+
+	for _, pattern := range rules.BlockedMimeTypes {
+		if mimeMatches(detected, pattern) {
+			return "", nil, fmt.Errorf("%w: %s is blocked", ErrFileTypeNotAllowed, sniffed)
+		}
+	}
+	for _, allowed := range [][]string{rules.ConfigAllowed, rules.PolicyAllowed} {
+		if !mimeAllowed(detected, allowed) {
+			return "", nil, fmt.Errorf("%w: %s is not in the allowed types", ErrFileTypeNotAllowed, sniffed)
+		}
+	}
+
+	if claimed := mediaType(declared); claimed != "" && claimed != "application/octet-stream" && !typesCompatible(detected, claimed) {
+		return "", nil, fmt.Errorf("%w: declared %s, detected %s", ErrFileTypeMismatch, claimed, sniffed)
+	}
+
+	return sniffed, io.MultiReader(bytes.NewReader(head), reader), nil
+}
+
+// typesCompatible reports whether content detected as `detected` may be stored under the
+// claimed type. Claims the sniffer cannot recognise are accepted, since they cannot be verified.
+func typesCompatible(detected *mimetype.MIME, claimed string) bool {
+	expected := mimetype.Lookup(claimed)
+	if expected == nil {
+		return true
+	}
+	// The content is the claimed type or a more specific one (json for text/plain).
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is(claimed) {
+			return true
+		}
+	}
+	// The content is a generic container of the claimed type (zip for docx, text for csv),
+	// but not the catch-all application/octet-stream.
+	for m := expected.Parent(); m != nil && m.Parent() != nil; m = m.Parent() {
+		if m.Is(detected.String()) {
+			return true
+		}
+	}
+	// Text detection is heuristic; any text claim is fine for text content.
+	return strings.HasPrefix(claimed, "text/") && strings.HasPrefix(detected.String(), "text/")
+}
+
+// mimeAllowed treats an empty list or "*" as allow-all.
+func mimeAllowed(detected *mimetype.MIME, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		if mimeMatches(detected, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeMatches supports "*", "type/*" and exact types (including mimetype aliases).
+func mimeMatches(detected *mimetype.MIME, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(mediaType(detected.String()), strings.TrimSuffix(pattern, "*"))
+	default:
+		return pattern != "" && detected.Is(pattern)
+	}
+}
+
+// mediaType strips parameters such as "; charset=utf-8".
+func mediaType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidMimePattern reports whether s is "*", "type/*" or "type/subtype".
+func ValidMimePattern(s string) bool {
+	if s == "*" {
+		return true
+	}
+	parts := strings.Split(s, "/")
+	return len(parts) == 2 && parts[0] != "" && parts[0] != "*" && parts[1] != "" && !strings.ContainsAny(s, " ;,")
+}
+
+// ValidExtension reports whether s looks like ".ext".
+func ValidExtension(s string) bool {
+	return len(s) > 1 && strings.HasPrefix(s, ".") && !strings.ContainsAny(s[1:], "./\\ ")
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"gorm.io/gorm"
+)
+
+// HealthStatus is the state of one dependency checked by HealthService.
+type HealthStatus string
+
+const (
+	HealthUp       HealthStatus = "up"
+	HealthDegraded HealthStatus = "degraded" // working, but needs attention (e.g. low disk space)
+	HealthDown     HealthStatus = "down"
+)
+
+// Overall statuses of a HealthReport.
+const (
+	HealthReportOK          = "ok"
+	HealthReportDegraded    = "degraded"
+	HealthReportUnavailable = "unavailable"
+)
+
+// ComponentHealth is the result of checking one dependency.
+type ComponentHealth struct {
+	Status    HealthStatus   `json:"status"`
+	LatencyMs int64          `json:"latencyMs"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type HealthReport struct {
+	Status    string                     `json:"status"`
+	Checks    map[string]ComponentHealth `json:"checks,omitempty"`
+	CheckedAt time.Time                  `json:"checkedAt"`
+}
+
+// Ready reports whether the instance can serve traffic; degraded components do not stop it.
+func (r *HealthReport) Ready() bool {
+	return r.Status != HealthReportUnavailable
+}
+
+// HealthService checks the dependencies the server needs to serve requests: the database
+// (including the schema version), the storage backend and, for local storage, free disk space.
+type HealthService struct {
+	db      *gorm.DB
+	storage storage.Storage
+
+	expectedSchemaVersion uint          // 0 when the migrations are not deployed with the binary
+	checkTimeout          time.Duration // per component
+	minFreeBytes          uint64        // below either threshold the disk is reported degraded
+	minFreeRatio          float64
+}
+
+func NewHealthService(db *gorm.DB, st storage.Storage) *HealthService {
+	return &HealthService{
+		db:           db,
+		storage:      st,
+		checkTimeout: 3 * time.Second,
+		minFreeBytes: 1 << 30, // 1 GiB
+		minFreeRatio: 0.05,
+	}
+}
+
+// SetExpectedSchemaVersion makes readiness fail while the database schema is older than
+// version, e.g. when the migrations of a new release have not run yet.
+func (s *HealthService) SetExpectedSchemaVersion(version uint) {
+	s.expectedSchemaVersion = version
+}
+
+// Liveness only reports that the process is serving requests; it does not check
+// dependencies, so an outage of the database does not get the instance restarted.
+func (s *HealthService) Liveness() HealthReport {
+	return HealthReport{Status: HealthReportOK, CheckedAt: time.Now().UTC()}
+}
+
+// Readiness checks every dependency concurrently, each within checkTimeout.
+func (s *HealthService) Readiness(ctx context.Context) HealthReport {
+	checks := map[string]func(context.Context) ComponentHealth{
+		"database": s.checkDatabase,
+		"storage":  s.checkStorage,
+	}
+	if reporter, ok := s.storage.(storage.DiskSpaceReporter); ok {
+		checks["disk"] = func(context.Context) ComponentHealth { return s.checkDisk(reporter) }
+	}
+
+	report := HealthReport{Status: HealthReportOK, Checks: make(map[string]ComponentHealth, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, s.checkTimeout)
+			defer cancel()
+			start := time.Now()
+			result := check(checkCtx)
+			result.LatencyMs = time.Since(start).Milliseconds()
+			if result.Status != HealthUp {
+				slog.WarnContext(ctx, "health check failed", "component", "health", "check", name, "status", result.Status, "error", result.Error)
+			}
+			mu.Lock()
+			report.Checks[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		switch {
+		case result.Status == HealthDown:
+			report.Status = HealthReportUnavailable
+		case result.Status == HealthDegraded && report.Status == HealthReportOK:
+			report.Status = HealthReportDegraded
+		}
+	}
+	report.CheckedAt = time.Now().UTC()
+	return report
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) ComponentHealth {
+	if s.db == nil {
+		return ComponentHealth{Status: HealthDown, Error: "database not connected"}
+	}
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return ComponentHealth{Status: HealthDown, Error: err.Error()}
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return ComponentHealth{Status: HealthDown, Error: "ping failed: " + err.Error()}
+	}
+
+	stats := sqlDB.Stats()
+	details := map[string]any{
+		"openConnections": stats.OpenConnections,
+		"inUse":           stats.InUse,
+	}
+	var schema struct {
+		Version uint
+		Dirty   bool
+	}
+	result := s.db.WithContext(ctx).Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&schema)
+	if result.Error != nil {
+		return ComponentHealth{Status: HealthDown, Error: "reading schema version failed: " + result.Error.Error(), Details: details}
+	}
+	if result.RowsAffected == 0 {
+		return ComponentHealth{Status: HealthDown, Error: "migrations have not been applied", Details: details}
+	}
+	details["schemaVersion"] = schema.Version
+	if s.expectedSchemaVersion > 0 {
+		details["expectedSchemaVersion"] = s.expectedSchemaVersion
+	}
+
+	switch {
+	case schema.Dirty:
+		return ComponentHealth{Status: HealthDown, Error: fmt.Sprintf("migration %d failed and left the schema dirty", schema.Version), Details: details}
+	case schema.Version < s.expectedSchemaVersion:
+		return ComponentHealth{Status: HealthDown, Error: fmt.Sprintf("schema version %d is older than the expected %d", schema.Version, s.expectedSchemaVersion), Details: details}
+	}
+	return ComponentHealth{Status: HealthUp, Details: details}
+}
+
+func (s *HealthService) checkStorage(ctx context.Context) ComponentHealth {
+	if s.storage == nil {
+		return ComponentHealth{Status: HealthDown, Error: "storage not configured"}
+	}
+	if err := s.storage.Probe(ctx); err != nil {
+		return ComponentHealth{Status: HealthDown, Error: err.Error()}
+	}
+	return ComponentHealth{Status: HealthUp}
+}
+
+// checkDisk never reports down: a full disk only breaks uploads, downloads keep working.
+func (s *HealthService) checkDisk(reporter storage.DiskSpaceReporter) ComponentHealth {
+	usage, err := reporter.DiskUsage()
+	if errors.Is(err, errors.ErrUnsupported) {
+		return ComponentHealth{Status: HealthUp, Details: map[string]any{"supported": false}}
+	}
+	if err != nil {
+		return ComponentHealth{Status: HealthDegraded, Error: err.Error()}
+	}
+
+	details := map[string]any{
+		"freeBytes":  usage.FreeBytes,
+		"totalBytes": usage.TotalBytes,
+	}
+	if usage.FreeBytes < s.minFreeBytes || (usage.TotalBytes > 0 && float64(usage.FreeBytes)/float64(usage.TotalBytes) < s.minFreeRatio) {
+		return ComponentHealth{Status: HealthDegraded, Error: "low free disk space", Details: details}
+	}
+	return ComponentHealth{Status: HealthUp, Details: details}
+}
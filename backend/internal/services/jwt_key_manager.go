@@ -0,0 +1,470 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported access token signing algorithms.
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnsupportedJWTAlgorithm = errors.New("unsupported jwt algorithm")
+	ErrUnknownSigningKey       = errors.New("unknown or expired jwt signing key")
+	ErrNoSigningKey            = errors.New("no active jwt signing key")
+)
+
+const (
+	defaultKeyRotationInterval = 30 * 24 * time.Hour
+	defaultAccessTokenTTL      = 15 * time.Minute
+	rsaKeyBits                 = 2048
+	// unknownKIDReloadInterval limits how often a token with an unknown kid
+	// (e.g. signed by another instance after a rotation) triggers a key reload.
+	unknownKIDReloadInterval = 30 * time.Second
+	// rotationLockWait bounds how long RotateIfDue waits for another instance that is
+	// rotating before it settles for the keys that instance has stored so far.
+	rotationLockWait      = 10 * time.Second
+	rotationLockRetryWait = 100 * time.Millisecond
+)
+
+// JSONWebKey is the public part of a signing key as published in the JWKS document (RFC 7517).
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	public    crypto.PublicKey
+	createdAt time.Time
+	expiresAt *time.Time
+}
+
+// JWTKeyManager signs and verifies access tokens.
+//
+// With HS256 it uses the shared JWT secret, as before. With RS256 or EdDSA it keeps a set of
+// key pairs in the database: the newest one signs, each rotation retires the previous ones, and
+// retired keys keep verifying (and stay in the JWKS) for one access token lifetime so that
+// tokens issued before the rotation remain valid until they expire.
+type JWTKeyManager struct {
+	algorithm string
+	secret    []byte
+	repo      repositories.JWTSigningKeyRepository
+	lock      Locker
+	rotation  time.Duration
+	tokenTTL  time.Duration
+
+	// legacyHMACUntil accepts HS256 tokens issued before switching to an asymmetric
+	// algorithm until they have expired.
+	legacyHMACUntil time.Time
+
+	mu              sync.RWMutex
+	keys            map[string]*signingKey
+	current         *signingKey
+	lastUnknownLoad time.Time
+}
+
+// NewJWTKeyManager builds a key manager for cfg.Algorithm. For asymmetric algorithms it loads
+// the stored keys and generates the first one if none is active. lock is held while checking
+// for and performing a rotation so that replicas sharing repo never rotate at the same time;
+// it may be nil when a single instance uses repo.
+func NewJWTKeyManager(cfg config.JWTConfig, repo repositories.JWTSigningKeyRepository, lock Locker) (*JWTKeyManager, error) {
+	algorithm := normalizeJWTAlgorithm(cfg.Algorithm)
+	if algorithm == JWTAlgorithmHS256 {
+		return newHMACKeyManager(cfg.Secret), nil
+	}
+	if algorithm != JWTAlgorithmRS256 && algorithm != JWTAlgorithmEdDSA {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedJWTAlgorithm, cfg.Algorithm)
+	}
+	if repo == nil {
+		return nil, errors.New("jwt signing key repository is required for " + algorithm)
+	}
+
+	rotation, err := cfg.GetRotationInterval()
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt rotation interval: %w", err)
+	}
+	if rotation <= 0 {
+		rotation = defaultKeyRotationInterval
+	}
+	tokenTTL, err := cfg.GetAccessTokenExpiry()
+	if err != nil {
+		return nil, fmt.Errorf("invalid access token expiry: %w", err)
+	}
+	if tokenTTL <= 0 {
+		tokenTTL = defaultAccessTokenTTL
+	}
+
+	m := &JWTKeyManager{
+		algorithm: algorithm,
+		repo:      repo,
+		lock:      lock,
+		rotation:  rotation,
+		tokenTTL:  tokenTTL,
+		keys:      make(map[string]*signingKey),
+	}
+	if cfg.Secret != "" {
+		m.secret = []byte(cfg.Secret)
+		m.legacyHMACUntil = time.Now().Add(tokenTTL)
+	}
+
+	if _, err := m.RotateIfDue(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func newHMACKeyManager(secret string) *JWTKeyManager {
+	return &JWTKeyManager{
+		algorithm: JWTAlgorithmHS256,
+		secret:    []byte(secret),
+		keys:      make(map[string]*signingKey),
+	}
+}
+
+func normalizeJWTAlgorithm(algorithm string) string {
+	switch strings.ToUpper(strings.TrimSpace(algorithm)) {
+	case "", "HS256":
+		return JWTAlgorithmHS256
+	case "RS256":
+		return JWTAlgorithmRS256
+	case "EDDSA", "ED25519":
+		return JWTAlgorithmEdDSA
+	default:
+		return algorithm
+	}
+}
+
+// Algorithm returns the algorithm used to sign new tokens.
+func (m *JWTKeyManager) Algorithm() string {
+	return m.algorithm
+}
+
+// Asymmetric reports whether keys are rotated and published in the JWKS.
+func (m *JWTKeyManager) Asymmetric() bool {
+	return m.algorithm != JWTAlgorithmHS256
+}
+
+// Sign signs claims with the current key, setting the "kid" header for asymmetric keys.
+func (m *JWTKeyManager) Sign(claims jwt.Claims) (string, error) {
+	if !m.Asymmetric() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	}
+
+	m.mu.RLock()
+	key := m.current
+	m.mu.RUnlock()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// Parse verifies tokenStr and decodes it into claims.
+func (m *JWTKeyManager) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	methods := []string{JWTAlgorithmHS256}
+	if m.Asymmetric() {
+		// keyfunc checks that the algorithm matches the key selected by kid.
+		methods = []string{JWTAlgorithmRS256, JWTAlgorithmEdDSA}
+		if m.secret != nil && time.Now().Before(m.legacyHMACUntil) {
+			methods = append(methods, JWTAlgorithmHS256)
+		}
+	}
+	return jwt.ParseWithClaims(tokenStr, claims, m.keyfunc, jwt.WithValidMethods(methods))
+}
+
+func (m *JWTKeyManager) keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if m.Asymmetric() && !time.Now().Before(m.legacyHMACUntil) {
+			return nil, ErrUnknownSigningKey
+		}
+		return m.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownSigningKey
+	}
+
+	key := m.lookup(kid)
+	if key == nil && m.shouldReloadForUnknownKID() {
+		// The key may have been created by another instance since our last reload.
+		if err := m.Reload(); err != nil {
+			return nil, err
+		}
+		key = m.lookup(kid)
+	}
+	if key == nil || key.method.Alg() != token.Method.Alg() {
+		return nil, ErrUnknownSigningKey
+	}
+	if key.expiresAt != nil && !time.Now().Before(*key.expiresAt) {
+		return nil, ErrUnknownSigningKey
+	}
+	return key.public, nil
+}
+
+func (m *JWTKeyManager) lookup(kid string) *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[kid]
+}
+
+func (m *JWTKeyManager) shouldReloadForUnknownKID() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.lastUnknownLoad) < unknownKIDReloadInterval {
+		return false
+	}
+	m.lastUnknownLoad = time.Now()
+	return true
+}
+
+// JWKS returns the public keys that currently verify tokens. It is empty for HS256.
+func (m *JWTKeyManager) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if !m.Asymmetric() {
+		return set
+	}
+
+	now := time.Now()
+	m.mu.RLock()
+	keys := make([]*signingKey, 0, len(m.keys))
+	for _, key := range m.keys {
+		if key.expiresAt == nil || now.Before(*key.expiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	m.mu.RUnlock()
+
+	// Newest first, so the current signing key leads the document.
+	sort.Slice(keys, func(i, j int) bool { return keys[i].createdAt.After(keys[j].createdAt) })
+	for _, key := range keys {
+		set.Keys = append(set.Keys, publicJWK(key))
+	}
+	return set
+}
+
+// Reload refreshes the in-memory key set from the database.
+func (m *JWTKeyManager) Reload() error {
+	if !m.Asymmetric() {
+		return nil
+	}
+
+	stored, err := m.repo.ListUsable(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(stored))
+	var current *signingKey
+	for i := range stored {
+		key, err := parseSigningKey(&stored[i])
+		if err != nil {
+			return fmt.Errorf("jwt signing key %s: %w", stored[i].KID, err)
+		}
+		keys[key.kid] = key
+		// Keys left over from a previous algorithm still verify until they expire, but never sign.
+		if key.method.Alg() == m.algorithm && stored[i].RetiredAt == nil && (current == nil || key.createdAt.After(current.createdAt)) {
+			current = key
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.current = current
+	m.mu.Unlock()
+	return nil
+}
+
+// RotateIfDue reloads the key set, removes expired keys and generates a new signing key when
+// there is none or the current one is older than the rotation interval. The check and the
+// rotation run under the rotation lock; when another instance holds it for longer than
+// rotationLockWait, the keys are only reloaded.
+func (m *JWTKeyManager) RotateIfDue(now time.Time) (bool, error) {
+	if !m.Asymmetric() {
+		return false, nil
+	}
+	if m.lock != nil {
+		ctx := context.Background()
+		locked, err := m.acquireRotationLock(ctx)
+		if err != nil {
+			return false, err
+		}
+		if !locked {
+			return false, m.Reload()
+		}
+		defer m.lock.Unlock(ctx)
+	}
+
+	// Reload after taking the lock: the instance that held it may just have rotated
+	if err := m.repo.DeleteExpired(now); err != nil {
+		return false, err
+	}
+	if err := m.Reload(); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	current := m.current
+	m.mu.RUnlock()
+	if current != nil && now.Sub(current.createdAt) < m.rotation {
+		return false, nil
+	}
+	return true, m.Rotate(now)
+}
+
+func (m *JWTKeyManager) acquireRotationLock(ctx context.Context) (bool, error) {
+	deadline := time.Now().Add(rotationLockWait)
+	for {
+		locked, err := m.lock.TryLock(ctx)
+		if err != nil || locked {
+			return locked, err
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+		time.Sleep(rotationLockRetryWait)
+	}
+}
+
+// Rotate generates a new signing key and retires the keys created before it. Retired keys
+// keep verifying for one access token lifetime. Use RotateIfDue unless the caller holds the
+// rotation lock; a key created concurrently by another instance is never retired here, so
+// the newest key keeps signing either way.
+func (m *JWTKeyManager) Rotate(now time.Time) error {
+	if !m.Asymmetric() {
+		return ErrUnsupportedJWTAlgorithm
+	}
+
+	stored, err := generateSigningKey(m.algorithm, now)
+	if err != nil {
+		return err
+	}
+	if err := m.repo.Create(stored); err != nil {
+		return err
+	}
+	if err := m.repo.RetireOlderThan(stored.KID, stored.CreatedAt, now, now.Add(m.tokenTTL)); err != nil {
+		return err
+	}
+	return m.Reload()
+}
+
+func generateSigningKey(algorithm string, now time.Time) (*models.JWTSigningKey, error) {
+	var private crypto.Signer
+	switch algorithm {
+	case JWTAlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case JWTAlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedJWTAlgorithm, algorithm)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return nil, err
+	}
+
+	return &models.JWTSigningKey{
+		KID:        now.Format("20060102") + "-" + hex.EncodeToString(kidBytes),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  now,
+	}, nil
+}
+
+func parseSigningKey(stored *models.JWTSigningKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(stored.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		kid:       stored.KID,
+		createdAt: stored.CreatedAt,
+		expiresAt: stored.ExpiresAt,
+	}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method = jwt.SigningMethodRS256
+		key.private = private
+		key.public = &private.PublicKey
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.private = private
+		key.public = private.Public()
+	default:
+		return nil, fmt.Errorf("%w: unexpected key type %T", ErrUnsupportedJWTAlgorithm, parsed)
+	}
+	return key, nil
+}
+
+func publicJWK(key *signingKey) JSONWebKey {
+	jwk := JSONWebKey{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
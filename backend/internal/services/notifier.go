@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"strings"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+)
+
+// Notifier delivers plain-text messages to users, e.g. takedown notices to file owners.
+type Notifier interface {
+	Notify(ctx context.Context, to, subject, body string) error
+}
+
+// NewNotifier sends mail through SMTP when email is enabled and only logs otherwise.
+func NewNotifier(cfg config.EmailConfig) Notifier {
+	if !cfg.Enabled || cfg.SMTPHost == "" {
+		return logNotifier{}
+	}
+	return &smtpNotifier{cfg: cfg}
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, to, subject, body string) error {
+	slog.InfoContext(ctx, "email disabled, notification not sent", "component", "notify", "subject", subject, "to", to)
+	return nil
+}
+
+type smtpNotifier struct {
+	cfg config.EmailConfig
+}
+
+func (n *smtpNotifier) Notify(ctx context.Context, to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("notifier: invalid header value")
+	}
+
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.SMTPHost)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + n.cfg.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	addr := fmt.Sprintf("%s:%d", n.cfg.SMTPHost, n.cfg.SMTPPort)
+	return smtp.SendMail(addr, auth, n.cfg.From, []string{to}, []byte(msg))
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOIDCDisabled         = errors.New("single sign-on is not configured")
+	ErrOIDCProviderDown     = errors.New("identity provider unavailable")
+	ErrOIDCInvalidState     = errors.New("invalid or expired sso state")
+	ErrOIDCTokenInvalid     = errors.New("invalid id token")
+	ErrOIDCMissingEmail     = errors.New("identity provider did not return an email")
+	ErrOIDCEmailNotVerified = errors.New("email not verified by identity provider")
+)
+
+var usernameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// OIDCService is an OpenID Connect relying party using the authorization code flow with PKCE.
+// Users are provisioned on first login, or linked to an existing account with the same verified email.
+type OIDCService struct {
+	cfg          config.OIDCConfig
+	userRepo     repositories.UserRepository
+	identityRepo repositories.UserIdentityRepository
+	requestRepo  repositories.OIDCAuthRequestRepository
+	requestTTL   time.Duration
+
+	// The provider is discovered lazily so an unreachable IdP does not prevent startup.
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+type oidcClaims struct {
+	Email             string    `json:"email"`
+	EmailVerified     claimBool `json:"email_verified"`
+	PreferredUsername string    `json:"preferred_username"`
+	Name              string    `json:"name"`
+}
+
+// claimBool accepts both JSON booleans and "true"/"false" strings, which some providers send.
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case bool:
+		*b = claimBool(t)
+	case string:
+		*b = claimBool(strings.EqualFold(t, "true"))
+	}
+	return nil
+}
+
+func NewOIDCService(
+	cfg config.OIDCConfig,
+	userRepo repositories.UserRepository,
+	identityRepo repositories.UserIdentityRepository,
+	requestRepo repositories.OIDCAuthRequestRepository,
+) *OIDCService {
+	return &OIDCService{
+		cfg:          cfg,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		requestRepo:  requestRepo,
+		requestTTL:   10 * time.Minute,
+	}
+}
+
+func (s *OIDCService) Enabled() bool {
+	return s.cfg.Enabled && s.cfg.IssuerURL != "" && s.cfg.ClientID != ""
+}
+
+func (s *OIDCService) discover(ctx context.Context) (*oidc.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.provider != nil {
+		return s.provider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, s.cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: discovery failed: %v", ErrOIDCProviderDown, err)
+	}
+	s.provider = provider
+	return provider, nil
+}
+
+func (s *OIDCService) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range s.cfg.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &oauth2.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: s.cfg.ClientSecret,
+		RedirectURL:  s.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+}
+
+// AuthorizationURL starts a login: it stores a fresh state, nonce and PKCE verifier
+// and returns the IdP URL the browser should be redirected to.
+func (s *OIDCService) AuthorizationURL(ctx context.Context) (string, error) {
+	if !s.Enabled() {
+		return "", ErrOIDCDisabled
+	}
+	provider, err := s.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now().UTC()
+	_ = s.requestRepo.DeleteExpired(now)
+	request := &models.OIDCAuthRequest{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.requestTTL),
+	}
+	if err := s.requestRepo.Create(request); err != nil {
+		return "", err
+	}
+
+	return s.oauth2Config(provider).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	), nil
+}
+
+// Callback redeems the authorization code, validates the ID token against the provider's
+// JWKS and returns the linked (or newly provisioned) local user.
+func (s *OIDCService) Callback(ctx context.Context, state, code string) (*models.User, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	provider, err := s.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := s.requestRepo.Consume(state, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOIDCInvalidState
+		}
+		return nil, err
+	}
+
+	token, err := s.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(request.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code exchange failed: %v", ErrOIDCTokenInvalid, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrOIDCTokenInvalid)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+	if idToken.Nonce != request.Nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCTokenInvalid)
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+	var rawClaims map[string]interface{}
+	if err := idToken.Claims(&rawClaims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+
+	user, err := s.resolveUser(idToken.Issuer, idToken.Subject, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.syncRole(user, rawClaims); err != nil {
+		return nil, err
+	}
+
+	if now := time.Now().UTC(); user.IsLocked(now) {
+		return nil, &AccountLockedError{Until: *user.LockedUntil}
+	}
+	return user, nil
+}
+
+// resolveUser finds the user linked to issuer+subject. Unlinked identities are linked to an
+// existing account by verified email, or a new account is provisioned just in time.
+func (s *OIDCService) resolveUser(issuer, subject string, claims *oidcClaims) (*models.User, error) {
+	now := time.Now().UTC()
+
+	identity, err := s.identityRepo.GetByIssuerSubject(issuer, subject)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := s.userRepo.GetByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		_ = s.identityRepo.UpdateLastLogin(identity.ID, now)
+		return user, nil
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" {
+		return nil, ErrOIDCMissingEmail
+	}
+	// Linking or creating an account by email is only safe if the IdP vouches for it.
+	if !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if user == nil {
+		user, err = s.provisionUser(email, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	identity = &models.UserIdentity{
+		UserID:      user.ID,
+		Issuer:      issuer,
+		Subject:     subject,
+		Email:       &email,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	}
+	if err := s.identityRepo.Create(identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionUser creates an SSO-only account. It has no local password, so
+// password login is impossible until the user sets one.
+func (s *OIDCService) provisionUser(email string, claims *oidcClaims) (*models.User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(email, "@", 2)[0]
+	}
+	base = strings.Trim(usernameSanitizer.ReplaceAllString(base, "_"), "_")
+	if base == "" {
+		base = "user"
+	}
+	base = truncate(base, 40)
+
+	username := base
+	for i := 2; ; i++ {
+		exists, err := s.userRepo.ExistsByUsername(username)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			break
+		}
+		username = fmt.Sprintf("%s%d", base, i)
+	}
+
+	user := &models.User{
+		Username: username,
+		Email:    email,
+		Role:     models.RoleUser,
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// syncRole applies RoleMapping to the configured role claim. The highest mapped role wins,
+// and it only ever raises the user's role: demotions go through the admin API, which
+// protects the last admin and records them in the audit log.
+func (s *OIDCService) syncRole(user *models.User, rawClaims map[string]interface{}) error {
+	if s.cfg.RoleClaim == "" {
+		return nil
+	}
+
+	role := user.Role
+	for _, value := range claimValues(rawClaims[s.cfg.RoleClaim]) {
+		mapped, ok := s.cfg.RoleMapping[value]
+		if !ok {
+			// viper lowercases map keys read from config files
+			mapped, ok = s.cfg.RoleMapping[strings.ToLower(value)]
+		}
+		if ok && models.UserRole(mapped).IsValid() && models.UserRole(mapped).Outranks(role) {
+			role = models.UserRole(mapped)
+		}
+	}
+
+	if user.Role == role {
+		return nil
+	}
+	slog.Info("role granted by identity provider", "component", "oidc", "user_id", user.ID, "from", user.Role, "to", role)
+	user.Role = role
+	return s.userRepo.Update(user)
+}
+
+func claimValues(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		values := make([]string, 0, len(t))
+		for _, item := range t {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
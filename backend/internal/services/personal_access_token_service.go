@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAccessToken     = errors.New("invalid or expired personal access token")
+	ErrAccessTokenNotFound    = errors.New("personal access token not found")
+	ErrInvalidTokenScopes     = errors.New("invalid token scopes")
+	ErrInvalidTokenExpiry     = errors.New("invalid token expiry")
+	ErrInvalidAccessTokenName = errors.New("token name must be 1-100 characters")
+)
+
+const (
+	defaultAccessTokenExpiryDays = 30
+	maxAccessTokenExpiryDays     = 365
+	maxAccessTokenName           = 100
+	// lastUsedResolution limits how often last_used_at is written for busy tokens.
+	lastUsedResolution = time.Minute
+)
+
+type PersonalAccessTokenService struct {
+	tokenRepo repositories.PersonalAccessTokenRepository
+	userRepo  repositories.UserRepository
+}
+
+func NewPersonalAccessTokenService(tokenRepo repositories.PersonalAccessTokenRepository, userRepo repositories.UserRepository) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{
+		tokenRepo: tokenRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// Create issues a new token and returns its plaintext value, which is never stored and
+// cannot be retrieved again. expiresInDays of 0 uses the default of 30 days.
+func (s *PersonalAccessTokenService) Create(userID uuid.UUID, name string, scopes []string, expiresInDays int) (string, *models.PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAccessTokenName {
+		return "", nil, ErrInvalidAccessTokenName
+	}
+
+	if expiresInDays == 0 {
+		expiresInDays = defaultAccessTokenExpiryDays
+	}
+	if expiresInDays < 1 || expiresInDays > maxAccessTokenExpiryDays {
+		return "", nil, fmt.Errorf("%w: must be between 1 and %d days", ErrInvalidTokenExpiry, maxAccessTokenExpiryDays)
+	}
+
+	normalized, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	raw := models.PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now().UTC()
+	token := &models.PersonalAccessToken{
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   hashAccessToken(raw),
+		TokenPrefix: raw[:len(models.PersonalAccessTokenPrefix)+6],
+		Scopes:      normalized,
+		ExpiresAt:   now.AddDate(0, 0, expiresInDays),
+		CreatedAt:   now,
+	}
+	if err := s.tokenRepo.Create(token); err != nil {
+		return "", nil, err
+	}
+	return raw, token, nil
+}
+
+func (s *PersonalAccessTokenService) List(userID uuid.UUID) ([]models.PersonalAccessToken, error) {
+	return s.tokenRepo.ListByUserID(userID)
+}
+
+func (s *PersonalAccessTokenService) Revoke(userID, tokenID uuid.UUID) error {
+	if err := s.tokenRepo.Revoke(tokenID, userID, time.Now().UTC()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAccessTokenNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Authenticate resolves a plaintext token to its owner. Revoked, expired and unknown
+// tokens all yield ErrInvalidAccessToken.
+func (s *PersonalAccessTokenService) Authenticate(raw string) (*models.User, *models.PersonalAccessToken, error) {
+	if !strings.HasPrefix(raw, models.PersonalAccessTokenPrefix) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	token, err := s.tokenRepo.GetByHash(hashAccessToken(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAccessToken
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	if !token.IsActive(now) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	user, err := s.userRepo.GetByID(token.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAccessToken
+		}
+		return nil, nil, err
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedResolution {
+		if err := s.tokenRepo.UpdateLastUsed(token.ID, now); err == nil {
+			token.LastUsedAt = &now
+		}
+	}
+	return user, token, nil
+}
+
+func normalizeScopes(scopes []string) (models.StringArray, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidTokenScopes)
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	normalized := make(models.StringArray, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		valid := false
+		for _, known := range models.AllTokenScopes {
+			if scope == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidTokenScopes, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+func hashAccessToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
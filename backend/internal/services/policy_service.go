@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidPolicyAudience = errors.New("invalid policy audience")
+	// ErrPolicyUnchanged is returned when an update or rollback would not change anything.
+	ErrPolicyUnchanged = errors.New("policy unchanged")
+)
+
+// PolicyActor identifies who changed a policy; Name is the email or "admin_token".
+type PolicyActor struct {
+	ID   *uuid.UUID
+	Name string
+}
+
+// PolicyService edits the system policy and per-audience overrides, recording every change
+// with before/after snapshots so it can be rolled back. Reads go through
+// FileService.GetSystemPolicy, which resolves overrides for the caller.
+type PolicyService struct {
+	db *gorm.DB
+}
+
+func NewPolicyService(db *gorm.DB) *PolicyService {
+	return &PolicyService{db: db}
+}
+
+// UpdateSystem applies apply to the base policy. apply may return an error to reject the
+// resulting policy, e.g. when the new limits are inconsistent.
+func (s *PolicyService) UpdateSystem(ctx context.Context, actor PolicyActor, apply func(*models.SystemPolicy) error) (*models.SystemPolicy, *models.PolicyChange, error) {
+	var (
+		policy models.SystemPolicy
+		change *models.PolicyChange
+	)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&policy, 1).Error; err != nil {
+			return err
+		}
+		before, err := json.Marshal(policy)
+		if err != nil {
+			return err
+		}
+		if err := apply(&policy); err != nil {
+			return err
+		}
+		policy.ID = 1
+
+		change, err = newPolicyChange(models.PolicyAudienceSystem, models.PolicyChangeUpdate, before, policy, actor)
+		if err != nil {
+			return err
+		}
+		if err := tx.Save(&policy).Error; err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &policy, change, nil
+}
+
+// ListOverrides returns all overrides ordered by audience.
+func (s *PolicyService) ListOverrides(ctx context.Context) ([]models.PolicyOverride, error) {
+	var overrides []models.PolicyOverride
+	err := s.db.WithContext(ctx).Order("audience ASC").Find(&overrides).Error
+	return overrides, err
+}
+
+// SetOverride replaces the override of audience with settings, creating it if needed.
+func (s *PolicyService) SetOverride(ctx context.Context, audience string, settings models.PolicySettings, actor PolicyActor) (*models.PolicyOverride, *models.PolicyChange, error) {
+	if !models.ValidPolicyAudience(audience) {
+		return nil, nil, ErrInvalidPolicyAudience
+	}
+	var (
+		override *models.PolicyOverride
+		change   *models.PolicyChange
+	)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		override, change, err = s.writeOverride(tx, audience, &settings, models.PolicyChangeUpdate, nil, actor)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return override, change, nil
+}
+
+// DeleteOverride removes the override so the audience falls back to the base policy.
+func (s *PolicyService) DeleteOverride(ctx context.Context, audience string, actor PolicyActor) (*models.PolicyChange, error) {
+	if !models.ValidPolicyAudience(audience) {
+		return nil, ErrInvalidPolicyAudience
+	}
+	var change *models.PolicyChange
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		_, change, err = s.writeOverride(tx, audience, nil, models.PolicyChangeDelete, nil, actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// ListChanges returns the change history, newest first; audience "" lists every audience.
+func (s *PolicyService) ListChanges(ctx context.Context, audience string, limit, offset int) ([]models.PolicyChange, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.PolicyChange{})
+	if audience != "" {
+		query = query.Where("audience = ?", audience)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var changes []models.PolicyChange
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&changes).Error; err != nil {
+		return nil, 0, err
+	}
+	return changes, total, nil
+}
+
+// Rollback restores the policy of the change's audience to what it was before that change,
+// recorded as a new "rollback" change. Rolling back the creation of an override deletes it.
+func (s *PolicyService) Rollback(ctx context.Context, changeID uuid.UUID, actor PolicyActor) (*models.PolicyChange, error) {
+	var change *models.PolicyChange
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var target models.PolicyChange
+		if err := tx.First(&target, "id = ?", changeID).Error; err != nil {
+			return err
+		}
+
+		if target.Audience == models.PolicyAudienceSystem {
+			if target.Before == nil {
+				return ErrPolicyUnchanged
+			}
+			var policy models.SystemPolicy
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&policy, 1).Error; err != nil {
+				return err
+			}
+			before, err := json.Marshal(policy)
+			if err != nil {
+				return err
+			}
+			var restored models.SystemPolicy
+			if err := json.Unmarshal([]byte(*target.Before), &restored); err != nil {
+				return err
+			}
+			restored.ID = 1
+
+			change, err = newPolicyChange(models.PolicyAudienceSystem, models.PolicyChangeRollback, before, restored, actor)
+			if err != nil {
+				return err
+			}
+			change.RollbackOf = &target.ID
+			if err := tx.Save(&restored).Error; err != nil {
+				return err
+			}
+			return tx.Create(change).Error
+		}
+
+		var settings *models.PolicySettings
+		if target.Before != nil {
+			settings = &models.PolicySettings{}
+			if err := json.Unmarshal([]byte(*target.Before), settings); err != nil {
+				return err
+			}
+		}
+		var err error
+		_, change, err = s.writeOverride(tx, target.Audience, settings, models.PolicyChangeRollback, &target.ID, actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// writeOverride sets (settings != nil) or deletes (settings == nil) the override of audience
+// inside tx and records the change.
+func (s *PolicyService) writeOverride(tx *gorm.DB, audience string, settings *models.PolicySettings, action string, rollbackOf *uuid.UUID, actor PolicyActor) (*models.PolicyOverride, *models.PolicyChange, error) {
+	var existing models.PolicyOverride
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("audience = ?", audience).First(&existing).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	if settings == nil && !found {
+		if action == models.PolicyChangeDelete {
+			return nil, nil, gorm.ErrRecordNotFound
+		}
+		return nil, nil, ErrPolicyUnchanged
+	}
+
+	var before []byte
+	if found {
+		if before, err = json.Marshal(existing.Settings); err != nil {
+			return nil, nil, err
+		}
+	}
+	var after interface{}
+	if settings != nil {
+		after = *settings
+	}
+	change, err := newPolicyChange(audience, action, before, after, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+	change.RollbackOf = rollbackOf
+
+	var override *models.PolicyOverride
+	switch {
+	case settings == nil:
+		if err := tx.Delete(&existing).Error; err != nil {
+			return nil, nil, err
+		}
+	case found:
+		existing.Settings = *settings
+		if err := tx.Model(&existing).Updates(map[string]interface{}{"settings": existing.Settings, "updated_at": gorm.Expr("CURRENT_TIMESTAMP")}).Error; err != nil {
+			return nil, nil, err
+		}
+		override = &existing
+	default:
+		override = &models.PolicyOverride{Audience: audience, Settings: *settings}
+		if err := tx.Create(override).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := tx.Create(change).Error; err != nil {
+		return nil, nil, err
+	}
+	return override, change, nil
+}
+
+// newPolicyChange builds a change from the JSON snapshot before (nil if nothing existed)
+// and the new state after (nil when deleted). It returns ErrPolicyUnchanged when the two match.
+func newPolicyChange(audience, action string, before []byte, after interface{}, actor PolicyActor) (*models.PolicyChange, error) {
+	var afterJSON []byte
+	if after != nil {
+		var err error
+		if afterJSON, err = json.Marshal(after); err != nil {
+			return nil, err
+		}
+	}
+	diff, err := policyDiff(before, afterJSON)
+	if err != nil {
+		return nil, err
+	}
+	if len(diff) == 0 && (before == nil) == (afterJSON == nil) {
+		return nil, ErrPolicyUnchanged
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &models.PolicyChange{
+		Audience:      audience,
+		Action:        action,
+		Diff:          string(diffJSON),
+		ChangedBy:     actor.ID,
+		ChangedByName: optionalString(actor.Name),
+	}
+	if before != nil {
+		change.Before = optionalString(string(before))
+	}
+	if afterJSON != nil {
+		change.After = optionalString(string(afterJSON))
+	}
+	return change, nil
+}
+
+type policyFieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// policyDiff compares two JSON objects field by field.
+func policyDiff(before, after []byte) (map[string]policyFieldChange, error) {
+	from, to := map[string]interface{}{}, map[string]interface{}{}
+	if before != nil {
+		if err := json.Unmarshal(before, &from); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &to); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(from)+len(to))
+	for k := range from {
+		keys = append(keys, k)
+	}
+	for k := range to {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diff := map[string]policyFieldChange{}
+	for _, k := range keys {
+		if k == "id" || reflect.DeepEqual(from[k], to[k]) {
+			continue
+		}
+		diff[k] = policyFieldChange{From: from[k], To: to[k]}
+	}
+	return diff, nil
+}
+
+// policyAudiences lists the overrides that apply to the caller, least specific first.
+func policyAudiences(ctx context.Context, db *gorm.DB, userID *uuid.UUID) ([]string, error) {
+	if userID == nil {
+		return []string{models.PolicyAudienceAnonymous}, nil
+	}
+	audiences := []string{models.PolicyAudienceUser}
+
+	var user models.User
+	err := db.WithContext(ctx).Select("id", "role", "policy_group").First(&user, "id = ?", *userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return audiences, nil
+		}
+		return nil, err
+	}
+	if user.Role != "" && user.Role != models.RoleUser {
+		audiences = append(audiences, models.PolicyAudienceAdmin)
+	}
+	if user.PolicyGroup != nil && *user.PolicyGroup != "" {
+		audiences = append(audiences, models.PolicyAudienceGroupPref+*user.PolicyGroup)
+	}
+	return audiences, nil
+}
+
+// applyPolicyOverrides layers the caller's overrides onto policy in audience order.
+func applyPolicyOverrides(ctx context.Context, db *gorm.DB, policy *models.SystemPolicy, userID *uuid.UUID) error {
+	audiences, err := policyAudiences(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	var overrides []models.PolicyOverride
+	if err := db.WithContext(ctx).Where("audience IN ?", audiences).Find(&overrides).Error; err != nil {
+		return err
+	}
+	byAudience := make(map[string]models.PolicySettings, len(overrides))
+	for _, o := range overrides {
+		byAudience[o.Audience] = o.Settings
+	}
+	for _, audience := range audiences {
+		if settings, ok := byAudience[audience]; ok {
+			settings.ApplyTo(policy)
+		}
+	}
+	return nil
+}
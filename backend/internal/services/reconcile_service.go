@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrReconcileRunning is returned when a repairing reconciliation or a cleanup run is in progress.
+var ErrReconcileRunning = errors.New("storage maintenance is already in progress")
+
+const (
+	defaultReconcileMinAge = time.Hour
+	reconcileBatchSize     = 500
+	// maxReconcileReportEntries bounds the lists in a report; counts are always complete.
+	maxReconcileReportEntries = 1000
+)
+
+// ReconcileService compares storage with the files table. Objects without a row (failed
+// uploads, ignored delete errors) are orphans; rows whose object is gone are dangling.
+type ReconcileService struct {
+	db      *gorm.DB
+	storage storage.Storage
+	// lock serializes repairs with cleanup runs, which delete objects before their rows.
+	lock Locker
+	// repairing refuses a second repair in this process, which the re-entrant lock lets through.
+	repairing sync.Mutex
+}
+
+func NewReconcileService(db *gorm.DB, st storage.Storage, lock Locker) *ReconcileService {
+	return &ReconcileService{db: db, storage: st, lock: lock}
+}
+
+// ReconcileOptions controls one reconciliation.
+type ReconcileOptions struct {
+	// Repair deletes orphaned objects and dangling rows; otherwise they are only reported.
+	Repair bool
+	// MinAge ignores objects modified more recently, so uploads whose row is not
+	// written yet are not mistaken for orphans. Defaults to one hour.
+	MinAge time.Duration
+}
+
+// OrphanObject is a stored object that no file row points to.
+type OrphanObject struct {
+	Container    storage.ContainerType `json:"container"`
+	Path         string                `json:"path"`
+	Size         int64                 `json:"size"`
+	LastModified time.Time             `json:"lastModified"`
+	Deleted      bool                  `json:"deleted"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// DanglingFile is a file row whose storage object does not exist.
+type DanglingFile struct {
+	FileID    uuid.UUID  `json:"fileId"`
+	FileName  string     `json:"fileName"`
+	FilePath  string     `json:"filePath"`
+	OwnerID   *uuid.UUID `json:"ownerId,omitempty"`
+	LegalHold bool       `json:"legalHold"`
+	Deleted   bool       `json:"deleted"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ReconcileReport is the outcome of one reconciliation.
+type ReconcileReport struct {
+	Repair         bool           `json:"repair"`
+	MinAgeSeconds  int64          `json:"minAgeSeconds"`
+	ObjectsScanned int            `json:"objectsScanned"`
+	ObjectsRecent  int            `json:"objectsRecent"`
+	FilesScanned   int            `json:"filesScanned"`
+	OrphansFound   int            `json:"orphansFound"`
+	OrphanBytes    int64          `json:"orphanBytes"`
+	ObjectsDeleted int            `json:"objectsDeleted"`
+	DanglingFound  int            `json:"danglingFound"`
+	FilesDeleted   int            `json:"filesDeleted"`
+	Truncated      bool           `json:"truncated"`
+	OrphanObjects  []OrphanObject `json:"orphanObjects"`
+	DanglingFiles  []DanglingFile `json:"danglingFiles"`
+	StartedAt      time.Time      `json:"startedAt"`
+	FinishedAt     time.Time      `json:"finishedAt"`
+}
+
+// Reconcile scans both storage containers and every file row. Rows under legal hold are
+// reported but never deleted.
+func (s *ReconcileService) Reconcile(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	if opts.MinAge <= 0 {
+		opts.MinAge = defaultReconcileMinAge
+	}
+	if opts.Repair {
+		if !s.repairing.TryLock() {
+			return nil, ErrReconcileRunning
+		}
+		defer s.repairing.Unlock()
+
+		locked, err := s.lock.TryLock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !locked {
+			return nil, ErrReconcileRunning
+		}
+		defer func() {
+			if err := s.lock.Unlock(context.Background()); err != nil {
+				slog.Error("releasing reconcile lock failed", "component", "reconcile", "error", err)
+			}
+		}()
+	}
+
+	report := &ReconcileReport{
+		Repair:        opts.Repair,
+		MinAgeSeconds: int64(opts.MinAge / time.Second),
+		OrphanObjects: []OrphanObject{},
+		DanglingFiles: []DanglingFile{},
+		StartedAt:     time.Now().UTC(),
+	}
+
+	for _, container := range []storage.ContainerType{storage.ContainerPublic, storage.ContainerPrivate} {
+		if err := s.findOrphans(ctx, container, opts, report); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.findDangling(ctx, opts, report); err != nil {
+		return nil, err
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	slog.InfoContext(ctx, "storage reconciliation finished", "component", "reconcile", "repair", opts.Repair,
+		"objects_scanned", report.ObjectsScanned, "files_scanned", report.FilesScanned,
+		"orphans", report.OrphansFound, "objects_deleted", report.ObjectsDeleted,
+		"dangling", report.DanglingFound, "files_deleted", report.FilesDeleted)
+	return report, nil
+}
+
+func (s *ReconcileService) findOrphans(ctx context.Context, container storage.ContainerType, opts ReconcileOptions, report *ReconcileReport) error {
+	cutoff := time.Now().Add(-opts.MinAge)
+	batch := make([]storage.ObjectInfo, 0, reconcileBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() { batch = batch[:0] }()
+
+		paths := make([]string, len(batch))
+		for i := range batch {
+			paths[i] = batch[i].Path
+		}
+		var known []string
+		if err := s.db.WithContext(ctx).Model(&models.File{}).Where("file_path IN ?", paths).Pluck("file_path", &known).Error; err != nil {
+			return err
+		}
+		referenced := make(map[string]struct{}, len(known))
+		for _, p := range known {
+			referenced[p] = struct{}{}
+		}
+
+		for _, obj := range batch {
+			if _, ok := referenced[obj.Path]; ok {
+				continue
+			}
+			orphan := OrphanObject{Container: obj.Container, Path: obj.Path, Size: obj.Size, LastModified: obj.LastModified}
+			if opts.Repair {
+				if err := s.storage.Delete(ctx, &storage.Location{Container: obj.Container, Path: obj.Path}); err != nil {
+					orphan.Error = err.Error()
+				} else {
+					orphan.Deleted = true
+					report.ObjectsDeleted++
+				}
+			}
+			report.OrphansFound++
+			report.OrphanBytes += obj.Size
+			report.addOrphan(orphan)
+		}
+		return nil
+	}
+
+	err := s.storage.List(ctx, container, func(obj storage.ObjectInfo) error {
+		report.ObjectsScanned++
+		if obj.LastModified.After(cutoff) {
+			report.ObjectsRecent++
+			return nil
+		}
+		batch = append(batch, obj)
+		if len(batch) == reconcileBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+func (s *ReconcileService) findDangling(ctx context.Context, opts ReconcileOptions, report *ReconcileReport) error {
+	lastID := uuid.Nil
+	for {
+		var files []models.File
+		err := s.db.WithContext(ctx).
+			Select("id", "file_name", "file_path", "owner_id", "is_public", "quarantined_at", "legal_hold").
+			Where("id > ? AND file_path <> ''", lastID).
+			Order("id ASC").
+			Limit(reconcileBatchSize).
+			Find(&files).Error
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		lastID = files[len(files)-1].ID
+
+		for i := range files {
+			report.FilesScanned++
+			missing, err := s.objectMissing(ctx, &files[i])
+			if err != nil {
+				return err
+			}
+			if !missing {
+				continue
+			}
+
+			dangling := DanglingFile{
+				FileID:    files[i].ID,
+				FileName:  files[i].FileName,
+				FilePath:  files[i].FilePath,
+				OwnerID:   files[i].OwnerID,
+				LegalHold: files[i].LegalHold,
+			}
+			if opts.Repair {
+				s.repairDangling(ctx, &dangling, report)
+			}
+			report.DanglingFound++
+			report.addDangling(dangling)
+		}
+	}
+}
+
+// objectMissing reports whether the file's object is absent from both containers; a row
+// whose object sits in the other container is misplaced, not dangling.
+func (s *ReconcileService) objectMissing(ctx context.Context, file *models.File) (bool, error) {
+	primary := containerFromFile(file)
+	for _, container := range []storage.ContainerType{primary, otherContainer(primary)} {
+		_, err := s.storage.Stat(ctx, &storage.Location{Container: container, Path: file.FilePath})
+		if err == nil {
+			return false, nil
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// repairDangling deletes the row after re-reading it, since a scan may have moved the
+// object (and updated file_path) after the row was listed.
+func (s *ReconcileService) repairDangling(ctx context.Context, dangling *DanglingFile, report *ReconcileReport) {
+	if dangling.LegalHold {
+		dangling.Error = "file is under legal hold"
+		return
+	}
+
+	var current models.File
+	if err := s.db.WithContext(ctx).First(&current, "id = ?", dangling.FileID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			dangling.Error = err.Error()
+		}
+		return
+	}
+	if current.FilePath != dangling.FilePath {
+		missing, err := s.objectMissing(ctx, &current)
+		if err != nil {
+			dangling.Error = err.Error()
+			return
+		}
+		if !missing {
+			dangling.Error = "object was moved during reconciliation"
+			return
+		}
+	}
+
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND file_path = ? AND legal_hold = ?", current.ID, current.FilePath, false).
+		Delete(&models.File{})
+	if result.Error != nil {
+		dangling.Error = result.Error.Error()
+		return
+	}
+	if result.RowsAffected == 0 {
+		dangling.Error = "file changed during reconciliation"
+		return
+	}
+	dangling.Deleted = true
+	report.FilesDeleted++
+}
+
+func (r *ReconcileReport) addOrphan(o OrphanObject) {
+	if len(r.OrphanObjects) >= maxReconcileReportEntries {
+		r.Truncated = true
+		return
+	}
+	r.OrphanObjects = append(r.OrphanObjects, o)
+}
+
+func (r *ReconcileReport) addDangling(d DanglingFile) {
+	if len(r.DanglingFiles) >= maxReconcileReportEntries {
+		r.Truncated = true
+		return
+	}
+	r.DanglingFiles = append(r.DanglingFiles, d)
+}
+
+func otherContainer(c storage.ContainerType) storage.ContainerType {
+	if c == storage.ContainerPublic {
+		return storage.ContainerPrivate
+	}
+	return storage.ContainerPublic
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+)
+
+// User-Agent fragments of link preview fetchers and crawlers that do not say "bot"
+var botAgentMarkers = []string{"bot", "spider", "crawl", "slurp", "facebookexternalhit", "whatsapp", "headlesschrome"}
+
+// User-Agent prefixes of command line tools and HTTP libraries
+var cliAgentPrefixes = []string{"curl/", "wget/", "python-requests/", "python-urllib/", "go-http-client/", "httpie/", "okhttp/", "axios/", "node-fetch/", "java/", "libwww-perl/", "powershell/", "aria2/"}
+
+var mobileAgentMarkers = []string{"mobile", "android", "iphone", "ipad"}
+
+// Search engines are matched by name in any label of the host (google.com, google.com.vn)
+var searchEngineNames = []string{"google", "bing", "duckduckgo", "yahoo", "baidu", "yandex", "coccoc"}
+
+// Social networks and messengers, matched as the host or a parent domain of it
+var socialDomains = []string{"facebook.com", "fb.com", "messenger.com", "instagram.com", "t.co", "twitter.com", "x.com",
+	"linkedin.com", "lnkd.in", "reddit.com", "youtube.com", "tiktok.com", "zalo.me", "t.me", "telegram.org", "discord.com", "slack.com"}
+
+// ClassifyClient returns the category of the client that sent userAgent.
+func ClassifyClient(userAgent string) models.ClientCategory {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return models.ClientUnknown
+	}
+	for _, marker := range botAgentMarkers {
+		if strings.Contains(ua, marker) {
+			return models.ClientBot
+		}
+	}
+	for _, prefix := range cliAgentPrefixes {
+		if strings.HasPrefix(ua, prefix) {
+			return models.ClientCLI
+		}
+	}
+	if !strings.HasPrefix(ua, "mozilla/") {
+		return models.ClientOther
+	}
+	for _, marker := range mobileAgentMarkers {
+		if strings.Contains(ua, marker) {
+			return models.ClientMobile
+		}
+	}
+	return models.ClientBrowser
+}
+
+// ClassifyReferrer returns where a request with the given Referer header came from. Links
+// from one of internalHosts (the API itself, the web frontend) are internal.
+func ClassifyReferrer(referrer string, internalHosts ...string) models.ReferrerCategory {
+	if strings.TrimSpace(referrer) == "" {
+		return models.ReferrerDirect
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return models.ReferrerUnknown
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, internal := range internalHosts {
+		if host == strings.ToLower(hostOnly(internal)) {
+			return models.ReferrerInternal
+		}
+	}
+	for _, label := range strings.Split(host, ".") {
+		for _, name := range searchEngineNames {
+			if label == name {
+				return models.ReferrerSearch
+			}
+		}
+	}
+	for _, domain := range socialDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return models.ReferrerSocial
+		}
+	}
+	return models.ReferrerExternal
+}
+
+// hostOnly strips the port from a host[:port] value.
+func hostOnly(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
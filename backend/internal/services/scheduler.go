@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/tracing"
+	"github.com/robfig/cron/v3"
+)
+
+// CronScheduler runs a job on a cron schedule on exactly one replica: every tick, the
+// replica first makes sure it holds the leader lock and skips the job otherwise. A
+// leader keeps the lock between ticks, so leadership only moves when it goes away.
+type CronScheduler struct {
+	name     string
+	schedule cron.Schedule
+	leader   Locker
+	job      func(ctx context.Context)
+
+	mu      sync.Mutex
+	cron    *cron.Cron
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// NewCronScheduler validates spec, a standard 5-field expression or a descriptor such
+// as "@daily" or "@every 1h".
+func NewCronScheduler(name, spec string, leader Locker, job func(ctx context.Context)) (*CronScheduler, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s scheduler: invalid cron expression %q: %w", name, spec, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CronScheduler{
+		name:     name,
+		schedule: schedule,
+		leader:   leader,
+		job:      job,
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Start begins firing ticks in the background.
+func (s *CronScheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cron != nil {
+		return
+	}
+	s.cron = cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.PrintfLogger(slog.NewLogLogger(slog.Default().Handler(), slog.LevelInfo)))))
+	s.cron.Schedule(s.schedule, cron.FuncJob(func() { s.Tick(s.ctx) }))
+	s.cron.Start()
+	slog.Info("job scheduled", "component", "scheduler", "job", s.name, "next_run", s.Next(time.Now()))
+}
+
+// Stop stops firing ticks, cancels and waits for a running job, then gives up leadership.
+func (s *CronScheduler) Stop() {
+	s.mu.Lock()
+	if s.cron != nil {
+		<-s.cron.Stop().Done()
+		s.cron = nil
+	}
+	s.mu.Unlock()
+
+	s.cancel()
+	s.running.Wait()
+	if err := s.leader.Unlock(context.Background()); err != nil {
+		slog.Error("releasing leadership failed", "component", "scheduler", "job", s.name, "error", err)
+	}
+}
+
+// Next returns the first scheduled time after t.
+func (s *CronScheduler) Next(t time.Time) time.Time {
+	return s.schedule.Next(t)
+}
+
+// Tick runs the job now if this replica is (or becomes) the leader, and reports whether
+// it ran. Start calls it on schedule.
+func (s *CronScheduler) Tick(ctx context.Context) bool {
+	leader, err := s.leader.TryLock(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "leader election failed", "component", "scheduler", "job", s.name, "error", err)
+		return false
+	}
+	if !leader {
+		return false
+	}
+
+	s.running.Add(1)
+	defer s.running.Done()
+	ctx, span := tracing.Tracer().Start(ctx, "cron "+s.name)
+	defer span.End()
+	s.job(ctx)
+	return true
+}
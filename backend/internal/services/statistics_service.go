@@ -1,8 +1,6 @@
 package services
 
 import (
-	"time"
-
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
 	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
 	"github.com/google/uuid"
@@ -11,6 +9,8 @@ import (
 
 var _ repositories.StatisticsRepository = (*StatisticsService)(nil)
 
+// StatisticsService reads and maintains file statistics. The download and preview counters
+// are only updated by FileEventService, so concurrent transfers are never lost.
 type StatisticsService struct {
 	db *gorm.DB
 }
@@ -37,30 +37,6 @@ func (s *StatisticsService) Update(stats *models.FileStatistics) error {
 	return s.db.Save(stats).Error
 }
 
-// Hàm này sẽ được gọi bên trong API Download
-func (s *StatisticsService) IncrementDownloadCount(fileID uuid.UUID) error {
-	// Dùng SQL raw hoặc GORM update expression để tránh race condition
-	return s.db.Model(&models.FileStatistics{}).
-		Where("file_id = ?", fileID).
-		UpdateColumn("download_count", gorm.Expr("download_count + ?", 1)).
-		Error
-}
-
-func (s *StatisticsService) IncrementUniqueDownloaders(fileID uuid.UUID) error {
-	return s.db.Model(&models.FileStatistics{}).
-		Where("file_id = ?", fileID).
-		UpdateColumn("unique_downloaders", gorm.Expr("unique_downloaders + ?", 1)).
-		Error
-}
-
-func (s *StatisticsService) UpdateLastDownloadedAt(fileID uuid.UUID) error {
-	now := time.Now()
-	return s.db.Model(&models.FileStatistics{}).
-		Where("file_id = ?", fileID).
-		Update("last_downloaded_at", now).
-		Error
-}
-
 func (s *StatisticsService) GetByFileIDs(fileIDs []uuid.UUID) ([]models.FileStatistics, error) {
 	var stats []models.FileStatistics
 	err := s.db.Where("file_id IN ?", fileIDs).Find(&stats).Error
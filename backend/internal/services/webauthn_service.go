@@ -0,0 +1,475 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebAuthnSessionExpired        = errors.New("webauthn session expired")
+	ErrWebAuthnVerificationFailed    = errors.New("webauthn verification failed")
+	ErrWebAuthnCredentialNotFound    = errors.New("webauthn credential not found")
+	ErrWebAuthnNoCredentials         = errors.New("no webauthn credentials registered")
+	ErrWebAuthnCloneDetected         = errors.New("webauthn authenticator may be cloned")
+	ErrWebAuthnInvalidCredentialName = errors.New("credential name must be 1-100 characters")
+)
+
+const maxWebAuthnCredentialName = 100
+
+type WebAuthnService struct {
+	webAuthn         *webauthn.WebAuthn
+	userRepo         repositories.UserRepository
+	credentialRepo   repositories.WebAuthnCredentialRepository
+	sessionRepo      repositories.WebAuthnSessionRepository
+	loginSessionRepo repositories.LoginSessionRepository
+	ceremonyTTL      time.Duration
+}
+
+func NewWebAuthnService(
+	cfg *config.Config,
+	userRepo repositories.UserRepository,
+	credentialRepo repositories.WebAuthnCredentialRepository,
+	sessionRepo repositories.WebAuthnSessionRepository,
+	loginSessionRepo repositories.LoginSessionRepository,
+) (*WebAuthnService, error) {
+	displayName := cfg.WebAuthn.RPDisplayName
+	if displayName == "" {
+		displayName = cfg.TOTP.Issuer
+	}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: displayName,
+		RPOrigins:     cfg.WebAuthn.RPOrigins,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn config: %w", err)
+	}
+
+	return &WebAuthnService{
+		webAuthn:         wa,
+		userRepo:         userRepo,
+		credentialRepo:   credentialRepo,
+		sessionRepo:      sessionRepo,
+		loginSessionRepo: loginSessionRepo,
+		ceremonyTTL:      5 * time.Minute,
+	}, nil
+}
+
+// webAuthnUser adapts a user and its stored credentials to webauthn.User.
+// The user handle is the raw 16 bytes of the user ID.
+type webAuthnUser struct {
+	user        *models.User
+	credentials []models.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	id := u.user.ID
+	return id[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(u.credentials))
+	for i := range u.credentials {
+		creds = append(creds, toLibraryCredential(&u.credentials[i]))
+	}
+	return creds
+}
+
+func (u *webAuthnUser) find(credentialID []byte) *models.WebAuthnCredential {
+	for i := range u.credentials {
+		if bytes.Equal(u.credentials[i].CredentialID, credentialID) {
+			return &u.credentials[i]
+		}
+	}
+	return nil
+}
+
+func toLibraryCredential(c *models.WebAuthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+	for _, t := range c.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(t))
+	}
+	return webauthn.Credential{
+		ID:              c.CredentialID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    true,
+			BackupEligible: c.BackupEligible,
+			BackupState:    c.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       c.AAGUID,
+			SignCount:    uint32(c.SignCount),
+			CloneWarning: c.CloneWarning,
+		},
+	}
+}
+
+func (s *WebAuthnService) loadUser(userID uuid.UUID) (*webAuthnUser, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidCredentials
+	}
+	credentials, err := s.credentialRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// HasCredentials reports whether the user can use WebAuthn as a second factor.
+func (s *WebAuthnService) HasCredentials(userID uuid.UUID) (bool, error) {
+	count, err := s.credentialRepo.CountByUserID(userID)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BeginRegistration starts registering a new authenticator for a logged-in user.
+// Returns the options to pass to navigator.credentials.create() and the ceremony session ID.
+func (s *WebAuthnService) BeginRegistration(userID uuid.UUID) (*protocol.CredentialCreation, uuid.UUID, error) {
+	u, err := s.loadUser(userID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(u.credentials))
+	for _, cred := range u.WebAuthnCredentials() {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+
+	creation, data, err := s.webAuthn.BeginRegistration(u,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	sessionID, err := s.saveSession(&userID, models.WebAuthnCeremonyRegistration, data)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return creation, sessionID, nil
+}
+
+// FinishRegistration verifies the attestation response and stores the new credential under the given name.
+func (s *WebAuthnService) FinishRegistration(userID, sessionID uuid.UUID, name string, response []byte) (*models.WebAuthnCredential, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxWebAuthnCredentialName {
+		return nil, ErrWebAuthnInvalidCredentialName
+	}
+
+	data, err := s.consumeSession(sessionID, models.WebAuthnCeremonyRegistration, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+	cred, err := s.webAuthn.CreateCredential(u, *data, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+
+	transports := make(models.StringArray, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+	credential := &models.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       int64(cred.Authenticator.SignCount),
+		Transports:      transports,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now().UTC(),
+	}
+	if err := s.credentialRepo.Create(credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (s *WebAuthnService) ListCredentials(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	return s.credentialRepo.GetByUserID(userID)
+}
+
+func (s *WebAuthnService) RenameCredential(userID, credentialID uuid.UUID, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxWebAuthnCredentialName {
+		return ErrWebAuthnInvalidCredentialName
+	}
+	if err := s.credentialRepo.UpdateName(credentialID, userID, name); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWebAuthnCredentialNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *WebAuthnService) DeleteCredential(userID, credentialID uuid.UUID) error {
+	if err := s.credentialRepo.Delete(credentialID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWebAuthnCredentialNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// BeginSecondFactor starts a WebAuthn assertion for the login session (cid) returned
+// by the password step, as an alternative to submitting a TOTP code.
+func (s *WebAuthnService) BeginSecondFactor(cid uuid.UUID) (*protocol.CredentialAssertion, uuid.UUID, error) {
+	session, err := s.activeLoginSession(cid)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	u, err := s.loadUser(session.UserID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if len(u.credentials) == 0 {
+		return nil, uuid.Nil, ErrWebAuthnNoCredentials
+	}
+
+	assertion, data, err := s.webAuthn.BeginLogin(u)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	sessionID, err := s.saveSession(&session.UserID, models.WebAuthnCeremonyLogin, data)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return assertion, sessionID, nil
+}
+
+// FinishSecondFactor verifies the assertion and consumes the login session on success.
+func (s *WebAuthnService) FinishSecondFactor(cid, sessionID uuid.UUID, response []byte) (_ *models.User, err error) {
+	defer func() { recordAuthFailure("webauthn", err) }()
+
+	session, err := s.activeLoginSession(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.consumeSession(sessionID, models.WebAuthnCeremonyLogin, &session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.loadUser(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if u.user.IsLocked(now) {
+		_ = s.loginSessionRepo.MarkConsumed(session.ID, now)
+		return nil, &AccountLockedError{Until: *u.user.LockedUntil}
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+	cred, err := s.webAuthn.ValidateLogin(u, *data, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+	if err := s.recordAssertion(u, cred, now); err != nil {
+		return nil, err
+	}
+
+	if err := s.loginSessionRepo.MarkConsumed(session.ID, now); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLoginSessionExpired
+		}
+		return nil, err
+	}
+	return u.user, nil
+}
+
+// BeginPasswordless starts a discoverable-credential (passkey) login without a username or password.
+func (s *WebAuthnService) BeginPasswordless() (*protocol.CredentialAssertion, uuid.UUID, error) {
+	assertion, data, err := s.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	sessionID, err := s.saveSession(nil, models.WebAuthnCeremonyPasskey, data)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return assertion, sessionID, nil
+}
+
+// FinishPasswordless resolves the user from the passkey's user handle and verifies the assertion.
+// User verification is required, so the passkey alone satisfies both factors.
+func (s *WebAuthnService) FinishPasswordless(sessionID uuid.UUID, response []byte) (_ *models.User, err error) {
+	defer func() { recordAuthFailure("webauthn", err) }()
+
+	data, err := s.consumeSession(sessionID, models.WebAuthnCeremonyPasskey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+
+	var resolved *webAuthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		u, err := s.loadUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		if u.find(rawID) == nil {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		resolved = u
+		return u, nil
+	}
+
+	cred, err := s.webAuthn.ValidateDiscoverableLogin(handler, *data, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+
+	now := time.Now().UTC()
+	if resolved.user.IsLocked(now) {
+		return nil, &AccountLockedError{Until: *resolved.user.LockedUntil}
+	}
+	if err := s.recordAssertion(resolved, cred, now); err != nil {
+		return nil, err
+	}
+	return resolved.user, nil
+}
+
+// recordAssertion persists the new signature counter and last use. A counter that did not
+// increase flags the credential as possibly cloned, and the login is rejected.
+func (s *WebAuthnService) recordAssertion(u *webAuthnUser, cred *webauthn.Credential, now time.Time) error {
+	stored := u.find(cred.ID)
+	if stored == nil {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	if cred.Authenticator.CloneWarning {
+		if !stored.CloneWarning {
+			stored.CloneWarning = true
+			if err := s.credentialRepo.UpdateAfterLogin(stored); err != nil {
+				return err
+			}
+		}
+		return ErrWebAuthnCloneDetected
+	}
+
+	stored.SignCount = int64(cred.Authenticator.SignCount)
+	stored.BackupState = cred.Flags.BackupState
+	stored.LastUsedAt = &now
+	return s.credentialRepo.UpdateAfterLogin(stored)
+}
+
+func (s *WebAuthnService) activeLoginSession(cid uuid.UUID) (*models.LoginSession, error) {
+	session, err := s.loginSessionRepo.GetActiveByID(cid, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLoginSessionExpired
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *WebAuthnService) saveSession(userID *uuid.UUID, ceremony string, data *webauthn.SessionData) (uuid.UUID, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	now := time.Now().UTC()
+	// Abandoned ceremonies are cleaned up opportunistically.
+	_ = s.sessionRepo.DeleteExpired(now)
+
+	session := &models.WebAuthnSession{
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Data:      string(raw),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ceremonyTTL),
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return uuid.Nil, err
+	}
+	return session.ID, nil
+}
+
+// consumeSession loads and deletes the ceremony session. When userID is set, the session
+// must belong to that user.
+func (s *WebAuthnService) consumeSession(id uuid.UUID, ceremony string, userID *uuid.UUID) (*webauthn.SessionData, error) {
+	session, err := s.sessionRepo.Consume(id, ceremony, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnSessionExpired
+		}
+		return nil, err
+	}
+	if userID != nil && (session.UserID == nil || *session.UserID != *userID) {
+		return nil, ErrWebAuthnSessionExpired
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal([]byte(session.Data), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 )
 
 type AzureBlobStorage struct {
@@ -109,12 +110,99 @@ func (s *AzureBlobStorage) Delete(ctx context.Context, loc *Location) error {
 	if err != nil {
 		return err
 	}
-	if _, err := s.client.DeleteBlob(ctx, container, loc.Path, nil); err != nil {
+	// A blob that is already gone counts as deleted, matching LocalStorage.
+	if _, err := s.client.DeleteBlob(ctx, container, loc.Path, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
 		return fmt.Errorf("azure blob: delete failed: %w", err)
 	}
 	return nil
 }
 
+func (s *AzureBlobStorage) Stat(ctx context.Context, loc *Location) (*ObjectInfo, error) {
+	if err := ValidateLocation(loc); err != nil {
+		return nil, err
+	}
+	container, err := s.containerName(loc.Container)
+	if err != nil {
+		return nil, err
+	}
+	props, err := s.client.ServiceClient().NewContainerClient(container).NewBlobClient(loc.Path).GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("azure blob: stat failed: %w", err)
+	}
+
+	info := &ObjectInfo{Container: loc.Container, Path: loc.Path}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.ContentType != nil {
+		info.ContentType = *props.ContentType
+	}
+	if props.LastModified != nil {
+		info.LastModified = *props.LastModified
+	}
+	return info, nil
+}
+
+func (s *AzureBlobStorage) List(ctx context.Context, ct ContainerType, fn func(ObjectInfo) error) error {
+	container, err := s.containerName(ct)
+	if err != nil {
+		return err
+	}
+	pager := s.client.NewListBlobsFlatPager(container, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("azure blob: list failed: %w", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item == nil || item.Name == nil {
+				continue
+			}
+			info := ObjectInfo{Container: ct, Path: *item.Name}
+			if p := item.Properties; p != nil {
+				if p.ContentLength != nil {
+					info.Size = *p.ContentLength
+				}
+				if p.ContentType != nil {
+					info.ContentType = *p.ContentType
+				}
+				if p.LastModified != nil {
+					info.LastModified = *p.LastModified
+				}
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Probe reads the properties of each configured container, which fails when the account is
+// unreachable, the credentials are wrong or a container is missing.
+func (s *AzureBlobStorage) Probe(ctx context.Context) error {
+	probed := 0
+	for _, container := range []string{s.publicContainer, s.privateContainer} {
+		if container == "" {
+			continue
+		}
+		if _, err := s.client.ServiceClient().NewContainerClient(container).GetProperties(ctx, nil); err != nil {
+			if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+				return fmt.Errorf("azure blob: container %q not found", container)
+			}
+			return fmt.Errorf("azure blob: probe failed: %w", err)
+		}
+		probed++
+	}
+	if probed == 0 {
+		return fmt.Errorf("azure blob: no container configured")
+	}
+	return nil
+}
+
 func (s *AzureBlobStorage) containerName(ct ContainerType) (string, error) {
 	switch ct {
 	case ContainerPublic:
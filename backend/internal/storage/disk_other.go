@@ -0,0 +1,10 @@
+//go:build !unix
+
+package storage
+
+import "errors"
+
+// DiskUsage is not implemented on this platform.
+func (s *LocalStorage) DiskUsage() (*DiskUsage, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package storage
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// DiskUsage reports the space of the filesystem holding the base path.
+func (s *LocalStorage) DiskUsage() (*DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(s.basePath, &st); err != nil {
+		return nil, fmt.Errorf("local storage: statfs failed: %w", err)
+	}
+	return &DiskUsage{
+		TotalBytes: uint64(st.Blocks) * uint64(st.Bsize),
+		FreeBytes:  uint64(st.Bavail) * uint64(st.Bsize),
+	}, nil
+}
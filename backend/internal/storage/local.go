@@ -2,8 +2,10 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -92,6 +94,85 @@ func (s *LocalStorage) Delete(ctx context.Context, loc *Location) error {
 	return nil
 }
 
+func (s *LocalStorage) Stat(ctx context.Context, loc *Location) (*ObjectInfo, error) {
+	if err := ValidateLocation(loc); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(filepath.Join(s.basePath, filepath.FromSlash(loc.Path)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("local storage: stat failed: %w", err)
+	}
+	if info.IsDir() {
+		return nil, ErrObjectNotFound
+	}
+	return &ObjectInfo{
+		Container:    loc.Container,
+		Path:         loc.Path,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, container ContainerType, fn func(ObjectInfo) error) error {
+	if !container.IsValid() {
+		return fmt.Errorf("%w: invalid container %q", ErrInvalidLocation, container)
+	}
+	root := filepath.Join(s.basePath, container.String())
+	err := filepath.WalkDir(root, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && fullPath == root {
+				// Nothing uploaded to this container yet.
+				return fs.SkipDir
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.basePath, fullPath)
+		if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{
+			Container:    container,
+			Path:         filepath.ToSlash(rel),
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("local storage: list failed: %w", err)
+	}
+	return nil
+}
+
+// Probe creates and removes a temporary file under the base path, creating the base path
+// first like Upload does.
+func (s *LocalStorage) Probe(ctx context.Context) error {
+	if err := os.MkdirAll(s.basePath, 0o755); err != nil {
+		return fmt.Errorf("local storage: base path unavailable: %w", err)
+	}
+	probe, err := os.CreateTemp(s.basePath, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("local storage: base path not writable: %w", err)
+	}
+	probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("local storage: removing probe file failed: %w", err)
+	}
+	return nil
+}
+
 func (s *LocalStorage) safeRelativePath(name string) (string, error) {
 	clean := filepath.Clean(name)
 	if clean == "." || clean == "/" {
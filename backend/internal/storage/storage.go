@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 )
 
 // Sentinel errors to help callers distinguish failure reasons.
 var (
 	ErrInvalidObject   = errors.New("storage: invalid object")
 	ErrInvalidLocation = errors.New("storage: invalid location")
+	ErrObjectNotFound  = errors.New("storage: object not found")
 )
 
 type ContainerType string
@@ -56,11 +58,38 @@ type DownloadResult struct {
 	Size        int64
 }
 
+// ObjectInfo describes a stored object without reading its content.
+// Path has the same form as Location.Path returned by Upload.
+type ObjectInfo struct {
+	Container    ContainerType
+	Path         string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// DiskUsage describes the filesystem holding a backend's files.
+type DiskUsage struct {
+	TotalBytes uint64
+	FreeBytes  uint64 // available to the server process
+}
+
+// DiskSpaceReporter is implemented by backends that store files on a local filesystem.
+type DiskSpaceReporter interface {
+	DiskUsage() (*DiskUsage, error)
+}
+
 // Storage describes the basic operations supported by every storage backend we implement.
 type Storage interface {
 	Upload(ctx context.Context, obj *Object) (*Location, error)
 	Download(ctx context.Context, loc *Location) (*DownloadResult, error)
 	Delete(ctx context.Context, loc *Location) error
+	// Stat returns ErrObjectNotFound when nothing is stored at loc.
+	Stat(ctx context.Context, loc *Location) (*ObjectInfo, error)
+	// List calls fn for every object in the container; an error from fn stops the listing.
+	List(ctx context.Context, container ContainerType, fn func(ObjectInfo) error) error
+	// Probe checks that the backend is reachable and writable without touching stored objects.
+	Probe(ctx context.Context) error
 }
 
 // ValidateObject performs a light validation of the input object before delegating to providers.
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// InstrumentGORM records a client span for each statement db runs with a context that
+// already carries a span (db.WithContext(ctx) inside a traced request or job). Queries
+// without one are not traced, so context-less lookups do not each start a trace of their
+// own. Only the parameterised SQL is recorded, never the values.
+func InstrumentGORM(db *gorm.DB) error {
+	cb := db.Callback()
+	register := func(op string, before, after func(string, func(*gorm.DB)) error) error {
+		if err := before("tracing:before_"+op, startGORMSpan); err != nil {
+			return err
+		}
+		return after("tracing:after_"+op, endGORMSpan)
+	}
+	return errors.Join(
+		register("create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register),
+		register("query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register),
+		register("update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register),
+		register("delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register),
+		register("row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register),
+		register("raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register),
+	)
+}
+
+func startGORMSpan(tx *gorm.DB) {
+	ctx := tx.Statement.Context
+	if ctx == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return
+	}
+	_, span := Tracer().Start(ctx, "db", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNamePostgreSQL))
+	tx.InstanceSet(gormSpanKey, span)
+}
+
+func endGORMSpan(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	query := tx.Statement.SQL.String()
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	operation = strings.ToUpper(operation)
+	name := operation
+	if table := tx.Statement.Table; table != "" {
+		name += " " + table
+		span.SetAttributes(semconv.DBCollectionName(table))
+	}
+	if name != "" {
+		span.SetName(name)
+	}
+	span.SetAttributes(
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(query),
+		semconv.DBResponseReturnedRows(int(tx.Statement.RowsAffected)),
+	)
+	if err := tx.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
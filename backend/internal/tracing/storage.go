@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStorage records a client span for every call to the wrapped backend.
+type tracedStorage struct {
+	next    storage.Storage
+	backend string
+}
+
+// InstrumentStorage wraps st so each storage.Storage method gets a span labelled with the
+// backend (e.g. "local", "azure_blob"). Unlike the metrics wrapper, the Download span lasts
+// until the returned stream is closed, so it includes the time spent reading the object.
+func InstrumentStorage(st storage.Storage, backend string) storage.Storage {
+	return &tracedStorage{next: st, backend: backend}
+}
+
+func (s *tracedStorage) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("storage.backend", s.backend), attribute.String("storage.operation", operation))
+	return Tracer().Start(ctx, "storage."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// finish ends span, marking it failed unless err is nil or a plain "not found".
+func finish(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func locationAttrs(loc *storage.Location) []attribute.KeyValue {
+	if loc == nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		attribute.String("storage.container", loc.Container.String()),
+		attribute.String("storage.path", loc.Path),
+	}
+}
+
+func (s *tracedStorage) Upload(ctx context.Context, obj *storage.Object) (*storage.Location, error) {
+	var attrs []attribute.KeyValue
+	if obj != nil {
+		attrs = append(attrs, attribute.String("storage.container", obj.Container.String()), attribute.Int64("storage.size", obj.Size))
+	}
+	ctx, span := s.start(ctx, "upload", attrs...)
+	loc, err := s.next.Upload(ctx, obj)
+	if loc != nil {
+		span.SetAttributes(attribute.String("storage.path", loc.Path))
+	}
+	finish(span, err)
+	return loc, err
+}
+
+func (s *tracedStorage) Download(ctx context.Context, loc *storage.Location) (*storage.DownloadResult, error) {
+	ctx, span := s.start(ctx, "download", locationAttrs(loc)...)
+	res, err := s.next.Download(ctx, loc)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("storage.size", res.Size))
+	res.Reader = &tracedReader{ReadCloser: res.Reader, span: span}
+	return res, nil
+}
+
+func (s *tracedStorage) Delete(ctx context.Context, loc *storage.Location) error {
+	ctx, span := s.start(ctx, "delete", locationAttrs(loc)...)
+	err := s.next.Delete(ctx, loc)
+	finish(span, err)
+	return err
+}
+
+func (s *tracedStorage) Stat(ctx context.Context, loc *storage.Location) (*storage.ObjectInfo, error) {
+	ctx, span := s.start(ctx, "stat", locationAttrs(loc)...)
+	info, err := s.next.Stat(ctx, loc)
+	finish(span, err)
+	return info, err
+}
+
+func (s *tracedStorage) List(ctx context.Context, container storage.ContainerType, fn func(storage.ObjectInfo) error) error {
+	ctx, span := s.start(ctx, "list", attribute.String("storage.container", container.String()))
+	listed := 0
+	err := s.next.List(ctx, container, func(info storage.ObjectInfo) error {
+		listed++
+		return fn(info)
+	})
+	span.SetAttributes(attribute.Int("storage.objects", listed))
+	finish(span, err)
+	return err
+}
+
+func (s *tracedStorage) Probe(ctx context.Context) error {
+	ctx, span := s.start(ctx, "probe")
+	err := s.next.Probe(ctx)
+	finish(span, err)
+	return err
+}
+
+// tracedReader ends the download span when the stream is closed, recording how much of
+// the object was read and the first read error.
+type tracedReader struct {
+	io.ReadCloser
+	span    trace.Span
+	read    int64
+	readErr error
+	closed  bool
+}
+
+func (r *tracedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if err != nil && err != io.EOF && r.readErr == nil {
+		r.readErr = err
+	}
+	return n, err
+}
+
+func (r *tracedReader) Close() error {
+	err := r.ReadCloser.Close()
+	if !r.closed {
+		r.closed = true
+		r.span.SetAttributes(attribute.Int64("storage.bytes_read", r.read))
+		finish(r.span, errors.Join(r.readErr, err))
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+// Package tracing records OpenTelemetry spans for HTTP requests, database queries and
+// storage calls, so a slow request can be broken down by where its time went. W3C trace
+// context is read from incoming requests; spans are exported over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/dath-251-thuanle/file-sharing-be-web"
+	defaultServiceName  = "file-sharing-backend"
+)
+
+// Tracer returns the tracer of the global provider. It is looked up on every call so spans
+// follow the provider installed by Setup (or by a test) at any time.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup installs the W3C trace context propagator and, for the "otlp" exporter, a tracer
+// provider sending spans to cfg.Endpoint. With the default "none" exporter the global
+// provider stays a no-op, so instrumentation costs next to nothing. The returned function
+// flushes buffered spans and must be called on shutdown.
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q (want none or otlp)", cfg.Exporter)
+	}
+
+	// Without an endpoint the exporter falls back to OTEL_EXPORTER_OTLP_* or localhost:4318
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: create otlp exporter: %w", err)
+	}
+
+	provider, err := NewProvider(cfg, sdktrace.WithBatcher(exporter))
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider builds a tracer provider with the service resource and sampler of cfg.
+// Tests pass sdktrace.WithSyncer(tracetest.NewInMemoryExporter()) to inspect spans.
+func NewProvider(cfg config.TracingConfig, opts ...sdktrace.TracerProviderOption) (*sdktrace.TracerProvider, error) {
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("tracing: sample_ratio must be between 0 and 1, got %v", ratio)
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: build resource: %w", err)
+	}
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		// Callers that already decided to sample (or not) through traceparent are followed
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}, opts...)
+	return sdktrace.NewTracerProvider(opts...), nil
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS security_events;
+
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_failed_attempts;
@@ -0,0 +1,18 @@
+-- Track consecutive TOTP failures across login sessions and temporary account lockouts
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_failed_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
+
+-- Create security_events table
+-- Security-relevant events (failed TOTP attempts, lockouts) the user can review
+-- API endpoint: GET /user/security-events
+CREATE TABLE IF NOT EXISTS security_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,           -- totp_failed, login_session_locked, account_locked, login_blocked
+    ip_address VARCHAR(64),
+    user_agent VARCHAR(255),
+    details VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user_created ON security_events(user_id, created_at DESC);
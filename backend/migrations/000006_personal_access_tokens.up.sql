@@ -0,0 +1,16 @@
+-- Create personal_access_tokens table
+-- Named, scoped, expiring tokens for scripts/CI; only the SHA-256 hash of the token is stored
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,        -- hex SHA-256 of the full token
+    token_prefix VARCHAR(16) NOT NULL,             -- first characters, to help users identify tokens
+    scopes JSONB NOT NULL DEFAULT '[]'::jsonb,     -- e.g. ["files:read", "files:write"]
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
@@ -0,0 +1,13 @@
+-- Create jwt_signing_keys table
+-- Asymmetric keys used to sign access tokens (RS256/EdDSA), identified by the JWT "kid" header.
+-- Retired keys stop signing but keep verifying until expires_at (retirement + access token lifetime).
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,                -- RS256 or EdDSA
+    private_key TEXT NOT NULL,                     -- PKCS#8 PEM; public key is derived from it
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    retired_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_jwt_signing_keys_expires_at ON jwt_signing_keys(expires_at);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS admin_audit_logs;
+
+-- Postgres cannot drop enum values, so recreate user_role without moderator/auditor
+UPDATE users SET role = 'user' WHERE role IN ('moderator', 'auditor');
+ALTER TYPE user_role RENAME TO user_role_old;
+CREATE TYPE user_role AS ENUM ('user', 'admin');
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN role TYPE user_role USING role::text::user_role;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+DROP TYPE user_role_old;
@@ -0,0 +1,23 @@
+-- Finer-grained staff roles for the admin API (see models.RolePermissions)
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'moderator';
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'auditor';
+
+-- Create admin_audit_logs table
+-- Every admin API action, attributed to the staff user (or to the bootstrap token / cron)
+-- API endpoint: GET /admin/audit-log
+CREATE TABLE IF NOT EXISTS admin_audit_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    actor_type VARCHAR(20) NOT NULL,               -- user, admin_token, cron
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    actor_email VARCHAR(255),                      -- kept when the user is deleted
+    actor_role VARCHAR(20),
+    action VARCHAR(50) NOT NULL,                   -- e.g. policy.update, cleanup.run
+    target_type VARCHAR(50),
+    target_id VARCHAR(100),
+    details TEXT,
+    ip_address VARCHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_logs_created_at ON admin_audit_logs(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_logs_actor_id ON admin_audit_logs(actor_id);
@@ -0,0 +1,5 @@
+-- Admin user management: suspension and forced logout
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_reason VARCHAR(255);
+-- Access tokens issued at or before this time are rejected (force logout)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sessions_revoked_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,4 @@
+ALTER TABLE files DROP COLUMN IF EXISTS legal_hold_at;
+ALTER TABLE files DROP COLUMN IF EXISTS legal_hold_reason;
+ALTER TABLE files DROP COLUMN IF EXISTS legal_hold;
+ALTER TABLE files DROP COLUMN IF EXISTS share_disabled_at;
@@ -0,0 +1,6 @@
+-- Admin file moderation: disabled share links and legal hold
+ALTER TABLE files ADD COLUMN IF NOT EXISTS share_disabled_at TIMESTAMP WITH TIME ZONE;
+-- Files under legal hold cannot be deleted by their owner, admins or the cleanup job
+ALTER TABLE files ADD COLUMN IF NOT EXISTS legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS legal_hold_reason VARCHAR(255);
+ALTER TABLE files ADD COLUMN IF NOT EXISTS legal_hold_at TIMESTAMP WITH TIME ZONE;
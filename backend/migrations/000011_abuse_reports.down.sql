@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_abuse_reports_file_id;
+DROP INDEX IF EXISTS idx_abuse_reports_status_created_at;
+DROP TABLE IF EXISTS abuse_reports;
+
+ALTER TABLE files DROP COLUMN IF EXISTS takedown_reason;
+ALTER TABLE files DROP COLUMN IF EXISTS taken_down_at;
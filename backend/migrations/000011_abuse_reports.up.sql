@@ -0,0 +1,23 @@
+-- Takedown of files reported for abuse; taken-down share links answer 451
+ALTER TABLE files ADD COLUMN IF NOT EXISTS taken_down_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS takedown_reason VARCHAR(255);
+
+-- Abuse reports submitted anonymously through a share link
+CREATE TABLE IF NOT EXISTS abuse_reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    reason VARCHAR(30) NOT NULL
+        CHECK (reason IN ('malware', 'copyright', 'illegal', 'harassment', 'spam', 'other')),
+    details TEXT,
+    contact_email VARCHAR(255),
+    reporter_ip VARCHAR(64),
+    status VARCHAR(20) NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'dismissed', 'actioned')),
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    resolution_note VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_abuse_reports_status_created_at ON abuse_reports(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_abuse_reports_file_id ON abuse_reports(file_id);
@@ -0,0 +1,3 @@
+ALTER TABLE system_policy DROP COLUMN IF EXISTS blocked_extensions;
+ALTER TABLE system_policy DROP COLUMN IF EXISTS blocked_mime_types;
+ALTER TABLE system_policy DROP COLUMN IF EXISTS allowed_mime_types;
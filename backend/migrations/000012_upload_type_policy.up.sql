@@ -0,0 +1,6 @@
+-- Upload type rules checked against the sniffed MIME type; executables blocked by default
+ALTER TABLE system_policy ADD COLUMN IF NOT EXISTS allowed_mime_types JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE system_policy ADD COLUMN IF NOT EXISTS blocked_mime_types JSONB NOT NULL
+    DEFAULT '["application/vnd.microsoft.portable-executable", "application/x-elf", "application/x-mach-binary", "application/x-ms-installer"]'::jsonb;
+ALTER TABLE system_policy ADD COLUMN IF NOT EXISTS blocked_extensions JSONB NOT NULL
+    DEFAULT '[".exe", ".dll", ".msi", ".scr", ".com", ".bat", ".cmd", ".ps1", ".vbs"]'::jsonb;
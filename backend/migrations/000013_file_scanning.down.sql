@@ -0,0 +1,7 @@
+ALTER TABLE system_policy DROP COLUMN IF EXISTS scan_download_policy;
+
+DROP INDEX IF EXISTS idx_files_scan_pending;
+ALTER TABLE files DROP COLUMN IF EXISTS quarantined_at;
+ALTER TABLE files DROP COLUMN IF EXISTS scanned_at;
+ALTER TABLE files DROP COLUMN IF EXISTS scan_signature;
+ALTER TABLE files DROP COLUMN IF EXISTS scan_status;
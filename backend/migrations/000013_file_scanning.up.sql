@@ -0,0 +1,12 @@
+-- Malware scan verdict per file; NULL means the file was uploaded while scanning was disabled
+ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_status VARCHAR(20)
+    CHECK (scan_status IN ('pending', 'clean', 'infected', 'error'));
+ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255);
+ALTER TABLE files ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS quarantined_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_files_scan_pending ON files(created_at) WHERE scan_status = 'pending';
+
+-- Which scan verdicts may be downloaded
+ALTER TABLE system_policy ADD COLUMN IF NOT EXISTS scan_download_policy VARCHAR(20) NOT NULL DEFAULT 'require_clean'
+    CHECK (scan_download_policy IN ('require_clean', 'block_infected'));
@@ -0,0 +1,18 @@
+-- History of expired-file cleanup runs (scheduled in-process or triggered by an admin)
+CREATE TABLE IF NOT EXISTS cleanup_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    trigger VARCHAR(20) NOT NULL CHECK (trigger IN ('schedule', 'manual')),
+    status VARCHAR(20) NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'succeeded', 'partial', 'failed')),
+    triggered_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    instance VARCHAR(255),
+    batches INTEGER NOT NULL DEFAULT 0,
+    files_found INTEGER NOT NULL DEFAULT 0,
+    files_deleted INTEGER NOT NULL DEFAULT 0,
+    files_failed INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_cleanup_runs_started_at ON cleanup_runs(started_at DESC);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS cleanup_run_files;
+
+ALTER TABLE cleanup_runs DROP COLUMN IF EXISTS bytes_reclaimed;
+ALTER TABLE cleanup_runs DROP COLUMN IF EXISTS files_skipped;
+ALTER TABLE cleanup_runs DROP COLUMN IF EXISTS grace_hours;
+ALTER TABLE cleanup_runs DROP COLUMN IF EXISTS dry_run;
+
+ALTER TABLE system_policy DROP COLUMN IF EXISTS cleanup_grace_hours;
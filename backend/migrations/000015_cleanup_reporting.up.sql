@@ -0,0 +1,26 @@
+-- Grace period after available_to before expired files are physically deleted
+ALTER TABLE system_policy ADD COLUMN IF NOT EXISTS cleanup_grace_hours INTEGER NOT NULL DEFAULT 0
+    CHECK (cleanup_grace_hours >= 0);
+
+ALTER TABLE cleanup_runs ADD COLUMN IF NOT EXISTS dry_run BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE cleanup_runs ADD COLUMN IF NOT EXISTS grace_hours INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE cleanup_runs ADD COLUMN IF NOT EXISTS files_skipped INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE cleanup_runs ADD COLUMN IF NOT EXISTS bytes_reclaimed BIGINT NOT NULL DEFAULT 0;
+
+-- Per-file outcome of a cleanup run; file and owner are snapshots since the file is gone
+CREATE TABLE IF NOT EXISTS cleanup_run_files (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    run_id UUID NOT NULL REFERENCES cleanup_runs(id) ON DELETE CASCADE,
+    file_id UUID NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    owner_id UUID,
+    owner_email VARCHAR(255),
+    file_size BIGINT NOT NULL DEFAULT 0,
+    available_to TIMESTAMP WITH TIME ZONE,
+    result VARCHAR(20) NOT NULL CHECK (result IN ('deleted', 'failed', 'skipped', 'would_delete')),
+    error_message TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_cleanup_run_files_run_id ON cleanup_run_files(run_id, available_to, file_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS policy_changes;
+DROP TABLE IF EXISTS policy_overrides;
+
+ALTER TABLE users DROP COLUMN IF EXISTS policy_group;
@@ -0,0 +1,29 @@
+-- Named group a user belongs to for policy overrides (audience 'group:<name>')
+ALTER TABLE users ADD COLUMN IF NOT EXISTS policy_group VARCHAR(64);
+
+-- Per-audience overrides of system_policy; settings holds only the overridden fields
+CREATE TABLE IF NOT EXISTS policy_overrides (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    audience VARCHAR(80) NOT NULL UNIQUE
+        CHECK (audience IN ('anonymous', 'user', 'admin') OR audience ~ '^group:[a-z0-9_-]{1,64}$'),
+    settings JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every change to system_policy or an override, with full snapshots for rollback
+CREATE TABLE IF NOT EXISTS policy_changes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    audience VARCHAR(80) NOT NULL,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('update', 'delete', 'rollback')),
+    before JSONB,
+    after JSONB,
+    diff JSONB NOT NULL DEFAULT '{}',
+    changed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    changed_by_name VARCHAR(255),
+    rollback_of UUID REFERENCES policy_changes(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_policy_changes_created_at ON policy_changes(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_policy_changes_audience ON policy_changes(audience, created_at DESC);
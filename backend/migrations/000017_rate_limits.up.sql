@@ -0,0 +1,10 @@
+-- Fixed-window rate limit counters shared by all replicas (rate_limit.store = "postgres").
+-- Counters are disposable, so the table is unlogged: faster writes, emptied after a crash.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_counters (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_expires_at ON rate_limit_counters(expires_at);
@@ -0,0 +1,12 @@
+-- Failed file password attempts per file and client (user:<id> or ip:<addr>).
+-- locked_until holds both the short progressive delays and the longer lockouts.
+CREATE TABLE IF NOT EXISTS file_password_attempts (
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    client_key VARCHAR(255) NOT NULL,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (file_id, client_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_password_attempts_last_failed_at ON file_password_attempts(last_failed_at);
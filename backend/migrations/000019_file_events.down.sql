@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS file_unique_downloaders;
+
+ALTER TABLE file_statistics
+    DROP COLUMN IF EXISTS last_previewed_at,
+    DROP COLUMN IF EXISTS preview_count;
+
+DROP INDEX IF EXISTS idx_download_history_file_event;
+DELETE FROM download_history WHERE event_type <> 'download';
+ALTER TABLE download_history DROP COLUMN IF EXISTS event_type;
+
+DROP TABLE IF EXISTS file_events;
@@ -0,0 +1,56 @@
+-- Outbox of file access events. The download and preview handlers insert one row per
+-- transfer; a worker applies it to download_history and file_statistics in one
+-- transaction and deletes it. Rows that keep failing are retried with backoff and kept
+-- with their last error once they run out of attempts.
+CREATE TABLE IF NOT EXISTS file_events (
+    id BIGSERIAL PRIMARY KEY,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('download', 'preview')),
+    user_id UUID,  -- no foreign key: the user may be deleted before the event is applied
+    completed BOOLEAN NOT NULL,
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_events_next_attempt_at ON file_events(next_attempt_at, id);
+
+-- History now records previews as well as downloads
+ALTER TABLE download_history
+    ADD COLUMN IF NOT EXISTS event_type VARCHAR(20) NOT NULL DEFAULT 'download'
+        CHECK (event_type IN ('download', 'preview'));
+
+CREATE INDEX IF NOT EXISTS idx_download_history_file_event ON download_history(file_id, event_type, downloaded_at DESC);
+
+ALTER TABLE file_statistics
+    ADD COLUMN IF NOT EXISTS preview_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_previewed_at TIMESTAMP WITH TIME ZONE;
+
+-- One row per signed-in user who completed a download of a file. Inserting with
+-- ON CONFLICT DO NOTHING decides atomically whether a download is the user's first.
+CREATE TABLE IF NOT EXISTS file_unique_downloaders (
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    first_downloaded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (file_id, user_id)
+);
+
+-- Backfill from history and recount, which also repairs counts inflated by concurrent downloads
+INSERT INTO file_unique_downloaders (file_id, user_id, first_downloaded_at)
+SELECT file_id, downloader_id, MIN(downloaded_at)
+FROM download_history
+WHERE downloader_id IS NOT NULL AND download_completed IS NOT FALSE
+GROUP BY file_id, downloader_id
+ON CONFLICT DO NOTHING;
+
+UPDATE file_statistics s
+SET unique_downloaders = COALESCE(u.downloaders, 0)
+FROM (
+    SELECT f.id AS file_id, COUNT(d.user_id) AS downloaders
+    FROM files f
+    LEFT JOIN file_unique_downloaders d ON d.file_id = f.id
+    GROUP BY f.id
+) u
+WHERE s.file_id = u.file_id;
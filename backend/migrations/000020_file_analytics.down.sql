@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS file_analytics_hourly;
+
+ALTER TABLE download_history
+    DROP COLUMN IF EXISTS referrer_category,
+    DROP COLUMN IF EXISTS client_category,
+    DROP COLUMN IF EXISTS bytes_sent;
+
+ALTER TABLE file_events
+    DROP COLUMN IF EXISTS referrer_category,
+    DROP COLUMN IF EXISTS client_category;
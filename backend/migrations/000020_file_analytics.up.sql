@@ -0,0 +1,35 @@
+-- Coarse request details kept for analytics. Only a category is stored, never the raw
+-- User-Agent or Referer header.
+ALTER TABLE file_events
+    ADD COLUMN IF NOT EXISTS client_category VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    ADD COLUMN IF NOT EXISTS referrer_category VARCHAR(20) NOT NULL DEFAULT 'unknown';
+
+ALTER TABLE download_history
+    ADD COLUMN IF NOT EXISTS bytes_sent BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS client_category VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    ADD COLUMN IF NOT EXISTS referrer_category VARCHAR(20) NOT NULL DEFAULT 'unknown';
+
+-- Hourly rollup of download_history. The file event worker adds each event to its bucket
+-- in the same transaction as the history row, so range queries never scan the history.
+CREATE TABLE IF NOT EXISTS file_analytics_hourly (
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('download', 'preview')),
+    bucket_start TIMESTAMP WITH TIME ZONE NOT NULL,  -- start of the UTC hour
+    client_category VARCHAR(20) NOT NULL,
+    referrer_category VARCHAR(20) NOT NULL,
+    completed_count INTEGER NOT NULL DEFAULT 0,
+    aborted_count INTEGER NOT NULL DEFAULT 0,
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (file_id, event_type, bucket_start, client_category, referrer_category)
+);
+
+-- Roll up the existing history
+INSERT INTO file_analytics_hourly (file_id, event_type, bucket_start, client_category, referrer_category, completed_count, aborted_count, bytes_sent)
+SELECT file_id, event_type, date_trunc('hour', downloaded_at, 'UTC'), client_category, referrer_category,
+       COUNT(*) FILTER (WHERE download_completed IS NOT FALSE),
+       COUNT(*) FILTER (WHERE download_completed IS FALSE),
+       SUM(bytes_sent)
+FROM download_history
+WHERE downloaded_at IS NOT NULL
+GROUP BY 1, 2, 3, 4, 5
+ON CONFLICT DO NOTHING;
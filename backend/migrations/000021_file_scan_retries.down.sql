@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_files_scan_retry;
+ALTER TABLE files DROP COLUMN IF EXISTS next_scan_at;
+ALTER TABLE files DROP COLUMN IF EXISTS scan_attempts;
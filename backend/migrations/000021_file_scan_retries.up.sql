@@ -0,0 +1,8 @@
+-- Scans that failed because the scanner or storage was unavailable are retried with backoff
+ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS next_scan_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_files_scan_retry ON files(next_scan_at) WHERE scan_status = 'error' AND next_scan_at IS NOT NULL;
+
+-- Failed scans from before this migration are retried on the next sweep
+UPDATE files SET scan_attempts = 1, next_scan_at = NOW() WHERE scan_status = 'error';
@@ -0,0 +1,262 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/controllers"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/routes"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type fakeAbuseReportRepo struct {
+	reports []*models.AbuseReport
+}
+
+func (f *fakeAbuseReportRepo) Create(report *models.AbuseReport) error {
+	report.ID = uuid.New()
+	copied := *report
+	f.reports = append(f.reports, &copied)
+	return nil
+}
+
+func (f *fakeAbuseReportRepo) GetByID(id uuid.UUID) (*models.AbuseReport, error) {
+	for _, r := range f.reports {
+		if r.ID == id {
+			copied := *r
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeAbuseReportRepo) FindOpen(fileID uuid.UUID, reporterIP string) (*models.AbuseReport, error) {
+	for _, r := range f.reports {
+		if r.FileID == fileID && r.Status == models.AbuseReportOpen && r.ReporterIP != nil && *r.ReporterIP == reporterIP {
+			copied := *r
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeAbuseReportRepo) List(status models.AbuseReportStatus, fileID *uuid.UUID, limit, offset int) ([]models.AbuseReport, int64, error) {
+	var result []models.AbuseReport
+	for _, r := range f.reports {
+		if (status == "" || r.Status == status) && (fileID == nil || r.FileID == *fileID) {
+			result = append(result, *r)
+		}
+	}
+	return result, int64(len(result)), nil
+}
+
+func (f *fakeAbuseReportRepo) Resolve(id uuid.UUID, status models.AbuseReportStatus, reviewerID *uuid.UUID, note *string, at time.Time) error {
+	for _, r := range f.reports {
+		if r.ID == id {
+			r.Status, r.ReviewedBy, r.ResolutionNote, r.ReviewedAt = status, reviewerID, note, &at
+		}
+	}
+	return nil
+}
+
+func (f *fakeAbuseReportRepo) ResolveOpenForFile(fileID uuid.UUID, status models.AbuseReportStatus, reviewerID *uuid.UUID, note *string, at time.Time) (int64, error) {
+	var n int64
+	for _, r := range f.reports {
+		if r.FileID == fileID && r.Status == models.AbuseReportOpen {
+			r.Status, r.ReviewedBy, r.ResolutionNote, r.ReviewedAt = status, reviewerID, note, &at
+			n++
+		}
+	}
+	return n, nil
+}
+
+// fakeTakedownFiles mirrors FileService.GetByShareToken's handling of taken-down files.
+type fakeTakedownFiles struct {
+	files map[uuid.UUID]*models.File
+}
+
+func (f *fakeTakedownFiles) GetByShareToken(token string) (*models.File, error) {
+	for _, file := range f.files {
+		if file.ShareToken == token {
+			if file.TakenDownAt != nil {
+				return nil, services.ErrFileTakenDown
+			}
+			return file, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeTakedownFiles) GetByID(id uuid.UUID) (*models.File, error) {
+	if file, ok := f.files[id]; ok {
+		return file, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeTakedownFiles) SetTakenDown(id uuid.UUID, takenDown bool, reason string) (*models.File, error) {
+	file, ok := f.files[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	file.TakenDownAt, file.TakedownReason = nil, nil
+	if takenDown {
+		now := time.Now()
+		file.TakenDownAt, file.TakedownReason = &now, &reason
+	}
+	return file, nil
+}
+
+type sentNotification struct {
+	to, subject, body string
+}
+
+type fakeNotifier struct {
+	sent []sentNotification
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, to, subject, body string) error {
+	f.sent = append(f.sent, sentNotification{to, subject, body})
+	return nil
+}
+
+func newAbuseReportFixture() (*services.AbuseReportService, *fakeAbuseReportRepo, *fakeNotifier, *models.File) {
+	owner := &models.User{ID: uuid.New(), Email: "owner@example.com"}
+	file := &models.File{ID: uuid.New(), ShareToken: "sharetoken123", FileName: "movie.mkv", OwnerID: &owner.ID, Owner: owner}
+	repo := &fakeAbuseReportRepo{}
+	notifier := &fakeNotifier{}
+	svc := services.NewAbuseReportService(repo, &fakeTakedownFiles{files: map[uuid.UUID]*models.File{file.ID: file}})
+	svc.SetNotifier(notifier)
+	return svc, repo, notifier, file
+}
+
+func TestAbuseReportService_ReportValidatesAndDeduplicates(t *testing.T) {
+	svc, repo, _, file := newAbuseReportFixture()
+
+	if _, _, err := svc.Report(file.ShareToken, services.AbuseReportInput{Reason: "boring"}); !errors.Is(err, services.ErrInvalidAbuseReason) {
+		t.Errorf("expected ErrInvalidAbuseReason, got %v", err)
+	}
+	if _, _, err := svc.Report("missing", services.AbuseReportInput{Reason: "spam"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected not found for unknown share token, got %v", err)
+	}
+
+	input := services.AbuseReportInput{Reason: "Copyright", ContactEmail: "rights@example.com", ReporterIP: "203.0.113.7"}
+	first, created, err := svc.Report(file.ShareToken, input)
+	if err != nil || !created {
+		t.Fatalf("expected report to be created, got created=%v err=%v", created, err)
+	}
+	if first.Reason != models.AbuseReasonCopyright || first.Status != models.AbuseReportOpen || first.FileID != file.ID {
+		t.Errorf("unexpected report: %+v", first)
+	}
+
+	again, created, err := svc.Report(file.ShareToken, input)
+	if err != nil || created || again.ID != first.ID {
+		t.Errorf("expected repeated report from the same IP to return the open one, got created=%v err=%v", created, err)
+	}
+	if len(repo.reports) != 1 {
+		t.Errorf("expected 1 stored report, got %d", len(repo.reports))
+	}
+}
+
+func TestAbuseReportService_TakedownClosesReportsAndNotifiesOwner(t *testing.T) {
+	svc, repo, notifier, file := newAbuseReportFixture()
+	reviewer := uuid.New()
+
+	first, _, _ := svc.Report(file.ShareToken, services.AbuseReportInput{Reason: "malware", ReporterIP: "198.51.100.1"})
+	svc.Report(file.ShareToken, services.AbuseReportInput{Reason: "malware", ReporterIP: "198.51.100.2"})
+
+	report, err := svc.TakedownReport(first.ID, &reviewer, "")
+	if err != nil {
+		t.Fatalf("TakedownReport failed: %v", err)
+	}
+	if report.Status != models.AbuseReportActioned || report.ReviewedBy == nil || *report.ReviewedBy != reviewer {
+		t.Errorf("expected report to be actioned by the reviewer, got %+v", report)
+	}
+	for _, r := range repo.reports {
+		if r.Status != models.AbuseReportActioned {
+			t.Errorf("expected every open report for the file to be closed, got %s", r.Status)
+		}
+	}
+	if file.TakenDownAt == nil || file.TakedownReason == nil || *file.TakedownReason != "Reported as malware" {
+		t.Errorf("expected file to be taken down with a default reason, got %+v", file)
+	}
+
+	if len(notifier.sent) != 1 || notifier.sent[0].to != "owner@example.com" || !strings.Contains(notifier.sent[0].body, "Reported as malware") {
+		t.Fatalf("expected one takedown notice to the owner, got %+v", notifier.sent)
+	}
+
+	if _, _, err := svc.Report(file.ShareToken, services.AbuseReportInput{Reason: "spam"}); !errors.Is(err, services.ErrFileTakenDown) {
+		t.Errorf("expected taken-down file to refuse new reports, got %v", err)
+	}
+	if _, err := svc.Dismiss(first.ID, &reviewer, ""); !errors.Is(err, services.ErrReportNotOpen) {
+		t.Errorf("expected ErrReportNotOpen for reviewed report, got %v", err)
+	}
+
+	if _, err := svc.Restore(file.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if file.TakenDownAt != nil || len(notifier.sent) != 2 {
+		t.Errorf("expected takedown lifted and owner notified, got takenDownAt=%v notices=%d", file.TakenDownAt, len(notifier.sent))
+	}
+	if _, err := svc.Restore(file.ID); !errors.Is(err, services.ErrFileNotTakenDown) {
+		t.Errorf("expected ErrFileNotTakenDown, got %v", err)
+	}
+}
+
+func TestAbuseReportService_Dismiss(t *testing.T) {
+	svc, _, notifier, file := newAbuseReportFixture()
+
+	report, _, _ := svc.Report(file.ShareToken, services.AbuseReportInput{Reason: "other", ReporterIP: "192.0.2.10"})
+	dismissed, err := svc.Dismiss(report.ID, nil, "not infringing")
+	if err != nil {
+		t.Fatalf("Dismiss failed: %v", err)
+	}
+	if dismissed.Status != models.AbuseReportDismissed || dismissed.ResolutionNote == nil || *dismissed.ResolutionNote != "not infringing" {
+		t.Errorf("unexpected dismissed report: %+v", dismissed)
+	}
+	if file.TakenDownAt != nil || len(notifier.sent) != 0 {
+		t.Errorf("expected dismissal to leave the file alone")
+	}
+}
+
+func TestFileController_ReportFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, _, _, file := newAbuseReportFixture()
+
+	fileController := controllers.NewFileController(nil, nil, nil)
+	fileController.SetAbuseReportService(svc)
+	router := gin.New()
+	routes.RegisterFileRoutes(router.Group("/api/files"), fileController, func(c *gin.Context) { c.Next() }, nil)
+
+	post := func(token, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/files/"+token+"/report", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(file.ShareToken, `{"reason":"spam","contactEmail":"not-an-email"}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid contact email, got %d", code)
+	}
+	if code := post(file.ShareToken, `{"reason":"spam","details":"phishing page"}`); code != http.StatusAccepted {
+		t.Errorf("expected 202 for a valid report, got %d", code)
+	}
+	if code := post("unknown", `{"reason":"spam"}`); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown share token, got %d", code)
+	}
+
+	svc.Takedown(file.ID, nil, "court order")
+	if code := post(file.ShareToken, `{"reason":"spam"}`); code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("expected 451 for a taken-down file, got %d", code)
+	}
+}
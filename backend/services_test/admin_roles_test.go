@@ -0,0 +1,97 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestRolePermissions(t *testing.T) {
+	cases := []struct {
+		role models.UserRole
+		perm models.Permission
+		want bool
+	}{
+		{models.RoleAdmin, models.PermissionPolicyWrite, true},
+		{models.RoleAdmin, models.PermissionAuditRead, true},
+		{models.RoleModerator, models.PermissionPolicyRead, true},
+		{models.RoleModerator, models.PermissionPolicyWrite, false},
+		{models.RoleAuditor, models.PermissionAuditRead, true},
+		{models.RoleAuditor, models.PermissionCleanupRun, false},
+		{models.RoleUser, models.PermissionPolicyRead, false},
+		// Bootstrap is reserved for ADMIN_API_TOKEN.
+		{models.RoleAdmin, models.PermissionAdminBootstrap, false},
+	}
+	for _, tc := range cases {
+		if got := tc.role.HasPermission(tc.perm); got != tc.want {
+			t.Errorf("%s.HasPermission(%s) = %v, want %v", tc.role, tc.perm, got, tc.want)
+		}
+	}
+
+	if !models.RoleAdmin.Outranks(models.RoleModerator) || models.RoleAuditor.Outranks(models.RoleModerator) {
+		t.Errorf("unexpected role ordering")
+	}
+	if models.UserRole("superuser").IsValid() || models.RoleUser.IsStaff() || !models.RoleAuditor.IsStaff() {
+		t.Errorf("unexpected role validity or staff flags")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// fakeAuth stands in for AuthMiddleware, taking the role from a test header.
+	fakeAuth := func(c *gin.Context) {
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			c.Set("userID", uuid.New())
+			c.Set("userRole", models.UserRole(role))
+		}
+		if c.GetHeader("X-Test-PAT") != "" {
+			c.Set("tokenID", uuid.New())
+		}
+		c.Next()
+	}
+
+	router := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/policy", fakeAuth, middleware.RequirePermission(models.PermissionPolicyRead), ok)
+	router.PATCH("/policy", fakeAuth, middleware.RequirePermission(models.PermissionPolicyWrite), ok)
+	router.GET("/audit-log", fakeAuth, middleware.RequirePermission(models.PermissionAuditRead), ok)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		role   string
+		pat    bool
+		want   int
+	}{
+		{"anonymous", http.MethodGet, "/policy", "", false, http.StatusUnauthorized},
+		{"regular user", http.MethodGet, "/policy", "user", false, http.StatusForbidden},
+		{"moderator reads policy", http.MethodGet, "/policy", "moderator", false, http.StatusOK},
+		{"moderator cannot edit policy", http.MethodPatch, "/policy", "moderator", false, http.StatusForbidden},
+		{"auditor reads audit log", http.MethodGet, "/audit-log", "auditor", false, http.StatusOK},
+		{"admin edits policy", http.MethodPatch, "/policy", "admin", false, http.StatusOK},
+		{"admin via personal access token", http.MethodPatch, "/policy", "admin", true, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.role != "" {
+				req.Header.Set("X-Test-Role", tc.role)
+			}
+			if tc.pat {
+				req.Header.Set("X-Test-PAT", "1")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Errorf("expected status %d, got %d (%s)", tc.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -27,6 +27,9 @@ type mockUserRepo struct {
 	getAllFunc          func(limit, offset int) ([]models.User, int64, error)
 	existsByUsernameFunc func(username string) (bool, error)
 	existsByEmailFunc    func(email string) (bool, error)
+	incrementTOTPFailedAttemptsFunc func(id uuid.UUID) (int, error)
+	resetTOTPFailedAttemptsFunc     func(id uuid.UUID) error
+	setLockedUntilFunc              func(id uuid.UUID, until *time.Time) error
 }
 
 func (m *mockUserRepo) GetByID(id uuid.UUID) (*models.User, error) {
@@ -92,6 +95,27 @@ func (m *mockUserRepo) ExistsByEmail(email string) (bool, error) {
 	return m.existsByEmailFunc(email)
 }
 
+func (m *mockUserRepo) IncrementTOTPFailedAttempts(id uuid.UUID) (int, error) {
+	if m.incrementTOTPFailedAttemptsFunc == nil {
+		return 0, errors.New("not implemented")
+	}
+	return m.incrementTOTPFailedAttemptsFunc(id)
+}
+
+func (m *mockUserRepo) ResetTOTPFailedAttempts(id uuid.UUID) error {
+	if m.resetTOTPFailedAttemptsFunc == nil {
+		return errors.New("not implemented")
+	}
+	return m.resetTOTPFailedAttemptsFunc(id)
+}
+
+func (m *mockUserRepo) SetLockedUntil(id uuid.UUID, until *time.Time) error {
+	if m.setLockedUntilFunc == nil {
+		return errors.New("not implemented")
+	}
+	return m.setLockedUntilFunc(id, until)
+}
+
 func newAuthTestConfig() *config.Config {
 	return &config.Config{
 		JWT: config.JWTConfig{
@@ -137,7 +161,7 @@ func TestAuthService_Login_Success_TOTPDisabled(t *testing.T) {
 
 	authService := newTestAuthServiceWithUserRepo(mockRepo)
 
-	gotUser, totpEnabled, err := authService.Login(user.Email, plainPassword)
+	gotUser, totpEnabled, err := authService.Login(user.Email, plainPassword, services.ClientInfo{})
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -177,7 +201,7 @@ func TestAuthService_Login_Success_TOTPEnabled(t *testing.T) {
 
 	authService := newTestAuthServiceWithUserRepo(mockRepo)
 
-	gotUser, totpEnabled, err := authService.Login(user.Email, plainPassword)
+	gotUser, totpEnabled, err := authService.Login(user.Email, plainPassword, services.ClientInfo{})
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -212,7 +236,7 @@ func TestAuthService_Login_InvalidPassword(t *testing.T) {
 
 	authService := newTestAuthServiceWithUserRepo(mockRepo)
 
-	gotUser, totpEnabled, err := authService.Login(user.Email, "wrong-password")
+	gotUser, totpEnabled, err := authService.Login(user.Email, "wrong-password", services.ClientInfo{})
 
 	if err == nil {
 		t.Fatalf("expected error, got nil")
@@ -238,7 +262,7 @@ func TestAuthService_Login_UserNotFound(t *testing.T) {
 	authService := newTestAuthServiceWithUserRepo(mockRepo)
 
 	// Act
-	gotUser, totpEnabled, err := authService.Login("notfound@example.com", "any-password")
+	gotUser, totpEnabled, err := authService.Login("notfound@example.com", "any-password", services.ClientInfo{})
 
 	// Assert
 	if err == nil {
@@ -266,7 +290,7 @@ func TestAuthService_Login_RepositoryError(t *testing.T) {
 
 	authService := newTestAuthServiceWithUserRepo(mockRepo)
 
-	gotUser, totpEnabled, err := authService.Login("user@example.com", "password123")
+	gotUser, totpEnabled, err := authService.Login("user@example.com", "password123", services.ClientInfo{})
 
 	// Assert
 	if err == nil {
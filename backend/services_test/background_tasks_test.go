@@ -0,0 +1,64 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+func TestBackgroundTasks_WaitForRunningTasks(t *testing.T) {
+	tasks := services.NewBackgroundTasks()
+	release := make(chan struct{})
+	var finished atomic.Int32
+	for i := 0; i < 3; i++ {
+		tasks.Go(func() {
+			<-release
+			finished.Add(1)
+		})
+	}
+
+	// Wait gives up when its context ends before the tasks do
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tasks.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to time out, got %v", err)
+	}
+
+	close(release)
+	if err := tasks.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if finished.Load() != 3 {
+		t.Fatalf("expected all tasks to finish before Wait returns, got %d", finished.Load())
+	}
+}
+
+func TestBackgroundTasks_RunsLateTasksSynchronously(t *testing.T) {
+	tasks := services.NewBackgroundTasks()
+	if err := tasks.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	ran := false
+	tasks.Go(func() { ran = true })
+	if !ran {
+		t.Fatalf("tasks started after Wait must run before Go returns")
+	}
+}
+
+func TestBackgroundTasks_NilRunsUntracked(t *testing.T) {
+	var tasks *services.BackgroundTasks
+	done := make(chan struct{})
+	tasks.Go(func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("a nil BackgroundTasks must still run the task")
+	}
+	if err := tasks.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait on nil must not fail, got %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/repositories"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"gorm.io/gorm"
+)
+
+// fakeClusterLock simulates one advisory lock shared by several replicas.
+type fakeClusterLock struct {
+	mu     sync.Mutex
+	holder *fakeLocker
+}
+
+type fakeLocker struct {
+	cluster *fakeClusterLock
+	unlocks int
+}
+
+func (c *fakeClusterLock) replica() *fakeLocker {
+	return &fakeLocker{cluster: c}
+}
+
+func (l *fakeLocker) TryLock(ctx context.Context) (bool, error) {
+	l.cluster.mu.Lock()
+	defer l.cluster.mu.Unlock()
+	if l.cluster.holder == nil {
+		l.cluster.holder = l
+	}
+	return l.cluster.holder == l, nil
+}
+
+func (l *fakeLocker) Unlock(ctx context.Context) error {
+	l.cluster.mu.Lock()
+	defer l.cluster.mu.Unlock()
+	if l.cluster.holder == l {
+		l.cluster.holder = nil
+	}
+	l.unlocks++
+	return nil
+}
+
+// flakyStorage fails Delete for a path the given number of times before succeeding.
+type flakyStorage struct {
+	*fakeStorage
+	failures map[string]int
+	attempts map[string]int
+}
+
+func (f *flakyStorage) Delete(ctx context.Context, loc *storage.Location) error {
+	f.attempts[loc.Path]++
+	if f.failures[loc.Path] > 0 {
+		f.failures[loc.Path]--
+		return errors.New("transient storage error")
+	}
+	return f.fakeStorage.Delete(ctx, loc)
+}
+
+// blockingStorage holds every Delete until release is closed, so a run stays in progress.
+type blockingStorage struct {
+	*fakeStorage
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *blockingStorage) Delete(ctx context.Context, loc *storage.Location) error {
+	b.once.Do(func() { close(b.entered) })
+	<-b.release
+	return b.fakeStorage.Delete(ctx, loc)
+}
+
+func TestCronScheduler_InvalidSpec(t *testing.T) {
+	cluster := &fakeClusterLock{}
+	if _, err := services.NewCronScheduler("cleanup", "every day", cluster.replica(), func(context.Context) {}); err == nil {
+		t.Fatalf("expected invalid cron expression to be rejected")
+	}
+
+	s, err := services.NewCronScheduler("cleanup", "0 0 * * *", cluster.replica(), func(context.Context) {})
+	if err != nil {
+		t.Fatalf("NewCronScheduler failed: %v", err)
+	}
+	from := time.Date(2025, 3, 10, 15, 30, 0, 0, time.UTC)
+	if next := s.Next(from); !next.Equal(time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected next run at midnight, got %s", next)
+	}
+}
+
+func TestCronScheduler_OnlyLeaderRunsJob(t *testing.T) {
+	cluster := &fakeClusterLock{}
+	runs := map[string]int{}
+	newReplica := func(name string) (*services.CronScheduler, *fakeLocker) {
+		lock := cluster.replica()
+		s, err := services.NewCronScheduler("cleanup", "@daily", lock, func(context.Context) { runs[name]++ })
+		if err != nil {
+			t.Fatalf("NewCronScheduler failed: %v", err)
+		}
+		return s, lock
+	}
+	first, firstLock := newReplica("first")
+	second, _ := newReplica("second")
+
+	for i := 0; i < 3; i++ {
+		first.Tick(context.Background())
+		second.Tick(context.Background())
+	}
+	if runs["first"] != 3 || runs["second"] != 0 {
+		t.Fatalf("expected only the leader to run, got %v", runs)
+	}
+
+	// Leadership moves once the leader stops.
+	first.Stop()
+	if firstLock.unlocks != 1 {
+		t.Fatalf("expected Stop to release leadership")
+	}
+	if !second.Tick(context.Background()) || runs["second"] != 1 {
+		t.Fatalf("expected the other replica to take over, got %v", runs)
+	}
+}
+
+func newTestCleanupService(t *testing.T, db *gorm.DB, st storage.Storage, runLock services.Locker, batchSize int) (*services.CleanupService, repositories.CleanupRunRepository) {
+	t.Helper()
+	runs := repositories.NewCleanupRunRepository(db)
+	svc, err := services.NewCleanupService(db, st, runs, runLock, config.CleanupConfig{
+		BatchSize:   batchSize,
+		MaxAttempts: 3,
+		RetryDelay:  "1ms",
+	})
+	if err != nil {
+		t.Fatalf("NewCleanupService failed: %v", err)
+	}
+	return svc, runs
+}
+
+func TestCleanupService_RunDeletesInBatchesWithRetries(t *testing.T) {
+	store := &flakyStorage{fakeStorage: newFakeStorage(), failures: map[string]int{}, attempts: map[string]int{}}
+	db := newTestDB(t)
+	cleanup, runs := newTestCleanupService(t, db, store, (&fakeClusterLock{}).replica(), 2)
+	files := services.NewFileService(db, store)
+
+	var expired []*models.File
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+		file := uploadModerationTestFile(t, files, name, "text/plain", true)
+		if _, err := files.ForceExpire(file.ID); err != nil {
+			t.Fatalf("ForceExpire failed: %v", err)
+		}
+		expired = append(expired, file)
+	}
+	kept := uploadModerationTestFile(t, files, "active.txt", "text/plain", true)
+	held := uploadModerationTestFile(t, files, "held.txt", "text/plain", true)
+	if _, err := files.ForceExpire(held.ID); err != nil {
+		t.Fatalf("ForceExpire failed: %v", err)
+	}
+	if _, err := files.SetLegalHold(held.ID, true, "litigation"); err != nil {
+		t.Fatalf("SetLegalHold failed: %v", err)
+	}
+
+	store.failures[expired[0].FilePath] = 1  // recovers on retry
+	store.failures[expired[1].FilePath] = 10 // never recovers in this run
+	time.Sleep(10 * time.Millisecond)
+
+	run, err := cleanup.Run(context.Background(), services.CleanupRequest{Trigger: models.CleanupTriggerManual})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if run.Status != models.CleanupRunPartial || run.FilesFound != 5 || run.FilesDeleted != 4 || run.FilesFailed != 1 {
+		t.Fatalf("unexpected run result: %+v", run)
+	}
+	if run.Batches != 3 {
+		t.Fatalf("expected 3 batches of at most 2 files, got %d", run.Batches)
+	}
+	if store.attempts[expired[0].FilePath] != 2 || store.attempts[expired[1].FilePath] != 3 {
+		t.Fatalf("unexpected delete attempts: %v", store.attempts)
+	}
+
+	if _, err := files.GetByID(expired[1].ID); err != nil {
+		t.Fatalf("file whose object could not be deleted must be kept: %v", err)
+	}
+	for _, f := range []*models.File{kept, held} {
+		if _, err := files.GetByID(f.ID); err != nil {
+			t.Fatalf("file %s must not be deleted: %v", f.FileName, err)
+		}
+	}
+
+	failed, total, err := runs.ListFiles(run.ID, models.CleanupFileFailed, 10, 0)
+	if err != nil || total != 1 {
+		t.Fatalf("expected one failed result, got %d (%v)", total, err)
+	}
+	if failed[0].FileID != expired[1].ID || failed[0].Attempts != 3 || failed[0].ErrorMessage == nil {
+		t.Fatalf("failed result must name the file, attempts and error: %+v", failed[0])
+	}
+	if _, total, _ := runs.ListFiles(run.ID, models.CleanupFileDeleted, 10, 0); total != 4 {
+		t.Fatalf("expected 4 deleted results, got %d", total)
+	}
+	if run.BytesReclaimed != expired[0].FileSize+expired[2].FileSize+expired[3].FileSize+expired[4].FileSize {
+		t.Fatalf("unexpected reclaimed bytes %d", run.BytesReclaimed)
+	}
+
+	stored, err := runs.GetByID(run.ID)
+	if err != nil {
+		t.Fatalf("run not persisted: %v", err)
+	}
+	if stored.FinishedAt == nil || stored.Status != models.CleanupRunPartial {
+		t.Fatalf("unexpected persisted run: %+v", stored)
+	}
+}
+
+func TestCleanupService_RunRefusesConcurrentRun(t *testing.T) {
+	cluster := &fakeClusterLock{}
+	other := cluster.replica()
+	if ok, _ := other.TryLock(context.Background()); !ok {
+		t.Fatalf("expected to take the run lock")
+	}
+
+	cleanup, runs := newTestCleanupService(t, newTestDB(t), newFakeStorage(), cluster.replica(), 10)
+	if _, err := cleanup.Run(context.Background(), services.CleanupRequest{Trigger: models.CleanupTriggerSchedule}); !errors.Is(err, services.ErrCleanupRunning) {
+		t.Fatalf("expected ErrCleanupRunning, got %v", err)
+	}
+	if _, total, _ := runs.List(10, 0); total != 0 {
+		t.Fatalf("expected no run to be recorded, got %d", total)
+	}
+}
+
+func TestCleanupService_RunRefusesOverlappingRunInSameProcess(t *testing.T) {
+	store := &blockingStorage{fakeStorage: newFakeStorage(), entered: make(chan struct{}), release: make(chan struct{})}
+	db := newTestDB(t)
+	cleanup, runs := newTestCleanupService(t, db, store, (&fakeClusterLock{}).replica(), 10)
+	files := services.NewFileService(db, store)
+
+	file := uploadModerationTestFile(t, files, "a.txt", "text/plain", true)
+	if _, err := files.ForceExpire(file.ID); err != nil {
+		t.Fatalf("ForceExpire failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	type result struct {
+		run *models.CleanupRun
+		err error
+	}
+	first := make(chan result, 1)
+	go func() {
+		run, err := cleanup.Run(context.Background(), services.CleanupRequest{Trigger: models.CleanupTriggerSchedule})
+		first <- result{run, err}
+	}()
+	<-store.entered
+
+	if _, err := cleanup.Run(context.Background(), services.CleanupRequest{Trigger: models.CleanupTriggerManual}); !errors.Is(err, services.ErrCleanupRunning) {
+		t.Fatalf("expected ErrCleanupRunning, got %v", err)
+	}
+	close(store.release)
+
+	res := <-first
+	if res.err != nil {
+		t.Fatalf("first run failed: %v", res.err)
+	}
+	if res.run.Status != models.CleanupRunSucceeded || res.run.FilesDeleted != 1 {
+		t.Fatalf("first run must not be disturbed by the refused one: %+v", res.run)
+	}
+	if _, total, _ := runs.List(10, 0); total != 1 {
+		t.Fatalf("expected exactly one recorded run, got %d", total)
+	}
+}
+
+func TestCleanupService_DryRunAndGracePeriod(t *testing.T) {
+	db := newTestDB(t)
+	store := newFakeStorage()
+	cleanup, runs := newTestCleanupService(t, db, store, (&fakeClusterLock{}).replica(), 10)
+	files := services.NewFileService(db, store)
+
+	old := uploadModerationTestFile(t, files, "old.txt", "text/plain", true)
+	recent := uploadModerationTestFile(t, files, "recent.txt", "text/plain", true)
+	if err := db.Model(&models.File{}).Where("id = ?", old.ID).Update("available_to", time.Now().Add(-48*time.Hour)).Error; err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if err := db.Model(&models.File{}).Where("id = ?", recent.ID).Update("available_to", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if err := db.Model(&models.SystemPolicy{}).Where("id = ?", 1).Update("cleanup_grace_hours", 24).Error; err != nil {
+		t.Fatalf("update policy failed: %v", err)
+	}
+
+	dry, err := cleanup.Run(context.Background(), services.CleanupRequest{Trigger: models.CleanupTriggerManual, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if !dry.DryRun || dry.GraceHours != 24 || dry.FilesFound != 1 || dry.FilesDeleted != 0 || dry.BytesReclaimed != old.FileSize {
+		t.Fatalf("unexpected dry run: %+v", dry)
+	}
+	results, _, err := runs.ListFiles(dry.ID, "", 10, 0)
+	if err != nil || len(results) != 1 || results[0].FileID != old.ID || results[0].Result != models.CleanupFileWouldDelete {
+		t.Fatalf("expected only the file past the grace period to be listed, got %+v (%v)", results, err)
+	}
+	if _, ok := store.files[old.FilePath]; !ok {
+		t.Fatalf("dry run must not delete storage objects")
+	}
+	if _, err := files.GetByID(old.ID); err != nil {
+		t.Fatalf("dry run must not delete rows: %v", err)
+	}
+
+	run, err := cleanup.Run(context.Background(), services.CleanupRequest{Trigger: models.CleanupTriggerManual})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if run.FilesDeleted != 1 {
+		t.Fatalf("expected one file deleted, got %+v", run)
+	}
+	if _, err := files.GetByID(recent.ID); err != nil {
+		t.Fatalf("file inside the grace period must be kept: %v", err)
+	}
+}
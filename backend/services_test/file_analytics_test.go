@@ -0,0 +1,189 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+func TestClassifyClient(t *testing.T) {
+	cases := map[string]models.ClientCategory{
+		"": models.ClientUnknown,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36":   models.ClientBrowser,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148": models.ClientMobile,
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":                                      models.ClientBot,
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)":                                     models.ClientBot,
+		"curl/8.4.0":           models.ClientCLI,
+		"python-requests/2.31": models.ClientCLI,
+		"MyDownloader/1.0":     models.ClientOther,
+	}
+	for ua, want := range cases {
+		if got := services.ClassifyClient(ua); got != want {
+			t.Errorf("ClassifyClient(%q) = %s, want %s", ua, got, want)
+		}
+	}
+}
+
+func TestClassifyReferrer(t *testing.T) {
+	events := services.NewFileEventService(nil)
+	events.SetInternalOrigins([]string{"https://share.example.com"})
+
+	cases := map[string]models.ReferrerCategory{
+		"":                                    models.ReferrerDirect,
+		"https://share.example.com/files/abc": models.ReferrerInternal,
+		"http://api.example.com:8080/docs":    models.ReferrerInternal,
+		"https://www.google.com.vn/":          models.ReferrerSearch,
+		"https://duckduckgo.com/?q=report":    models.ReferrerSearch,
+		"https://l.facebook.com/l.php?u=x":    models.ReferrerSocial,
+		"https://t.co/abc":                    models.ReferrerSocial,
+		"https://blog.example.org/post":       models.ReferrerExternal,
+		"not a url":                           models.ReferrerUnknown,
+	}
+	for referrer, want := range cases {
+		if got := events.ClassifyReferrer(referrer, "api.example.com:8080"); got != want {
+			t.Errorf("ClassifyReferrer(%q) = %s, want %s", referrer, got, want)
+		}
+	}
+}
+
+func TestFileAnalytics_RejectsInvalidQueries(t *testing.T) {
+	svc := services.NewFileAnalyticsService(nil)
+	now := time.Now()
+	queries := map[string]services.AnalyticsQuery{
+		"unknown interval": {Interval: "week"},
+		"unknown type":     {EventType: "share"},
+		"empty range":      {From: now, To: now.Add(-time.Hour)},
+		"too many hours":   {Interval: services.AnalyticsHourly, From: now.AddDate(0, -2, 0), To: now},
+		"too many days":    {Interval: services.AnalyticsDaily, From: now.AddDate(-2, 0, 0), To: now},
+	}
+	for name, q := range queries {
+		if _, err := svc.GetFileAnalytics(context.Background(), uuid.New(), q); !errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+			t.Errorf("%s: expected ErrInvalidAnalyticsQuery, got %v", name, err)
+		}
+	}
+}
+
+func TestFileAnalytics_BucketsFromRollup(t *testing.T) {
+	db, events, file, user := newFileEventFixture(t)
+	ctx := context.Background()
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	record := func(eventType models.FileEventType, at time.Time, completed bool, bytes int64, client models.ClientCategory, referrer models.ReferrerCategory) {
+		t.Helper()
+		err := events.Record(ctx, &models.FileEvent{FileID: file.ID, EventType: eventType, UserID: &user.ID, Completed: completed, BytesSent: bytes,
+			ClientCategory: client, ReferrerCategory: referrer, OccurredAt: at, NextAttemptAt: time.Now()})
+		if err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	record(models.FileEventDownload, day.Add(9*time.Hour+5*time.Minute), true, 100, models.ClientBrowser, models.ReferrerDirect)
+	record(models.FileEventDownload, day.Add(9*time.Hour+40*time.Minute), false, 30, models.ClientCLI, models.ReferrerDirect)
+	record(models.FileEventDownload, day.Add(26*time.Hour), true, 100, models.ClientBrowser, models.ReferrerSocial)
+	record(models.FileEventPreview, day.Add(9*time.Hour), true, 100, models.ClientMobile, models.ReferrerInternal)
+	if _, err := events.ProcessPending(ctx, time.Now()); err != nil {
+		t.Fatalf("ProcessPending failed: %v", err)
+	}
+
+	var history models.DownloadHistory
+	if err := db.Where("file_id = ? AND client_category = ?", file.ID, models.ClientCLI).First(&history).Error; err != nil || history.BytesSent != 30 {
+		t.Fatalf("expected the categories and bytes in the history, got %+v (%v)", history, err)
+	}
+
+	analytics := services.NewFileAnalyticsService(db)
+	daily, err := analytics.GetFileAnalytics(ctx, file.ID, services.AnalyticsQuery{From: day, To: day.AddDate(0, 0, 3)})
+	if err != nil {
+		t.Fatalf("GetFileAnalytics failed: %v", err)
+	}
+	if len(daily.Series) != 3 || daily.Series[2].Completed != 0 {
+		t.Fatalf("expected 3 daily buckets including an empty one, got %+v", daily.Series)
+	}
+	if first := daily.Series[0]; !first.Start.Equal(day) || first.Completed != 1 || first.Aborted != 1 || first.BytesSent != 130 {
+		t.Fatalf("unexpected first bucket %+v", first)
+	}
+	if daily.Totals.Completed != 2 || daily.Totals.Aborted != 1 || daily.Totals.BytesSent != 230 {
+		t.Fatalf("unexpected totals %+v", daily.Totals)
+	}
+	if len(daily.Clients) != 2 || daily.Clients[0].Category != string(models.ClientBrowser) || daily.Clients[0].Completed != 2 {
+		t.Fatalf("expected browsers first in the client breakdown, got %+v", daily.Clients)
+	}
+	if len(daily.Referrers) != 2 {
+		t.Fatalf("expected direct and social referrers, got %+v", daily.Referrers)
+	}
+
+	hourly, err := analytics.GetFileAnalytics(ctx, file.ID, services.AnalyticsQuery{
+		Interval: services.AnalyticsHourly, EventType: models.FileEventPreview, From: day.Add(8 * time.Hour), To: day.Add(10*time.Hour + 30*time.Minute)})
+	if err != nil {
+		t.Fatalf("GetFileAnalytics failed: %v", err)
+	}
+	if len(hourly.Series) != 3 || !hourly.To.Equal(day.Add(11*time.Hour)) || hourly.Series[1].Completed != 1 || hourly.Totals.Completed != 1 {
+		t.Fatalf("expected the preview in the 09:00 bucket of a range rounded up to 11:00, got %+v", hourly)
+	}
+}
+
+func TestFileAnalytics_OwnerAggregatesAcrossFiles(t *testing.T) {
+	db, events, report, owner := newFileEventFixture(t)
+	ctx := context.Background()
+	fileService := services.NewFileService(db, newFakeStorage())
+	slides := uploadModerationTestFile(t, fileService, "slides.pdf", "application/pdf", true)
+	other := uploadModerationTestFile(t, fileService, "other.pdf", "application/pdf", true)
+	stranger := &models.User{ID: uuid.New(), Email: "stranger@example.com", Username: "stranger"}
+	if err := db.Create(stranger).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	now := time.Now()
+	setFile := func(file *models.File, ownerID uuid.UUID, availableTo time.Time) {
+		t.Helper()
+		err := db.Model(&models.File{}).Where("id = ?", file.ID).
+			Updates(map[string]interface{}{"owner_id": ownerID, "available_to": availableTo}).Error
+		if err != nil {
+			t.Fatalf("failed to update file: %v", err)
+		}
+	}
+	setFile(report, owner.ID, now.Add(48*time.Hour))
+	setFile(slides, owner.ID, now.Add(20*24*time.Hour))
+	setFile(other, stranger.ID, now.Add(time.Hour))
+
+	download := func(file *models.File, userID *uuid.UUID, completed bool) {
+		t.Helper()
+		err := events.Record(ctx, &models.FileEvent{FileID: file.ID, EventType: models.FileEventDownload, UserID: userID, Completed: completed, BytesSent: 10})
+		if err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	download(slides, &stranger.ID, true)
+	download(slides, &stranger.ID, true)
+	download(slides, nil, true)
+	download(report, nil, true)
+	download(report, &owner.ID, false)
+	download(other, nil, true)
+	if _, err := events.ProcessPending(ctx, time.Now()); err != nil {
+		t.Fatalf("ProcessPending failed: %v", err)
+	}
+
+	analytics, err := services.NewFileAnalyticsService(db).GetOwnerAnalytics(ctx, owner.ID, services.AnalyticsQuery{})
+	if err != nil {
+		t.Fatalf("GetOwnerAnalytics failed: %v", err)
+	}
+	if len(analytics.Series) != 31 || analytics.Totals.Completed != 4 || analytics.Totals.Aborted != 1 || analytics.Totals.BytesSent != 50 {
+		t.Fatalf("expected the downloads of both files over 31 days, got %d buckets and %+v", len(analytics.Series), analytics.Totals)
+	}
+	if len(analytics.TopFiles) != 2 || analytics.TopFiles[0].FileID != slides.ID || analytics.TopFiles[0].Completed != 3 || analytics.TopFiles[0].AllTimeCount != 3 {
+		t.Fatalf("expected slides to be the top file, got %+v", analytics.TopFiles)
+	}
+	if d := analytics.Downloaders; d.Anonymous != 2 || d.Authenticated != 2 || d.UniqueUsers != 1 || d.AnonymousRatio != 0.5 {
+		t.Fatalf("unexpected downloader breakdown %+v", d)
+	}
+	if s := analytics.Storage; s.Files != 2 || s.Active != 2 || s.ExpiringSoon != 1 || s.Downloads != 4 || s.Bytes != report.FileSize+slides.FileSize {
+		t.Fatalf("unexpected storage usage %+v", s)
+	}
+	if len(analytics.ExpiringSoon) != 1 || analytics.ExpiringSoon[0].FileID != report.ID {
+		t.Fatalf("expected only the report to expire within a week, got %+v", analytics.ExpiringSoon)
+	}
+}
@@ -0,0 +1,251 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/controllers"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/routes"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+)
+
+func newFileEventFixture(t *testing.T) (*gorm.DB, *services.FileEventService, *models.File, *models.User) {
+	t.Helper()
+	db := newTestDB(t)
+	file := uploadModerationTestFile(t, services.NewFileService(db, newFakeStorage()), "report.pdf", "application/pdf", true)
+	user := &models.User{ID: uuid.New(), Email: "reader@example.com", Username: "reader"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return db, services.NewFileEventService(db), file, user
+}
+
+func loadFileStatistics(t *testing.T, db *gorm.DB, fileID uuid.UUID) models.FileStatistics {
+	t.Helper()
+	var stats models.FileStatistics
+	if err := db.Where("file_id = ?", fileID).First(&stats).Error; err != nil {
+		t.Fatalf("failed to load statistics: %v", err)
+	}
+	return stats
+}
+
+func TestFileEventService_RecordRejectsInvalidEvents(t *testing.T) {
+	svc := services.NewFileEventService(nil)
+	ctx := context.Background()
+	if err := svc.Record(ctx, &models.FileEvent{EventType: models.FileEventDownload}); !errors.Is(err, services.ErrInvalidFileEvent) {
+		t.Fatalf("expected an event without a file to be rejected, got %v", err)
+	}
+	if err := svc.Record(ctx, &models.FileEvent{FileID: uuid.New(), EventType: "share"}); !errors.Is(err, services.ErrInvalidFileEvent) {
+		t.Fatalf("expected an unknown event type to be rejected, got %v", err)
+	}
+}
+
+func TestFileEventService_ConcurrentDownloadsCountUserOnce(t *testing.T) {
+	db, svc, file, user := newFileEventFixture(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if err := svc.Record(ctx, &models.FileEvent{FileID: file.ID, EventType: models.FileEventDownload, UserID: &user.ID, Completed: true, BytesSent: 10}); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if err := svc.Record(ctx, &models.FileEvent{FileID: file.ID, EventType: models.FileEventDownload, Completed: true}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if err := svc.Record(ctx, &models.FileEvent{FileID: file.ID, EventType: models.FileEventDownload, UserID: &user.ID, Completed: false}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	// Several replicas draining the outbox at once must apply every event exactly once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n, err := svc.ProcessPending(ctx, time.Now())
+				if err != nil {
+					t.Errorf("ProcessPending failed: %v", err)
+					return
+				}
+				if n == 0 {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := loadFileStatistics(t, db, file.ID)
+	if stats.DownloadCount != 6 || stats.UniqueDownloaders != 1 || stats.LastDownloadedAt == nil {
+		t.Fatalf("expected 6 downloads by 1 known user, got %d downloads and %d users", stats.DownloadCount, stats.UniqueDownloaders)
+	}
+	var history, pending int64
+	db.Model(&models.DownloadHistory{}).Where("file_id = ?", file.ID).Count(&history)
+	db.Model(&models.FileEvent{}).Count(&pending)
+	if history != 7 || pending != 0 {
+		t.Fatalf("expected every event in the history and none left pending, got %d and %d", history, pending)
+	}
+}
+
+func TestFileEventService_PreviewsCountedSeparately(t *testing.T) {
+	db, svc, file, user := newFileEventFixture(t)
+	ctx := context.Background()
+
+	if err := svc.Record(ctx, &models.FileEvent{FileID: file.ID, EventType: models.FileEventPreview, UserID: &user.ID, Completed: true}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if _, err := svc.ProcessPending(ctx, time.Now()); err != nil {
+		t.Fatalf("ProcessPending failed: %v", err)
+	}
+
+	stats := loadFileStatistics(t, db, file.ID)
+	if stats.PreviewCount != 1 || stats.LastPreviewedAt == nil || stats.DownloadCount != 0 || stats.UniqueDownloaders != 0 {
+		t.Fatalf("expected only the preview counters to change, got %+v", stats)
+	}
+
+	history := services.NewDownloadHistoryService(db)
+	if _, total, _ := history.GetByFileID(file.ID, models.FileEventDownload, 10, 0); total != 0 {
+		t.Fatalf("previews must not appear in the download history, got %d", total)
+	}
+	previews, total, err := history.GetByFileID(file.ID, models.FileEventPreview, 10, 0)
+	if err != nil || total != 1 || previews[0].EventType != models.FileEventPreview {
+		t.Fatalf("expected the preview in the preview history, got %d (%v)", total, err)
+	}
+}
+
+func TestFileEventService_DeletedUserRecordedAsAnonymous(t *testing.T) {
+	db, svc, file, _ := newFileEventFixture(t)
+	ctx := context.Background()
+
+	gone := uuid.New()
+	if err := svc.Record(ctx, &models.FileEvent{FileID: file.ID, EventType: models.FileEventDownload, UserID: &gone, Completed: true}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if _, err := svc.ProcessPending(ctx, time.Now()); err != nil {
+		t.Fatalf("ProcessPending failed: %v", err)
+	}
+
+	if stats := loadFileStatistics(t, db, file.ID); stats.DownloadCount != 1 || stats.UniqueDownloaders != 0 {
+		t.Fatalf("expected the download to count without a downloader, got %+v", stats)
+	}
+	var entry models.DownloadHistory
+	if err := db.Where("file_id = ?", file.ID).First(&entry).Error; err != nil || entry.DownloaderID != nil {
+		t.Fatalf("expected an anonymous history entry, got %+v (%v)", entry, err)
+	}
+}
+
+func TestFileEventService_FailedEventsBackOff(t *testing.T) {
+	db, svc, file, _ := newFileEventFixture(t)
+	ctx := context.Background()
+
+	if err := svc.Record(ctx, &models.FileEvent{FileID: file.ID, EventType: models.FileEventDownload, Completed: true}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	good := &models.FileEvent{FileID: file.ID, EventType: models.FileEventPreview, Completed: true}
+	if err := svc.Record(ctx, good); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	// Make applying downloads fail until the constraint is restored
+	if err := db.Exec("ALTER TABLE file_statistics ADD CONSTRAINT test_no_downloads CHECK (download_count = 0)").Error; err != nil {
+		t.Fatalf("failed to add constraint: %v", err)
+	}
+	t.Cleanup(func() { db.Exec("ALTER TABLE file_statistics DROP CONSTRAINT IF EXISTS test_no_downloads") })
+
+	now := time.Now()
+	if n, err := svc.ProcessPending(ctx, now); err != nil || n != 2 {
+		t.Fatalf("expected both events to be taken, got %d (%v)", n, err)
+	}
+
+	var failed models.FileEvent
+	if err := db.First(&failed).Error; err != nil {
+		t.Fatalf("expected the failed event to stay in the outbox: %v", err)
+	}
+	if failed.Attempts != 1 || failed.LastError == nil || !failed.NextAttemptAt.After(now) {
+		t.Fatalf("expected the failure to be recorded and the retry delayed, got %+v", failed)
+	}
+	if stats := loadFileStatistics(t, db, file.ID); stats.PreviewCount != 1 {
+		t.Fatalf("a failing event must not hold back the rest of the batch, got %+v", stats)
+	}
+	var history int64
+	db.Model(&models.DownloadHistory{}).Where("event_type = ?", models.FileEventDownload).Count(&history)
+	if history != 0 {
+		t.Fatalf("the history of a failed event must be rolled back, got %d rows", history)
+	}
+
+	if n, _ := svc.ProcessPending(ctx, now); n != 0 {
+		t.Fatalf("expected the event to wait for its retry, got %d taken", n)
+	}
+	db.Exec("ALTER TABLE file_statistics DROP CONSTRAINT test_no_downloads")
+	if n, err := svc.ProcessPending(ctx, failed.NextAttemptAt); err != nil || n != 1 {
+		t.Fatalf("expected the retry to be applied, got %d (%v)", n, err)
+	}
+	if stats := loadFileStatistics(t, db, file.ID); stats.DownloadCount != 1 {
+		t.Fatalf("expected the retried download to be counted, got %+v", stats)
+	}
+}
+
+func TestFileController_DownloadRangesRecordedOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	fileService := services.NewFileService(db, storage.NewLocalStorage(t.TempDir()))
+	file := uploadModerationTestFile(t, fileService, "report.pdf", "application/pdf", true)
+	events := services.NewFileEventService(db)
+
+	fileController := controllers.NewFileController(fileService, nil, nil)
+	fileController.SetFileEventService(events)
+	router := gin.New()
+	routes.RegisterFileRoutes(router.Group("/api/files"), fileController, func(c *gin.Context) { c.Next() }, nil)
+
+	download := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/files/"+file.ShareToken+"/download", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	content := "moderation test report.pdf"
+	head := download("bytes=0-9")
+	if head.Code != http.StatusPartialContent || head.Body.String() != content[:10] || head.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("expected the first 10 bytes, got %d %q", head.Code, head.Body.String())
+	}
+	tail := download("bytes=10-")
+	if tail.Code != http.StatusPartialContent || tail.Body.String() != content[10:] {
+		t.Fatalf("expected the rest of the file, got %d %q", tail.Code, tail.Body.String())
+	}
+	if full := download(""); full.Code != http.StatusOK || full.Body.String() != content {
+		t.Fatalf("expected the whole file, got %d %q", full.Code, full.Body.String())
+	}
+	if outside := download("bytes=1000-"); outside.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("expected 416 for a range past the end, got %d", outside.Code)
+	}
+
+	if _, err := events.ProcessPending(context.Background(), time.Now()); err != nil {
+		t.Fatalf("ProcessPending failed: %v", err)
+	}
+	// The resumed download counts once, when its last part is sent, and the full one once
+	var history []models.DownloadHistory
+	if err := db.Where("file_id = ?", file.ID).Order("bytes_sent").Find(&history).Error; err != nil {
+		t.Fatalf("failed to load history: %v", err)
+	}
+	if len(history) != 2 || history[0].BytesSent != int64(len(content)-10) || history[1].BytesSent != int64(len(content)) {
+		t.Fatalf("expected the tail range and the full download in the history, got %+v", history)
+	}
+	if stats := loadFileStatistics(t, db, file.ID); stats.DownloadCount != 2 {
+		t.Fatalf("expected 2 downloads, got %+v", stats)
+	}
+}
@@ -0,0 +1,142 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+func uploadModerationTestFile(t *testing.T, svc *services.FileService, name, contentType string, isPublic bool) *models.File {
+	t.Helper()
+	content := []byte("moderation test " + name)
+	file, err := svc.UploadFile(context.Background(), &services.UploadInput{
+		FileName:    name,
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		Reader:      bytes.NewReader(content),
+		IsPublic:    &isPublic,
+	})
+	if err != nil {
+		t.Fatalf("upload %s failed: %v", name, err)
+	}
+	return file
+}
+
+func TestFileService_ListFilesForAdmin_Filters(t *testing.T) {
+	db := newTestDB(t)
+	svc := services.NewFileService(db, newFakeStorage())
+
+	image := uploadModerationTestFile(t, svc, "photo.png", "image/png", true)
+	uploadModerationTestFile(t, svc, "notes.txt", "text/plain", true)
+	if _, err := svc.ForceExpire(image.ID); err != nil {
+		t.Fatalf("ForceExpire failed: %v", err)
+	}
+
+	files, total, err := svc.ListFilesForAdmin(services.AdminFileFilter{MimeType: "image/"}, 20, 0)
+	if err != nil {
+		t.Fatalf("ListFilesForAdmin failed: %v", err)
+	}
+	if total != 1 || len(files) != 1 || files[0].ID != image.ID {
+		t.Errorf("expected only the image to match mime prefix, got total=%d", total)
+	}
+
+	_, total, _ = svc.ListFilesForAdmin(services.AdminFileFilter{Status: "expired"}, 20, 0)
+	if total != 1 {
+		t.Errorf("expected 1 expired file, got %d", total)
+	}
+	_, total, _ = svc.ListFilesForAdmin(services.AdminFileFilter{Status: "active"}, 20, 0)
+	if total != 1 {
+		t.Errorf("expected 1 active file, got %d", total)
+	}
+
+	future := time.Now().Add(time.Hour)
+	_, total, _ = svc.ListFilesForAdmin(services.AdminFileFilter{CreatedFrom: &future}, 20, 0)
+	if total != 0 {
+		t.Errorf("expected no files created after now, got %d", total)
+	}
+}
+
+func TestFileService_DisabledShareLink(t *testing.T) {
+	db := newTestDB(t)
+	svc := services.NewFileService(db, newFakeStorage())
+	file := uploadModerationTestFile(t, svc, "shared.txt", "text/plain", true)
+
+	if _, err := svc.SetShareDisabled(file.ID, true); err != nil {
+		t.Fatalf("SetShareDisabled failed: %v", err)
+	}
+	if _, err := svc.GetByShareToken(file.ShareToken); !errors.Is(err, services.ErrShareDisabled) {
+		t.Errorf("expected ErrShareDisabled, got %v", err)
+	}
+
+	if _, err := svc.SetShareDisabled(file.ID, false); err != nil {
+		t.Fatalf("SetShareDisabled failed: %v", err)
+	}
+	if _, err := svc.GetByShareToken(file.ShareToken); err != nil {
+		t.Errorf("expected re-enabled share link to work, got %v", err)
+	}
+}
+
+func TestFileService_LegalHoldBlocksDeletionAndCleanup(t *testing.T) {
+	db := newTestDB(t)
+	svc := services.NewFileService(db, newFakeStorage())
+	file := uploadModerationTestFile(t, svc, "evidence.txt", "text/plain", true)
+
+	held, err := svc.SetLegalHold(file.ID, true, "case #42")
+	if err != nil {
+		t.Fatalf("SetLegalHold failed: %v", err)
+	}
+	if !held.LegalHold || held.LegalHoldReason == nil || *held.LegalHoldReason != "case #42" || held.LegalHoldAt == nil {
+		t.Errorf("expected hold with reason and timestamp, got %+v", held)
+	}
+
+	if err := svc.Delete(file.ID); !errors.Is(err, services.ErrLegalHold) {
+		t.Errorf("expected ErrLegalHold, got %v", err)
+	}
+
+	if _, err := svc.ForceExpire(file.ID); err != nil {
+		t.Fatalf("ForceExpire failed: %v", err)
+	}
+	expired, err := svc.GetExpiredFiles()
+	if err != nil {
+		t.Fatalf("GetExpiredFiles failed: %v", err)
+	}
+	if len(expired) != 0 {
+		t.Errorf("expected held file to be excluded from cleanup, got %d files", len(expired))
+	}
+
+	released, err := svc.SetLegalHold(file.ID, false, "")
+	if err != nil {
+		t.Fatalf("SetLegalHold release failed: %v", err)
+	}
+	if released.LegalHold || released.LegalHoldReason != nil {
+		t.Errorf("expected hold to be cleared, got %+v", released)
+	}
+	if err := svc.Delete(file.ID); err != nil {
+		t.Errorf("expected delete after release to succeed, got %v", err)
+	}
+}
+
+func TestFileService_TakenDownShareLink(t *testing.T) {
+	db := newTestDB(t)
+	svc := services.NewFileService(db, newFakeStorage())
+	file := uploadModerationTestFile(t, svc, "pirated.mkv", "video/x-matroska", true)
+
+	if _, err := svc.SetTakenDown(file.ID, true, "copyright"); err != nil {
+		t.Fatalf("SetTakenDown failed: %v", err)
+	}
+	if _, err := svc.GetByShareToken(file.ShareToken); !errors.Is(err, services.ErrFileTakenDown) {
+		t.Errorf("expected ErrFileTakenDown, got %v", err)
+	}
+
+	if _, err := svc.SetTakenDown(file.ID, false, ""); err != nil {
+		t.Fatalf("SetTakenDown failed: %v", err)
+	}
+	if _, err := svc.GetByShareToken(file.ShareToken); err != nil {
+		t.Errorf("expected restored share link to work, got %v", err)
+	}
+}
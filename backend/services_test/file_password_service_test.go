@@ -0,0 +1,301 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type fakeFilePasswordAttemptRepo struct {
+	attempts map[string]*models.FilePasswordAttempt
+}
+
+func newFakeFilePasswordAttemptRepo() *fakeFilePasswordAttemptRepo {
+	return &fakeFilePasswordAttemptRepo{attempts: map[string]*models.FilePasswordAttempt{}}
+}
+
+func (f *fakeFilePasswordAttemptRepo) key(fileID uuid.UUID, clientKey string) string {
+	return fileID.String() + "|" + clientKey
+}
+
+func (f *fakeFilePasswordAttemptRepo) Get(fileID uuid.UUID, clientKey string) (*models.FilePasswordAttempt, error) {
+	a, ok := f.attempts[f.key(fileID, clientKey)]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *a
+	return &copied, nil
+}
+
+func (f *fakeFilePasswordAttemptRepo) RecordFailure(fileID uuid.UUID, clientKey string, now, staleBefore time.Time) (*models.FilePasswordAttempt, error) {
+	a, ok := f.attempts[f.key(fileID, clientKey)]
+	if !ok {
+		a = &models.FilePasswordAttempt{FileID: fileID, ClientKey: clientKey}
+		f.attempts[f.key(fileID, clientKey)] = a
+	}
+	if a.LastFailedAt.Before(staleBefore) {
+		a.FailedAttempts = 0
+	}
+	a.FailedAttempts++
+	a.LastFailedAt = now
+	copied := *a
+	return &copied, nil
+}
+
+func (f *fakeFilePasswordAttemptRepo) SetLockedUntil(fileID uuid.UUID, clientKey string, until time.Time) error {
+	f.attempts[f.key(fileID, clientKey)].LockedUntil = &until
+	return nil
+}
+
+func (f *fakeFilePasswordAttemptRepo) Reset(fileID uuid.UUID, clientKey string) error {
+	delete(f.attempts, f.key(fileID, clientKey))
+	return nil
+}
+
+func newFilePasswordFixture(t *testing.T) (*services.FilePasswordService, *fakeFilePasswordAttemptRepo, *fakeNotifier, *models.File) {
+	t.Helper()
+	keys, err := services.NewJWTKeyManager(config.JWTConfig{Secret: "file-password-test-secret-32-chars!!"}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewJWTKeyManager failed: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt failed: %v", err)
+	}
+	passwordHash := string(hash)
+	owner := &models.User{ID: uuid.New(), Email: "owner@example.com"}
+	file := &models.File{ID: uuid.New(), ShareToken: "protected123", FileName: "report.pdf", PasswordHash: &passwordHash, OwnerID: &owner.ID, Owner: owner}
+
+	repo := newFakeFilePasswordAttemptRepo()
+	notifier := &fakeNotifier{}
+	svc := services.NewFilePasswordService(repo, keys)
+	svc.SetNotifier(notifier)
+	return svc, repo, notifier, file
+}
+
+func TestFilePasswordService_ProgressiveDelayAndLockout(t *testing.T) {
+	svc, repo, _, file := newFilePasswordFixture(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	client := "ip:198.51.100.7"
+
+	// The first two wrong passwords only fail
+	for i := 0; i < 2; i++ {
+		if err := svc.Verify(ctx, file, client, "guess", now); !errors.Is(err, services.ErrIncorrectFilePassword) {
+			t.Fatalf("attempt %d: expected ErrIncorrectFilePassword, got %v", i+1, err)
+		}
+	}
+	// The third starts a short delay; during it even the right password is not checked
+	if err := svc.Verify(ctx, file, client, "guess", now); !errors.Is(err, services.ErrIncorrectFilePassword) {
+		t.Fatalf("expected ErrIncorrectFilePassword, got %v", err)
+	}
+	var locked *services.FilePasswordLockedError
+	if err := svc.Verify(ctx, file, client, "correct horse", now.Add(time.Second)); !errors.As(err, &locked) || !locked.Until.Equal(now.Add(2*time.Second)) {
+		t.Fatalf("expected a 2s delay, got %v", err)
+	}
+	// Other clients are not affected
+	if err := svc.Verify(ctx, file, "user:"+uuid.NewString(), "correct horse", now); err != nil {
+		t.Fatalf("another client must not be delayed, got %v", err)
+	}
+
+	// Delays double until the lockout threshold, after which lockouts start at 15 minutes
+	for i := 4; i <= 10; i++ {
+		now = now.Add(24 * time.Minute)
+		if err := svc.Verify(ctx, file, client, "guess", now); !errors.Is(err, services.ErrIncorrectFilePassword) {
+			t.Fatalf("attempt %d: expected ErrIncorrectFilePassword, got %v", i, err)
+		}
+	}
+	if err := svc.Verify(ctx, file, client, "correct horse", now.Add(14*time.Minute)); !errors.As(err, &locked) || !locked.Until.Equal(now.Add(15*time.Minute)) {
+		t.Fatalf("expected a 15 minute lockout after 10 failures, got %v", err)
+	}
+
+	// The right password after the lockout clears the client's record
+	if err := svc.Verify(ctx, file, client, "correct horse", now.Add(15*time.Minute)); err != nil {
+		t.Fatalf("expected the correct password to be accepted after the lockout, got %v", err)
+	}
+	if _, err := repo.Get(file.ID, client); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the attempts to be reset, got %v", err)
+	}
+}
+
+func TestFilePasswordService_NotifiesOwnerAtThreshold(t *testing.T) {
+	svc, _, notifier, file := newFilePasswordFixture(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// Twenty guesses from ten clients stay under the per-client delays
+	for i := 0; i < 20; i++ {
+		client := "ip:203.0.113." + string(rune('0'+i%10))
+		if err := svc.Verify(ctx, file, client, "guess", now); !errors.Is(err, services.ErrIncorrectFilePassword) {
+			t.Fatalf("attempt %d: expected ErrIncorrectFilePassword, got %v", i+1, err)
+		}
+		if i == 18 && len(notifier.sent) != 0 {
+			t.Fatalf("owner notified before the threshold")
+		}
+	}
+	if len(notifier.sent) != 1 || notifier.sent[0].to != "owner@example.com" {
+		t.Fatalf("expected one notification to the owner, got %+v", notifier.sent)
+	}
+}
+
+func TestFilePasswordService_NotificationCountIgnoresClientResets(t *testing.T) {
+	svc, _, notifier, file := newFilePasswordFixture(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 19; i++ {
+		client := fmt.Sprintf("ip:203.0.113.%d", i%10)
+		if err := svc.Verify(ctx, file, client, "guess", now); !errors.Is(err, services.ErrIncorrectFilePassword) {
+			t.Fatalf("attempt %d: expected ErrIncorrectFilePassword, got %v", i+1, err)
+		}
+	}
+	// One of the guessing clients gets it right, which clears only its own count
+	if err := svc.Verify(ctx, file, "ip:203.0.113.9", "correct horse", now); err != nil {
+		t.Fatalf("expected the correct password to be accepted, got %v", err)
+	}
+	if err := svc.Verify(ctx, file, "ip:198.51.100.1", "guess", now); !errors.Is(err, services.ErrIncorrectFilePassword) {
+		t.Fatalf("expected ErrIncorrectFilePassword, got %v", err)
+	}
+	if len(notifier.sent) != 1 || !strings.Contains(notifier.sent[0].body, "20 wrong password attempts") {
+		t.Fatalf("expected the owner to be notified of the 20th failure, got %+v", notifier.sent)
+	}
+}
+
+func TestFilePasswordService_LocksFileForGuessesFromManyClients(t *testing.T) {
+	svc, _, _, file := newFilePasswordFixture(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// Each client stays under its own delay, but the file as a whole is being guessed at
+	for i := 0; i < 50; i++ {
+		client := services.FilePasswordClientKey(fmt.Sprintf("2001:db8:%x::1", i))
+		if err := svc.Verify(ctx, file, client, "guess", now); !errors.Is(err, services.ErrIncorrectFilePassword) {
+			t.Fatalf("attempt %d: expected ErrIncorrectFilePassword, got %v", i+1, err)
+		}
+	}
+	var locked *services.FilePasswordLockedError
+	if err := svc.Verify(ctx, file, "user:"+uuid.NewString(), "correct horse", now.Add(time.Minute)); !errors.As(err, &locked) || !locked.Until.Equal(now.Add(15*time.Minute)) {
+		t.Fatalf("expected the file to be locked for everyone for 15 minutes, got %v", err)
+	}
+	if err := svc.Verify(ctx, file, "user:"+uuid.NewString(), "correct horse", now.Add(15*time.Minute)); err != nil {
+		t.Fatalf("expected the correct password to be accepted after the lock, got %v", err)
+	}
+	// The count is not reset by that success: the next wrong password locks the file again
+	if err := svc.Verify(ctx, file, "ip:198.51.100.9", "guess", now.Add(16*time.Minute)); !errors.Is(err, services.ErrIncorrectFilePassword) {
+		t.Fatalf("expected ErrIncorrectFilePassword, got %v", err)
+	}
+	if err := svc.Verify(ctx, file, "ip:198.51.100.10", "correct horse", now.Add(17*time.Minute)); !errors.As(err, &locked) {
+		t.Fatalf("expected the file to be locked again, got %v", err)
+	}
+}
+
+func TestFilePasswordClientKey_GroupsIPv6By64(t *testing.T) {
+	if a, b := services.FilePasswordClientKey("2001:db8:1:2::a"), services.FilePasswordClientKey("2001:db8:1:2:ffff::b"); a != b || a != "ip:2001:db8:1:2::/64" {
+		t.Fatalf("expected addresses in one /64 to share a key, got %q and %q", a, b)
+	}
+	if a, b := services.FilePasswordClientKey("2001:db8:1:2::a"), services.FilePasswordClientKey("2001:db8:1:3::a"); a == b {
+		t.Fatalf("expected different /64 prefixes to get different keys, got %q", a)
+	}
+	if key := services.FilePasswordClientKey("198.51.100.7"); key != "ip:198.51.100.7" {
+		t.Fatalf("expected IPv4 addresses to be kept as is, got %q", key)
+	}
+}
+
+func TestFilePasswordService_DownloadGrant(t *testing.T) {
+	svc, _, _, file := newFilePasswordFixture(t)
+	now := time.Now()
+
+	grant, expiresAt, err := svc.IssueGrant(file, now)
+	if err != nil {
+		t.Fatalf("IssueGrant failed: %v", err)
+	}
+	if !expiresAt.Equal(now.Add(svc.GrantTTL())) {
+		t.Fatalf("unexpected expiry %v", expiresAt)
+	}
+	if err := svc.VerifyGrant(file, grant); err != nil {
+		t.Fatalf("expected the grant to be valid, got %v", err)
+	}
+
+	other := *file
+	other.ID = uuid.New()
+	if err := svc.VerifyGrant(&other, grant); !errors.Is(err, services.ErrInvalidDownloadGrant) {
+		t.Fatalf("a grant must only open its own file, got %v", err)
+	}
+
+	changed := *file
+	newHash, _ := bcrypt.GenerateFromPassword([]byte("new password"), bcrypt.MinCost)
+	newHashStr := string(newHash)
+	changed.PasswordHash = &newHashStr
+	if err := svc.VerifyGrant(&changed, grant); !errors.Is(err, services.ErrInvalidDownloadGrant) {
+		t.Fatalf("changing the password must invalidate grants, got %v", err)
+	}
+
+	expired, _, _ := svc.IssueGrant(file, now.Add(-time.Hour))
+	if err := svc.VerifyGrant(file, expired); !errors.Is(err, services.ErrInvalidDownloadGrant) {
+		t.Fatalf("expired grants must be rejected, got %v", err)
+	}
+	if err := svc.VerifyGrant(file, "not-a-token"); !errors.Is(err, services.ErrInvalidDownloadGrant) {
+		t.Fatalf("malformed grants must be rejected, got %v", err)
+	}
+}
+
+func TestAuthMiddleware_RejectsDownloadGrant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &models.User{ID: uuid.New(), Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	userRepo, _ := newInMemoryUserRepo(user)
+	authService := services.NewAuthService(userRepo, newAuthTestConfig())
+	keys := authService.KeyManager()
+	_, _, _, file := newFilePasswordFixture(t)
+
+	grant, _, err := services.NewFilePasswordService(newFakeFilePasswordAttemptRepo(), keys).IssueGrant(file, time.Now())
+	if err != nil {
+		t.Fatalf("IssueGrant failed: %v", err)
+	}
+	// A grant whose subject happens to parse as a user ID must be refused all the same.
+	now := time.Now()
+	lookalike, err := keys.Sign(services.DownloadGrantClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   user.ID.String(),
+		Audience:  jwt.ClaimStrings{services.DownloadGrantAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/me", middleware.AuthMiddleware(keys, userRepo, nil), func(c *gin.Context) { c.Status(http.StatusOK) })
+	requester := middleware.RequesterKey(keys)
+
+	for name, token := range map[string]string{"grant": grant, "lookalike": lookalike} {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = req
+		if key := requester(c); key != "" {
+			t.Errorf("%s: expected no requester key, got %q", name, key)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -18,15 +19,18 @@ import (
 
 type fakeStorage struct {
 	files        map[string]*storage.DownloadResult
+	containers   map[string]storage.ContainerType
 	uploadedObjs []*storage.Object
 	uploadErr    error
 	downloadErr  error
 	deleteErr    error
+	probeErr     error
 }
 
 func newFakeStorage() *fakeStorage {
 	return &fakeStorage{
-		files: make(map[string]*storage.DownloadResult),
+		files:      make(map[string]*storage.DownloadResult),
+		containers: make(map[string]storage.ContainerType),
 	}
 }
 
@@ -49,6 +53,7 @@ func (f *fakeStorage) Upload(ctx context.Context, obj *storage.Object) (*storage
 		ContentType: obj.ContentType,
 		Size:        int64(len(data)),
 	}
+	f.containers[path] = obj.Container
 	f.uploadedObjs = append(f.uploadedObjs, obj)
 
 	return &storage.Location{
@@ -91,9 +96,47 @@ func (f *fakeStorage) Delete(ctx context.Context, loc *storage.Location) error {
 		return storage.ErrInvalidLocation
 	}
 	delete(f.files, loc.Path)
+	delete(f.containers, loc.Path)
 	return nil
 }
 
+func (f *fakeStorage) Stat(ctx context.Context, loc *storage.Location) (*storage.ObjectInfo, error) {
+	if loc == nil {
+		return nil, storage.ErrInvalidLocation
+	}
+	res, ok := f.files[loc.Path]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	return &storage.ObjectInfo{Container: loc.Container, Path: loc.Path, Size: res.Size, ContentType: res.ContentType}, nil
+}
+
+// List reports objects added directly to files (without Upload) as private.
+func (f *fakeStorage) List(ctx context.Context, container storage.ContainerType, fn func(storage.ObjectInfo) error) error {
+	paths := make([]string, 0, len(f.files))
+	for path := range f.files {
+		c, ok := f.containers[path]
+		if !ok {
+			c = storage.ContainerPrivate
+		}
+		if c == container {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		res := f.files[path]
+		if err := fn(storage.ObjectInfo{Container: container, Path: path, Size: res.Size, ContentType: res.ContentType}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeStorage) Probe(ctx context.Context) error {
+	return f.probeErr
+}
+
 func TestFileService_UploadFile_Public_Success(t *testing.T) {
 	ctx := context.Background()
 	db := newTestDB(t)
@@ -938,7 +981,7 @@ func TestFileService_GetSystemPolicy_DefaultValues(t *testing.T) {
 	fs := newFakeStorage()
 	svc := services.NewFileService(db, fs)
 
-	policy, err := svc.GetSystemPolicy(ctx)
+	policy, err := svc.GetSystemPolicy(ctx, nil)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -0,0 +1,125 @@
+package services_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+var (
+	pdfBytes = []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	pngBytes = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+	// Minimal DOS/PE header: "MZ" stub whose e_lfanew points at "PE\0\0".
+	exeBytes = func() []byte {
+		b := make([]byte, 0x90)
+		copy(b, "MZ")
+		b[0x3c] = 0x80
+		copy(b[0x80:], "PE\x00\x00")
+		return b
+	}()
+)
+
+func defaultUploadRules() services.UploadTypeRules {
+	return services.UploadTypeRules{
+		ConfigAllowed:     []string{"*"},
+		BlockedMimeTypes:  models.DefaultBlockedMimeTypes,
+		BlockedExtensions: models.DefaultBlockedExtensions,
+	}
+}
+
+func TestSniffUpload_StoresDetectedTypeAndKeepsStream(t *testing.T) {
+	// Large enough that the sniffed prefix is only part of the stream.
+	content := append(append([]byte{}, pdfBytes...), bytes.Repeat([]byte("x"), 10000)...)
+
+	sniffed, reader, err := services.SniffUpload(bytes.NewReader(content), "report.pdf", "application/octet-stream", defaultUploadRules())
+	if err != nil {
+		t.Fatalf("SniffUpload failed: %v", err)
+	}
+	if sniffed != "application/pdf" {
+		t.Errorf("expected application/pdf, got %s", sniffed)
+	}
+	got, _ := io.ReadAll(reader)
+	if !bytes.Equal(got, content) {
+		t.Errorf("expected the full stream to be preserved, got %d of %d bytes", len(got), len(content))
+	}
+
+	sniffed, _, err = services.SniffUpload(strings.NewReader("hello world"), "notes.txt", "text/plain", defaultUploadRules())
+	if err != nil || sniffed != "text/plain" {
+		t.Errorf("expected text/plain without parameters, got %q (%v)", sniffed, err)
+	}
+}
+
+func TestSniffUpload_RejectsExecutables(t *testing.T) {
+	cases := []struct {
+		name, fileName, declared string
+		content                  []byte
+	}{
+		{"blocked extension", "setup.exe", "application/octet-stream", []byte("anything")},
+		{"blocked extension any case", "RUN.BAT", "", []byte("echo hi")},
+		{"exe posing as pdf", "invoice.pdf", "application/pdf", exeBytes},
+		{"exe with neutral declared type", "invoice.bin", "application/octet-stream", exeBytes},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := services.SniffUpload(bytes.NewReader(tc.content), tc.fileName, tc.declared, defaultUploadRules())
+			if !errors.Is(err, services.ErrFileTypeNotAllowed) && !errors.Is(err, services.ErrFileTypeMismatch) {
+				t.Errorf("expected upload to be rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSniffUpload_RejectsMismatchedDeclaredType(t *testing.T) {
+	rules := defaultUploadRules()
+
+	if _, _, err := services.SniffUpload(bytes.NewReader(pngBytes), "cat.pdf", "application/pdf", rules); !errors.Is(err, services.ErrFileTypeMismatch) {
+		t.Errorf("expected ErrFileTypeMismatch for a png declared as pdf, got %v", err)
+	}
+	// Related types are accepted: csv content is detected as text, json is a kind of text.
+	if _, _, err := services.SniffUpload(strings.NewReader("a;b\n1;2\n"), "data.csv", "text/csv", rules); err != nil {
+		t.Errorf("expected csv to be accepted, got %v", err)
+	}
+	if _, _, err := services.SniffUpload(strings.NewReader(`{"a":1}`), "data.txt", "text/plain", rules); err != nil {
+		t.Errorf("expected json declared as text/plain to be accepted, got %v", err)
+	}
+}
+
+func TestSniffUpload_AllowLists(t *testing.T) {
+	rules := defaultUploadRules()
+	rules.PolicyAllowed = []string{"image/*", "application/pdf"}
+
+	if _, _, err := services.SniffUpload(bytes.NewReader(pngBytes), "cat.png", "image/png", rules); err != nil {
+		t.Errorf("expected image/* to allow png, got %v", err)
+	}
+	if _, _, err := services.SniffUpload(strings.NewReader("hello"), "notes.txt", "text/plain", rules); !errors.Is(err, services.ErrFileTypeNotAllowed) {
+		t.Errorf("expected text to be outside the policy allowlist, got %v", err)
+	}
+
+	// The deployment allowlist applies even when the policy allows everything.
+	rules.PolicyAllowed = nil
+	rules.ConfigAllowed = []string{"application/pdf"}
+	if _, _, err := services.SniffUpload(bytes.NewReader(pngBytes), "cat.png", "image/png", rules); !errors.Is(err, services.ErrFileTypeNotAllowed) {
+		t.Errorf("expected storage.allowed_mime_types to reject png, got %v", err)
+	}
+}
+
+func TestPolicyPatternValidation(t *testing.T) {
+	for _, valid := range []string{"*", "image/*", "application/pdf"} {
+		if !services.ValidMimePattern(valid) {
+			t.Errorf("expected %q to be a valid MIME pattern", valid)
+		}
+	}
+	for _, invalid := range []string{"", "image", "*/*", "text/plain; charset=utf-8", "a/b/c"} {
+		if services.ValidMimePattern(invalid) {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+	if !services.ValidExtension(".exe") || services.ValidExtension("exe") || services.ValidExtension(".tar.gz") {
+		t.Errorf("unexpected extension validation result")
+	}
+}
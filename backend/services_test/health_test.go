@@ -0,0 +1,123 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/controllers"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+)
+
+// lowDiskStorage reports a nearly full local disk.
+type lowDiskStorage struct {
+	*fakeStorage
+}
+
+func (lowDiskStorage) DiskUsage() (*storage.DiskUsage, error) {
+	return &storage.DiskUsage{TotalBytes: 100 << 30, FreeBytes: 2 << 30}, nil
+}
+
+func TestHealthService_ReportsComponentFailures(t *testing.T) {
+	fs := newFakeStorage()
+	fs.probeErr = errors.New("container missing")
+	svc := services.NewHealthService(nil, lowDiskStorage{fs})
+
+	report := svc.Readiness(context.Background())
+	if report.Status != services.HealthReportUnavailable || report.Ready() {
+		t.Fatalf("expected the instance to be unavailable, got %q", report.Status)
+	}
+	if got := report.Checks["database"]; got.Status != services.HealthDown {
+		t.Fatalf("expected the missing database to be down, got %+v", got)
+	}
+	if got := report.Checks["storage"]; got.Status != services.HealthDown || got.Error != "container missing" {
+		t.Fatalf("expected the storage probe error, got %+v", got)
+	}
+	// 2 of 100 GiB free is under the 5% threshold
+	if got := report.Checks["disk"]; got.Status != services.HealthDegraded || got.Details["freeBytes"] != uint64(2<<30) {
+		t.Fatalf("expected low disk space to be degraded, got %+v", got)
+	}
+
+	// Liveness does not depend on any of them
+	if live := svc.Liveness(); live.Status != services.HealthReportOK || len(live.Checks) != 0 {
+		t.Fatalf("unexpected liveness report %+v", live)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	health := controllers.NewHealthController(svc)
+	router.GET("/health/live", health.Live)
+	router.GET("/health/ready", health.Ready)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected liveness 200, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	var body services.HealthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid readiness body: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || body.Status != services.HealthReportUnavailable || len(body.Checks) != 3 {
+		t.Fatalf("expected 503 with every check, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHealthService_DatabaseSchemaVersion(t *testing.T) {
+	db := newTestDB(t)
+	svc := services.NewHealthService(db, storage.NewLocalStorage(t.TempDir()))
+
+	svc.SetExpectedSchemaVersion(1)
+	report := svc.Readiness(context.Background())
+	if report.Status == services.HealthReportUnavailable {
+		t.Fatalf("expected the instance to be ready, got %+v", report.Checks)
+	}
+	if got := report.Checks["database"]; got.Status != services.HealthUp || got.Details["schemaVersion"] == nil {
+		t.Fatalf("expected the database to be up with its schema version, got %+v", got)
+	}
+	if _, ok := report.Checks["disk"]; !ok {
+		t.Fatalf("local storage must report disk space")
+	}
+
+	// A release whose migrations have not run yet must not receive traffic
+	svc.SetExpectedSchemaVersion(1 << 30)
+	report = svc.Readiness(context.Background())
+	if got := report.Checks["database"]; got.Status != services.HealthDown || !strings.Contains(got.Error, "older than the expected") {
+		t.Fatalf("expected an outdated schema to be down, got %+v", got)
+	}
+}
+
+func TestLocalStorage_Probe(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "uploads")
+	st := storage.NewLocalStorage(base)
+	if err := st.Probe(context.Background()); err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		t.Fatalf("expected Probe to create the base path: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Probe must not leave files behind, found %d", len(entries))
+	}
+
+	// A base path that is a file cannot hold uploads
+	file := filepath.Join(t.TempDir(), "not-a-dir")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.NewLocalStorage(file).Probe(context.Background()); err == nil {
+		t.Fatalf("expected Probe to fail when the base path is a file")
+	}
+}
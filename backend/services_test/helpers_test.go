@@ -55,12 +55,29 @@ func resetTestDatabase(t *testing.T, db *gorm.DB) {
 
 	truncateStmt := `
 TRUNCATE TABLE 
+	abuse_reports,
+	admin_audit_logs,
+	cleanup_run_files,
+	cleanup_runs,
 	download_history,
+	file_analytics_hourly,
+	file_events,
+	file_password_attempts,
 	file_statistics,
+	file_unique_downloaders,
 	files,
+	jwt_signing_keys,
 	login_sessions,
+	oidc_auth_requests,
+	personal_access_tokens,
+	policy_changes,
+	policy_overrides,
+	security_events,
+	user_identities,
 	system_policy,
-	users
+	users,
+	webauthn_credentials,
+	webauthn_sessions
 RESTART IDENTITY CASCADE`
 	if err := db.Exec(truncateStmt).Error; err != nil {
 		t.Fatalf("failed to truncate tables: %v", err)
@@ -0,0 +1,311 @@
+package services_test
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type fakeJWTSigningKeyRepo struct {
+	mu   sync.Mutex
+	keys []*models.JWTSigningKey
+}
+
+func (f *fakeJWTSigningKeyRepo) Create(key *models.JWTSigningKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *key
+	f.keys = append(f.keys, &copied)
+	return nil
+}
+
+func (f *fakeJWTSigningKeyRepo) ListUsable(now time.Time) ([]models.JWTSigningKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result []models.JWTSigningKey
+	for _, k := range f.keys {
+		if k.ExpiresAt == nil || k.ExpiresAt.After(now) {
+			result = append(result, *k)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result, nil
+}
+
+func (f *fakeJWTSigningKeyRepo) RetireOlderThan(kid string, createdAt, retiredAt, expiresAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range f.keys {
+		if k.KID != kid && k.RetiredAt == nil && k.CreatedAt.Before(createdAt) {
+			r, e := retiredAt, expiresAt
+			k.RetiredAt, k.ExpiresAt = &r, &e
+		}
+	}
+	return nil
+}
+
+func (f *fakeJWTSigningKeyRepo) DeleteExpired(now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	kept := f.keys[:0]
+	for _, k := range f.keys {
+		if k.ExpiresAt == nil || k.ExpiresAt.After(now) {
+			kept = append(kept, k)
+		}
+	}
+	f.keys = kept
+	return nil
+}
+
+func (f *fakeJWTSigningKeyRepo) signing() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var kids []string
+	for _, k := range f.keys {
+		if k.RetiredAt == nil {
+			kids = append(kids, k.KID)
+		}
+	}
+	return kids
+}
+
+func newTestKeyManager(t *testing.T, algorithm string, repo *fakeJWTSigningKeyRepo) *services.JWTKeyManager {
+	t.Helper()
+	return newTestKeyManagerWithLock(t, algorithm, repo, nil)
+}
+
+func newTestKeyManagerWithLock(t *testing.T, algorithm string, repo *fakeJWTSigningKeyRepo, lock services.Locker) *services.JWTKeyManager {
+	t.Helper()
+	keys, err := services.NewJWTKeyManager(config.JWTConfig{
+		Algorithm:         algorithm,
+		AccessTokenExpiry: "15m",
+		RotationInterval:  "1h",
+	}, repo, lock)
+	if err != nil {
+		t.Fatalf("NewJWTKeyManager failed: %v", err)
+	}
+	return keys
+}
+
+func signTestToken(t *testing.T, keys *services.JWTKeyManager) string {
+	t.Helper()
+	token, err := keys.Sign(jwt.RegisteredClaims{
+		Subject:   uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return token
+}
+
+func parseTestToken(keys *services.JWTKeyManager, token string) (*jwt.Token, error) {
+	return keys.Parse(token, &jwt.RegisteredClaims{})
+}
+
+func TestJWTKeyManager_RS256SignsWithKIDAndPublishesJWKS(t *testing.T) {
+	repo := &fakeJWTSigningKeyRepo{}
+	keys := newTestKeyManager(t, "RS256", repo)
+	if len(repo.keys) != 1 {
+		t.Fatalf("expected a signing key to be generated on startup, got %d", len(repo.keys))
+	}
+
+	parsed, err := parseTestToken(keys, signTestToken(t, keys))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if parsed.Method.Alg() != "RS256" || parsed.Header["kid"] != repo.keys[0].KID {
+		t.Errorf("expected RS256 token with kid %s, got %s/%v", repo.keys[0].KID, parsed.Method.Alg(), parsed.Header["kid"])
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("expected 1 key in JWKS, got %d", len(jwks.Keys))
+	}
+	if k := jwks.Keys[0]; k.Kty != "RSA" || k.Kid != repo.keys[0].KID || k.N == "" || k.E != "AQAB" {
+		t.Errorf("unexpected JWK: %+v", k)
+	}
+}
+
+func TestJWTKeyManager_EdDSA(t *testing.T) {
+	keys := newTestKeyManager(t, "EdDSA", &fakeJWTSigningKeyRepo{})
+
+	parsed, err := parseTestToken(keys, signTestToken(t, keys))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if parsed.Method.Alg() != "EdDSA" {
+		t.Errorf("expected EdDSA, got %s", parsed.Method.Alg())
+	}
+	if k := keys.JWKS().Keys[0]; k.Kty != "OKP" || k.Crv != "Ed25519" || k.X == "" {
+		t.Errorf("unexpected JWK: %+v", k)
+	}
+}
+
+func TestJWTKeyManager_RotationKeepsOldKeysUntilTokensExpire(t *testing.T) {
+	repo := &fakeJWTSigningKeyRepo{}
+	keys := newTestKeyManager(t, "RS256", repo)
+	oldToken := signTestToken(t, keys)
+	oldKID := repo.keys[0].KID
+
+	if rotated, err := keys.RotateIfDue(time.Now().UTC()); err != nil || rotated {
+		t.Fatalf("expected no rotation before the interval, got rotated=%v err=%v", rotated, err)
+	}
+	if rotated, err := keys.RotateIfDue(time.Now().UTC().Add(2 * time.Hour)); err != nil || !rotated {
+		t.Fatalf("expected rotation after the interval, got rotated=%v err=%v", rotated, err)
+	}
+
+	newToken := signTestToken(t, keys)
+	parsed, err := parseTestToken(keys, newToken)
+	if err != nil {
+		t.Fatalf("Parse of new token failed: %v", err)
+	}
+	if parsed.Header["kid"] == oldKID {
+		t.Errorf("expected new tokens to use the new key")
+	}
+	if _, err := parseTestToken(keys, oldToken); err != nil {
+		t.Errorf("expected token signed with retired key to stay valid, got %v", err)
+	}
+	if n := len(keys.JWKS().Keys); n != 2 {
+		t.Errorf("expected retired key to stay in JWKS, got %d keys", n)
+	}
+
+	// Once the retired key expires (one access token lifetime later) it is dropped.
+	past := time.Now().Add(-time.Second)
+	repo.keys[0].ExpiresAt = &past
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, err := parseTestToken(keys, oldToken); err == nil {
+		t.Errorf("expected token signed with expired key to be rejected")
+	}
+	if n := len(keys.JWKS().Keys); n != 1 {
+		t.Errorf("expected expired key to leave JWKS, got %d keys", n)
+	}
+}
+
+func TestJWTKeyManager_AcceptsKeysRotatedByAnotherInstance(t *testing.T) {
+	repo := &fakeJWTSigningKeyRepo{}
+	instanceA := newTestKeyManager(t, "RS256", repo)
+	instanceB := newTestKeyManager(t, "RS256", repo)
+
+	if err := instanceB.Rotate(time.Now().UTC()); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if _, err := parseTestToken(instanceA, signTestToken(t, instanceB)); err != nil {
+		t.Errorf("expected unknown kid to trigger a reload, got %v", err)
+	}
+}
+
+func TestJWTKeyManager_ConcurrentRotationKeepsOneSigningKey(t *testing.T) {
+	repo := &fakeJWTSigningKeyRepo{}
+	cluster := &fakeClusterLock{}
+	instanceA := newTestKeyManagerWithLock(t, "EdDSA", repo, cluster.replica())
+	instanceB := newTestKeyManagerWithLock(t, "EdDSA", repo, cluster.replica())
+	if n := len(repo.keys); n != 1 {
+		t.Fatalf("expected the second instance to reuse the first key, got %d keys", n)
+	}
+
+	due := time.Now().UTC().Add(2 * time.Hour)
+	var wg sync.WaitGroup
+	for _, keys := range []*services.JWTKeyManager{instanceA, instanceB} {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(keys *services.JWTKeyManager) {
+				defer wg.Done()
+				if _, err := keys.RotateIfDue(due); err != nil {
+					t.Errorf("RotateIfDue failed: %v", err)
+				}
+			}(keys)
+		}
+	}
+	wg.Wait()
+
+	signing := repo.signing()
+	if len(signing) != 1 {
+		t.Fatalf("expected exactly one signing key after concurrent rotations, got %v", signing)
+	}
+	for _, keys := range []*services.JWTKeyManager{instanceA, instanceB} {
+		if err := keys.Reload(); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+		parsed, err := parseTestToken(keys, signTestToken(t, keys))
+		if err != nil || parsed.Header["kid"] != signing[0] {
+			t.Fatalf("expected both instances to sign with %s, got %v (%v)", signing[0], parsed, err)
+		}
+	}
+}
+
+func TestJWTKeyManager_RotationNeverRetiresANewerKey(t *testing.T) {
+	repo := &fakeJWTSigningKeyRepo{}
+	instanceA := newTestKeyManager(t, "RS256", repo)
+	instanceB := newTestKeyManager(t, "RS256", repo)
+
+	// Without the lock, B finishing a rotation it started before A's must leave A's key signing
+	now := time.Now().UTC().Add(2 * time.Hour)
+	if err := instanceA.Rotate(now.Add(time.Second)); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if err := instanceB.Rotate(now); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	for _, keys := range []*services.JWTKeyManager{instanceA, instanceB} {
+		if err := keys.Reload(); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+		if _, err := keys.Sign(jwt.RegisteredClaims{Subject: "user"}); err != nil {
+			t.Fatalf("expected a signing key to survive interleaved rotations, got %v", err)
+		}
+	}
+}
+
+func TestJWTKeyManager_RejectsForeignAndConfusedTokens(t *testing.T) {
+	keys := newTestKeyManager(t, "RS256", &fakeJWTSigningKeyRepo{})
+
+	hsToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "x"}).SignedString([]byte("some-secret"))
+	if _, err := parseTestToken(keys, hsToken); err == nil {
+		t.Errorf("expected HS256 token to be rejected when no legacy secret is configured")
+	}
+
+	other := newTestKeyManager(t, "RS256", &fakeJWTSigningKeyRepo{})
+	if _, err := parseTestToken(keys, signTestToken(t, other)); !errors.Is(err, services.ErrUnknownSigningKey) {
+		t.Errorf("expected ErrUnknownSigningKey for a key we never issued, got %v", err)
+	}
+}
+
+func TestJWTKeyManager_AcceptsLegacyHS256DuringMigration(t *testing.T) {
+	legacy, err := services.NewJWTKeyManager(config.JWTConfig{Secret: "legacy-secret-minimum-32-characters"}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewJWTKeyManager failed: %v", err)
+	}
+	legacyToken := signTestToken(t, legacy)
+	if k := legacy.JWKS().Keys; len(k) != 0 {
+		t.Errorf("expected empty JWKS for HS256, got %d keys", len(k))
+	}
+
+	keys, err := services.NewJWTKeyManager(config.JWTConfig{
+		Secret:            "legacy-secret-minimum-32-characters",
+		Algorithm:         "EdDSA",
+		AccessTokenExpiry: "15m",
+	}, &fakeJWTSigningKeyRepo{}, nil)
+	if err != nil {
+		t.Fatalf("NewJWTKeyManager failed: %v", err)
+	}
+	if _, err := parseTestToken(keys, legacyToken); err != nil {
+		t.Errorf("expected HS256 token issued before the switch to remain valid, got %v", err)
+	}
+}
+
+func TestNewJWTKeyManager_RejectsUnknownAlgorithm(t *testing.T) {
+	if _, err := services.NewJWTKeyManager(config.JWTConfig{Algorithm: "none"}, &fakeJWTSigningKeyRepo{}, nil); !errors.Is(err, services.ErrUnsupportedJWTAlgorithm) {
+		t.Errorf("expected ErrUnsupportedJWTAlgorithm, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/logging"
+)
+
+func TestLogging_HandlerRedactsSecretsAndAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := logging.NewHandler(config.LoggingConfig{Level: "warn", Format: "json"}, &buf)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(handler)
+	ctx := logging.WithRequestID(context.Background(), "req-123")
+
+	logger.InfoContext(ctx, "below the configured level")
+	logger.WarnContext(ctx, "login failed",
+		"Authorization", "Bearer abc.def",
+		"X-File-Password", "hunter2",
+		slog.Group("request", "share_token", "tok", "client_secret", "s3cr3t", "file_id", "42"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected only the warn record, got %q", buf.String())
+	}
+	for _, secret := range []string{"abc.def", "hunter2", "tok\"", "s3cr3t"} {
+		if strings.Contains(lines[0], secret) {
+			t.Fatalf("secret %q leaked: %s", secret, lines[0])
+		}
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("record is not JSON: %v", err)
+	}
+	if record["request_id"] != "req-123" || record["Authorization"] != logging.Redacted {
+		t.Fatalf("unexpected record %v", record)
+	}
+	if group, _ := record["request"].(map[string]interface{}); group["file_id"] != "42" {
+		t.Fatalf("non-secret attributes must be kept: %v", record)
+	}
+
+	if _, err := logging.NewHandler(config.LoggingConfig{Level: "verbose"}, &buf); err == nil {
+		t.Fatalf("expected an error for an unknown level")
+	}
+	if got := logging.RedactQuery("password=x&page=2&code=abc"); strings.Contains(got, "=x") || strings.Contains(got, "abc") || !strings.Contains(got, "page=2") {
+		t.Fatalf("unexpected redacted query %q", got)
+	}
+}
+
+func TestLogging_RequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.RequestIDMiddleware())
+	var seen string
+	router.GET("/ok", func(c *gin.Context) {
+		seen = logging.RequestID(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	router.GET("/denied", func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "nope"})
+	})
+
+	// A well-formed ID from a proxy is kept and reaches the request context.
+	req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+	req.Header.Set(logging.RequestIDHeader, "edge-42")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Header().Get(logging.RequestIDHeader) != "edge-42" || seen != "edge-42" {
+		t.Fatalf("expected the incoming request ID to be reused, got header %q, context %q", rec.Header().Get(logging.RequestIDHeader), seen)
+	}
+	if strings.Contains(rec.Body.String(), "requestId") {
+		t.Fatalf("successful responses must not be modified: %s", rec.Body.String())
+	}
+
+	// Malformed IDs are replaced, and error bodies carry the ID.
+	req = httptest.NewRequest(http.MethodGet, "/denied", nil)
+	req.Header.Set(logging.RequestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	id := rec.Header().Get(logging.RequestIDHeader)
+	if id == "" || id == "bad id\n" {
+		t.Fatalf("expected a generated request ID, got %q", id)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body %q: %v", rec.Body.String(), err)
+	}
+	if rec.Code != http.StatusForbidden || body["requestId"] != id || body["message"] != "nope" {
+		t.Fatalf("unexpected error response %d %v", rec.Code, body)
+	}
+}
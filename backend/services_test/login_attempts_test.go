@@ -0,0 +1,316 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// fakeLoginSessionRepo keeps login sessions in memory.
+type fakeLoginSessionRepo struct {
+	sessions map[uuid.UUID]*models.LoginSession
+}
+
+func newFakeLoginSessionRepo() *fakeLoginSessionRepo {
+	return &fakeLoginSessionRepo{sessions: make(map[uuid.UUID]*models.LoginSession)}
+}
+
+func (f *fakeLoginSessionRepo) Create(userID uuid.UUID, ttl time.Duration) (*models.LoginSession, error) {
+	now := time.Now().UTC()
+	session := &models.LoginSession{
+		ID:        uuid.New(),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	f.sessions[session.ID] = session
+	return session, nil
+}
+
+func (f *fakeLoginSessionRepo) GetActiveByID(id uuid.UUID, now time.Time) (*models.LoginSession, error) {
+	session, ok := f.sessions[id]
+	if !ok || session.ConsumedAt != nil || !session.ExpiresAt.After(now) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (f *fakeLoginSessionRepo) ReserveAttempt(id uuid.UUID, maxAttempts int) (int, bool, error) {
+	session, ok := f.sessions[id]
+	if !ok || session.ConsumedAt != nil || session.FailedAttempts >= maxAttempts {
+		return 0, false, nil
+	}
+	session.FailedAttempts++
+	return session.FailedAttempts, true, nil
+}
+
+func (f *fakeLoginSessionRepo) MarkConsumed(id uuid.UUID, consumedAt time.Time) error {
+	session, ok := f.sessions[id]
+	if !ok || session.ConsumedAt != nil {
+		return gorm.ErrRecordNotFound
+	}
+	session.ConsumedAt = &consumedAt
+	return nil
+}
+
+// racingLoginSessionRepo lets a concurrent request with the same code consume the
+// session while this one is still checking its code.
+type racingLoginSessionRepo struct {
+	*fakeLoginSessionRepo
+}
+
+func (r racingLoginSessionRepo) ReserveAttempt(id uuid.UUID, maxAttempts int) (int, bool, error) {
+	attempts, ok, err := r.fakeLoginSessionRepo.ReserveAttempt(id, maxAttempts)
+	if ok {
+		_ = r.MarkConsumed(id, time.Now().UTC())
+	}
+	return attempts, ok, err
+}
+
+type fakeSecurityEventRepo struct {
+	events []models.SecurityEvent
+}
+
+func (f *fakeSecurityEventRepo) Create(event *models.SecurityEvent) error {
+	f.events = append(f.events, *event)
+	return nil
+}
+
+func (f *fakeSecurityEventRepo) GetByUserID(userID uuid.UUID, limit, offset int) ([]models.SecurityEvent, int64, error) {
+	var result []models.SecurityEvent
+	for _, e := range f.events {
+		if e.UserID == userID {
+			result = append(result, e)
+		}
+	}
+	return result, int64(len(result)), nil
+}
+
+func (f *fakeSecurityEventRepo) count(eventType models.SecurityEventType) int {
+	n := 0
+	for _, e := range f.events {
+		if e.EventType == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+// newTOTPUserRepo returns a mock user repo backed by a single TOTP-enabled user.
+func newTOTPUserRepo(user *models.User) *mockUserRepo {
+	return &mockUserRepo{
+		getByIDFunc: func(id uuid.UUID) (*models.User, error) {
+			copied := *user
+			return &copied, nil
+		},
+		getByEmailFunc: func(email string) (*models.User, error) {
+			copied := *user
+			return &copied, nil
+		},
+		incrementTOTPFailedAttemptsFunc: func(id uuid.UUID) (int, error) {
+			user.TOTPFailedAttempts++
+			return user.TOTPFailedAttempts, nil
+		},
+		resetTOTPFailedAttemptsFunc: func(id uuid.UUID) error {
+			user.TOTPFailedAttempts = 0
+			user.LockedUntil = nil
+			return nil
+		},
+		setLockedUntilFunc: func(id uuid.UUID, until *time.Time) error {
+			user.LockedUntil = until
+			return nil
+		},
+	}
+}
+
+func newTOTPUser() *models.User {
+	secret := "JBSWY3DPEHPK3PXP"
+	enabled := true
+	return &models.User{
+		ID:          uuid.New(),
+		Email:       "user@example.com",
+		Username:    "user",
+		TOTPSecret:  &secret,
+		TOTPEnabled: &enabled,
+	}
+}
+
+func TestAuthService_LoginWithTOTPSession_LocksSessionAfterMaxAttempts(t *testing.T) {
+	user := newTOTPUser()
+	sessions := newFakeLoginSessionRepo()
+	events := &fakeSecurityEventRepo{}
+
+	authService := services.NewAuthServiceWithLoginSessions(newTOTPUserRepo(user), sessions, newAuthTestConfig())
+	authService.SetSecurityEventRepository(events)
+
+	cid, err := authService.CreateLoginSession(user.ID)
+	if err != nil {
+		t.Fatalf("failed to create login session: %v", err)
+	}
+
+	for i := 1; i < 5; i++ {
+		_, err := authService.LoginWithTOTPSession(cid, "000000", services.ClientInfo{IPAddress: "10.0.0.1"})
+		if !errors.Is(err, services.ErrInvalidTOTPCode) {
+			t.Fatalf("attempt %d: expected ErrInvalidTOTPCode, got %v", i, err)
+		}
+	}
+
+	_, err = authService.LoginWithTOTPSession(cid, "000000", services.ClientInfo{})
+	if !errors.Is(err, services.ErrTOTPAttemptsExceeded) {
+		t.Fatalf("expected ErrTOTPAttemptsExceeded on 5th attempt, got %v", err)
+	}
+
+	// Even the correct code must not be accepted on a consumed session.
+	code, _ := totp.GenerateCode(*user.TOTPSecret, time.Now())
+	if _, err := authService.LoginWithTOTPSession(cid, code, services.ClientInfo{}); !errors.Is(err, services.ErrLoginSessionExpired) {
+		t.Errorf("expected ErrLoginSessionExpired after session lock, got %v", err)
+	}
+
+	if got := events.count(models.SecurityEventTOTPFailed); got != 5 {
+		t.Errorf("expected 5 totp_failed events, got %d", got)
+	}
+	if got := events.count(models.SecurityEventLoginSessionLocked); got != 1 {
+		t.Errorf("expected 1 login_session_locked event, got %d", got)
+	}
+}
+
+func TestAuthService_LoginWithTOTPSession_LocksAccountWithBackoff(t *testing.T) {
+	user := newTOTPUser()
+	user.TOTPFailedAttempts = 9
+	sessions := newFakeLoginSessionRepo()
+	events := &fakeSecurityEventRepo{}
+
+	authService := services.NewAuthServiceWithLoginSessions(newTOTPUserRepo(user), sessions, newAuthTestConfig())
+	authService.SetSecurityEventRepository(events)
+
+	cid, _ := authService.CreateLoginSession(user.ID)
+	_, err := authService.LoginWithTOTPSession(cid, "000000", services.ClientInfo{})
+
+	var lockedErr *services.AccountLockedError
+	if !errors.As(err, &lockedErr) {
+		t.Fatalf("expected AccountLockedError, got %v", err)
+	}
+	if !errors.Is(err, services.ErrAccountLocked) {
+		t.Errorf("expected error to match ErrAccountLocked")
+	}
+	firstLock := time.Until(lockedErr.Until)
+	if firstLock <= 0 || firstLock > time.Minute {
+		t.Errorf("expected first lockout of about 1 minute, got %v", firstLock)
+	}
+
+	// While locked, even a valid code is refused.
+	cid, _ = authService.CreateLoginSession(user.ID)
+	code, _ := totp.GenerateCode(*user.TOTPSecret, time.Now())
+	if _, err := authService.LoginWithTOTPSession(cid, code, services.ClientInfo{}); !errors.Is(err, services.ErrAccountLocked) {
+		t.Fatalf("expected ErrAccountLocked while locked, got %v", err)
+	}
+
+	// After the lock expires, another failure doubles the lockout.
+	expired := time.Now().Add(-time.Second)
+	user.LockedUntil = &expired
+	cid, _ = authService.CreateLoginSession(user.ID)
+	_, err = authService.LoginWithTOTPSession(cid, "000000", services.ClientInfo{})
+	if !errors.As(err, &lockedErr) {
+		t.Fatalf("expected AccountLockedError, got %v", err)
+	}
+	secondLock := time.Until(lockedErr.Until)
+	if secondLock <= time.Minute || secondLock > 2*time.Minute {
+		t.Errorf("expected second lockout of about 2 minutes, got %v", secondLock)
+	}
+
+	if got := events.count(models.SecurityEventAccountLocked); got != 2 {
+		t.Errorf("expected 2 account_locked events, got %d", got)
+	}
+}
+
+func TestAuthService_LoginWithTOTPSession_CountsAttemptsBeforeChecking(t *testing.T) {
+	user := newTOTPUser()
+	sessions := newFakeLoginSessionRepo()
+	authService := services.NewAuthServiceWithLoginSessions(newTOTPUserRepo(user), sessions, newAuthTestConfig())
+
+	cid, _ := authService.CreateLoginSession(user.ID)
+	// Five guesses still being checked have used up the session's attempts.
+	for i := 0; i < 5; i++ {
+		if _, ok, _ := sessions.ReserveAttempt(cid, 5); !ok {
+			t.Fatalf("reservation %d refused", i+1)
+		}
+	}
+
+	code, _ := totp.GenerateCode(*user.TOTPSecret, time.Now())
+	if _, err := authService.LoginWithTOTPSession(cid, code, services.ClientInfo{}); !errors.Is(err, services.ErrTOTPAttemptsExceeded) {
+		t.Fatalf("expected ErrTOTPAttemptsExceeded, got %v", err)
+	}
+	if sessions.sessions[cid].FailedAttempts != 5 {
+		t.Errorf("expected no attempt beyond the limit, got %d", sessions.sessions[cid].FailedAttempts)
+	}
+}
+
+func TestAuthService_LoginWithTOTPSession_ConsumesSessionOnce(t *testing.T) {
+	user := newTOTPUser()
+	sessions := racingLoginSessionRepo{newFakeLoginSessionRepo()}
+	authService := services.NewAuthServiceWithLoginSessions(newTOTPUserRepo(user), sessions, newAuthTestConfig())
+
+	cid, _ := authService.CreateLoginSession(user.ID)
+	code, _ := totp.GenerateCode(*user.TOTPSecret, time.Now())
+	if _, err := authService.LoginWithTOTPSession(cid, code, services.ClientInfo{}); !errors.Is(err, services.ErrLoginSessionExpired) {
+		t.Fatalf("expected the session consumed by the other request to be refused, got %v", err)
+	}
+}
+
+func TestAuthService_LoginWithTOTPSession_SuccessResetsFailures(t *testing.T) {
+	user := newTOTPUser()
+	user.TOTPFailedAttempts = 3
+
+	authService := services.NewAuthServiceWithLoginSessions(newTOTPUserRepo(user), newFakeLoginSessionRepo(), newAuthTestConfig())
+
+	cid, _ := authService.CreateLoginSession(user.ID)
+	code, _ := totp.GenerateCode(*user.TOTPSecret, time.Now())
+	if _, err := authService.LoginWithTOTPSession(cid, code, services.ClientInfo{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if user.TOTPFailedAttempts != 0 {
+		t.Errorf("expected failure counter reset, got %d", user.TOTPFailedAttempts)
+	}
+}
+
+func TestAuthService_Login_AccountLocked(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("failed to generate password hash: %v", err)
+	}
+	user := newTOTPUser()
+	user.PasswordHash = string(hash)
+	lockedUntil := time.Now().Add(10 * time.Minute)
+	user.LockedUntil = &lockedUntil
+
+	authService := newTestAuthServiceWithUserRepo(newTOTPUserRepo(user))
+	events := &fakeSecurityEventRepo{}
+	authService.SetSecurityEventRepository(events)
+
+	// A user agent longer than the column, cut in the middle of a multi-byte character
+	userAgent := "Mozilla/5.0 " + strings.Repeat("é", 200)
+	_, _, err = authService.Login(user.Email, "password123", services.ClientInfo{IPAddress: "203.0.113.9", UserAgent: userAgent})
+	if !errors.Is(err, services.ErrAccountLocked) {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+	if len(events.events) != 1 || events.events[0].EventType != models.SecurityEventLoginBlocked {
+		t.Fatalf("expected one login_blocked event, got %+v", events.events)
+	}
+	event := events.events[0]
+	if event.IPAddress == nil || *event.IPAddress != "203.0.113.9" {
+		t.Errorf("expected the client IP on the event, got %v", event.IPAddress)
+	}
+	if event.UserAgent == nil || len(*event.UserAgent) > 255 || !utf8.ValidString(*event.UserAgent) || !strings.HasPrefix(userAgent, *event.UserAgent) {
+		t.Errorf("expected the user agent cut to valid UTF-8 within 255 bytes, got %q", *event.UserAgent)
+	}
+}
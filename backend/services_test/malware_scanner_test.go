@@ -0,0 +1,295 @@
+package services_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/scanner"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd speaks just enough of the clamd protocol (zPING, zINSTREAM) for the scanner.
+type fakeClamd struct {
+	listener net.Listener
+	reply    func(data []byte) string
+
+	mu       sync.Mutex
+	received [][]byte
+}
+
+func startFakeClamd(t *testing.T, reply func(data []byte) string) *fakeClamd {
+	t.Helper()
+	return startFakeClamdAt(t, "127.0.0.1:0", reply)
+}
+
+func startFakeClamdAt(t *testing.T, address string, reply func(data []byte) string) *fakeClamd {
+	t.Helper()
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	d := &fakeClamd{listener: listener, reply: reply}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.handle(conn)
+		}
+	}()
+	return d
+}
+
+func (d *fakeClamd) address() string {
+	return "tcp://" + d.listener.Addr().String()
+}
+
+func (d *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch strings.TrimSuffix(command, "\x00") {
+	case "zPING":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM":
+		var data []byte
+		header := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(r, header); err != nil {
+				return
+			}
+			size := binary.BigEndian.Uint32(header)
+			if size == 0 {
+				break
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk...)
+		}
+		d.mu.Lock()
+		d.received = append(d.received, data)
+		d.mu.Unlock()
+		conn.Write([]byte(d.reply(data) + "\x00"))
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func eicarReply(data []byte) string {
+	if bytes.Contains(data, []byte(eicar)) {
+		return "stream: Win.Test.EICAR_HDB-1 FOUND"
+	}
+	return "stream: OK"
+}
+
+func newTestClamAV(t *testing.T, d *fakeClamd) *scanner.ClamAV {
+	t.Helper()
+	clam, err := scanner.NewClamAV(d.address(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClamAV failed: %v", err)
+	}
+	return clam
+}
+
+func TestClamAV_ScanVerdicts(t *testing.T) {
+	daemon := startFakeClamd(t, eicarReply)
+	clam := newTestClamAV(t, daemon)
+
+	if err := clam.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	clean, err := clam.Scan(context.Background(), strings.NewReader("just a text file"))
+	if err != nil {
+		t.Fatalf("Scan clean failed: %v", err)
+	}
+	if clean.Infected {
+		t.Fatalf("expected clean verdict, got %+v", clean)
+	}
+
+	infected, err := clam.Scan(context.Background(), strings.NewReader(eicar))
+	if err != nil {
+		t.Fatalf("Scan infected failed: %v", err)
+	}
+	if !infected.Infected || infected.Signature != "Win.Test.EICAR_HDB-1" {
+		t.Fatalf("expected EICAR signature, got %+v", infected)
+	}
+}
+
+func TestClamAV_StreamsLargeInputInChunks(t *testing.T) {
+	daemon := startFakeClamd(t, eicarReply)
+	clam := newTestClamAV(t, daemon)
+
+	// Put the signature past the first chunk so it only matches if the stream is reassembled.
+	payload := append(bytes.Repeat([]byte("a"), 100*1024), []byte(eicar)...)
+	result, err := clam.Scan(context.Background(), bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if !result.Infected {
+		t.Fatalf("expected infected verdict for signature beyond the first chunk")
+	}
+
+	daemon.mu.Lock()
+	defer daemon.mu.Unlock()
+	if len(daemon.received) != 1 || !bytes.Equal(daemon.received[0], payload) {
+		t.Fatalf("daemon did not receive the full stream")
+	}
+}
+
+func TestClamAV_ErrorReplies(t *testing.T) {
+	daemon := startFakeClamd(t, func([]byte) string { return "INSTREAM size limit exceeded. ERROR" })
+	clam := newTestClamAV(t, daemon)
+
+	_, err := clam.Scan(context.Background(), strings.NewReader("data"))
+	if !errors.Is(err, scanner.ErrScanFailed) {
+		t.Fatalf("expected ErrScanFailed, got %v", err)
+	}
+
+	unreachable, err := scanner.NewClamAV("tcp://127.0.0.1:1", time.Second)
+	if err != nil {
+		t.Fatalf("NewClamAV failed: %v", err)
+	}
+	if _, err := unreachable.Scan(context.Background(), strings.NewReader("data")); !errors.Is(err, scanner.ErrScanFailed) {
+		t.Fatalf("expected ErrScanFailed for unreachable daemon, got %v", err)
+	}
+}
+
+func TestCheckScanStatus_Policies(t *testing.T) {
+	status := func(s models.ScanStatus) *models.File { return &models.File{ScanStatus: &s} }
+
+	tests := []struct {
+		name   string
+		file   *models.File
+		policy string
+		want   error
+	}{
+		{"unscanned allowed", &models.File{}, models.ScanPolicyRequireClean, nil},
+		{"clean allowed", status(models.ScanStatusClean), models.ScanPolicyRequireClean, nil},
+		{"pending blocked when clean required", status(models.ScanStatusPending), models.ScanPolicyRequireClean, services.ErrFileNotScanned},
+		{"error blocked when clean required", status(models.ScanStatusError), models.ScanPolicyRequireClean, services.ErrFileNotScanned},
+		{"pending allowed when only infected blocked", status(models.ScanStatusPending), models.ScanPolicyBlockInfected, nil},
+		{"infected always blocked", status(models.ScanStatusInfected), models.ScanPolicyBlockInfected, services.ErrFileInfected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := services.CheckScanStatus(tt.file, tt.policy); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFileService_ScanFileQuarantinesInfected(t *testing.T) {
+	db := newTestDB(t)
+	store := newFakeStorage()
+	svc := services.NewFileService(db, store)
+
+	isPublic := true
+	file, err := svc.UploadFile(context.Background(), &services.UploadInput{
+		FileName:    "eicar.txt",
+		ContentType: "text/plain",
+		Size:        int64(len(eicar)),
+		Reader:      strings.NewReader(eicar),
+		IsPublic:    &isPublic,
+	})
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if file.ScanStatus != nil {
+		t.Fatalf("expected no scan status without a scanner, got %v", *file.ScanStatus)
+	}
+
+	svc.SetScanner(newTestClamAV(t, startFakeClamd(t, eicarReply)))
+	scanned, err := svc.ScanFile(context.Background(), file.ID)
+	if err != nil {
+		t.Fatalf("ScanFile failed: %v", err)
+	}
+
+	if scanned.ScanStatus == nil || *scanned.ScanStatus != models.ScanStatusInfected {
+		t.Fatalf("expected infected status, got %v", scanned.ScanStatus)
+	}
+	if scanned.ScanSignature == nil || *scanned.ScanSignature != "Win.Test.EICAR_HDB-1" {
+		t.Fatalf("expected signature to be recorded, got %v", scanned.ScanSignature)
+	}
+	if scanned.QuarantinedAt == nil || !strings.Contains(scanned.FilePath, "quarantine-") {
+		t.Fatalf("expected file to be quarantined, path=%s", scanned.FilePath)
+	}
+	if _, ok := store.files[file.FilePath]; ok {
+		t.Fatalf("expected original object to be removed")
+	}
+	if err := svc.CheckDownloadAllowed(context.Background(), scanned); !errors.Is(err, services.ErrFileInfected) {
+		t.Fatalf("expected download to be refused, got %v", err)
+	}
+}
+
+func TestFileService_ScanPendingRetriesScansFailedWhileClamdWasDown(t *testing.T) {
+	db := newTestDB(t)
+	svc := services.NewFileService(db, newFakeStorage())
+	tasks := services.NewBackgroundTasks()
+	svc.SetBackgroundTasks(tasks)
+
+	// Take a free port and leave it closed, so clamd is unreachable at upload
+	daemon := startFakeClamd(t, eicarReply)
+	address := daemon.listener.Addr().String()
+	daemon.listener.Close()
+	svc.SetScanner(newTestClamAV(t, daemon))
+
+	file := uploadModerationTestFile(t, svc, "report.pdf", "application/pdf", true)
+	if err := tasks.Wait(context.Background()); err != nil {
+		t.Fatalf("waiting for the background scan failed: %v", err)
+	}
+	failed, err := svc.GetByID(file.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if failed.ScanStatus == nil || *failed.ScanStatus != models.ScanStatusError || failed.ScanAttempts != 1 || failed.NextScanAt == nil {
+		t.Fatalf("expected a failed scan scheduled for a retry, got %+v", failed)
+	}
+	if err := svc.CheckDownloadAllowed(context.Background(), failed); !errors.Is(err, services.ErrFileNotScanned) {
+		t.Fatalf("expected the download to wait for a clean scan, got %v", err)
+	}
+
+	startFakeClamdAt(t, address, eicarReply)
+	if scanned, err := svc.ScanPending(context.Background(), time.Minute, 10); err != nil || scanned != 0 {
+		t.Fatalf("expected the retry to wait for its backoff, got %d (%v)", scanned, err)
+	}
+	if err := db.Model(&models.File{}).Where("id = ?", file.ID).Update("next_scan_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("failed to make the retry due: %v", err)
+	}
+	if scanned, err := svc.ScanPending(context.Background(), time.Minute, 10); err != nil || scanned != 1 {
+		t.Fatalf("expected the failed scan to be retried, got %d (%v)", scanned, err)
+	}
+
+	clean, err := svc.GetByID(file.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if *clean.ScanStatus != models.ScanStatusClean || clean.ScanAttempts != 0 || clean.NextScanAt != nil {
+		t.Fatalf("expected a clean verdict with the retry state cleared, got %+v", clean)
+	}
+	if err := svc.CheckDownloadAllowed(context.Background(), clean); err != nil {
+		t.Fatalf("expected the download to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/metrics"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+)
+
+// metricValue sums the samples of the metric name whose labels include labels.
+// Metrics are process-wide, so tests compare values before and after an action.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	var total float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	samples:
+		for _, m := range family.GetMetric() {
+			got := map[string]string{}
+			for _, l := range m.GetLabel() {
+				got[l.GetName()] = l.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue samples
+				}
+			}
+			switch {
+			case m.GetCounter() != nil:
+				total += m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				total += float64(m.GetHistogram().GetSampleCount())
+			case m.GetGauge() != nil:
+				total += m.GetGauge().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+func TestMetrics_InstrumentStorage(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeStorage()
+	st := metrics.InstrumentStorage(fake, "test")
+	ops := func(op string) float64 {
+		return metricValue(t, "filesharing_storage_operation_duration_seconds", map[string]string{"backend": "test", "operation": op})
+	}
+	errs := func(op string) float64 {
+		return metricValue(t, "filesharing_storage_operation_errors_total", map[string]string{"backend": "test", "operation": op})
+	}
+	uploads, stats, statErrs, deletes, deleteErrs := ops("upload"), ops("stat"), errs("stat"), ops("delete"), errs("delete")
+
+	loc, err := st.Upload(ctx, &storage.Object{Name: "a.txt", Container: storage.ContainerPublic, ContentType: "text/plain", Size: 5, Reader: bytes.NewReader([]byte("hello"))})
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if _, err := st.Stat(ctx, &storage.Location{Container: storage.ContainerPublic, Path: "missing"}); !errors.Is(err, storage.ErrObjectNotFound) {
+		t.Fatalf("wrapper must pass errors through, got %v", err)
+	}
+	fake.deleteErr = errors.New("backend down")
+	if err := st.Delete(ctx, loc); err == nil {
+		t.Fatalf("expected delete error")
+	}
+
+	if ops("upload") != uploads+1 || ops("stat") != stats+1 || ops("delete") != deletes+1 {
+		t.Fatalf("every call must be timed")
+	}
+	if errs("stat") != statErrs {
+		t.Fatalf("a missing object is not a backend error")
+	}
+	if errs("delete") != deleteErrs+1 {
+		t.Fatalf("failed delete must be counted")
+	}
+}
+
+func TestMetrics_MiddlewareUsesRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(metrics.Middleware())
+	router.GET("/api/files/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	route := map[string]string{"method": "GET", "route": "/api/files/:id", "status": "204"}
+	unmatched := map[string]string{"route": "unmatched", "status": "404"}
+	before, beforeUnmatched := metricValue(t, "filesharing_http_request_duration_seconds", route), metricValue(t, "filesharing_http_request_duration_seconds", unmatched)
+
+	for _, path := range []string{"/api/files/1", "/api/files/2", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := metricValue(t, "filesharing_http_request_duration_seconds", route) - before; got != 2 {
+		t.Fatalf("expected both requests under the route template, got %v", got)
+	}
+	if got := metricValue(t, "filesharing_http_request_duration_seconds", unmatched) - beforeUnmatched; got != 1 {
+		t.Fatalf("expected the unknown path under \"unmatched\", got %v", got)
+	}
+}
+
+func TestMetrics_TransfersCleanupAndAuthFailures(t *testing.T) {
+	bytesSent := metricValue(t, "filesharing_transfer_bytes_total", map[string]string{"direction": "download"})
+	aborted := metricValue(t, "filesharing_transfer_duration_seconds", map[string]string{"direction": "download", "result": "failed"})
+	metrics.ObserveTransfer(metrics.DirectionDownload, 512, time.Now(), false)
+	if metricValue(t, "filesharing_transfer_bytes_total", map[string]string{"direction": "download"}) != bytesSent+512 ||
+		metricValue(t, "filesharing_transfer_duration_seconds", map[string]string{"direction": "download", "result": "failed"}) != aborted+1 {
+		t.Fatalf("transfer metrics not recorded")
+	}
+
+	deleted := metricValue(t, "filesharing_cleanup_files_total", map[string]string{"result": "deleted"})
+	runs := metricValue(t, "filesharing_cleanup_runs_total", map[string]string{"status": "partial"})
+	finished := time.Now()
+	metrics.ObserveCleanupRun(&models.CleanupRun{Trigger: models.CleanupTriggerSchedule, Status: models.CleanupRunPartial, FilesDeleted: 3, FilesFailed: 1, BytesReclaimed: 100, FinishedAt: &finished})
+	metrics.ObserveCleanupRun(&models.CleanupRun{Trigger: models.CleanupTriggerSchedule, Status: models.CleanupRunSucceeded, DryRun: true, FilesFound: 7, FinishedAt: &finished})
+	if metricValue(t, "filesharing_cleanup_runs_total", map[string]string{"status": "partial"}) != runs+1 {
+		t.Fatalf("cleanup run not counted")
+	}
+	if metricValue(t, "filesharing_cleanup_files_total", map[string]string{"result": "deleted"}) != deleted+3 {
+		t.Fatalf("dry runs must not count as deleted files")
+	}
+
+	failures := metricValue(t, "filesharing_auth_failures_total", map[string]string{"method": "password", "reason": "invalid_credentials"})
+	metrics.AuthFailure("password", "invalid_credentials")
+	if metricValue(t, "filesharing_auth_failures_total", map[string]string{"method": "password", "reason": "invalid_credentials"}) != failures+1 {
+		t.Fatalf("auth failure not counted")
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "filesharing_auth_failures_total") {
+		t.Fatalf("exposition should include the auth failure counter, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,442 @@
+package services_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS and a token endpoint that checks PKCE.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	codes  map[string]mockAuthCode
+}
+
+type mockAuthCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	idp := &mockIdP{key: key, codes: make(map[string]mockAuthCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		code, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, code.claims)
+		token.Header["kid"] = "test-key"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "idp-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the user approving the login at the IdP: it reads state, nonce and
+// code_challenge from the authorization URL and issues a code for the given claims.
+func (idp *mockIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (state, code string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid authorization url: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization url is missing PKCE parameters: %s", authURL)
+	}
+	if !strings.Contains(q.Get("scope"), "openid") {
+		t.Fatalf("authorization url is missing openid scope: %s", authURL)
+	}
+
+	now := time.Now()
+	full := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   "test-client",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	code = uuid.NewString()
+	idp.codes[code] = mockAuthCode{challenge: q.Get("code_challenge"), claims: full}
+	return q.Get("state"), code
+}
+
+type fakeUserIdentityRepo struct {
+	identities []models.UserIdentity
+}
+
+func (f *fakeUserIdentityRepo) Create(identity *models.UserIdentity) error {
+	if identity.ID == uuid.Nil {
+		identity.ID = uuid.New()
+	}
+	f.identities = append(f.identities, *identity)
+	return nil
+}
+
+func (f *fakeUserIdentityRepo) GetByIssuerSubject(issuer, subject string) (*models.UserIdentity, error) {
+	for _, i := range f.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			copied := i
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeUserIdentityRepo) UpdateLastLogin(id uuid.UUID, at time.Time) error {
+	return nil
+}
+
+type fakeOIDCAuthRequestRepo struct {
+	requests map[string]models.OIDCAuthRequest
+}
+
+func (f *fakeOIDCAuthRequestRepo) Create(request *models.OIDCAuthRequest) error {
+	f.requests[request.State] = *request
+	return nil
+}
+
+func (f *fakeOIDCAuthRequestRepo) Consume(state string, now time.Time) (*models.OIDCAuthRequest, error) {
+	request, ok := f.requests[state]
+	delete(f.requests, state)
+	if !ok || !request.ExpiresAt.After(now) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &request, nil
+}
+
+func (f *fakeOIDCAuthRequestRepo) DeleteExpired(now time.Time) error {
+	return nil
+}
+
+// newInMemoryUserRepo returns a mock user repo backed by a slice of users.
+func newInMemoryUserRepo(users ...*models.User) (*mockUserRepo, *[]*models.User) {
+	store := &users
+	find := func(match func(u *models.User) bool) (*models.User, error) {
+		for _, u := range *store {
+			if match(u) {
+				copied := *u
+				return &copied, nil
+			}
+		}
+		return nil, gorm.ErrRecordNotFound
+	}
+	repo := &mockUserRepo{
+		getByIDFunc: func(id uuid.UUID) (*models.User, error) {
+			return find(func(u *models.User) bool { return u.ID == id })
+		},
+		getByEmailFunc: func(email string) (*models.User, error) {
+			return find(func(u *models.User) bool { return strings.EqualFold(u.Email, email) })
+		},
+		existsByUsernameFunc: func(username string) (bool, error) {
+			u, _ := find(func(u *models.User) bool { return strings.EqualFold(u.Username, username) })
+			return u != nil, nil
+		},
+		createFunc: func(user *models.User) error {
+			if user.ID == uuid.Nil {
+				user.ID = uuid.New()
+			}
+			copied := *user
+			*store = append(*store, &copied)
+			return nil
+		},
+		updateFunc: func(user *models.User) error {
+			for _, u := range *store {
+				if u.ID == user.ID {
+					*u = *user
+					return nil
+				}
+			}
+			return gorm.ErrRecordNotFound
+		},
+	}
+	return repo, store
+}
+
+func newTestOIDCService(idp *mockIdP, userRepo *mockUserRepo, identities *fakeUserIdentityRepo) *services.OIDCService {
+	cfg := config.OIDCConfig{
+		Enabled:     true,
+		IssuerURL:   idp.server.URL,
+		ClientID:    "test-client",
+		RedirectURL: "http://localhost:3000/auth/oidc/callback",
+		Scopes:      []string{"email", "profile"},
+		RoleClaim:   "groups",
+		RoleMapping: map[string]string{"file-sharing-admins": "admin", "file-sharing-moderators": "moderator"},
+	}
+	requests := &fakeOIDCAuthRequestRepo{requests: make(map[string]models.OIDCAuthRequest)}
+	return services.NewOIDCService(cfg, userRepo, identities, requests)
+}
+
+func oidcLogin(t *testing.T, svc *services.OIDCService, idp *mockIdP, claims jwt.MapClaims) (*models.User, error) {
+	t.Helper()
+	authURL, err := svc.AuthorizationURL(context.Background())
+	if err != nil {
+		t.Fatalf("AuthorizationURL failed: %v", err)
+	}
+	state, code := idp.authorize(t, authURL, claims)
+	return svc.Callback(context.Background(), state, code)
+}
+
+func TestOIDCService_ProvisionsUserWithMappedRole(t *testing.T) {
+	idp := newMockIdP(t)
+	userRepo, users := newInMemoryUserRepo()
+	identities := &fakeUserIdentityRepo{}
+	svc := newTestOIDCService(idp, userRepo, identities)
+
+	user, err := oidcLogin(t, svc, idp, jwt.MapClaims{
+		"sub":                "idp-user-1",
+		"email":              "alice@corp.example",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             []string{"staff", "file-sharing-admins"},
+	})
+	if err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+	if user.Username != "alice" || user.Email != "alice@corp.example" {
+		t.Errorf("unexpected provisioned user: %+v", user)
+	}
+	if user.Role != models.RoleAdmin {
+		t.Errorf("expected admin role from group mapping, got %s", user.Role)
+	}
+	if len(*users) != 1 || len(identities.identities) != 1 {
+		t.Fatalf("expected 1 user and 1 identity, got %d and %d", len(*users), len(identities.identities))
+	}
+
+	// A second login resolves the same user via issuer+subject; losing the group does not
+	// demote, since demotions must go through the admin API.
+	again, err := oidcLogin(t, svc, idp, jwt.MapClaims{
+		"sub":            "idp-user-1",
+		"email":          "alice@corp.example",
+		"email_verified": true,
+		"groups":         []string{"staff"},
+	})
+	if err != nil {
+		t.Fatalf("second Callback failed: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("expected same user on second login")
+	}
+	if again.Role != models.RoleAdmin {
+		t.Errorf("expected admin role to be kept, got %s", again.Role)
+	}
+	if len(*users) != 1 {
+		t.Errorf("expected no new user on second login, got %d users", len(*users))
+	}
+}
+
+func TestOIDCService_HighestMappedRoleWins(t *testing.T) {
+	idp := newMockIdP(t)
+	userRepo, _ := newInMemoryUserRepo()
+	svc := newTestOIDCService(idp, userRepo, &fakeUserIdentityRepo{})
+
+	user, err := oidcLogin(t, svc, idp, jwt.MapClaims{
+		"sub":            "idp-user-mod",
+		"email":          "mod@corp.example",
+		"email_verified": true,
+		"groups":         []string{"file-sharing-moderators"},
+	})
+	if err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+	if user.Role != models.RoleModerator {
+		t.Errorf("expected moderator role, got %s", user.Role)
+	}
+
+	user, err = oidcLogin(t, svc, idp, jwt.MapClaims{
+		"sub":            "idp-user-mod",
+		"email":          "mod@corp.example",
+		"email_verified": true,
+		"groups":         []string{"file-sharing-admins", "file-sharing-moderators"},
+	})
+	if err != nil {
+		t.Fatalf("second Callback failed: %v", err)
+	}
+	if user.Role != models.RoleAdmin {
+		t.Errorf("expected admin to outrank moderator, got %s", user.Role)
+	}
+}
+
+func TestOIDCService_LinksExistingUserByVerifiedEmail(t *testing.T) {
+	idp := newMockIdP(t)
+	existing := &models.User{ID: uuid.New(), Username: "bob", Email: "bob@corp.example", Role: models.RoleUser}
+	userRepo, users := newInMemoryUserRepo(existing)
+	identities := &fakeUserIdentityRepo{}
+	svc := newTestOIDCService(idp, userRepo, identities)
+
+	user, err := oidcLogin(t, svc, idp, jwt.MapClaims{
+		"sub":            "idp-user-2",
+		"email":          "BOB@corp.example",
+		"email_verified": "true",
+	})
+	if err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("expected existing user to be linked, got %s", user.ID)
+	}
+	if len(*users) != 1 || len(identities.identities) != 1 || identities.identities[0].UserID != existing.ID {
+		t.Errorf("expected identity linked to existing user")
+	}
+}
+
+func TestOIDCService_KeepsExistingAdminWithoutMappedClaim(t *testing.T) {
+	idp := newMockIdP(t)
+	existing := &models.User{ID: uuid.New(), Username: "root", Email: "root@corp.example", Role: models.RoleAdmin}
+	userRepo, users := newInMemoryUserRepo(existing)
+	svc := newTestOIDCService(idp, userRepo, &fakeUserIdentityRepo{})
+
+	user, err := oidcLogin(t, svc, idp, jwt.MapClaims{
+		"sub":            "idp-user-root",
+		"email":          "root@corp.example",
+		"email_verified": true,
+		"groups":         []string{"staff"},
+	})
+	if err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+	if user.ID != existing.ID || user.Role != models.RoleAdmin {
+		t.Fatalf("expected existing admin to stay admin, got %s (%s)", user.ID, user.Role)
+	}
+	if stored := (*users)[0]; stored.Role != models.RoleAdmin {
+		t.Errorf("expected stored role to stay admin, got %s", stored.Role)
+	}
+}
+
+func TestOIDCService_RejectsUnverifiedEmail(t *testing.T) {
+	idp := newMockIdP(t)
+	existing := &models.User{ID: uuid.New(), Username: "carol", Email: "carol@corp.example", Role: models.RoleAdmin}
+	userRepo, _ := newInMemoryUserRepo(existing)
+	identities := &fakeUserIdentityRepo{}
+	svc := newTestOIDCService(idp, userRepo, identities)
+
+	_, err := oidcLogin(t, svc, idp, jwt.MapClaims{
+		"sub":   "attacker",
+		"email": "carol@corp.example",
+	})
+	if !errors.Is(err, services.ErrOIDCEmailNotVerified) {
+		t.Fatalf("expected ErrOIDCEmailNotVerified, got %v", err)
+	}
+	if len(identities.identities) != 0 {
+		t.Errorf("expected no identity to be linked")
+	}
+}
+
+func TestOIDCService_RejectsReplayedState(t *testing.T) {
+	idp := newMockIdP(t)
+	userRepo, _ := newInMemoryUserRepo()
+	svc := newTestOIDCService(idp, userRepo, &fakeUserIdentityRepo{})
+
+	authURL, err := svc.AuthorizationURL(context.Background())
+	if err != nil {
+		t.Fatalf("AuthorizationURL failed: %v", err)
+	}
+	claims := jwt.MapClaims{"sub": "idp-user-3", "email": "dave@corp.example", "email_verified": true}
+	state, code := idp.authorize(t, authURL, claims)
+	if _, err := svc.Callback(context.Background(), state, code); err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+
+	_, code = idp.authorize(t, authURL, claims)
+	if _, err := svc.Callback(context.Background(), state, code); !errors.Is(err, services.ErrOIDCInvalidState) {
+		t.Errorf("expected ErrOIDCInvalidState on replayed state, got %v", err)
+	}
+}
+
+func TestOIDCService_RejectsTokenForOtherAudience(t *testing.T) {
+	idp := newMockIdP(t)
+	userRepo, users := newInMemoryUserRepo()
+	svc := newTestOIDCService(idp, userRepo, &fakeUserIdentityRepo{})
+
+	_, err := oidcLogin(t, svc, idp, jwt.MapClaims{
+		"sub":            "idp-user-4",
+		"aud":            "another-client",
+		"email":          "eve@corp.example",
+		"email_verified": true,
+	})
+	if !errors.Is(err, services.ErrOIDCTokenInvalid) {
+		t.Fatalf("expected ErrOIDCTokenInvalid, got %v", err)
+	}
+	if len(*users) != 0 {
+		t.Errorf("expected no user provisioned")
+	}
+}
+
+func TestOIDCService_DisabledWithoutConfig(t *testing.T) {
+	svc := services.NewOIDCService(config.OIDCConfig{}, &mockUserRepo{}, &fakeUserIdentityRepo{}, &fakeOIDCAuthRequestRepo{})
+	if _, err := svc.AuthorizationURL(context.Background()); !errors.Is(err, services.ErrOIDCDisabled) {
+		t.Errorf("expected ErrOIDCDisabled, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package services_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type fakePersonalAccessTokenRepo struct {
+	tokens      []*models.PersonalAccessToken
+	lastUsedSet int
+}
+
+func (f *fakePersonalAccessTokenRepo) Create(token *models.PersonalAccessToken) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	copied := *token
+	f.tokens = append(f.tokens, &copied)
+	return nil
+}
+
+func (f *fakePersonalAccessTokenRepo) GetByHash(tokenHash string) (*models.PersonalAccessToken, error) {
+	for _, t := range f.tokens {
+		if t.TokenHash == tokenHash {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakePersonalAccessTokenRepo) ListByUserID(userID uuid.UUID) ([]models.PersonalAccessToken, error) {
+	var result []models.PersonalAccessToken
+	for _, t := range f.tokens {
+		if t.UserID == userID {
+			result = append(result, *t)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakePersonalAccessTokenRepo) Revoke(id, userID uuid.UUID, revokedAt time.Time) error {
+	for _, t := range f.tokens {
+		if t.ID == id && t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &revokedAt
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (f *fakePersonalAccessTokenRepo) UpdateLastUsed(id uuid.UUID, usedAt time.Time) error {
+	for _, t := range f.tokens {
+		if t.ID == id {
+			t.LastUsedAt = &usedAt
+			f.lastUsedSet++
+		}
+	}
+	return nil
+}
+
+func newTestTokenService(user *models.User) (*services.PersonalAccessTokenService, *fakePersonalAccessTokenRepo) {
+	repo := &fakePersonalAccessTokenRepo{}
+	userRepo, _ := newInMemoryUserRepo(user)
+	return services.NewPersonalAccessTokenService(repo, userRepo), repo
+}
+
+func TestPersonalAccessTokenService_CreateStoresOnlyHash(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Username: "ci", Email: "ci@example.com", Role: models.RoleUser}
+	svc, repo := newTestTokenService(user)
+
+	raw, token, err := svc.Create(user.ID, "CI pipeline", []string{models.ScopeFilesWrite, models.ScopeFilesWrite}, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(raw, models.PersonalAccessTokenPrefix) {
+		t.Errorf("expected token to start with %q, got %q", models.PersonalAccessTokenPrefix, raw)
+	}
+	if repo.tokens[0].TokenHash == raw || strings.Contains(repo.tokens[0].TokenHash, raw) {
+		t.Errorf("plaintext token must not be stored")
+	}
+	if !strings.HasPrefix(raw, token.TokenPrefix) {
+		t.Errorf("token prefix %q should identify token %q", token.TokenPrefix, raw)
+	}
+	if len(token.Scopes) != 1 {
+		t.Errorf("expected duplicate scopes to be collapsed, got %v", token.Scopes)
+	}
+	if days := time.Until(token.ExpiresAt).Hours() / 24; days < 29 || days > 30 {
+		t.Errorf("expected default expiry of 30 days, got %.1f days", days)
+	}
+}
+
+func TestPersonalAccessTokenService_CreateValidation(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Username: "ci", Email: "ci@example.com"}
+	svc, _ := newTestTokenService(user)
+
+	if _, _, err := svc.Create(user.ID, "deploy", []string{"files:admin"}, 0); !errors.Is(err, services.ErrInvalidTokenScopes) {
+		t.Errorf("expected ErrInvalidTokenScopes for unknown scope, got %v", err)
+	}
+	if _, _, err := svc.Create(user.ID, "deploy", nil, 0); !errors.Is(err, services.ErrInvalidTokenScopes) {
+		t.Errorf("expected ErrInvalidTokenScopes for no scopes, got %v", err)
+	}
+	if _, _, err := svc.Create(user.ID, "deploy", []string{models.ScopeFilesRead}, 400); !errors.Is(err, services.ErrInvalidTokenExpiry) {
+		t.Errorf("expected ErrInvalidTokenExpiry, got %v", err)
+	}
+	if _, _, err := svc.Create(user.ID, "  ", []string{models.ScopeFilesRead}, 1); !errors.Is(err, services.ErrInvalidAccessTokenName) {
+		t.Errorf("expected ErrInvalidAccessTokenName, got %v", err)
+	}
+}
+
+func TestPersonalAccessTokenService_AuthenticateRevokeAndExpire(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Username: "ci", Email: "ci@example.com"}
+	svc, repo := newTestTokenService(user)
+
+	raw, token, _ := svc.Create(user.ID, "CI", []string{models.ScopeFilesRead}, 7)
+
+	got, gotToken, err := svc.Authenticate(raw)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if got.ID != user.ID || gotToken.ID != token.ID {
+		t.Errorf("authenticated wrong user or token")
+	}
+	// last_used_at is written at most once per minute.
+	_, _, _ = svc.Authenticate(raw)
+	if repo.lastUsedSet != 1 {
+		t.Errorf("expected last_used_at to be written once, got %d", repo.lastUsedSet)
+	}
+
+	if _, _, err := svc.Authenticate(raw + "x"); !errors.Is(err, services.ErrInvalidAccessToken) {
+		t.Errorf("expected ErrInvalidAccessToken for unknown token, got %v", err)
+	}
+
+	if err := svc.Revoke(uuid.New(), token.ID); !errors.Is(err, services.ErrAccessTokenNotFound) {
+		t.Errorf("expected ErrAccessTokenNotFound revoking another user's token, got %v", err)
+	}
+	if err := svc.Revoke(user.ID, token.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, _, err := svc.Authenticate(raw); !errors.Is(err, services.ErrInvalidAccessToken) {
+		t.Errorf("expected ErrInvalidAccessToken after revoke, got %v", err)
+	}
+
+	expiredRaw, _, _ := svc.Create(user.ID, "old", []string{models.ScopeFilesRead}, 1)
+	repo.tokens[len(repo.tokens)-1].ExpiresAt = time.Now().Add(-time.Minute)
+	if _, _, err := svc.Authenticate(expiredRaw); !errors.Is(err, services.ErrInvalidAccessToken) {
+		t.Errorf("expected ErrInvalidAccessToken for expired token, got %v", err)
+	}
+}
+
+func TestAuthMiddleware_PersonalAccessTokenScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &models.User{ID: uuid.New(), Username: "ci", Email: "ci@example.com", Role: models.RoleUser}
+	svc, _ := newTestTokenService(user)
+	userRepo, _ := newInMemoryUserRepo(user)
+	raw, _, _ := svc.Create(user.ID, "read only", []string{models.ScopeFilesRead}, 1)
+
+	cfg := newAuthTestConfig()
+	cfg.JWT.AccessTokenExpiry = "15m"
+	authService := services.NewAuthService(&mockUserRepo{}, cfg)
+	jwtToken, err := authService.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("failed to generate jwt: %v", err)
+	}
+
+	router := gin.New()
+	auth := middleware.AuthMiddleware(authService.KeyManager(), userRepo, svc)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/files", auth, middleware.RequireScope(models.ScopeFilesRead), ok)
+	router.POST("/files", auth, middleware.RequireScope(models.ScopeFilesWrite), ok)
+	router.POST("/tokens", auth, middleware.SessionOnly(), ok)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"pat with scope", http.MethodGet, "/files", raw, http.StatusOK},
+		{"pat without scope", http.MethodPost, "/files", raw, http.StatusForbidden},
+		{"pat on session-only route", http.MethodPost, "/tokens", raw, http.StatusForbidden},
+		{"unknown pat", http.MethodGet, "/files", models.PersonalAccessTokenPrefix + "bogus", http.StatusUnauthorized},
+		{"jwt is not scope restricted", http.MethodPost, "/files", jwtToken, http.StatusOK},
+		{"jwt on session-only route", http.MethodPost, "/tokens", jwtToken, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Errorf("expected status %d, got %d (%s)", tc.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func intPtr(v int) *int { return &v }
+
+func createPolicyTestUser(t *testing.T, db *gorm.DB, name string, role models.UserRole, group *string) *models.User {
+	t.Helper()
+	user := &models.User{
+		ID:           uuid.New(),
+		Username:     name,
+		Email:        name + "@example.com",
+		PasswordHash: "x",
+		Role:         role,
+		PolicyGroup:  group,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+func TestPolicySettings_ApplyToAndAudiences(t *testing.T) {
+	blocked := models.StringArray{".txt"}
+	policy := models.SystemPolicy{MaxFileSizeMB: 50, DefaultValidityDays: 7, BlockedExtensions: models.StringArray{".exe"}}
+	models.PolicySettings{MaxFileSizeMB: intPtr(5), BlockedExtensions: &blocked}.ApplyTo(&policy)
+
+	if policy.MaxFileSizeMB != 5 || policy.DefaultValidityDays != 7 || len(policy.BlockedExtensions) != 1 || policy.BlockedExtensions[0] != ".txt" {
+		t.Fatalf("override must replace only the fields it sets: %+v", policy)
+	}
+
+	for audience, valid := range map[string]bool{
+		"anonymous":      true,
+		"user":           true,
+		"admin":          true,
+		"group:partners": true,
+		"group:":         false,
+		"group:Partners": false,
+		"system":         false,
+		"moderator":      false,
+	} {
+		if models.ValidPolicyAudience(audience) != valid {
+			t.Fatalf("ValidPolicyAudience(%q) = %v, want %v", audience, !valid, valid)
+		}
+	}
+}
+
+func TestPolicyService_UpdateRecordsHistoryAndRollback(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	policies := services.NewPolicyService(db)
+	files := services.NewFileService(db, newFakeStorage())
+	actor := services.PolicyActor{Name: "admin@example.com"}
+
+	_, change, err := policies.UpdateSystem(ctx, actor, func(p *models.SystemPolicy) error {
+		p.MaxFileSizeMB = 100
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateSystem failed: %v", err)
+	}
+	var diff map[string]struct{ From, To interface{} }
+	if err := json.Unmarshal([]byte(change.Diff), &diff); err != nil {
+		t.Fatalf("invalid diff: %v", err)
+	}
+	if len(diff) != 1 || diff["maxFileSizeMB"].From != float64(50) || diff["maxFileSizeMB"].To != float64(100) {
+		t.Fatalf("unexpected diff %s", change.Diff)
+	}
+	if change.ChangedByName == nil || *change.ChangedByName != actor.Name || change.Before == nil {
+		t.Fatalf("change must record the actor and a snapshot: %+v", change)
+	}
+
+	if _, _, err := policies.UpdateSystem(ctx, actor, func(p *models.SystemPolicy) error { return nil }); !errors.Is(err, services.ErrPolicyUnchanged) {
+		t.Fatalf("a no-op update must not be recorded, got %v", err)
+	}
+
+	rollback, err := policies.Rollback(ctx, change.ID, actor)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if rollback.Action != models.PolicyChangeRollback || rollback.RollbackOf == nil || *rollback.RollbackOf != change.ID {
+		t.Fatalf("unexpected rollback change: %+v", rollback)
+	}
+	policy, err := files.GetSystemPolicy(ctx, nil)
+	if err != nil {
+		t.Fatalf("GetSystemPolicy failed: %v", err)
+	}
+	if policy.MaxFileSizeMB != 50 {
+		t.Fatalf("expected rollback to restore 50 MB, got %d", policy.MaxFileSizeMB)
+	}
+	if _, err := policies.Rollback(ctx, change.ID, actor); !errors.Is(err, services.ErrPolicyUnchanged) {
+		t.Fatalf("expected ErrPolicyUnchanged when already rolled back, got %v", err)
+	}
+
+	changes, total, err := policies.ListChanges(ctx, models.PolicyAudienceSystem, 10, 0)
+	if err != nil || total != 2 || changes[0].ID != rollback.ID {
+		t.Fatalf("expected two changes, newest first, got %d (%v)", total, err)
+	}
+}
+
+func TestFileService_GetSystemPolicy_ResolvesAudienceOverrides(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	policies := services.NewPolicyService(db)
+	files := services.NewFileService(db, newFakeStorage())
+	actor := services.PolicyActor{Name: "admin@example.com"}
+	base, err := files.GetSystemPolicy(ctx, nil)
+	if err != nil {
+		t.Fatalf("GetSystemPolicy failed: %v", err)
+	}
+	baseBlocked := len(base.BlockedExtensions)
+
+	txt := models.StringArray{".txt"}
+	overrides := map[string]models.PolicySettings{
+		models.PolicyAudienceAnonymous: {MaxFileSizeMB: intPtr(10), BlockedExtensions: &txt},
+		models.PolicyAudienceUser:      {MaxFileSizeMB: intPtr(200)},
+		models.PolicyAudienceAdmin:     {MaxFileSizeMB: intPtr(1000)},
+		"group:partners":               {MaxFileSizeMB: intPtr(500), DefaultValidityDays: intPtr(30)},
+	}
+	for audience, settings := range overrides {
+		if _, _, err := policies.SetOverride(ctx, audience, settings, actor); err != nil {
+			t.Fatalf("SetOverride(%s) failed: %v", audience, err)
+		}
+	}
+
+	partners := "partners"
+	regular := createPolicyTestUser(t, db, "regular", models.RoleUser, nil)
+	staff := createPolicyTestUser(t, db, "staff", models.RoleModerator, nil)
+	partner := createPolicyTestUser(t, db, "partner", models.RoleUser, &partners)
+
+	cases := []struct {
+		name         string
+		userID       *uuid.UUID
+		maxMB, days  int
+		blockedCount int
+	}{
+		{"anonymous", nil, 10, 7, 1},
+		{"user", &regular.ID, 200, 7, baseBlocked},
+		{"staff", &staff.ID, 1000, 7, baseBlocked},
+		{"group", &partner.ID, 500, 30, baseBlocked},
+	}
+	for _, tc := range cases {
+		policy, err := files.GetSystemPolicy(ctx, tc.userID)
+		if err != nil {
+			t.Fatalf("%s: GetSystemPolicy failed: %v", tc.name, err)
+		}
+		if policy.MaxFileSizeMB != tc.maxMB || policy.DefaultValidityDays != tc.days || len(policy.BlockedExtensions) != tc.blockedCount {
+			t.Fatalf("%s: unexpected policy %+v", tc.name, policy)
+		}
+	}
+
+	isPublic := true
+	_, err = files.UploadFile(ctx, &services.UploadInput{
+		FileName: "notes.txt", ContentType: "text/plain", Size: 5, Reader: bytes.NewReader([]byte("notes")), IsPublic: &isPublic,
+	})
+	if !errors.Is(err, services.ErrFileTypeNotAllowed) {
+		t.Fatalf("anonymous override should block .txt uploads, got %v", err)
+	}
+	if _, err := files.UploadFile(ctx, &services.UploadInput{
+		FileName: "notes.txt", ContentType: "text/plain", Size: 5, Reader: bytes.NewReader([]byte("notes")), IsPublic: &isPublic, OwnerID: &regular.ID,
+	}); err != nil {
+		t.Fatalf("signed-in users are not affected by the anonymous override: %v", err)
+	}
+
+	// Rolling back the creation of an override removes it.
+	created, _, err := policies.ListChanges(ctx, "group:partners", 10, 0)
+	if err != nil || len(created) != 1 {
+		t.Fatalf("expected one change for the group, got %d (%v)", len(created), err)
+	}
+	if _, err := policies.Rollback(ctx, created[0].ID, actor); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	policy, err := files.GetSystemPolicy(ctx, &partner.ID)
+	if err != nil || policy.MaxFileSizeMB != 200 {
+		t.Fatalf("partner should fall back to the user override after rollback, got %+v (%v)", policy, err)
+	}
+}
@@ -0,0 +1,169 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/ratelimit"
+)
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Hit(context.Context, string, time.Duration, time.Time) (int, error) {
+	return 0, errors.New("store down")
+}
+
+// newRateLimitedRouter serves GET /api/ping and the file password and upload routes, with
+// requests from 10.0.0.1 treated as the trusted nginx front.
+func newRateLimitedRouter(t *testing.T, limiter *ratelimit.Limiter) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies([]string{"10.0.0.1"}); err != nil {
+		t.Fatalf("SetTrustedProxies failed: %v", err)
+	}
+	router.Use(limiter.Global())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/api/ping", ok)
+	router.GET("/health", ok)
+	router.GET("/api/files/:shareToken/download", limiter.FilePassword(), ok)
+	router.POST("/api/files/upload", func(c *gin.Context) {
+		if id := c.GetHeader("X-Test-User"); id != "" {
+			c.Set("userID", uuid.MustParse(id))
+		}
+	}, limiter.Upload(), ok)
+	return router
+}
+
+func rateLimitedRequest(router *gin.Engine, method, path, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimit_GlobalHeadersAndRetryAfter(t *testing.T) {
+	limiter := ratelimit.New(config.RateLimitConfig{RequestsPerMinute: 2}, ratelimit.NewMemoryStore())
+	now := time.Date(2026, 1, 1, 12, 0, 15, 0, time.UTC)
+	limiter.SetClock(func() time.Time { return now })
+	router := newRateLimitedRouter(t, limiter)
+
+	rec := rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.1:1234", nil)
+	if rec.Code != http.StatusNoContent || rec.Header().Get(ratelimit.HeaderLimit) != "2" ||
+		rec.Header().Get(ratelimit.HeaderRemaining) != "1" || rec.Header().Get(ratelimit.HeaderReset) != "45" {
+		t.Fatalf("unexpected first response %d %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Get(ratelimit.HeaderPolicy) != "2;w=60" {
+		t.Fatalf("unexpected policy %q", rec.Header().Get(ratelimit.HeaderPolicy))
+	}
+	rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.1:1234", nil)
+	rec = rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.1:1234", nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "45" || rec.Header().Get(ratelimit.HeaderRemaining) != "0" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+
+	// Other clients and non-API paths are not affected
+	if rec := rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.2:1234", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("another IP must have its own bucket, got %d", rec.Code)
+	}
+	if rec := rateLimitedRequest(router, http.MethodGet, "/health", "192.0.2.1:1234", nil); rec.Code != http.StatusNoContent || rec.Header().Get(ratelimit.HeaderLimit) != "" {
+		t.Fatalf("health checks must not be limited, got %d", rec.Code)
+	}
+
+	// The next window starts a fresh count
+	now = now.Add(time.Minute)
+	if rec := rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.1:1234", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the limit to reset in the next window, got %d", rec.Code)
+	}
+}
+
+func TestRateLimit_TrustedProxyAndUserKeys(t *testing.T) {
+	limiter := ratelimit.New(config.RateLimitConfig{RequestsPerMinute: 1}, ratelimit.NewMemoryStore())
+	limiter.SetIdentify(func(c *gin.Context) string {
+		if c.GetHeader("Authorization") == "Bearer alice" {
+			return "user:alice"
+		}
+		return ""
+	})
+	router := newRateLimitedRouter(t, limiter)
+
+	// Behind the trusted proxy each forwarded client has its own bucket
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+		rec := rateLimitedRequest(router, http.MethodGet, "/api/ping", "10.0.0.1:443", map[string]string{"X-Forwarded-For": ip})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("forwarded client %s must not share the proxy's bucket, got %d", ip, rec.Code)
+		}
+	}
+	// An untrusted peer cannot escape its bucket by forging X-Forwarded-For
+	rateLimitedRequest(router, http.MethodGet, "/api/ping", "203.0.113.9:1", map[string]string{"X-Forwarded-For": "198.51.100.3"})
+	if rec := rateLimitedRequest(router, http.MethodGet, "/api/ping", "203.0.113.9:1", map[string]string{"X-Forwarded-For": "198.51.100.4"}); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("forged X-Forwarded-For from an untrusted peer must be ignored, got %d", rec.Code)
+	}
+
+	// A signed-in user is limited per user, whatever their IP
+	auth := map[string]string{"Authorization": "Bearer alice"}
+	rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.10:1", auth)
+	if rec := rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.11:1", auth); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the user's bucket to be shared across IPs, got %d", rec.Code)
+	}
+}
+
+func TestRateLimit_UploadAndFilePasswordBuckets(t *testing.T) {
+	limiter := ratelimit.New(config.RateLimitConfig{RequestsPerMinute: -1, UploadPerHour: 1, FilePasswordPerMinute: 2}, ratelimit.NewMemoryStore())
+	router := newRateLimitedRouter(t, limiter)
+
+	// Uploads count per authenticated user
+	alice := map[string]string{"X-Test-User": uuid.NewString()}
+	if rec := rateLimitedRequest(router, http.MethodPost, "/api/files/upload", "192.0.2.1:1", alice); rec.Code != http.StatusNoContent || rec.Header().Get(ratelimit.HeaderPolicy) != "1;w=3600" {
+		t.Fatalf("unexpected first upload %d %v", rec.Code, rec.Header())
+	}
+	if rec := rateLimitedRequest(router, http.MethodPost, "/api/files/upload", "192.0.2.2:1", alice); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the second upload of the hour to be limited, got %d", rec.Code)
+	}
+	if rec := rateLimitedRequest(router, http.MethodPost, "/api/files/upload", "192.0.2.1:1", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("anonymous uploads from the same IP use the IP bucket, got %d", rec.Code)
+	}
+
+	// Only attempts that send a file password count, per file; the negative global limit
+	// disables the API bucket, so these carry no RateLimit headers
+	password := map[string]string{"X-File-Password": "guess"}
+	for i := 0; i < 3; i++ {
+		if rec := rateLimitedRequest(router, http.MethodGet, "/api/files/abc/download", "192.0.2.1:1", nil); rec.Code != http.StatusNoContent || rec.Header().Get(ratelimit.HeaderLimit) != "" {
+			t.Fatalf("downloads without a password must not be limited, got %d %v", rec.Code, rec.Header())
+		}
+	}
+	rateLimitedRequest(router, http.MethodGet, "/api/files/abc/download", "192.0.2.1:1", password)
+	rateLimitedRequest(router, http.MethodGet, "/api/files/abc/download", "192.0.2.1:1", password)
+	if rec := rateLimitedRequest(router, http.MethodGet, "/api/files/abc/download", "192.0.2.1:1", password); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected password guesses to be limited, got %d", rec.Code)
+	}
+	if rec := rateLimitedRequest(router, http.MethodGet, "/api/files/other/download", "192.0.2.1:1", password); rec.Code != http.StatusNoContent {
+		t.Fatalf("each file has its own password bucket, got %d", rec.Code)
+	}
+}
+
+func TestRateLimit_FailsOpenAndNilLimiter(t *testing.T) {
+	router := newRateLimitedRouter(t, ratelimit.New(config.RateLimitConfig{}, failingRateLimitStore{}))
+	if rec := rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.1:1", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("a store outage must not reject requests, got %d", rec.Code)
+	}
+
+	router = newRateLimitedRouter(t, nil)
+	for i := 0; i < ratelimit.DefaultRequestsPerMinute+1; i++ {
+		if rec := rateLimitedRequest(router, http.MethodGet, "/api/ping", "192.0.2.1:1", nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("a nil limiter must not limit, got %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+)
+
+func TestLocalStorage_StatAndList(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewLocalStorage(t.TempDir())
+
+	loc, err := st.Upload(ctx, &storage.Object{Name: "a.txt", Container: storage.ContainerPublic, Reader: bytes.NewReader([]byte("hello"))})
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	info, err := st.Stat(ctx, loc)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Path != loc.Path || info.Size != 5 || info.LastModified.IsZero() {
+		t.Fatalf("unexpected object info: %+v", info)
+	}
+	if _, err := st.Stat(ctx, &storage.Location{Container: storage.ContainerPublic, Path: "public/missing.txt"}); !errors.Is(err, storage.ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+
+	var listed []storage.ObjectInfo
+	if err := st.List(ctx, storage.ContainerPublic, func(o storage.ObjectInfo) error {
+		listed = append(listed, o)
+		return nil
+	}); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Path != loc.Path || listed[0].Container != storage.ContainerPublic {
+		t.Fatalf("List must return paths usable as locations, got %+v", listed)
+	}
+
+	// Nothing was uploaded to the private container yet.
+	if err := st.List(ctx, storage.ContainerPrivate, func(o storage.ObjectInfo) error {
+		t.Fatalf("unexpected object %+v", o)
+		return nil
+	}); err != nil {
+		t.Fatalf("List of an empty container failed: %v", err)
+	}
+}
+
+func TestReconcileService_ReportsAndRepairs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	store := newFakeStorage()
+	files := services.NewFileService(db, store)
+	reconcile := services.NewReconcileService(db, store, (&fakeClusterLock{}).replica())
+
+	kept := uploadModerationTestFile(t, files, "kept.txt", "text/plain", true)
+	lost := uploadModerationTestFile(t, files, "lost.txt", "text/plain", true)
+	held := uploadModerationTestFile(t, files, "held.txt", "text/plain", false)
+	if _, err := files.SetLegalHold(held.ID, true, "litigation"); err != nil {
+		t.Fatalf("SetLegalHold failed: %v", err)
+	}
+	delete(store.files, lost.FilePath)
+	delete(store.files, held.FilePath)
+	orphan := uploadModerationTestFile(t, files, "orphan.txt", "text/plain", true)
+	if err := db.Exec("DELETE FROM files WHERE id = ?", orphan.ID).Error; err != nil {
+		t.Fatalf("delete row failed: %v", err)
+	}
+
+	report, err := reconcile.Reconcile(ctx, services.ReconcileOptions{})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if report.OrphansFound != 1 || report.OrphanObjects[0].Path != orphan.FilePath || report.OrphanBytes != orphan.FileSize {
+		t.Fatalf("expected the object without a row to be reported, got %+v", report.OrphanObjects)
+	}
+	if report.DanglingFound != 2 || report.ObjectsDeleted != 0 || report.FilesDeleted != 0 {
+		t.Fatalf("report-only run must not repair: %+v", report)
+	}
+	if _, ok := store.files[orphan.FilePath]; !ok {
+		t.Fatalf("report-only run deleted an object")
+	}
+
+	report, err = reconcile.Reconcile(ctx, services.ReconcileOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	if report.ObjectsDeleted != 1 || report.FilesDeleted != 1 {
+		t.Fatalf("unexpected repair counts: %+v", report)
+	}
+	if _, ok := store.files[orphan.FilePath]; ok {
+		t.Fatalf("orphaned object should be deleted")
+	}
+	if _, err := files.GetByID(lost.ID); err == nil {
+		t.Fatalf("dangling row should be deleted")
+	}
+	if _, err := files.GetByID(held.ID); err != nil {
+		t.Fatalf("row under legal hold must be kept: %v", err)
+	}
+	if _, err := files.GetByID(kept.ID); err != nil {
+		t.Fatalf("healthy file must be kept: %v", err)
+	}
+	for _, d := range report.DanglingFiles {
+		if d.FileID == held.ID && (d.Deleted || d.Error == "") {
+			t.Fatalf("legal hold should be reported as the reason: %+v", d)
+		}
+	}
+}
+
+func TestReconcileService_RepairRefusedWhileCleanupRuns(t *testing.T) {
+	db := newTestDB(t)
+	cluster := &fakeClusterLock{}
+	if ok, _ := cluster.replica().TryLock(context.Background()); !ok {
+		t.Fatalf("expected to take the lock")
+	}
+	reconcile := services.NewReconcileService(db, newFakeStorage(), cluster.replica())
+
+	if _, err := reconcile.Reconcile(context.Background(), services.ReconcileOptions{Repair: true}); !errors.Is(err, services.ErrReconcileRunning) {
+		t.Fatalf("expected ErrReconcileRunning, got %v", err)
+	}
+	if _, err := reconcile.Reconcile(context.Background(), services.ReconcileOptions{}); err != nil {
+		t.Fatalf("report-only run should not need the lock: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/storage"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/tracing"
+)
+
+// useInMemoryTracing installs a provider recording every span until the test ends.
+func useInMemoryTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	if _, err := tracing.Setup(context.Background(), config.TracingConfig{}); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := tracing.NewProvider(config.TracingConfig{}, sdktrace.WithSyncer(exporter))
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	t.Fatalf("no span %q among %v", name, names)
+	return tracetest.SpanStub{}
+}
+
+func spanAttr(s tracetest.SpanStub, key string) (attribute.Value, bool) {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracing_MiddlewareContinuesIncomingTrace(t *testing.T) {
+	exporter := useInMemoryTracing(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(tracing.Middleware())
+	router.GET("/api/files/:id", func(c *gin.Context) {
+		_, span := tracing.Tracer().Start(c.Request.Context(), "handler work")
+		span.End()
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/api/broken", func(c *gin.Context) { c.Status(http.StatusBadGateway) })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/files/123", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	server := findSpan(t, spans, "GET /api/files/:id")
+	if server.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the span to continue the incoming trace, got trace %s parent %s", server.SpanContext.TraceID(), server.Parent.SpanID())
+	}
+	if status, _ := spanAttr(server, "http.response.status_code"); status.AsInt64() != http.StatusNoContent {
+		t.Fatalf("expected the status code attribute, got %v", status)
+	}
+	if child := findSpan(t, spans, "handler work"); child.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Fatalf("spans started by handlers must be children of the request span")
+	}
+
+	exporter.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/broken", nil))
+	if broken := findSpan(t, exporter.GetSpans(), "GET /api/broken"); broken.Status.Code != codes.Error || broken.Parent.IsValid() {
+		t.Fatalf("expected a new root span marked as failed, got %+v", broken.Status)
+	}
+}
+
+func TestTracing_StorageSpans(t *testing.T) {
+	exporter := useInMemoryTracing(t)
+	fs := newFakeStorage()
+	fs.files["private/report.pdf"] = &storage.DownloadResult{Reader: io.NopCloser(strings.NewReader("content")), Size: 7}
+	st := tracing.InstrumentStorage(fs, "local")
+	ctx := context.Background()
+
+	res, err := st.Download(ctx, &storage.Location{Container: storage.ContainerPrivate, Path: "private/report.pdf"})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if len(exporter.GetSpans()) != 0 {
+		t.Fatalf("the download span must stay open while the stream is read")
+	}
+	if _, err := io.ReadAll(res.Reader); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	res.Reader.Close()
+	download := findSpan(t, exporter.GetSpans(), "storage.download")
+	if read, _ := spanAttr(download, "storage.bytes_read"); read.AsInt64() != 7 {
+		t.Fatalf("expected the bytes read to be recorded, got %v", read)
+	}
+
+	// A missing object is an answer, not a failure; a backend error is
+	exporter.Reset()
+	if _, err := st.Stat(ctx, &storage.Location{Container: storage.ContainerPrivate, Path: "missing"}); !errors.Is(err, storage.ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+	fs.uploadErr = errors.New("disk full")
+	_, _ = st.Upload(ctx, &storage.Object{Name: "a.txt", Container: storage.ContainerPublic, Reader: strings.NewReader("x"), Size: 1})
+	spans := exporter.GetSpans()
+	if stat := findSpan(t, spans, "storage.stat"); stat.Status.Code == codes.Error {
+		t.Fatalf("a missing object must not mark the span as failed")
+	}
+	if upload := findSpan(t, spans, "storage.upload"); upload.Status.Code != codes.Error || upload.Status.Description != "disk full" {
+		t.Fatalf("expected the upload error on the span, got %+v", upload.Status)
+	}
+}
+
+func TestTracing_GORMSpansOnlyInsideTraces(t *testing.T) {
+	exporter := useInMemoryTracing(t)
+	// DryRun builds the SQL and runs the callbacks without a database connection
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("gorm.Open failed: %v", err)
+	}
+	if err := tracing.InstrumentGORM(db); err != nil {
+		t.Fatalf("InstrumentGORM failed: %v", err)
+	}
+
+	db.Where("share_token = ?", "secret-token").First(&models.File{})
+	if len(exporter.GetSpans()) != 0 {
+		t.Fatalf("queries outside a trace must not start one")
+	}
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "request")
+	db.WithContext(ctx).Where("share_token = ?", "secret-token").First(&models.File{})
+	parent.End()
+
+	query := findSpan(t, exporter.GetSpans(), "SELECT files")
+	if query.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("the query span must be a child of the request span")
+	}
+	text, _ := spanAttr(query, "db.query.text")
+	if !strings.Contains(text.AsString(), "share_token = $1") || strings.Contains(text.AsString(), "secret-token") {
+		t.Fatalf("expected the parameterised SQL without values, got %q", text.AsString())
+	}
+}
+
+func TestTracing_FilePasswordCheckSpan(t *testing.T) {
+	exporter := useInMemoryTracing(t)
+	svc, _, _, file := newFilePasswordFixture(t)
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "GET /api/files/:shareToken/download")
+	if err := svc.Verify(ctx, file, "ip:192.0.2.1", "correct horse", file.CreatedAt); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	parent.End()
+
+	if bcrypt := findSpan(t, exporter.GetSpans(), "bcrypt.compare"); bcrypt.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("the bcrypt check must be part of the request trace")
+	}
+}
+
+func TestTracing_SetupRejectsBadConfig(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), config.TracingConfig{Exporter: "zipkin"}); err == nil {
+		t.Fatalf("expected an unknown exporter to be rejected")
+	}
+	if _, err := tracing.NewProvider(config.TracingConfig{SampleRatio: 1.5}); err == nil {
+		t.Fatalf("expected a sample ratio above 1 to be rejected")
+	}
+}
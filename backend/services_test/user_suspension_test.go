@@ -0,0 +1,120 @@
+package services_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/middleware"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthService_SuspendedUserCannotSignIn(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	suspendedAt := time.Now().Add(-time.Hour)
+	user := &models.User{
+		ID:           uuid.New(),
+		Username:     "mallory",
+		Email:        "mallory@example.com",
+		PasswordHash: string(hash),
+		SuspendedAt:  &suspendedAt,
+	}
+	userRepo, _ := newInMemoryUserRepo(user)
+
+	cfg := newAuthTestConfig()
+	cfg.JWT.AccessTokenExpiry = "15m"
+	svc := services.NewAuthService(userRepo, cfg)
+
+	if _, _, err := svc.Login(user.Email, "password123", services.ClientInfo{}); !errors.Is(err, services.ErrAccountSuspended) {
+		t.Errorf("expected ErrAccountSuspended from Login, got %v", err)
+	}
+	// SSO, passkey and TOTP logins all end in GenerateAccessToken.
+	if _, err := svc.GenerateAccessToken(user); !errors.Is(err, services.ErrAccountSuspended) {
+		t.Errorf("expected ErrAccountSuspended from GenerateAccessToken, got %v", err)
+	}
+}
+
+func TestAuthMiddleware_AppliesAccountStateImmediately(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &models.User{ID: uuid.New(), Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	userRepo, users := newInMemoryUserRepo(user)
+	stored := (*users)[0]
+
+	cfg := newAuthTestConfig()
+	cfg.JWT.AccessTokenExpiry = "15m"
+	authService := services.NewAuthService(userRepo, cfg)
+	tokenService := services.NewPersonalAccessTokenService(&fakePersonalAccessTokenRepo{}, userRepo)
+
+	jwtToken, err := authService.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("failed to generate jwt: %v", err)
+	}
+	pat, _, _ := tokenService.Create(user.ID, "ci", []string{models.ScopeFilesRead}, 1)
+
+	router := gin.New()
+	auth := middleware.AuthMiddleware(authService.KeyManager(), userRepo, tokenService)
+	router.GET("/me", auth, func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/policy", auth, middleware.RequirePermission(models.PermissionPolicyRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	call := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := call("/me", jwtToken); code != http.StatusOK {
+		t.Fatalf("expected active user to pass, got %d", code)
+	}
+
+	// A promotion applies without a new token because the role is read from the user record.
+	if code := call("/policy", jwtToken); code != http.StatusForbidden {
+		t.Errorf("expected regular user to be forbidden, got %d", code)
+	}
+	stored.Role = models.RoleAuditor
+	if code := call("/policy", jwtToken); code != http.StatusOK {
+		t.Errorf("expected promoted user to pass with the same token, got %d", code)
+	}
+
+	now := time.Now()
+	stored.SuspendedAt = &now
+	if code := call("/me", jwtToken); code != http.StatusForbidden {
+		t.Errorf("expected suspended user's jwt to be rejected with 403, got %d", code)
+	}
+	if code := call("/me", pat); code != http.StatusForbidden {
+		t.Errorf("expected suspended user's personal access token to be rejected with 403, got %d", code)
+	}
+
+	stored.SuspendedAt = nil
+	stored.SessionsRevokedAt = &now
+	if code := call("/me", jwtToken); code != http.StatusUnauthorized {
+		t.Errorf("expected token issued before force logout to be rejected, got %d", code)
+	}
+}
+
+func TestUser_SessionRevoked(t *testing.T) {
+	revokedAt := time.Date(2025, 1, 1, 10, 0, 0, 700_000_000, time.UTC)
+	user := &models.User{SessionsRevokedAt: &revokedAt}
+
+	if !user.SessionRevoked(revokedAt.Add(-time.Minute)) {
+		t.Errorf("expected earlier token to be revoked")
+	}
+	// JWT iat has second precision: a token from the same second may predate the revocation.
+	if !user.SessionRevoked(revokedAt.Truncate(time.Second)) {
+		t.Errorf("expected token from the same second to be revoked")
+	}
+	if user.SessionRevoked(revokedAt.Add(2 * time.Second)) {
+		t.Errorf("expected later token to stay valid")
+	}
+	if (&models.User{}).SessionRevoked(revokedAt) {
+		t.Errorf("expected no revocation without SessionsRevokedAt")
+	}
+}
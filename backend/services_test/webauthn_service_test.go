@@ -0,0 +1,353 @@
+package services_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/config"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/models"
+	"github.com/dath-251-thuanle/file-sharing-be-web/internal/services"
+	"github.com/descope/virtualwebauthn"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeWebAuthnCredentialRepo keeps credentials in memory.
+type fakeWebAuthnCredentialRepo struct {
+	credentials []*models.WebAuthnCredential
+}
+
+func (f *fakeWebAuthnCredentialRepo) Create(credential *models.WebAuthnCredential) error {
+	if credential.ID == uuid.Nil {
+		credential.ID = uuid.New()
+	}
+	copied := *credential
+	f.credentials = append(f.credentials, &copied)
+	return nil
+}
+
+func (f *fakeWebAuthnCredentialRepo) GetByUserID(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var result []models.WebAuthnCredential
+	for _, c := range f.credentials {
+		if c.UserID == userID {
+			result = append(result, *c)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeWebAuthnCredentialRepo) GetByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	for _, c := range f.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			copied := *c
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeWebAuthnCredentialRepo) CountByUserID(userID uuid.UUID) (int64, error) {
+	creds, _ := f.GetByUserID(userID)
+	return int64(len(creds)), nil
+}
+
+func (f *fakeWebAuthnCredentialRepo) UpdateName(id, userID uuid.UUID, name string) error {
+	for _, c := range f.credentials {
+		if c.ID == id && c.UserID == userID {
+			c.Name = name
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (f *fakeWebAuthnCredentialRepo) UpdateAfterLogin(credential *models.WebAuthnCredential) error {
+	for _, c := range f.credentials {
+		if c.ID == credential.ID {
+			c.SignCount = credential.SignCount
+			c.CloneWarning = credential.CloneWarning
+			c.BackupState = credential.BackupState
+			c.LastUsedAt = credential.LastUsedAt
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (f *fakeWebAuthnCredentialRepo) Delete(id, userID uuid.UUID) error {
+	for i, c := range f.credentials {
+		if c.ID == id && c.UserID == userID {
+			f.credentials = append(f.credentials[:i], f.credentials[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+type fakeWebAuthnSessionRepo struct {
+	sessions map[uuid.UUID]models.WebAuthnSession
+}
+
+func newFakeWebAuthnSessionRepo() *fakeWebAuthnSessionRepo {
+	return &fakeWebAuthnSessionRepo{sessions: make(map[uuid.UUID]models.WebAuthnSession)}
+}
+
+func (f *fakeWebAuthnSessionRepo) Create(session *models.WebAuthnSession) error {
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	f.sessions[session.ID] = *session
+	return nil
+}
+
+func (f *fakeWebAuthnSessionRepo) Consume(id uuid.UUID, ceremony string, now time.Time) (*models.WebAuthnSession, error) {
+	session, ok := f.sessions[id]
+	if !ok || session.Ceremony != ceremony {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(f.sessions, id)
+	if !session.ExpiresAt.After(now) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+func (f *fakeWebAuthnSessionRepo) DeleteExpired(now time.Time) error {
+	for id, s := range f.sessions {
+		if !s.ExpiresAt.After(now) {
+			delete(f.sessions, id)
+		}
+	}
+	return nil
+}
+
+var testRelyingParty = virtualwebauthn.RelyingParty{Name: "FileSharingTest", ID: "localhost", Origin: "http://localhost:3000"}
+
+type webAuthnTestEnv struct {
+	user          *models.User
+	service       *services.WebAuthnService
+	credentials   *fakeWebAuthnCredentialRepo
+	loginSessions *fakeLoginSessionRepo
+	authenticator virtualwebauthn.Authenticator
+}
+
+func newWebAuthnTestEnv(t *testing.T) *webAuthnTestEnv {
+	t.Helper()
+
+	user := newTOTPUser()
+	cfg := newAuthTestConfig()
+	cfg.WebAuthn = config.WebAuthnConfig{
+		RPID:          testRelyingParty.ID,
+		RPDisplayName: testRelyingParty.Name,
+		RPOrigins:     []string{testRelyingParty.Origin},
+	}
+
+	env := &webAuthnTestEnv{
+		user:          user,
+		credentials:   &fakeWebAuthnCredentialRepo{},
+		loginSessions: newFakeLoginSessionRepo(),
+		authenticator: virtualwebauthn.NewAuthenticatorWithOptions(virtualwebauthn.AuthenticatorOptions{
+			UserHandle: user.ID[:],
+		}),
+	}
+
+	svc, err := services.NewWebAuthnService(cfg, newTOTPUserRepo(user), env.credentials, newFakeWebAuthnSessionRepo(), env.loginSessions)
+	if err != nil {
+		t.Fatalf("failed to create webauthn service: %v", err)
+	}
+	env.service = svc
+	return env
+}
+
+// register runs a full registration ceremony with a new virtual credential.
+func (e *webAuthnTestEnv) register(t *testing.T, name string) virtualwebauthn.Credential {
+	t.Helper()
+
+	creation, sessionID, err := e.service.BeginRegistration(e.user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration failed: %v", err)
+	}
+	options, err := virtualwebauthn.ParseAttestationOptions(mustJSON(t, creation))
+	if err != nil {
+		t.Fatalf("failed to parse attestation options: %v", err)
+	}
+
+	cred := virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2)
+	response := virtualwebauthn.CreateAttestationResponse(testRelyingParty, e.authenticator, cred, *options)
+	if _, err := e.service.FinishRegistration(e.user.ID, sessionID, name, []byte(response)); err != nil {
+		t.Fatalf("FinishRegistration failed: %v", err)
+	}
+	e.authenticator.AddCredential(cred)
+	return cred
+}
+
+func assertionResponse(t *testing.T, assertion any, auth virtualwebauthn.Authenticator, cred virtualwebauthn.Credential) []byte {
+	t.Helper()
+	options, err := virtualwebauthn.ParseAssertionOptions(mustJSON(t, assertion))
+	if err != nil {
+		t.Fatalf("failed to parse assertion options: %v", err)
+	}
+	return []byte(virtualwebauthn.CreateAssertionResponse(testRelyingParty, auth, cred, *options))
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	return string(raw)
+}
+
+func TestWebAuthnService_RegisterAndManageCredentials(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+
+	env.register(t, "YubiKey")
+	env.register(t, "Laptop")
+
+	creds, err := env.service.ListCredentials(env.user.ID)
+	if err != nil {
+		t.Fatalf("ListCredentials failed: %v", err)
+	}
+	if len(creds) != 2 {
+		t.Fatalf("expected 2 credentials, got %d", len(creds))
+	}
+
+	if err := env.service.RenameCredential(env.user.ID, creds[0].ID, "Office key"); err != nil {
+		t.Fatalf("RenameCredential failed: %v", err)
+	}
+	if err := env.service.RenameCredential(uuid.New(), creds[0].ID, "Stolen"); !errors.Is(err, services.ErrWebAuthnCredentialNotFound) {
+		t.Errorf("expected ErrWebAuthnCredentialNotFound renaming another user's key, got %v", err)
+	}
+	if err := env.service.DeleteCredential(env.user.ID, creds[1].ID); err != nil {
+		t.Fatalf("DeleteCredential failed: %v", err)
+	}
+
+	creds, _ = env.service.ListCredentials(env.user.ID)
+	if len(creds) != 1 || creds[0].Name != "Office key" {
+		t.Errorf("unexpected credentials after rename/delete: %+v", creds)
+	}
+}
+
+func TestWebAuthnService_FinishRegistration_RejectsReplayedSession(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+
+	creation, sessionID, err := env.service.BeginRegistration(env.user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration failed: %v", err)
+	}
+	options, _ := virtualwebauthn.ParseAttestationOptions(mustJSON(t, creation))
+	cred := virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2)
+	response := virtualwebauthn.CreateAttestationResponse(testRelyingParty, env.authenticator, cred, *options)
+
+	if _, err := env.service.FinishRegistration(env.user.ID, sessionID, "Key", []byte(response)); err != nil {
+		t.Fatalf("FinishRegistration failed: %v", err)
+	}
+	if _, err := env.service.FinishRegistration(env.user.ID, sessionID, "Key", []byte(response)); !errors.Is(err, services.ErrWebAuthnSessionExpired) {
+		t.Errorf("expected ErrWebAuthnSessionExpired on replay, got %v", err)
+	}
+}
+
+func TestWebAuthnService_SecondFactorLogin(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	cred := env.register(t, "YubiKey")
+
+	session, _ := env.loginSessions.Create(env.user.ID, 5*time.Minute)
+	assertion, sessionID, err := env.service.BeginSecondFactor(session.ID)
+	if err != nil {
+		t.Fatalf("BeginSecondFactor failed: %v", err)
+	}
+
+	cred.Counter = 1
+	user, err := env.service.FinishSecondFactor(session.ID, sessionID, assertionResponse(t, assertion, env.authenticator, cred))
+	if err != nil {
+		t.Fatalf("FinishSecondFactor failed: %v", err)
+	}
+	if user.ID != env.user.ID {
+		t.Errorf("expected user %s, got %s", env.user.ID, user.ID)
+	}
+
+	stored := env.credentials.credentials[0]
+	if stored.SignCount != 1 || stored.LastUsedAt == nil {
+		t.Errorf("expected sign count 1 and last_used_at set, got %d / %v", stored.SignCount, stored.LastUsedAt)
+	}
+
+	// The login session is consumed on success.
+	if _, _, err := env.service.BeginSecondFactor(session.ID); !errors.Is(err, services.ErrLoginSessionExpired) {
+		t.Errorf("expected ErrLoginSessionExpired after successful login, got %v", err)
+	}
+}
+
+func TestWebAuthnService_SecondFactorLogin_RejectsClonedAuthenticator(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	cred := env.register(t, "YubiKey")
+	env.credentials.credentials[0].SignCount = 10
+
+	session, _ := env.loginSessions.Create(env.user.ID, 5*time.Minute)
+	assertion, sessionID, err := env.service.BeginSecondFactor(session.ID)
+	if err != nil {
+		t.Fatalf("BeginSecondFactor failed: %v", err)
+	}
+
+	cred.Counter = 5
+	_, err = env.service.FinishSecondFactor(session.ID, sessionID, assertionResponse(t, assertion, env.authenticator, cred))
+	if !errors.Is(err, services.ErrWebAuthnCloneDetected) {
+		t.Fatalf("expected ErrWebAuthnCloneDetected, got %v", err)
+	}
+	if !env.credentials.credentials[0].CloneWarning {
+		t.Errorf("expected credential to be flagged with clone warning")
+	}
+}
+
+func TestWebAuthnService_SecondFactorLogin_RespectsAccountLock(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	cred := env.register(t, "YubiKey")
+	until := time.Now().Add(time.Hour)
+	env.user.LockedUntil = &until
+
+	session, _ := env.loginSessions.Create(env.user.ID, 5*time.Minute)
+	assertion, sessionID, _ := env.service.BeginSecondFactor(session.ID)
+
+	cred.Counter = 1
+	_, err := env.service.FinishSecondFactor(session.ID, sessionID, assertionResponse(t, assertion, env.authenticator, cred))
+	if !errors.Is(err, services.ErrAccountLocked) {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+}
+
+func TestWebAuthnService_PasswordlessLogin(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	cred := env.register(t, "Phone passkey")
+
+	assertion, sessionID, err := env.service.BeginPasswordless()
+	if err != nil {
+		t.Fatalf("BeginPasswordless failed: %v", err)
+	}
+
+	cred.Counter = 1
+	user, err := env.service.FinishPasswordless(sessionID, assertionResponse(t, assertion, env.authenticator, cred))
+	if err != nil {
+		t.Fatalf("FinishPasswordless failed: %v", err)
+	}
+	if user.ID != env.user.ID {
+		t.Errorf("expected user %s, got %s", env.user.ID, user.ID)
+	}
+}
+
+func TestWebAuthnService_PasswordlessLogin_RequiresUserVerification(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	cred := env.register(t, "Phone passkey")
+
+	assertion, sessionID, _ := env.service.BeginPasswordless()
+
+	noUV := env.authenticator
+	noUV.Options.UserNotVerified = true
+	cred.Counter = 1
+	_, err := env.service.FinishPasswordless(sessionID, assertionResponse(t, assertion, noUV, cred))
+	if !errors.Is(err, services.ErrWebAuthnVerificationFailed) {
+		t.Fatalf("expected ErrWebAuthnVerificationFailed without user verification, got %v", err)
+	}
+}